@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+func testGraph() *db.DepGraph {
+	epicID := "ep-gph001"
+	return &db.DepGraph{
+		Nodes: []model.Item{
+			{ID: epicID, Type: model.ItemTypeEpic, Title: `Auth "v2"`, Status: model.StatusInProgress},
+			{ID: "ts-gph001", Type: model.ItemTypeTask, Title: "Schema", Status: model.StatusInProgress, ParentID: &epicID},
+			{ID: "ts-gph002", Type: model.ItemTypeTask, Title: "API", Status: model.StatusOpen, ParentID: &epicID},
+			{ID: "ts-gph003", Type: model.ItemTypeTask, Title: "Frontend", Status: model.StatusDone},
+		},
+		Edges: []db.DepEdge{
+			{ItemID: "ts-gph002", DependsOnID: "ts-gph001"},
+			{ItemID: "ts-gph003", DependsOnID: epicID},
+		},
+	}
+}
+
+func TestRenderGraphDOT(t *testing.T) {
+	out := renderGraphDOT(testGraph())
+
+	for _, want := range []string{
+		"digraph prog {",
+		`subgraph "cluster_ep-gph001" {`,
+		`label="ep-gph001 [in_progress] Auth \"v2\"";`,
+		`"ep-gph001" [label="ep-gph001", shape=folder`, // epic is an edge endpoint
+		`"ts-gph001" [label="ts-gph001\nSchema", fillcolor="#fff3bf"];`,
+		`"ts-gph003" [label="ts-gph003\nFrontend", fillcolor="#d3f9d8"];`,
+		`"ts-gph001" -> "ts-gph002";`,
+		`"ep-gph001" -> "ts-gph003";`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("DOT output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Children are drawn inside their epic's cluster
+	cluster := out[strings.Index(out, "subgraph"):]
+	cluster = cluster[:strings.Index(cluster, "\n  }")]
+	if !strings.Contains(cluster, "ts-gph002") || strings.Contains(cluster, "ts-gph003") {
+		t.Errorf("cluster has wrong members:\n%s", cluster)
+	}
+}
+
+func TestRenderGraphMermaid(t *testing.T) {
+	out := renderGraphMermaid(testGraph())
+
+	for _, want := range []string{
+		"flowchart LR",
+		`subgraph ep_gph001 ["ep-gph001 [in_progress] Auth #quot;v2#quot;"]`,
+		"  end\n  class ep_gph001 in_progress\n", // Derived epic status, as in DOT
+		`ts_gph001["ts-gph001: Schema"]:::in_progress`,
+		"ts_gph001 --> ts_gph002",
+		"ep_gph001 --> ts_gph003",
+		"classDef done fill:#d3f9d8",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Mermaid output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "classDef blocked") {
+		t.Errorf("unused statuses should not get a classDef:\n%s", out)
+	}
+}
+
+func TestGraphToJSON(t *testing.T) {
+	out := graphToJSON(testGraph())
+
+	if len(out.Nodes) != 4 || len(out.Edges) != 2 {
+		t.Fatalf("got %d nodes and %d edges, want 4 and 2", len(out.Nodes), len(out.Edges))
+	}
+	if out.Nodes[1].Parent == nil || *out.Nodes[1].Parent != "ep-gph001" {
+		t.Errorf("node parent = %v, want ep-gph001", out.Nodes[1].Parent)
+	}
+	if out.Edges[0].ItemID != "ts-gph002" || out.Edges[0].DependsOn != "ts-gph001" {
+		t.Errorf("edge = %+v, want ts-gph002 depending on ts-gph001", out.Edges[0])
+	}
+}
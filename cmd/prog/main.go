@@ -1,18 +1,33 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/baiirun/prog/internal/audit"
 	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/hooks"
+	"github.com/baiirun/prog/internal/mcp"
 	"github.com/baiirun/prog/internal/model"
+	"github.com/baiirun/prog/internal/orchestrator"
+	"github.com/baiirun/prog/internal/pages"
+	"github.com/baiirun/prog/internal/server"
 	"github.com/baiirun/prog/internal/tui"
+	"github.com/baiirun/prog/internal/verify"
+	"github.com/baiirun/prog/internal/webhook"
 	"github.com/spf13/cobra"
 )
 
@@ -38,45 +53,92 @@ type Hook struct {
 }
 
 var (
-	flagProject          string
-	flagStatus           string
-	flagEpic             bool
-	flagDraft            bool
-	flagPriority         int
-	flagForce            bool
-	flagParent           string
-	flagBlocks           string
-	flagListParent       string
-	flagListType         string
-	flagBlocking         string
-	flagBlockedBy        string
-	flagHasBlockers      bool
-	flagNoBlockers       bool
-	flagEditTitle        string
-	flagStatusAll        bool
-	flagLearnConcept     []string
-	flagLearnFile        []string
-	flagLearnEditSummary string
-	flagLearnEditDetail  string
-	flagLearnStaleReason string
-	flagConceptsRecent   bool
-	flagConceptsRelated  string
-	flagConceptsSummary  string
-	flagConceptsRename   string
-	flagConceptsStats    bool
-	flagContextConcept   []string
-	flagContextQuery     string
-	flagContextStale     bool
-	flagContextSummary   bool
-	flagContextID        string
-	flagContextJSON      bool
-	flagLearnDetail      string
-	flagLabelsColor      string
-	flagAddLabels        []string
-	flagFilterLabels     []string
-	flagDoD              string
-	flagDesc             string
-	flagJSON             bool
+	flagProject             string
+	flagStatus              string
+	flagEpic                bool
+	flagDraft               bool
+	flagPriority            int
+	flagForce               bool
+	flagParent              string
+	flagBlocks              string
+	flagListParent          string
+	flagListType            string
+	flagBlocking            string
+	flagBlockedBy           string
+	flagHasBlockers         bool
+	flagNoBlockers          bool
+	flagEditTitle           string
+	flagStatusAll           bool
+	flagLearnConcept        []string
+	flagLearnFile           []string
+	flagLearnEditSummary    string
+	flagLearnEditDetail     string
+	flagLearnStaleReason    string
+	flagLearnAuditThreshold float64
+	flagLearnAuditDryRun    bool
+	flagConceptsRecent      bool
+	flagConceptsRelated     string
+	flagConceptsSummary     string
+	flagConceptsRename      string
+	flagConceptsStats       bool
+	flagConceptsSynonym     []string
+	flagConceptsUnsynonym   []string
+	flagContextConcept      []string
+	flagContextQuery        string
+	flagContextStale        bool
+	flagContextSummary      bool
+	flagContextID           string
+	flagContextJSON         bool
+	flagContextFile         []string
+	flagContextStdin        bool
+	flagLearnDetail         string
+	flagLabelsColor         string
+	flagAddLabels           []string
+	flagFilterLabels        []string
+	flagDoD                 string
+	flagDesc                string
+	flagJSON                bool
+	flagActor               string
+	flagClaimTTL            time.Duration
+	flagClaimRenew          bool
+	flagClaimRelease        bool
+	flagNextClaim           bool
+	flagDaemonSocket        string
+	flagDaemonTTL           time.Duration
+	flagAutoRequeue         bool
+	flagStealThreshold      int
+	flagAddAreas            []string
+	flagNoConflicts         bool
+	flagPlanWaves           bool
+	flagGraphCheck          bool
+	flagGraphFormat         string
+	flagGraphEpic           string
+	flagAssignee            string
+	flagCreatedBy           string
+	flagLogsBy              string
+	flagUndoSteps           int
+	flagOlderThan           string
+	flagServeAddr           string
+	flagServeSocket         string
+	flagWatchSince          int64
+	flagWebhookEvents       []string
+	flagWebhookSecret       string
+	flagWebhookFollow       bool
+	flagDoDCommand          string
+	flagDoDNote             string
+	flagVerifyDir           string
+	flagVerifyTimeout       time.Duration
+	flagVerifyVerbose       bool
+	flagReviewers           []string
+	flagReviewNote          string
+	flagReviewFor           string
+	flagFeedbackRelevant    bool
+	flagFeedbackNotRelevant bool
+	flagFeedbackUnexpected  bool
+	flagFeedbackReason      string
+	flagFeedbackTask        string
+	flagFeedbackContext     string
+	flagFeedbackLimit       int
 )
 
 func openDB() (*db.DB, error) {
@@ -93,7 +155,30 @@ func openDB() (*db.DB, error) {
 		_ = database.Close()
 		return nil, fmt.Errorf("migration failed: %w", err)
 	}
-	return database, nil
+	// Return tasks whose claim lapsed to open so every command sees them as ready
+	if _, err := database.ExpireLeases(time.Now()); err != nil {
+		_ = database.Close()
+		return nil, err
+	}
+	// Attribute this command's changes in item history, and run lifecycle
+	// hooks from the hooks directory next to the database
+	runner := hooks.New(hooks.Config{Dir: filepath.Join(filepath.Dir(path), "hooks")})
+	return database.WithActor(resolveActor()).WithHooks(runner), nil
+}
+
+// resolveActor returns who is performing an action: the --as flag if given,
+// then $PROG_ACTOR, then the OS user name.
+func resolveActor() string {
+	if flagActor != "" {
+		return flagActor
+	}
+	if actor := os.Getenv("PROG_ACTOR"); actor != "" {
+		return actor
+	}
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return "unknown"
 }
 
 var rootCmd = &cobra.Command{
@@ -223,6 +308,13 @@ Examples:
 			}
 		}
 
+		// Add areas if specified
+		for _, area := range flagAddAreas {
+			if err := database.AddItemArea(item.ID, area); err != nil {
+				return err
+			}
+		}
+
 		fmt.Println(item.ID)
 
 		// Backup after successful mutation
@@ -249,6 +341,8 @@ Examples:
   prog list --has-blockers
   prog list --no-blockers
   prog list -l bug -l urgent
+  prog list --assignee agent-x
+  prog list --created-by alice
   prog list --json`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		database, err := openDB()
@@ -276,6 +370,8 @@ Examples:
 			HasBlockers: flagHasBlockers,
 			NoBlockers:  flagNoBlockers,
 			Labels:      flagFilterLabels,
+			Assignee:    flagAssignee,
+			CreatedBy:   flagCreatedBy,
 		}
 
 		items, err := database.ListItemsFiltered(filter)
@@ -318,6 +414,8 @@ Examples:
 					DefinitionOfDone: item.DefinitionOfDone,
 					Labels:           labels,
 					Dependencies:     deps,
+					CreatedBy:        item.CreatedBy,
+					Assignee:         item.Assignee,
 				})
 			}
 			b, err := json.MarshalIndent(output, "", "  ")
@@ -348,6 +446,7 @@ Examples:
   prog ready
   prog ready -p myproject
   prog ready -l bug
+  prog ready --no-conflicts
   prog ready --json`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		database, err := openDB()
@@ -356,7 +455,11 @@ Examples:
 		}
 		defer func() { _ = database.Close() }()
 
-		items, err := database.ReadyItemsFiltered(flagProject, flagFilterLabels)
+		items, err := database.ReadyItemsMatching(db.ReadyFilter{
+			Project:     flagProject,
+			Labels:      flagFilterLabels,
+			NoConflicts: flagNoConflicts,
+		})
 		if err != nil {
 			return err
 		}
@@ -405,8 +508,11 @@ var showCmd = &cobra.Command{
 	Long: `Show full details for a task including description, logs, dependencies,
 and suggested concepts for context retrieval.
 
+Each log entry shows who wrote it; --by keeps only one actor's entries.
+
 Examples:
   prog show ts-a1b2c3
+  prog show ts-a1b2c3 --by agent-x
   prog show ts-a1b2c3 --json`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -430,16 +536,39 @@ Examples:
 			item.Labels = append(item.Labels, l.Name)
 		}
 
+		item.Areas, err = database.GetItemAreas(args[0])
+		if err != nil {
+			return err
+		}
+
+		criteria, err := database.GetCriteria(args[0])
+		if err != nil {
+			return err
+		}
+
+		reviews, err := database.LatestReviews(args[0])
+		if err != nil {
+			return err
+		}
+
 		logs, err := database.GetLogs(args[0])
 		if err != nil {
 			return err
 		}
+		if flagLogsBy != "" {
+			logs = slices.DeleteFunc(logs, func(l model.Log) bool { return l.Actor != flagLogsBy })
+		}
 
 		deps, err := database.GetDeps(args[0])
 		if err != nil {
 			return err
 		}
 
+		lease, err := database.GetLease(args[0])
+		if err != nil {
+			return err
+		}
+
 		// Get related concepts for context suggestions
 		concepts, err := database.GetRelatedConcepts(args[0])
 		if err != nil {
@@ -451,6 +580,10 @@ Examples:
 			if labels == nil {
 				labels = []string{}
 			}
+			areas := item.Areas
+			if areas == nil {
+				areas = []string{}
+			}
 			if deps == nil {
 				deps = []string{}
 			}
@@ -458,9 +591,16 @@ Examples:
 			for _, l := range logs {
 				logEntries = append(logEntries, LogJSON{
 					Message:   l.Message,
+					Actor:     l.Actor,
 					CreatedAt: l.CreatedAt.Format(time.RFC3339),
 				})
 			}
+			if criteria == nil {
+				criteria = []model.Criterion{}
+			}
+			if reviews == nil {
+				reviews = []model.Review{}
+			}
 			output := ItemShowJSON{
 				ID:               item.ID,
 				Title:            item.Title,
@@ -471,9 +611,21 @@ Examples:
 				Parent:           item.ParentID,
 				Description:      item.Description,
 				DefinitionOfDone: item.DefinitionOfDone,
+				Criteria:         criteria,
+				Reviews:          reviews,
 				Labels:           labels,
+				Areas:            areas,
 				Dependencies:     deps,
 				Logs:             logEntries,
+				CreatedBy:        item.CreatedBy,
+				Assignee:         item.Assignee,
+			}
+			if lease != nil {
+				output.Lease = &LeaseJSON{
+					Actor:     lease.Actor,
+					ClaimedAt: lease.ClaimedAt.Format(time.RFC3339),
+					ExpiresAt: lease.ExpiresAt.Format(time.RFC3339),
+				}
 			}
 			b, err := json.MarshalIndent(output, "", "  ")
 			if err != nil {
@@ -483,7 +635,7 @@ Examples:
 			return nil
 		}
 
-		printItemDetail(item, logs, deps, concepts)
+		printItemDetail(item, criteria, reviews, lease, logs, deps, concepts)
 		return nil
 	},
 }
@@ -507,10 +659,186 @@ var startCmd = &cobra.Command{
 	},
 }
 
+var claimCmd = &cobra.Command{
+	Use:   "claim <id>",
+	Short: "Atomically claim a ready task with a lease",
+	Long: `Claim a task for exclusive work by one agent.
+
+Unlike 'prog start', claiming is atomic: the task only moves from open to
+in_progress if it is still open and unblocked, so two agents racing on the
+same 'prog ready' output cannot both get it. The loser gets an error.
+
+A claim carries a lease that expires after --ttl. Renew it while working;
+if it lapses the task returns to open for someone else to pick up.
+
+The claiming actor is taken from --as, then $PROG_ACTOR, then $USER.
+
+Examples:
+  prog claim ts-a1b2c3 --as agent-1
+  prog claim ts-a1b2c3 --ttl 1h
+  prog claim ts-a1b2c3 --renew     # extend the lease
+  prog claim ts-a1b2c3 --release   # give the task back (status -> open)`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagClaimRenew && flagClaimRelease {
+			return fmt.Errorf("--renew and --release are mutually exclusive")
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		id := args[0]
+		actor := resolveActor()
+
+		if flagClaimRelease {
+			if err := database.ReleaseLease(id, actor); err != nil {
+				return err
+			}
+			fmt.Printf("Released %s\n", id)
+			return nil
+		}
+
+		var lease *model.Lease
+		if flagClaimRenew {
+			lease, err = database.RenewLease(id, actor, flagClaimTTL)
+		} else {
+			lease, err = database.ClaimTask(id, actor, flagClaimTTL)
+		}
+		if err != nil {
+			return err
+		}
+
+		verb := "Claimed"
+		if flagClaimRenew {
+			verb = "Renewed"
+		}
+		fmt.Printf("%s %s as %s (lease expires %s)\n", verb, id, lease.Actor, lease.ExpiresAt.Format(time.RFC3339))
+		return nil
+	},
+}
+
+var nextCmd = &cobra.Command{
+	Use:   "next",
+	Short: "Pick the best ready task, optionally claiming it",
+	Long: `Pick the highest-ranked ready task and print it as JSON.
+
+Ready tasks are ranked by:
+  1. Priority (1=high first)
+  2. How many tasks it would directly unblock (it is their last blocker)
+  3. How many items are transitively waiting on it
+  4. Age (oldest first)
+
+With --claim, the task is claimed atomically (see 'prog claim'). If another
+agent claims it first, the next candidate is tried, so an agent loop needs only
+one call per task. Prints null when nothing is ready.
+
+With --no-conflicts, tasks whose areas overlap in-progress work are skipped
+(see 'prog area').
+
+Examples:
+  prog next -p myproject
+  prog next -p myproject -l bug
+  prog next -p myproject --claim --as agent-1 --ttl 1h
+  prog next -p myproject --claim --no-conflicts`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		var actor string
+		if flagNextClaim {
+			actor = resolveActor()
+		}
+		filter := db.ReadyFilter{Project: flagProject, Labels: flagFilterLabels, NoConflicts: flagNoConflicts}
+		next, err := pickNext(database, filter, actor, flagClaimTTL)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.MarshalIndent(next, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	},
+}
+
+// pickNext returns the highest-ranked ready task, or nil if there is none.
+// When actor is non-empty the task is claimed for actor, moving on to the
+// next candidate whenever another agent wins the race.
+func pickNext(database *db.DB, filter db.ReadyFilter, actor string, ttl time.Duration) (*NextJSON, error) {
+	ranked, err := database.RankedReadyItems(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range ranked {
+		var lease *model.Lease
+		if actor != "" {
+			lease, err = database.ClaimTask(r.ID, actor, ttl)
+			if errors.Is(err, db.ErrNotClaimable) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			r.Status = model.StatusInProgress
+		}
+
+		labelObjs, err := database.GetItemLabels(r.ID)
+		if err != nil {
+			return nil, err
+		}
+		labelNames := make([]string, 0, len(labelObjs))
+		for _, l := range labelObjs {
+			labelNames = append(labelNames, l.Name)
+		}
+
+		next := &NextJSON{
+			ID:               r.ID,
+			Project:          r.Project,
+			Title:            r.Title,
+			Description:      r.Description,
+			DefinitionOfDone: r.DefinitionOfDone,
+			Status:           string(r.Status),
+			Priority:         r.Priority,
+			Parent:           r.ParentID,
+			Labels:           labelNames,
+			Unblocks:         r.Unblocks,
+			Downstream:       r.Downstream,
+		}
+		if lease != nil {
+			next.Lease = &LeaseJSON{
+				Actor:     lease.Actor,
+				ClaimedAt: lease.ClaimedAt.Format(time.RFC3339),
+				ExpiresAt: lease.ExpiresAt.Format(time.RFC3339),
+			}
+		}
+		return next, nil
+	}
+	return nil, nil
+}
+
 var doneCmd = &cobra.Command{
 	Use:   "done <id>",
 	Short: "Mark a task as done",
-	Args:  cobra.ExactArgs(1),
+	Long: `Mark a task as done.
+
+A task with a definition of done can only be completed once every criterion
+is checked off ('prog dod check'), and a task with reviewers once each of
+them has approved it ('prog review approve'); --force completes it anyway.
+
+Examples:
+  prog done ts-a1b2c3
+  prog done ts-a1b2c3 --force`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		database, err := openDB()
 		if err != nil {
@@ -518,7 +846,13 @@ var doneCmd = &cobra.Command{
 		}
 		defer func() { _ = database.Close() }()
 
-		if err := database.UpdateStatus(args[0], model.StatusDone); err != nil {
+		if err := database.CompleteItem(args[0], flagForce); err != nil {
+			switch {
+			case errors.Is(err, db.ErrDoDIncomplete):
+				return fmt.Errorf("%w\nCheck them off with 'prog dod check %s <n> --note ...', or use --force", err, args[0])
+			case errors.Is(err, db.ErrReviewPending):
+				return fmt.Errorf("%w\nSee 'prog review queue', or use --force", err)
+			}
 			return err
 		}
 		fmt.Printf("Completed %s\n", args[0])
@@ -543,10 +877,16 @@ var reviewCmd = &cobra.Command{
 Use this when you've created a PR/branch and the code is ready for review,
 but shouldn't be marked "done" until it lands on main.
 
-Only tasks that are in_progress can be marked as reviewing.
+Only tasks that are in_progress can be marked as reviewing. --reviewer asks
+someone to review it; reviewers who requested changes last time are asked
+again automatically. Reviewers give their verdict with 'prog review approve'
+or 'prog review request-changes', and the task can only be completed once
+they have all approved it.
 
-Example:
-  prog review ts-a1b2c3`,
+Examples:
+  prog review ts-a1b2c3
+  prog review ts-a1b2c3 --reviewer bob --reviewer carol
+  prog review queue --for bob`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		database, err := openDB()
@@ -569,7 +909,18 @@ Example:
 		if err := database.UpdateStatus(id, model.StatusReviewing); err != nil {
 			return err
 		}
+		for _, reviewer := range flagReviewers {
+			if err := database.AssignReviewer(id, reviewer); err != nil {
+				return err
+			}
+		}
+		if _, err := database.RerequestReviews(id); err != nil {
+			return err
+		}
 		fmt.Printf("Marked %s as reviewing\n", id)
+		if err := printReviewStatus(database, id); err != nil {
+			return err
+		}
 
 		// Backup after successful mutation
 		database.BackupQuiet()
@@ -578,6 +929,211 @@ Example:
 	},
 }
 
+var reviewApproveCmd = &cobra.Command{
+	Use:   "approve <id>",
+	Short: "Approve a task in review",
+	Long: `Approve a task in review as the current actor (--as), with an optional
+note. The task stays in review until it is completed with 'prog done', which
+needs every assigned reviewer's approval.
+
+Example:
+  prog review approve ts-a1b2c3 --note "Checked the migration on a copy of prod"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if err := database.Approve(args[0], flagReviewNote); err != nil {
+			return err
+		}
+		fmt.Printf("Approved %s\n", args[0])
+		if err := printReviewStatus(database, args[0]); err != nil {
+			return err
+		}
+
+		database.BackupQuiet()
+		return nil
+	},
+}
+
+var reviewRequestChangesCmd = &cobra.Command{
+	Use:   "request-changes <id>",
+	Short: "Send a task in review back for changes",
+	Long: `Request changes to a task in review as the current actor (--as). The task
+moves back to in_progress for its assignee, with the note saying what to
+change logged on it. When it is resubmitted with 'prog review', you are asked
+to review it again.
+
+Example:
+  prog review request-changes ts-a1b2c3 --note "Expired tokens still return 500"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if strings.TrimSpace(flagReviewNote) == "" {
+			return fmt.Errorf("--note is required: say what needs to change")
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if err := database.RequestChanges(args[0], flagReviewNote); err != nil {
+			return err
+		}
+		fmt.Printf("Requested changes to %s; moved back to in_progress\n", args[0])
+
+		database.BackupQuiet()
+		return nil
+	},
+}
+
+var reviewAssignCmd = &cobra.Command{
+	Use:   "assign <id> <reviewer>...",
+	Short: "Ask reviewers to review a task",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		for _, reviewer := range args[1:] {
+			if err := database.AssignReviewer(args[0], reviewer); err != nil {
+				return err
+			}
+		}
+		return printReviewStatus(database, args[0])
+	},
+}
+
+var reviewUnassignCmd = &cobra.Command{
+	Use:   "unassign <id> <reviewer>",
+	Short: "Withdraw a pending review request",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if err := database.UnassignReviewer(args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s as a reviewer of %s\n", args[1], args[0])
+		return nil
+	},
+}
+
+var reviewQueueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Show what review is waiting on, and on whom",
+	Long: `Show tasks waiting on review, oldest first, and who they are waiting on:
+
+  review   A reviewer's verdict (or anyone's, if nobody is assigned)
+  changes  The assignee, to make the changes a reviewer requested
+  merge    The assignee, to land the approved work and run 'prog done'
+
+Examples:
+  prog review queue -p myproject
+  prog review queue --for bob`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		queue, err := database.ReviewQueue(flagProject, flagReviewFor)
+		if err != nil {
+			return err
+		}
+
+		if flagJSON {
+			out := make([]ReviewWaitJSON, 0, len(queue))
+			for _, w := range queue {
+				out = append(out, ReviewWaitJSON{
+					ID:         w.ItemID,
+					Title:      w.Title,
+					Project:    w.Project,
+					Status:     string(w.Status),
+					WaitingOn:  w.WaitingOn,
+					WaitingFor: reviewWaitKind(w.Verdict),
+					Since:      w.Since.Format(time.RFC3339),
+					Note:       w.Note,
+				})
+			}
+			b, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+
+		if len(queue) == 0 {
+			fmt.Println("Nothing is waiting on review")
+			return nil
+		}
+		fmt.Printf("%-10s  %-14s  %-7s  %-10s  %s\n", "ID", "WAITING ON", "FOR", "SINCE", "TITLE")
+		for _, w := range queue {
+			on := w.WaitingOn
+			if on == "" {
+				on = "(anyone)"
+			}
+			fmt.Printf("%-10s  %-14s  %-7s  %-10s  %s\n", w.ItemID, on, reviewWaitKind(w.Verdict), formatTimeAgo(w.Since), w.Title)
+			if w.Note != "" {
+				fmt.Printf("%-10s  %s\n", "", w.Note)
+			}
+		}
+		return nil
+	},
+}
+
+// reviewWaitKind names what a task in the review queue is waiting for.
+func reviewWaitKind(verdict string) string {
+	switch verdict {
+	case model.VerdictChangesRequested:
+		return "changes"
+	case model.VerdictApproved:
+		return "merge"
+	}
+	return "review"
+}
+
+// printReviewStatus prints where each reviewer's review of a task stands.
+func printReviewStatus(database *db.DB, id string) error {
+	reviews, err := database.LatestReviews(id)
+	if err != nil {
+		return err
+	}
+	if len(reviews) > 0 {
+		fmt.Println("Reviewers:")
+		printReviews(reviews)
+	}
+	return nil
+}
+
+// printReviews prints each reviewer's latest review and its note.
+func printReviews(reviews []model.Review) {
+	for _, r := range reviews {
+		when := formatTimeAgo(r.RequestedAt)
+		if r.DecidedAt != nil {
+			when = formatTimeAgo(*r.DecidedAt)
+		}
+		fmt.Printf("  %-14s  %-17s  %s\n", r.Reviewer, r.Verdict, when)
+		if r.Note != "" {
+			fmt.Printf("  %-14s  %s\n", "", r.Note)
+		}
+	}
+}
+
 var cancelCmd = &cobra.Command{
 	Use:   "cancel <id> [reason]",
 	Short: "Cancel a task without completing it",
@@ -682,10 +1238,12 @@ Example:
 var deleteCmd = &cobra.Command{
 	Use:   "delete <id>",
 	Short: "Delete a task or epic",
-	Long: `Permanently delete a task or epic and all associated data.
+	Long: `Move a task or epic to the trash.
 
-This removes the item, its logs, and any dependencies.
-This action cannot be undone.
+Trashed items are hidden from list, ready and status, and no longer block
+the tasks that depend on them. Their logs, labels, areas and dependencies are
+kept until the trash is purged. Run 'prog restore-item' or 'prog undo' to
+bring it back.
 
 Example:
   prog delete ts-a1b2c3`,
@@ -700,7 +1258,7 @@ Example:
 		if err := database.DeleteItem(args[0]); err != nil {
 			return err
 		}
-		fmt.Printf("Deleted %s\n", args[0])
+		fmt.Printf("Moved %s to the trash (restore with 'prog restore-item %s')\n", args[0], args[0])
 		return nil
 	},
 }
@@ -733,16 +1291,21 @@ Example:
 	},
 }
 
-var graphCmd = &cobra.Command{
-	Use:   "graph",
-	Short: "Show dependency graph",
-	Long: `Show all task dependencies as a graph.
+var historyCmd = &cobra.Command{
+	Use:   "history <id>",
+	Short: "Show every recorded change to a task",
+	Long: `Show a task's change history: status transitions and field edits,
+with old and new values, when each happened and who made it.
 
-Displays which tasks are blocked by other tasks.
+History is recorded for every change, including dependencies, labels, areas
+and lease moves, and is kept after the task is deleted. Long values such as
+descriptions are summarized; use --json for the full text.
 
 Examples:
-  prog graph
-  prog graph -p myproject`,
+  prog history ts-a1b2c3
+  prog history ts-a1b2c3 --by agent-x
+  prog history ts-a1b2c3 --json`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		database, err := openDB()
 		if err != nil {
@@ -750,23 +1313,421 @@ Examples:
 		}
 		defer func() { _ = database.Close() }()
 
-		edges, err := database.GetAllDeps(flagProject)
+		events, err := database.GetEvents(args[0])
 		if err != nil {
 			return err
 		}
-
-		if len(edges) == 0 {
-			fmt.Println("No dependencies")
-			return nil
+		if flagLogsBy != "" {
+			events = slices.DeleteFunc(events, func(e model.Event) bool { return e.Actor != flagLogsBy })
+		}
+		if len(events) == 0 {
+			// Distinguish a quiet item from a mistyped ID
+			if _, err := database.GetItem(args[0]); err != nil {
+				return err
+			}
 		}
 
-		printDepGraph(edges)
-		return nil
-	},
-}
-
-var projectsCmd = &cobra.Command{
-	Use:   "projects",
+		if flagJSON {
+			output := make([]EventJSON, 0, len(events))
+			for _, e := range events {
+				output = append(output, EventJSON{
+					Field:     e.Field,
+					OldValue:  e.OldValue,
+					NewValue:  e.NewValue,
+					Actor:     e.Actor,
+					CreatedAt: e.CreatedAt.Format(time.RFC3339),
+				})
+			}
+			b, err := json.MarshalIndent(output, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+
+		if len(events) == 0 {
+			fmt.Println("No recorded history (changes are recorded from this version on)")
+			return nil
+		}
+		printHistory(events)
+		return nil
+	},
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Stream changes as they happen",
+	Long: `Print changes to tasks, logs, dependencies, labels and learnings as they
+are made, by any agent or process, until interrupted.
+
+Every change has a sequence number. Pass the last one you saw to --since to
+resume without missing or repeating changes; --since 0 replays the whole feed.
+By default only changes made from now on are shown.
+
+With --json, each change is printed as one JSON object per line.
+
+Examples:
+  prog watch
+  prog watch -p myproject
+  prog watch --json --since 1042`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		since := flagWatchSince
+		if since < 0 {
+			if since, err = database.LatestChange(); err != nil {
+				return err
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		enc := json.NewEncoder(os.Stdout)
+		filter := db.ChangeFilter{After: since, Project: flagProject, Limit: 100}
+		return database.FollowChanges(ctx, filter, watchInterval, func(changes []model.Change) error {
+			for _, c := range changes {
+				if !flagJSON {
+					printChange(c)
+					continue
+				}
+				if err := enc.Encode(changeJSON(c)); err != nil {
+					return fmt.Errorf("failed to write change: %w", err)
+				}
+			}
+			return nil
+		})
+	},
+}
+
+// watchInterval is how often 'prog watch' checks for new changes.
+const watchInterval = 500 * time.Millisecond
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo your most recent changes",
+	Long: `Undo the last changes you made, newest first, using the item history.
+
+Deletes and restores, status changes, reparenting, edits to title,
+description and definition of done, and dependency, label and area changes
+can all be undone. Items purged from the trash can't be brought back, and
+label renames are skipped: rename the label back with 'prog labels rename'.
+A status change that would put a task back in progress or done is refused,
+since that skips claiming and the done checks; use 'prog start' or 'prog done'.
+Only your own changes are reversed (or another actor's with --by), so work
+done concurrently by other agents is kept.
+
+If a change can't be reversed cleanly because it has been changed again since,
+nothing is undone. Undos are recorded in 'prog history' and are not undone
+themselves.
+
+Examples:
+  prog undo
+  prog undo --steps 3
+  prog undo --by agent-x`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		actor := database.Actor()
+		if flagLogsBy != "" {
+			actor = flagLogsBy
+		}
+		undone, err := database.Undo(actor, flagUndoSteps)
+		if err != nil {
+			return err
+		}
+		if len(undone) == 0 {
+			fmt.Printf("Nothing to undo for %s\n", actor)
+			return nil
+		}
+		for _, e := range undone {
+			fmt.Printf("Undid %s %s: %s\n", e.ItemID, e.Field, describeEvent(e))
+		}
+		if len(undone) < flagUndoSteps {
+			fmt.Printf("(only %d change(s) to undo)\n", len(undone))
+		}
+		return nil
+	},
+}
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List deleted items",
+	Long: `List the items in the trash, most recently deleted first.
+
+Use 'prog restore-item' to bring one back and 'prog trash purge' to remove
+them for good.
+
+Examples:
+  prog trash
+  prog trash -p myproject --json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		trashed, err := database.ListTrash(flagProject)
+		if err != nil {
+			return err
+		}
+
+		if flagJSON {
+			output := make([]TrashJSON, 0, len(trashed))
+			for _, t := range trashed {
+				output = append(output, TrashJSON{
+					ID:        t.ID,
+					Title:     t.Title,
+					Type:      string(t.Type),
+					Status:    string(t.Status),
+					Project:   t.Project,
+					DeletedAt: t.DeletedAt.Format(time.RFC3339),
+				})
+			}
+			b, err := json.MarshalIndent(output, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+
+		if len(trashed) == 0 {
+			fmt.Println("Trash is empty")
+			return nil
+		}
+		fmt.Printf("%-12s %-12s %s\n", "ID", "DELETED", "TITLE")
+		for _, t := range trashed {
+			fmt.Printf("%-12s %-12s %s\n", t.ID, formatTimeAgo(t.DeletedAt), t.Title)
+		}
+		return nil
+	},
+}
+
+var trashPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Permanently remove items from the trash",
+	Long: `Permanently remove items from the trash, with their logs, dependencies,
+labels and areas. Learnings linked to them are kept but unlinked, and their
+children lose their parent. History is kept.
+
+Purged items can't be restored or undone.
+
+Examples:
+  prog trash purge
+  prog trash purge --older-than 30d`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		age, err := parseAge(flagOlderThan)
+		if err != nil {
+			return err
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		purged, err := database.PurgeTrash(flagProject, time.Now().Add(-age))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d item(s)\n", len(purged))
+		for _, id := range purged {
+			fmt.Printf("  %s\n", id)
+		}
+		return nil
+	},
+}
+
+var restoreItemCmd = &cobra.Command{
+	Use:   "restore-item <id>",
+	Short: "Restore a deleted item from the trash",
+	Long: `Bring a deleted task or epic back from the trash, with its logs, labels,
+areas and dependencies.
+
+Example:
+  prog restore-item ts-a1b2c3`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if err := database.RestoreItem(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s\n", args[0])
+		return nil
+	},
+}
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Show dependency graph",
+	Long: `Show all task dependencies as a graph.
+
+Displays which tasks are blocked by other tasks.
+
+Use --format to export the graph for docs and PRs: dot (Graphviz), mermaid,
+or json. Arrows point from a blocker to the task waiting on it, nodes are
+colored by status, and epics are drawn as boxes grouping their children.
+--epic limits the graph to one epic's subtree and whatever it depends on or
+blocks.
+
+With --check, looks for problems instead: dependency cycles (tasks in a
+cycle never become ready) and dependencies on items that no longer exist.
+Exits non-zero if any are found.
+
+Examples:
+  prog graph
+  prog graph -p myproject
+  prog graph -p myproject --format mermaid
+  prog graph --epic ep-a1b2c3 --format dot | dot -Tsvg > plan.svg
+  prog graph --check`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if flagGraphCheck {
+			issues, err := database.CheckGraph(flagProject)
+			if err != nil {
+				return err
+			}
+			if issues.Count() == 0 {
+				fmt.Println("No problems found")
+				return nil
+			}
+			printGraphIssues(issues)
+			cmd.SilenceUsage = true
+			return fmt.Errorf("found %d dependency graph problem(s)", issues.Count())
+		}
+
+		graph, err := database.GetDepGraph(flagProject, flagGraphEpic)
+		if err != nil {
+			return err
+		}
+
+		switch flagGraphFormat {
+		case "dot":
+			fmt.Print(renderGraphDOT(graph))
+		case "mermaid":
+			fmt.Print(renderGraphMermaid(graph))
+		case "json":
+			b, err := json.MarshalIndent(graphToJSON(graph), "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(b))
+		case "text":
+			if len(graph.Edges) == 0 {
+				fmt.Println("No dependencies")
+				return nil
+			}
+			printDepGraph(graph.Edges)
+		default:
+			return fmt.Errorf("invalid format: %s (valid: text, dot, mermaid, json)", flagGraphFormat)
+		}
+		return nil
+	},
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan [epic-id]",
+	Short: "Plan parallel execution from the dependency graph",
+	Long: `Plan how unfinished tasks can be worked on in parallel.
+
+Tasks are sorted along their dependencies into waves: every task in a wave
+can run at the same time once earlier waves are done. The critical path is
+the longest dependency chain, i.e. the fewest sequential steps to finish.
+Max parallelism is the widest wave; agents beyond that sit idle.
+
+Scope is the project's tasks, or an epic's tasks (including sub-epics) when
+an epic ID is given. Tasks waiting on unfinished work outside the scope are
+listed as externally blocked.
+
+Examples:
+  prog plan -p myproject
+  prog plan ep-a1b2c3 --waves
+  prog plan ep-a1b2c3 --json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		epicID := ""
+		if len(args) > 0 {
+			epicID = args[0]
+		}
+		plan, err := database.PlanWaves(flagProject, epicID)
+		if err != nil {
+			return err
+		}
+
+		if flagJSON {
+			b, err := json.MarshalIndent(planToJSON(plan), "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+
+		printPlan(plan, flagPlanWaves)
+		return nil
+	},
+}
+
+func planToJSON(plan *db.Plan) PlanJSON {
+	output := PlanJSON{
+		Tasks:          plan.TaskCount(),
+		Waves:          make([][]PlanTaskJSON, 0, len(plan.Waves)),
+		CriticalPath:   make([]string, 0, len(plan.CriticalPath)),
+		MaxParallelism: plan.MaxParallelism,
+		External:       plan.External,
+	}
+	for _, wave := range plan.Waves {
+		items := make([]PlanTaskJSON, 0, len(wave))
+		for _, item := range wave {
+			items = append(items, PlanTaskJSON{
+				ID:       item.ID,
+				Title:    item.Title,
+				Status:   string(item.Status),
+				Priority: item.Priority,
+			})
+		}
+		output.Waves = append(output.Waves, items)
+	}
+	for _, item := range plan.CriticalPath {
+		output.CriticalPath = append(output.CriticalPath, item.ID)
+	}
+	return output
+}
+
+var projectsCmd = &cobra.Command{
+	Use:   "projects",
 	Short: "List all projects",
 	Long:  `List all projects that have tasks.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -872,7 +1833,9 @@ var editCmd = &cobra.Command{
 	Long: `Edit a task's title, description, or definition of done.
 
 With --title, updates the title directly without opening an editor.
-With --dod, sets or clears the definition of done (use "" to clear).
+With --dod, sets or clears the definition of done (use "" to clear). Separate
+criteria with semicolons; criteria that are unchanged stay checked off. Use
+'prog dod' to add, check off or remove single criteria.
 Without flags, opens the description in your configured editor.
 
 Uses $PROG_EDITOR if set, otherwise defaults to nvim, then nano, then vi.
@@ -885,119 +1848,452 @@ Examples:
   PROG_EDITOR=code prog edit ts-a1b2c3    # Use VS Code as editor`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		database, err := openDB()
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		id := args[0]
+
+		// If --dod flag is set, update definition of done
+		if cmd.Flags().Changed("dod") {
+			var dod *string
+			if flagDoD != "" {
+				dod = &flagDoD
+			}
+			if err := database.SetDefinitionOfDone(id, dod); err != nil {
+				return err
+			}
+			if dod == nil {
+				fmt.Printf("Cleared definition of done for %s\n", id)
+			} else {
+				fmt.Printf("Updated definition of done for %s\n", id)
+			}
+			return nil
+		}
+
+		// If --title flag is set, update title directly
+		if flagEditTitle != "" {
+			if err := database.SetTitle(id, flagEditTitle); err != nil {
+				return err
+			}
+			fmt.Printf("Updated title for %s\n", id)
+			return nil
+		}
+
+		// Get current description
+		item, err := database.GetItem(id)
+		if err != nil {
+			return err
+		}
+
+		// Get editor (prefer $PROG_EDITOR, then nvim, then nano)
+		editor := os.Getenv("PROG_EDITOR")
+		if editor == "" {
+			if _, err := exec.LookPath("nvim"); err == nil {
+				editor = "nvim"
+			} else if _, err := exec.LookPath("nano"); err == nil {
+				editor = "nano"
+			} else {
+				editor = "vi"
+			}
+		}
+
+		// Create temp file
+		tmpfile, err := os.CreateTemp("", "prog-edit-*.md")
+		if err != nil {
+			return fmt.Errorf("failed to create temp file: %w", err)
+		}
+		tmpPath := tmpfile.Name()
+		defer func() { _ = os.Remove(tmpPath) }()
+
+		// Write current description
+		if _, err := tmpfile.WriteString(item.Description); err != nil {
+			_ = tmpfile.Close()
+			return fmt.Errorf("failed to write temp file: %w", err)
+		}
+		if err := tmpfile.Close(); err != nil {
+			return fmt.Errorf("failed to close temp file: %w", err)
+		}
+
+		// Get original stat for comparison
+		origStat, err := os.Stat(tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to stat temp file: %w", err)
+		}
+
+		// Open editor
+		editorCmd := execCommand(editor, tmpPath)
+		editorCmd.Stdin = os.Stdin
+		editorCmd.Stdout = os.Stdout
+		editorCmd.Stderr = os.Stderr
+		if err := editorCmd.Run(); err != nil {
+			return fmt.Errorf("editor failed: %w", err)
+		}
+
+		// Check if file was modified
+		newStat, err := os.Stat(tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to stat temp file: %w", err)
+		}
+
+		if newStat.ModTime().Equal(origStat.ModTime()) {
+			fmt.Println("No changes made")
+			return nil
+		}
+
+		// Read new content
+		newContent, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to read temp file: %w", err)
+		}
+
+		// Update description
+		if err := database.SetDescription(id, string(newContent)); err != nil {
+			return err
+		}
+		fmt.Printf("Updated description for %s\n", id)
+		return nil
+	},
+}
+
+// execCommand wraps exec.Command for testing
+var execCommand = func(name string, arg ...string) *exec.Cmd {
+	return exec.Command(name, arg...)
+}
+
+var dodCmd = &cobra.Command{
+	Use:   "dod <id>",
+	Short: "Show or check off a task's definition of done",
+	Long: `Show a task's definition of done as a numbered checklist, with the evidence
+recorded for each criterion that has been checked off.
+
+'prog done' refuses to complete a task while any criterion is unchecked, so
+check each one off with a note saying how it was verified. A criterion can
+carry a shell command that verifies it.
+
+Examples:
+  prog dod ts-a1b2c3
+  prog dod add ts-a1b2c3 "Tests pass" --cmd "go test ./..."
+  prog dod check ts-a1b2c3 1 --note "go test ./... passes (CI run 812)"
+  prog dod uncheck ts-a1b2c3 1
+  prog dod rm ts-a1b2c3 2`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if _, err := database.GetItem(args[0]); err != nil {
+			return err
+		}
+		criteria, err := database.GetCriteria(args[0])
+		if err != nil {
+			return err
+		}
+
+		if flagJSON {
+			if criteria == nil {
+				criteria = []model.Criterion{}
+			}
+			b, err := json.MarshalIndent(criteria, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+
+		if len(criteria) == 0 {
+			fmt.Printf("%s has no definition of done (add criteria with 'prog dod add %s <criterion>')\n", args[0], args[0])
+			return nil
+		}
+		fmt.Printf("Definition of Done for %s (%d/%d):\n", args[0], countChecked(criteria), len(criteria))
+		printCriteria(criteria)
+		return nil
+	},
+}
+
+var dodAddCmd = &cobra.Command{
+	Use:   "add <id> <criterion>",
+	Short: "Add a criterion to a task's definition of done",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if err := database.AddCriterion(args[0], args[1], flagDoDCommand); err != nil {
+			return err
+		}
+		criteria, err := database.GetCriteria(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added criterion %d to %s\n", len(criteria), args[0])
+		return nil
+	},
+}
+
+var dodCheckCmd = &cobra.Command{
+	Use:   "check <id> <n>...",
+	Short: "Check off definition of done criteria",
+	Long: `Check off one or more definition of done criteria by number, with a note
+recording the evidence: a test run, a CI link, a commit.
+
+Examples:
+  prog dod check ts-a1b2c3 1 --note "go test ./... passes"
+  prog dod check ts-a1b2c3 2 3`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		positions, err := parseCriterionNumbers(args[1:])
+		if err != nil {
+			return err
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		for _, n := range positions {
+			if err := database.CheckCriterion(args[0], n, flagDoDNote); err != nil {
+				return err
+			}
+		}
+		return printDoDProgress(database, args[0])
+	},
+}
+
+var dodUncheckCmd = &cobra.Command{
+	Use:   "uncheck <id> <n>...",
+	Short: "Mark definition of done criteria as not met",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		positions, err := parseCriterionNumbers(args[1:])
+		if err != nil {
+			return err
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		for _, n := range positions {
+			if err := database.UncheckCriterion(args[0], n); err != nil {
+				return err
+			}
+		}
+		return printDoDProgress(database, args[0])
+	},
+}
+
+var dodRmCmd = &cobra.Command{
+	Use:   "rm <id> <n>",
+	Short: "Remove a criterion from a task's definition of done",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		positions, err := parseCriterionNumbers(args[1:])
+		if err != nil {
+			return err
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if err := database.RemoveCriterion(args[0], positions[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed criterion %d from %s\n", positions[0], args[0])
+		return nil
+	},
+}
+
+// parseCriterionNumbers parses criterion numbers as shown by 'prog dod'.
+func parseCriterionNumbers(args []string) ([]int, error) {
+	positions := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid criterion number %q: use the numbers shown by 'prog dod <id>'", arg)
+		}
+		positions[i] = n
+	}
+	return positions, nil
+}
+
+// printDoDProgress prints how much of a task's definition of done is checked.
+func printDoDProgress(database *db.DB, id string) error {
+	criteria, err := database.GetCriteria(id)
+	if err != nil {
+		return err
+	}
+	checked := countChecked(criteria)
+	fmt.Printf("%s: %d/%d criteria checked\n", id, checked, len(criteria))
+	if checked == len(criteria) {
+		fmt.Printf("Definition of done met; complete with 'prog done %s'\n", id)
+	}
+	return nil
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <id> [n]...",
+	Short: "Run a task's definition of done commands and record the evidence",
+	Long: `Run the command of each definition of done criterion that has one (see
+'prog dod add --cmd'), or only the numbered criteria given.
+
+Commands run with sh -c in the task's workspace: the current directory, or
+--dir. Each run is recorded with its exit code, duration and the end of its
+output. A passing command checks its criterion off; a failing one unchecks
+it. The results are written to the task's log, and 'prog show' displays the
+latest run of each criterion for reviewers.
+
+Exits non-zero if any command fails.
+
+Examples:
+  prog verify ts-a1b2c3
+  prog verify ts-a1b2c3 2 --dir ../worktrees/ts-a1b2c3
+  prog verify ts-a1b2c3 -v --timeout 30m`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := args[0]
+		positions, err := parseCriterionNumbers(args[1:])
 		if err != nil {
 			return err
 		}
-		defer func() { _ = database.Close() }()
-
-		id := args[0]
-
-		// If --dod flag is set, update definition of done
-		if cmd.Flags().Changed("dod") {
-			var dod *string
-			if flagDoD != "" {
-				dod = &flagDoD
-			}
-			if err := database.SetDefinitionOfDone(id, dod); err != nil {
-				return err
-			}
-			if dod == nil {
-				fmt.Printf("Cleared definition of done for %s\n", id)
-			} else {
-				fmt.Printf("Updated definition of done for %s\n", id)
-			}
-			return nil
+		dir := flagVerifyDir
+		if dir == "" {
+			dir = "."
 		}
-
-		// If --title flag is set, update title directly
-		if flagEditTitle != "" {
-			if err := database.SetTitle(id, flagEditTitle); err != nil {
-				return err
-			}
-			fmt.Printf("Updated title for %s\n", id)
-			return nil
+		if dir, err = filepath.Abs(dir); err != nil {
+			return fmt.Errorf("failed to resolve directory: %w", err)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("workspace %s is not a directory", dir)
 		}
 
-		// Get current description
-		item, err := database.GetItem(id)
+		database, err := openDB()
 		if err != nil {
 			return err
 		}
+		defer func() { _ = database.Close() }()
 
-		// Get editor (prefer $PROG_EDITOR, then nvim, then nano)
-		editor := os.Getenv("PROG_EDITOR")
-		if editor == "" {
-			if _, err := exec.LookPath("nvim"); err == nil {
-				editor = "nvim"
-			} else if _, err := exec.LookPath("nano"); err == nil {
-				editor = "nano"
-			} else {
-				editor = "vi"
-			}
+		if _, err := database.GetItem(id); err != nil {
+			return err
 		}
-
-		// Create temp file
-		tmpfile, err := os.CreateTemp("", "prog-edit-*.md")
+		criteria, err := database.GetCriteria(id)
 		if err != nil {
-			return fmt.Errorf("failed to create temp file: %w", err)
+			return err
 		}
-		tmpPath := tmpfile.Name()
-		defer func() { _ = os.Remove(tmpPath) }()
-
-		// Write current description
-		if _, err := tmpfile.WriteString(item.Description); err != nil {
-			_ = tmpfile.Close()
-			return fmt.Errorf("failed to write temp file: %w", err)
+		var checks []model.Criterion
+		if len(positions) > 0 {
+			for _, n := range positions {
+				if n > len(criteria) {
+					return fmt.Errorf("%s has no criterion %d (use 'prog dod %s' to see its criteria)", id, n, id)
+				}
+				if criteria[n-1].Command == "" {
+					return fmt.Errorf("criterion %d of %s has no command (add one with 'prog dod add %s <criterion> --cmd <command>')", n, id, id)
+				}
+				checks = append(checks, criteria[n-1])
+			}
+		} else {
+			for _, c := range criteria {
+				if c.Command != "" {
+					checks = append(checks, c)
+				}
+			}
 		}
-		if err := tmpfile.Close(); err != nil {
-			return fmt.Errorf("failed to close temp file: %w", err)
+		if len(checks) == 0 {
+			return fmt.Errorf("%s has no criteria with commands to run (add one with 'prog dod add %s <criterion> --cmd <command>')", id, id)
 		}
 
-		// Get original stat for comparison
-		origStat, err := os.Stat(tmpPath)
-		if err != nil {
-			return fmt.Errorf("failed to stat temp file: %w", err)
-		}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 
-		// Open editor
-		editorCmd := execCommand(editor, tmpPath)
-		editorCmd.Stdin = os.Stdin
-		editorCmd.Stdout = os.Stdout
-		editorCmd.Stderr = os.Stderr
-		if err := editorCmd.Run(); err != nil {
-			return fmt.Errorf("editor failed: %w", err)
+		cfg := verify.Config{
+			Dir:     dir,
+			Timeout: flagVerifyTimeout,
+			Env:     map[string]string{"PROG_ITEM": id},
 		}
-
-		// Check if file was modified
-		newStat, err := os.Stat(tmpPath)
-		if err != nil {
-			return fmt.Errorf("failed to stat temp file: %w", err)
+		if flagVerifyVerbose {
+			cfg.Output = os.Stderr
 		}
 
-		if newStat.ModTime().Equal(origStat.ModTime()) {
-			fmt.Println("No changes made")
-			return nil
+		var failed []string
+		for _, c := range checks {
+			fmt.Printf("%d. %s\n   $ %s\n", c.Position, c.Text, c.Command)
+			v := verify.Run(ctx, cfg, c.Command)
+			v.ItemID = id
+			v.Criterion = c.Text
+			if err := database.RecordVerification(v); err != nil {
+				return err
+			}
+
+			took := formatRunDuration(v.Duration())
+			if v.Passed() {
+				fmt.Printf("   passed in %s\n", took)
+				continue
+			}
+			fmt.Printf("   FAILED with exit code %d in %s\n", v.ExitCode, took)
+			if !flagVerifyVerbose {
+				printOutputTail(v.Output, 10, "   ")
+			}
+			failed = append(failed, fmt.Sprintf("%d (exit %d)", c.Position, v.ExitCode))
+			if ctx.Err() != nil {
+				break
+			}
 		}
 
-		// Read new content
-		newContent, err := os.ReadFile(tmpPath)
-		if err != nil {
-			return fmt.Errorf("failed to read temp file: %w", err)
+		summary := fmt.Sprintf("Verified in %s: %d/%d checks passed", dir, len(checks)-len(failed), len(checks))
+		if len(failed) > 0 {
+			summary += "; failed: " + strings.Join(failed, ", ")
+		}
+		if err := database.AddLog(id, summary); err != nil {
+			return err
 		}
 
-		// Update description
-		if err := database.SetDescription(id, string(newContent)); err != nil {
+		fmt.Println()
+		if err := printDoDProgress(database, id); err != nil {
 			return err
 		}
-		fmt.Printf("Updated description for %s\n", id)
+		if len(failed) > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d of %d checks failed", len(failed), len(checks))
+		}
 		return nil
 	},
 }
 
-// execCommand wraps exec.Command for testing
-var execCommand = func(name string, arg ...string) *exec.Cmd {
-	return exec.Command(name, arg...)
+// printOutputTail prints the last n lines of a command's output after indent.
+func printOutputTail(output string, n int, indent string) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for _, line := range lines {
+		if line != "" {
+			fmt.Printf("%s| %s\n", indent, line)
+		}
+	}
+}
+
+// formatRunDuration formats how long a command ran, e.g. "850ms" or "2.3s".
+func formatRunDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.String()
+	}
+	return d.Round(100 * time.Millisecond).String()
 }
 
 var descCmd = &cobra.Command{
@@ -1170,6 +2466,159 @@ Example:
 	},
 }
 
+var areaCmd = &cobra.Command{
+	Use:   "area <item-id> <area>...",
+	Short: "Record code areas a task touches",
+	Long: `Record which parts of the codebase a task touches.
+
+An area is a path (covers everything beneath it), a glob where ** matches
+any number of directories, or a plain name like "schema". Tasks whose areas
+overlap an in-progress task are held back by 'prog ready --no-conflicts'
+and 'prog next --no-conflicts', so parallel agents don't collide.
+
+Examples:
+  prog area ts-a1b2c3 internal/db
+  prog area ts-a1b2c3 'cmd/**/*.go' schema`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		// Ensure the item exists
+		if _, err := database.GetItem(args[0]); err != nil {
+			return err
+		}
+
+		for _, area := range args[1:] {
+			if err := database.AddItemArea(args[0], area); err != nil {
+				return err
+			}
+			fmt.Printf("Added area %q to %s\n", db.NormalizeArea(area), args[0])
+		}
+		return nil
+	},
+}
+
+var unareaCmd = &cobra.Command{
+	Use:   "unarea <item-id> <area>...",
+	Short: "Remove code areas from a task",
+	Long: `Remove areas previously recorded with 'prog area'.
+
+Example:
+  prog unarea ts-a1b2c3 internal/db`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		// Ensure the item exists
+		if _, err := database.GetItem(args[0]); err != nil {
+			return err
+		}
+
+		for _, area := range args[1:] {
+			if err := database.RemoveItemArea(args[0], area); err != nil {
+				return err
+			}
+			fmt.Printf("Removed area %q from %s\n", db.NormalizeArea(area), args[0])
+		}
+		return nil
+	},
+}
+
+var conflictsCmd = &cobra.Command{
+	Use:   "conflicts",
+	Short: "Show tasks whose code areas overlap",
+	Long: `Report overlapping areas between tasks.
+
+Lists in-progress tasks that are touching the same areas right now, and
+ready tasks held back by 'prog ready --no-conflicts' because they overlap
+in-progress work.
+
+Examples:
+  prog conflicts
+  prog conflicts -p myproject
+  prog conflicts --json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		inFlight, err := database.Conflicts(flagProject)
+		if err != nil {
+			return err
+		}
+		heldBack, err := database.HeldBack(flagProject)
+		if err != nil {
+			return err
+		}
+
+		if flagJSON {
+			output := ConflictsJSON{
+				InProgress: conflictsToJSON(inFlight),
+				HeldBack:   conflictsToJSON(heldBack),
+			}
+			b, err := json.MarshalIndent(output, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+
+		if len(inFlight) == 0 && len(heldBack) == 0 {
+			fmt.Println("No conflicts")
+			return nil
+		}
+		if len(inFlight) > 0 {
+			fmt.Println("In progress:")
+			for _, c := range inFlight {
+				fmt.Printf("  %s <-> %s  (%s)\n", c.Item.ID, c.Other.ID, describeOverlap(c))
+			}
+		}
+		if len(heldBack) > 0 {
+			if len(inFlight) > 0 {
+				fmt.Println()
+			}
+			fmt.Println("Held back:")
+			for _, c := range heldBack {
+				fmt.Printf("  %s waits on %s  (%s)\n", c.Item.ID, c.Other.ID, describeOverlap(c))
+			}
+		}
+		return nil
+	},
+}
+
+// describeOverlap renders the areas that caused a conflict.
+func describeOverlap(c db.Conflict) string {
+	if c.Area == c.OtherArea {
+		return c.Area
+	}
+	return c.Area + " ~ " + c.OtherArea
+}
+
+func conflictsToJSON(conflicts []db.Conflict) []ConflictJSON {
+	out := make([]ConflictJSON, 0, len(conflicts))
+	for _, c := range conflicts {
+		out = append(out, ConflictJSON{
+			ID:        c.Item.ID,
+			Title:     c.Item.Title,
+			Area:      c.Area,
+			Other:     c.Other.ID,
+			OtherArea: c.OtherArea,
+		})
+	}
+	return out
+}
+
 var learnCmd = &cobra.Command{
 	Use:   "learn <summary>",
 	Short: "Log a learning for future context retrieval",
@@ -1195,7 +2644,7 @@ CONTEXT MANAGEMENT FLOW:
 ┌─────────────────────────────────────────────────────────────┐
 │ 2. Future Retrieval: Load context before starting work     │
 │    → prog context -c concept        # by concept           │
-│    → prog context -q "search term"  # full-text search     │
+│    → prog context -q "search term"  # search by words      │
 │    → prog context --summary         # scan all one-liners  │
 └─────────────────────────────────────────────────────────────┘
                           ↓
@@ -1360,11 +2809,121 @@ Examples:
 				fmt.Printf("Marked %s as stale\n", args[0])
 			}
 		} else {
-			if flagLearnStaleReason != "" {
-				fmt.Printf("Marked %d learnings as stale: %s\n", len(args), flagLearnStaleReason)
-			} else {
-				fmt.Printf("Marked %d learnings as stale\n", len(args))
-			}
+			if flagLearnStaleReason != "" {
+				fmt.Printf("Marked %d learnings as stale: %s\n", len(args), flagLearnStaleReason)
+			} else {
+				fmt.Printf("Marked %d learnings as stale\n", len(args))
+			}
+		}
+		return nil
+	},
+}
+
+var learnAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Flag learnings whose files changed since they were written",
+	Long: `Check each active learning's files against git history since the learning
+was last updated, and mark it as needing review when they changed heavily or
+no longer exist.
+
+A file's churn is the lines added and deleted since, over its lines before and
+after: rewriting it entirely is 1, doubling it is a third. Directories and
+globs count every file they match. Learnings without files aren't checked.
+
+Learnings needing review are still retrieved, tagged [needs review], and
+listed by 'prog compact'. Once checked, keep them with 'prog learn reviewed',
+or update or mark them stale.
+
+Run from inside the project's git repository.
+
+Examples:
+  prog learn audit -p myproject
+  prog learn audit -p myproject --threshold 0.3 --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagProject == "" {
+			return fmt.Errorf("project is required (-p)")
+		}
+		if flagLearnAuditThreshold <= 0 || flagLearnAuditThreshold > 1 {
+			return fmt.Errorf("--threshold must be between 0 and 1")
+		}
+		root, err := pages.FindRoot(".")
+		if err != nil {
+			return err
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		learnings, err := database.GetAllLearnings(flagProject, false)
+		if err != nil {
+			return err
+		}
+
+		auditor := &audit.Auditor{Root: root, Threshold: flagLearnAuditThreshold}
+		checked, flagged := 0, 0
+		for _, l := range learnings {
+			if l.Status != model.LearningStatusActive || len(l.Files) == 0 {
+				continue
+			}
+			checked++
+			result, err := auditor.Audit(cmd.Context(), l)
+			if err != nil {
+				return err
+			}
+			if !result.NeedsReview() {
+				continue
+			}
+			flagged++
+			if !flagLearnAuditDryRun {
+				if err := database.MarkNeedsReview(l.ID, result.Reason()); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("%s: %s\n  %s\n", l.ID, l.Summary, result.Reason())
+		}
+
+		switch {
+		case flagged == 0:
+			fmt.Printf("Checked %d learnings with files; none need review\n", checked)
+		case flagLearnAuditDryRun:
+			fmt.Printf("\n%d of %d learnings would be marked as needing review\n", flagged, checked)
+		default:
+			fmt.Printf("\nMarked %d of %d learnings as needing review\n", flagged, checked)
+		}
+		return nil
+	},
+}
+
+var learnReviewedCmd = &cobra.Command{
+	Use:   "reviewed <learning-id> [learning-id...]",
+	Short: "Mark learnings as reviewed and still accurate",
+	Long: `Mark one or more learnings flagged by 'prog learn audit' as checked and still
+accurate. They become active again; the next audit only counts changes made
+after this.
+
+Example:
+  prog learn reviewed lrn-abc123`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		for _, id := range args {
+			if err := database.UpdateLearningStatus(id, model.LearningStatusActive); err != nil {
+				return err
+			}
+		}
+		if len(args) == 1 {
+			fmt.Printf("Marked %s as reviewed\n", args[0])
+		} else {
+			fmt.Printf("Marked %d learnings as reviewed\n", len(args))
 		}
 		return nil
 	},
@@ -1428,8 +2987,15 @@ RETRIEVAL PATTERNS:
      → Suggests concepts based on task title/description
      → Then: prog context -c <suggested-concept>
   
-  3. Full-Text Search: prog context -q "token refresh"
-     → Searches across all learning summaries and details
+  3. Search: prog context -q "token refresh"
+     → Searches across all learning summaries and details, and the
+       concepts and synonyms the query names
+
+SYNONYMS:
+  A concept's synonyms are words or phrases that mean the same, like
+  "session timeout" and "ttl" for "sessions". A search that mentions the
+  concept or any synonym also searches for the rest and ranks the concept's
+  learnings higher.
 
 Default sort is by learning count (most used first).
 
@@ -1439,7 +3005,9 @@ Examples:
   prog concepts -p myproject --stats                # show count and oldest age
   prog concepts --related ts-abc123                 # suggest concepts for a task
   prog concepts fts -p myproject --summary "..."    # set concept summary
-  prog concepts fts -p myproject --rename "search"  # rename concept`,
+  prog concepts fts -p myproject --rename "search"  # rename concept
+  prog concepts sessions -p myproject --synonym ttl --synonym "session timeout"
+  prog concepts sessions -p myproject --remove-synonym ttl`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		database, err := openDB()
 		if err != nil {
@@ -1447,8 +3015,8 @@ Examples:
 		}
 		defer func() { _ = database.Close() }()
 
-		// Edit mode: concept name provided with --summary or --rename
-		if len(args) > 0 && (flagConceptsSummary != "" || flagConceptsRename != "") {
+		// Edit mode: concept name provided with --summary, --rename or synonyms
+		if len(args) > 0 && (flagConceptsSummary != "" || flagConceptsRename != "" || len(flagConceptsSynonym) > 0 || len(flagConceptsUnsynonym) > 0) {
 			if flagProject == "" {
 				return fmt.Errorf("project is required (-p)")
 			}
@@ -1458,6 +3026,23 @@ Examples:
 				}
 				fmt.Printf("Updated %s\n", args[0])
 			}
+			if len(flagConceptsSynonym) > 0 || len(flagConceptsUnsynonym) > 0 {
+				if err := database.AddConceptSynonyms(args[0], flagProject, flagConceptsSynonym); err != nil {
+					return err
+				}
+				if err := database.RemoveConceptSynonyms(args[0], flagProject, flagConceptsUnsynonym); err != nil {
+					return err
+				}
+				synonyms, err := database.GetConceptSynonyms(args[0], flagProject)
+				if err != nil {
+					return err
+				}
+				if len(synonyms) == 0 {
+					fmt.Printf("%s has no synonyms\n", args[0])
+				} else {
+					fmt.Printf("Synonyms for %s: %s\n", args[0], strings.Join(synonyms, ", "))
+				}
+			}
 			if flagConceptsRename != "" {
 				if err := database.RenameConcept(args[0], flagConceptsRename, flagProject); err != nil {
 					return err
@@ -1651,18 +3236,34 @@ Example:
 var contextCmd = &cobra.Command{
 	Use:   "context",
 	Short: "Retrieve learnings for context",
-	Long: `Retrieve learnings by concept, full-text search, or specific ID.
+	Long: `Retrieve learnings by concept, file, search, or specific ID.
 
 Use this to load relevant context before starting work on a task.
 
+Learnings about a file are those recorded with it (prog learn -f), with a
+directory containing it, or with a glob matching it. Give paths relative to
+the repo root, as git prints them.
+
+Search (-q) takes plain words, with no query syntax to get wrong. It ranks
+learnings by their exact words (BM25), by similar words and spellings, so
+"expiring" finds "expiry" and a typo still matches, and by the concepts the
+query names. Synonyms recorded on a concept ('prog concepts <name>
+--synonym') widen a search that mentions it. Everything runs locally.
+
 Examples:
   prog context -p myproject --summary                # all learnings, grouped by concept
   prog context -c auth -c concurrency -p myproject   # by concepts
-  prog context -q "rate limit" -p myproject          # full-text search
+  prog context -q "rate limit" -p myproject          # search
   prog context -c auth --summary -p myproject        # one-liner per learning
   prog context --id lrn-abc123                       # specific learning by ID
   prog context -c auth --include-stale -p myproject  # include stale learnings
-  prog context -c auth --json -p myproject           # JSON output for agents`,
+  prog context -c auth --json -p myproject           # JSON output for agents
+  prog context -f auth/token.go -p myproject         # learnings about a file
+  git diff --name-only | prog context --stdin -p myproject  # about changed files
+
+Learnings can also live in Markdown pages in the repo (see 'prog context
+upsert --help'). Each page is indexed as a stub that points to it, listed
+before other learnings; 'prog context open' prints the page.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		database, err := openDB()
 		if err != nil {
@@ -1688,8 +3289,21 @@ Examples:
 			return fmt.Errorf("project is required (-p) or use --id")
 		}
 
+		files := flagContextFile
+		if flagContextStdin {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("failed to read stdin: %w", err)
+			}
+			files = append(files, strings.Fields(string(data))...)
+			if len(files) == 0 {
+				fmt.Println("No files given on stdin")
+				return nil
+			}
+		}
+
 		// Mode 2: All learnings with --summary (no concepts/query required)
-		if flagContextSummary && len(flagContextConcept) == 0 && flagContextQuery == "" {
+		if flagContextSummary && len(flagContextConcept) == 0 && len(files) == 0 && flagContextQuery == "" {
 			learnings, err := database.GetAllLearnings(flagProject, flagContextStale)
 			if err != nil {
 				return err
@@ -1718,52 +3332,522 @@ Examples:
 			return nil
 		}
 
-		// Modes 3 & 4 require concepts or query
-		if len(flagContextConcept) == 0 && flagContextQuery == "" {
-			return fmt.Errorf("specify concepts (-c), query (-q), or use --summary for all")
+		// Modes 3 & 4 require concepts, files or query
+		if len(flagContextConcept) == 0 && len(files) == 0 && flagContextQuery == "" {
+			return fmt.Errorf("specify concepts (-c), files (-f), query (-q), or use --summary for all")
+		}
+
+		var learnings []model.Learning
+
+		if len(flagContextConcept) > 0 {
+			learnings, err = database.GetLearningsByConcepts(flagProject, flagContextConcept, flagContextStale)
+		} else if len(files) > 0 {
+			learnings, err = database.GetLearningsByFiles(flagProject, files, flagContextStale)
+		} else {
+			learnings, err = database.SearchLearnings(flagProject, flagContextQuery, flagContextStale)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(learnings) == 0 {
+			if flagContextJSON {
+				fmt.Println("[]")
+				return nil
+			}
+			fmt.Println("No learnings found")
+			return nil
+		}
+
+		// JSON mode
+		if flagContextJSON {
+			return printLearningsJSON(learnings)
+		}
+
+		// Mode 3: Summary mode (one-liners) for specific concepts
+		if flagContextSummary {
+			// Get concept summaries for header
+			concepts, _ := database.ListConcepts(flagProject, false)
+			conceptMap := make(map[string]string)
+			for _, c := range concepts {
+				conceptMap[c.Name] = c.Summary
+			}
+			printLearningSummaries(learnings, flagContextConcept, conceptMap)
+			return nil
+		}
+
+		// Mode 4: Full output
+		printLearnings(learnings)
+		return nil
+	},
+}
+
+var contextSearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search learnings, showing page stubs first",
+	Long: `Search learnings, as 'prog context -q' does, showing stubs: the title,
+one-liner and short summary of each learning page, with its path. Stubs come before
+learnings recorded with 'prog learn'. Open a page with 'prog context open'
+when the stub isn't enough.
+
+Examples:
+  prog context search "migration" -p myproject
+  prog context search "rate limit" -p myproject --json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagProject == "" {
+			return fmt.Errorf("project is required (-p)")
+		}
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		learnings, err := database.SearchLearnings(flagProject, strings.Join(args, " "), flagContextStale)
+		if err != nil {
+			return err
+		}
+		if flagContextJSON {
+			return printLearningsJSON(learnings)
+		}
+		if len(learnings) == 0 {
+			fmt.Println("No learnings found")
+			return nil
+		}
+		printStubs(learnings)
+		return nil
+	},
+}
+
+var contextOpenCmd = &cobra.Command{
+	Use:   "open <id|path>",
+	Short: "Print a learning page in full",
+	Long: `Print the full Markdown of a learning page, by its stub's ID or its path.
+A learning recorded with 'prog learn' has no page; it is printed in full.
+
+Examples:
+  prog context open lrn-abc123
+  prog context open docs/learnings/migrations.md`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, rootErr := pages.FindRoot(".")
+
+		// A path is read directly, indexed or not
+		if !strings.HasPrefix(args[0], "lrn-") {
+			content, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read page: %w", err)
+			}
+			fmt.Print(string(content))
+			return nil
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		learning, err := database.GetLearning(args[0])
+		if err != nil {
+			return err
+		}
+		if !learning.IsPage() {
+			printLearnings([]model.Learning{*learning})
+			return nil
+		}
+		if rootErr != nil {
+			return rootErr
+		}
+		content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(learning.Path)))
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("page %s for %s no longer exists (run 'prog context reindex -p %s')", learning.Path, learning.ID, learning.Project)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read page: %w", err)
+		}
+		fmt.Print(string(content))
+		return nil
+	},
+}
+
+var contextUpsertCmd = &cobra.Command{
+	Use:   "upsert <path>...",
+	Short: "Index learning pages as stubs",
+	Long: `Index Markdown learning pages, creating or updating the stub that context
+search and listings show for each. A stub keeps its ID when its page is
+indexed again.
+
+A page must follow the template: a "# Title", then non-empty "## Problem",
+"## Pattern / Rule", "## Example" and "## Caveats / When to ignore"
+sections, and a "## References" section. Pages that don't are rejected
+with what is missing. Frontmatter can set tags (indexed as concepts),
+updated, files, provenance, one_liner and summary:
+
+  ---
+  tags: [db, migrations]
+  updated: 2026-01-21
+  ---
+
+Examples:
+  prog context upsert docs/learnings/migrations.md -p myproject`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagProject == "" {
+			return fmt.Errorf("project is required (-p)")
+		}
+		root, err := pages.FindRoot(".")
+		if err != nil {
+			return err
+		}
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		rejected := 0
+		for _, arg := range args {
+			path, err := pages.RelPath(root, arg)
+			if err != nil {
+				return err
+			}
+			id, state, err := indexPageFile(database, root, path, nil)
+			var invalid *pages.InvalidError
+			if errors.As(err, &invalid) {
+				fmt.Fprintln(os.Stderr, err)
+				rejected++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Indexed %s: %s (%s)\n", id, path, state)
+		}
+		if rejected > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d of %d rejected; fix them to match the template (see 'prog context upsert --help')", rejected, len(args))
+		}
+		return nil
+	},
+}
+
+var contextReindexCmd = &cobra.Command{
+	Use:   "reindex [dir]...",
+	Short: "Index every learning page in the repo",
+	Long: `Index the Markdown learning pages under each dir (default: ` + pages.DefaultDir + `),
+and every page indexed before. Pages that haven't changed are skipped, and
+the stubs of pages that were deleted are archived. README.md and index.md
+are not pages.
+
+Reports pages that fail the template's checks, and exits non-zero if any
+did, so it can run in CI.
+
+Examples:
+  prog context reindex -p myproject
+  prog context reindex docs/learnings docs/adr -p myproject`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagProject == "" {
+			return fmt.Errorf("project is required (-p)")
+		}
+		root, err := pages.FindRoot(".")
+		if err != nil {
+			return err
+		}
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		hashes, err := database.PageHashes(flagProject)
+		if err != nil {
+			return err
+		}
+		// Dirs given are relative to the current directory, like paths to upsert
+		dirs := []string{pages.DefaultDir}
+		if len(args) > 0 {
+			dirs = nil
+			for _, arg := range args {
+				dir, err := pages.RelPath(root, arg)
+				if err != nil {
+					return err
+				}
+				dirs = append(dirs, dir)
+			}
+		}
+		var paths []string
+		for _, dir := range dirs {
+			found, err := pages.Discover(root, dir)
+			if err != nil {
+				return fmt.Errorf("failed to find pages in %s: %w", dir, err)
+			}
+			paths = append(paths, found...)
+		}
+		for path := range hashes {
+			if !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+		slices.Sort(paths)
+
+		counts := make(map[string]int)
+		for _, path := range paths {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(path))); errors.Is(err, os.ErrNotExist) {
+				if err := database.ArchivePage(flagProject, path); err != nil {
+					return err
+				}
+				fmt.Printf("Archived stub for deleted page %s\n", path)
+				counts["removed"]++
+				continue
+			}
+			id, state, err := indexPageFile(database, root, path, hashes)
+			var invalid *pages.InvalidError
+			if errors.As(err, &invalid) {
+				fmt.Fprintln(os.Stderr, err)
+				counts["rejected"]++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if state != "unchanged" {
+				fmt.Printf("Indexed %s: %s (%s)\n", id, path, state)
+			}
+			counts[state]++
+		}
+
+		var parts []string
+		for _, state := range []string{"new", "updated", "unchanged", "removed", "rejected"} {
+			if counts[state] > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", counts[state], state))
+			}
+		}
+		if len(parts) == 0 {
+			fmt.Printf("No learning pages found in %s\n", strings.Join(dirs, ", "))
+			return nil
+		}
+		fmt.Printf("Reindexed learning pages: %s\n", strings.Join(parts, ", "))
+		if counts["rejected"] > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d rejected; fix them to match the template (see 'prog context upsert --help')", counts["rejected"])
+		}
+		return nil
+	},
+}
+
+var contextFeedbackCmd = &cobra.Command{
+	Use:   "feedback [id]",
+	Short: "Record whether a learning was relevant, or report misleading ones",
+	Long: `Record an evaluation of a learning you retrieved: whether it looked
+relevant from its summary or stub (it did, unless you pass --unexpected),
+and whether it applied to your task once you read it. It's recorded against
+your in-progress task unless you pass --task.
+
+Learnings that look relevant but don't apply rank lower in 'prog context'
+and 'prog context search'; learnings that apply rank higher. Say why one
+didn't apply with --reason, e.g. "scope mismatch", "stale info",
+"misleading tags" or "wrong subsystem".
+
+Without an ID, reports the learnings that most often looked relevant but
+weren't, to groom: reword their summaries, fix their tags, or mark them
+stale.
+
+Examples:
+  prog context feedback lrn-abc123 --relevant
+  prog context feedback lrn-abc123 --not-relevant --reason "wrong subsystem"
+  prog context feedback lrn-abc123 --relevant --unexpected --task-context "bugfix, db"
+  prog context feedback -p myproject        # most misleading learnings`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if len(args) == 0 {
+			stats, err := database.MisleadingLearnings(flagProject, flagFeedbackLimit)
+			if err != nil {
+				return err
+			}
+			if flagJSON {
+				return printMisleadingJSON(stats)
+			}
+			if len(stats) == 0 {
+				fmt.Println("No misleading learnings")
+				return nil
+			}
+			printMisleading(stats)
+			return nil
+		}
+
+		if flagFeedbackRelevant == flagFeedbackNotRelevant {
+			return fmt.Errorf("specify whether the learning applied: --relevant or --not-relevant")
+		}
+		f := &model.Feedback{
+			LearningID:       args[0],
+			ExpectedRelevant: !flagFeedbackUnexpected,
+			ActuallyRelevant: flagFeedbackRelevant,
+			MismatchReason:   flagFeedbackReason,
+			TaskContext:      flagFeedbackContext,
+		}
+		if flagFeedbackTask != "" {
+			f.TaskID = &flagFeedbackTask
+		}
+		if err := database.RecordFeedback(f); err != nil {
+			return err
+		}
+
+		var verdict string
+		switch {
+		case f.Misleading():
+			verdict = "looked relevant but wasn't"
+		case f.ExpectedRelevant:
+			verdict = "relevant"
+		case f.ActuallyRelevant:
+			verdict = "relevant, though it didn't look it"
+		default:
+			verdict = "not relevant, as expected"
+		}
+		if f.MismatchReason != "" {
+			verdict += " (" + f.MismatchReason + ")"
+		}
+		if f.TaskID != nil {
+			verdict += " for " + *f.TaskID
+		}
+		fmt.Printf("Recorded %s: %s\n", f.LearningID, verdict)
+		return nil
+	},
+}
+
+// MisleadingJSON is the JSON serialization format for the misleading
+// learnings report.
+type MisleadingJSON struct {
+	ID          string   `json:"id"`
+	Summary     string   `json:"summary"`
+	Path        string   `json:"path,omitempty"`
+	Status      string   `json:"status"`
+	Evaluations int      `json:"evaluations"`
+	Relevant    int      `json:"relevant"`
+	Misleading  int      `json:"misleading"`
+	Score       float64  `json:"score"`
+	Reasons     []string `json:"reasons"`
+}
+
+func printMisleadingJSON(stats []db.FeedbackStats) error {
+	out := make([]MisleadingJSON, 0, len(stats))
+	for _, s := range stats {
+		reasons := s.Reasons
+		if reasons == nil {
+			reasons = []string{}
+		}
+		out = append(out, MisleadingJSON{
+			ID:          s.Learning.ID,
+			Summary:     s.Learning.Summary,
+			Path:        s.Learning.Path,
+			Status:      string(s.Learning.Status),
+			Evaluations: s.Evaluations,
+			Relevant:    s.Relevant,
+			Misleading:  s.Misleading,
+			Score:       s.Score,
+			Reasons:     reasons,
+		})
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// printMisleading prints learnings with how often they misled, and why.
+func printMisleading(stats []db.FeedbackStats) {
+	fmt.Printf("%-10s  %-10s  %5s  %s\n", "ID", "MISLEADING", "SCORE", "SUMMARY")
+	for _, s := range stats {
+		summary := s.Learning.Summary
+		if s.Learning.IsPage() {
+			summary += " (" + s.Learning.Path + ")"
+		}
+		summary += learningStatusTag(s.Learning)
+		fmt.Printf("%-10s  %-10s  %5.2f  %s\n", s.Learning.ID, fmt.Sprintf("%d of %d", s.Misleading, s.Evaluations), s.Score, summary)
+		if len(s.Reasons) > 0 {
+			fmt.Printf("%-10s  why: %s\n", "", strings.Join(s.Reasons, "; "))
 		}
+	}
+}
 
-		var learnings []model.Learning
+// indexPageFile parses and indexes the learning page at path, relative to
+// root, returning its stub's ID and whether it is new, updated or unchanged.
+// A page whose hash matches hashes[path] is unchanged and isn't validated.
+func indexPageFile(database *db.DB, root, path string, hashes map[string]string) (string, string, error) {
+	file := filepath.Join(root, filepath.FromSlash(path))
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read page: %w", err)
+	}
+	page, err := pages.Parse(path, content)
+	if err != nil {
+		return "", "", err
+	}
+	if hash, ok := hashes[path]; ok && hash == page.Hash {
+		return "", "unchanged", nil
+	}
+	if err := page.Validate(); err != nil {
+		return "", "", err
+	}
 
-		if len(flagContextConcept) > 0 {
-			learnings, err = database.GetLearningsByConcepts(flagProject, flagContextConcept, flagContextStale)
-		} else {
-			learnings, err = database.SearchLearnings(flagProject, flagContextQuery, flagContextStale)
-		}
+	// Without an updated date, the page was last updated when it was saved
+	updated := page.Updated
+	if updated.IsZero() {
+		info, err := os.Stat(file)
 		if err != nil {
-			return err
+			return "", "", fmt.Errorf("failed to read page: %w", err)
 		}
+		updated = info.ModTime()
+	}
+	stub := &model.Learning{
+		Project:    flagProject,
+		UpdatedAt:  updated,
+		Summary:    page.OneLiner,
+		Detail:     page.Summary,
+		Files:      page.Files,
+		Concepts:   page.Tags,
+		Path:       page.Path,
+		Title:      page.Title,
+		Provenance: page.Provenance,
+	}
+	created, err := database.IndexPage(stub, page.Hash)
+	if err != nil {
+		return "", "", err
+	}
+	if created {
+		return stub.ID, "new", nil
+	}
+	return stub.ID, "updated", nil
+}
 
-		if len(learnings) == 0 {
-			if flagContextJSON {
-				fmt.Println("[]")
-				return nil
-			}
-			fmt.Println("No learnings found")
-			return nil
+// printStubs prints learnings as stubs: a page's title, one-liner, summary
+// and path, or a recorded learning's summary.
+func printStubs(learnings []model.Learning) {
+	for i, l := range learnings {
+		if i > 0 {
+			fmt.Println()
 		}
-
-		// JSON mode
-		if flagContextJSON {
-			return printLearningsJSON(learnings)
+		status := learningStatusTag(l)
+		if !l.IsPage() {
+			fmt.Printf("%s%s  %s\n", l.ID, status, l.Summary)
+			continue
 		}
-
-		// Mode 3: Summary mode (one-liners) for specific concepts
-		if flagContextSummary {
-			// Get concept summaries for header
-			concepts, _ := database.ListConcepts(flagProject, false)
-			conceptMap := make(map[string]string)
-			for _, c := range concepts {
-				conceptMap[c.Name] = c.Summary
-			}
-			printLearningSummaries(learnings, flagContextConcept, conceptMap)
-			return nil
+		fmt.Printf("%s%s  %s\n", l.ID, status, l.Title)
+		fmt.Printf("  %s\n", l.Summary)
+		if l.Detail != "" {
+			fmt.Printf("  %s\n", l.Detail)
 		}
-
-		// Mode 4: Full output
-		printLearnings(learnings)
-		return nil
-	},
+		fmt.Printf("  %s\n", l.Path)
+	}
 }
 
 var onboardCmd = &cobra.Command{
@@ -2084,7 +4168,7 @@ Example:
 	RunE: func(cmd *cobra.Command, args []string) error {
 		database, err := openDB()
 		if err != nil {
-			printCompactContent(nil)
+			printCompactContent(nil, nil, nil)
 			return nil
 		}
 		defer func() { _ = database.Close() }()
@@ -2101,7 +4185,11 @@ Example:
 			}
 		}
 
-		printCompactContent(stats)
+		// Learnings that mislead agents are grooming candidates too
+		misleading, _ := database.MisleadingLearnings(flagProject, 10)
+		needsReview, _ := database.GetLearningsNeedingReview(flagProject)
+
+		printCompactContent(stats, misleading, needsReview)
 		return nil
 	},
 }
@@ -2219,64 +4307,482 @@ Examples:
 	},
 }
 
-func formatSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+var tuiCmd = &cobra.Command{
+	Use:     "tui",
+	Aliases: []string{"ui"},
+	Short:   "Launch interactive terminal UI",
+	Long: `Launch an interactive terminal UI for managing tasks.
+
+Navigation:
+  j/k or arrows    Move cursor up/down
+  g/G or home/end  Jump to first/last item
+  enter or l       View task details
+  esc or h         Go back to list
+
+Actions:
+  s   Start task (open -> in_progress)
+  d   Mark done (in_progress -> done)
+  o   Reopen task (any status -> open)
+  L   Log progress (prompts for message)
+  c   Cancel task (prompts for optional reason)
+  n   Create new task (inherits project from selected item)
+  D   Delete task
+  a   Add dependency (prompts for blocker ID)
+  r   Refresh task list
+
+Filtering:
+  /       Search by title/ID/description
+  p       Filter by project
+  1-7     Toggle status: 1=draft 2=open 3=in_progress 4=blocked 5=reviewing 6=done 7=canceled
+  0       Show all statuses
+  esc     Clear filters, or quit if none set
+
+Press q to quit.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		// Hook output would draw over the UI; rejections still show as errors
+		dir, err := defaultHooksDir()
+		if err != nil {
+			return err
+		}
+		return tui.Run(database.WithHooks(hooks.New(hooks.Config{Dir: dir, Output: io.Discard})))
+	},
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the agent orchestrator daemon",
+	Long: `Run the orchestrator daemon described in docs/agent-orchestrator-design.md.
+
+Agents register over a Unix socket, poll their inbox for assignments, and
+report progress and results. Messages are newline-delimited JSON:
+
+  {"type":"REGISTER","agent_id":"k3x9a2"}
+  {"type":"HEARTBEAT","agent_id":"k3x9a2","status":"working","task_id":"ts-a1b2c3"}
+  {"type":"POLL","agent_id":"k3x9a2"}
+  {"type":"ASSIGN","agent_id":"k3x9a2","task_id":"ts-a1b2c3","role":"implementer"}
+  {"type":"STATUS","agent_id":"k3x9a2","status":"blocked","task_id":"ts-a1b2c3","note":"..."}
+  {"type":"RESULT","agent_id":"k3x9a2","task_id":"ts-a1b2c3","summary_ref":"..."}
+  {"type":"DEREGISTER","agent_id":"k3x9a2","reason":"done for the day"}
+
+Assigned tasks are claimed with a lease (see 'prog claim') that heartbeats
+renew. When an agent polls an empty inbox, it first steals a queued task from
+the back of the busiest agent's inbox; failing that, the daemon claims the
+best ready task in scope (see 'prog next'). The daemon also rebalances idle
+agents periodically. Only tasks whose dependencies are resolved are stolen,
+and each move is logged on the task. RESULT moves the task to reviewing.
+
+An agent that misses heartbeats for --heartbeat-ttl is removed. Its queued
+tasks return to open. Its current task returns to open if it reported no
+progress; otherwise the task is marked blocked for a human to look at, unless
+--auto-requeue is set.
+
+Agent pool and inboxes live in memory; assignments are stored in the prog
+database so a restarted daemon picks them back up.
+
+Examples:
+  prog daemon
+  prog daemon -p myproject --heartbeat-ttl 2m
+  prog daemon --socket /tmp/prog.sock --auto-requeue`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		socket := flagDaemonSocket
+		if socket == "" {
+			if socket, err = defaultSocketPath(); err != nil {
+				return err
+			}
+		}
+		ln, err := listenUnix(socket)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(socket) }()
+
+		d := orchestrator.New(database, orchestrator.Config{
+			HeartbeatTTL:   flagDaemonTTL,
+			AutoRequeue:    flagAutoRequeue,
+			StealThreshold: flagStealThreshold,
+			Project:        flagProject,
+			Labels:         flagFilterLabels,
+			Logf:           logStderr,
+		})
+		if err := d.Restore(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		deliverWebhooks(ctx, database)
+
+		fmt.Printf("prog daemon listening on %s\n", socket)
+		return d.Serve(ctx, ln)
+	},
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the HTTP/JSON API",
+	Long: `Serve items, dependencies, logs, labels, projects, concepts and learnings
+as a versioned REST/JSON API, for dashboards and scripts that would otherwise
+parse CLI output.
+
+Routes live under /v1 and are described by the OpenAPI document at
+/v1/openapi.json. Send an X-Prog-Actor header to attribute changes to an
+actor; otherwise they are recorded as the actor running the server.
+
+The server listens on localhost TCP by default, or on a Unix socket with
+--socket. It has no authentication, so don't expose it beyond your machine.
+Requests that change anything must be sent with Content-Type
+application/json, and TCP requests must be addressed to localhost,
+127.0.0.1 or [::1], so web pages open in a browser can't use it.
+
+Examples:
+  prog serve
+  prog serve --addr 127.0.0.1:8080
+  prog serve --socket /tmp/prog-api.sock
+  curl -s localhost:7373/v1/ready?project=myproject`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		var ln net.Listener
+		addr := flagServeAddr
+		if flagServeSocket != "" {
+			if ln, err = listenUnix(flagServeSocket); err != nil {
+				return err
+			}
+			defer func() { _ = os.Remove(flagServeSocket) }()
+			addr = flagServeSocket
+		} else if ln, err = net.Listen("tcp", addr); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		deliverWebhooks(ctx, database)
+
+		fmt.Printf("prog API listening on %s\n", addr)
+		return server.New(database).Serve(ctx, ln)
+	},
+}
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Serve prog to agents over the Model Context Protocol",
+	Long: `Run a Model Context Protocol (MCP) server on stdin/stdout, so agent
+clients can use prog through tool calls instead of shelling out.
+
+Tools: ready, show, start, log, check, done, learn and context, each with a
+JSON schema for its arguments. start claims the task with a lease, as 'prog
+claim' does, which each log entry renews. Resources: prog://status/<project>, the project
+status report as JSON.
+
+Configure your MCP client to launch it, with -p to set the default project:
+  {"command": "prog", "args": ["mcp", "-p", "myproject"]}
+
+Changes are recorded as the actor from --as, $PROG_ACTOR or $USER.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		// stdout carries the protocol, so nothing else may be printed to it
+		srv := mcp.New(database, mcp.Config{Project: flagProject, Version: version})
+		return srv.Serve(cmd.Context(), os.Stdin, os.Stdout)
+	},
+}
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "List or manage outgoing webhooks",
+	Long: `List a project's webhook subscriptions, with how many deliveries are
+waiting to be sent and how many gave up.
+
+A webhook POSTs a JSON payload to its URL whenever a task in the project moves
+to one of its events (by default reviewing, done or blocked). The payload
+carries the event, the transition, the actor and the full item:
+
+  {"event":"done","transition":{"from":"in_progress","to":"done"},
+   "item":{"id":"ts-a1b2c3","title":"...",...},"actor":"agent-x",
+   "timestamp":"2025-01-01T12:00:00Z"}
+
+Each request has an X-Prog-Signature header, "sha256=" followed by the hex
+HMAC-SHA256 of the body keyed with the webhook's secret; X-Prog-Event names
+the event and X-Prog-Delivery identifies the delivery across retries.
+
+Deliveries are queued in the database with the change that triggers them and
+sent by 'prog serve', 'prog daemon' or 'prog webhooks deliver'. Failures are
+retried with exponential backoff, from 30s up to an hour, 8 times in all.
+
+Examples:
+  prog webhooks -p myproject
+  prog webhooks add https://ci.example.com/prog -p myproject --event reviewing
+  prog webhooks rm wh-a1b2c3
+  prog webhooks deliver --follow`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		webhooks, err := database.ListWebhooks(flagProject)
+		if err != nil {
+			return err
+		}
+		if len(webhooks) == 0 {
+			fmt.Println("No webhooks")
+			return nil
+		}
+
+		fmt.Printf("%-10s  %-14s  %-26s  %-9s  %s\n", "ID", "PROJECT", "EVENTS", "QUEUED", "URL")
+		for _, w := range webhooks {
+			queued := strconv.Itoa(w.Pending)
+			if w.Failed > 0 {
+				queued += fmt.Sprintf(" (%d failed)", w.Failed)
+			}
+			fmt.Printf("%-10s  %-14s  %-26s  %-9s  %s\n", w.ID, w.Project, strings.Join(w.Events, ","), queued, w.URL)
+		}
+		return nil
+	},
+}
+
+var webhooksAddCmd = &cobra.Command{
+	Use:   "add <url>",
+	Short: "Subscribe a URL to task status transitions",
+	Long: `Subscribe a URL to a project's task status transitions.
+
+--event picks the statuses that trigger a delivery (repeatable; default:
+reviewing, done, blocked). Without --secret a random signing secret is
+generated and printed; keep it to verify the X-Prog-Signature header.
+
+Examples:
+  prog webhooks add https://chat.example.com/hooks/prog -p myproject
+  prog webhooks add http://localhost:8080/ci -p myproject --event reviewing --secret s3cret`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagProject == "" {
+			return fmt.Errorf("project is required (-p)")
+		}
+
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		w := &model.Webhook{
+			Project: flagProject,
+			URL:     args[0],
+			Secret:  flagWebhookSecret,
+			Events:  flagWebhookEvents,
+		}
+		if err := database.CreateWebhook(w); err != nil {
+			return err
+		}
+		fmt.Printf("Created webhook %s for %s in %s\n", w.ID, strings.Join(w.Events, ", "), w.Project)
+		if flagWebhookSecret == "" {
+			fmt.Printf("Signing secret: %s\n", w.Secret)
+		}
+		return nil
+	},
+}
+
+var webhooksRmCmd = &cobra.Command{
+	Use:   "rm <id>",
+	Short: "Delete a webhook and its queued deliveries",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		if err := database.DeleteWebhook(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted webhook %s\n", args[0])
+		return nil
+	},
+}
+
+var webhooksDeliverCmd = &cobra.Command{
+	Use:   "deliver",
+	Short: "Send queued webhook deliveries",
+	Long: `Send every webhook delivery that is due, then exit. With --follow, keep
+sending new deliveries and retries until interrupted.
+
+'prog serve' and 'prog daemon' deliver webhooks in the background, so this is
+only needed when neither is running.
+
+Examples:
+  prog webhooks deliver
+  prog webhooks deliver --follow`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		d := webhook.New(database, webhook.Config{Logf: logStderr})
+		if flagWebhookFollow {
+			d.Run(ctx, webhookInterval)
+			return nil
+		}
+		res, err := d.DeliverDue(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Delivered %d, retrying %d, failed %d\n", res.Delivered, res.Retrying, res.Failed)
+		return nil
+	},
+}
+
+// webhookInterval is how often long-running commands send due webhooks.
+const webhookInterval = 5 * time.Second
+
+// deliverWebhooks sends queued webhooks in the background until ctx is done.
+func deliverWebhooks(ctx context.Context, database *db.DB) {
+	go webhook.New(database, webhook.Config{Logf: logStderr}).Run(ctx, webhookInterval)
 }
 
-var tuiCmd = &cobra.Command{
-	Use:     "tui",
-	Aliases: []string{"ui"},
-	Short:   "Launch interactive terminal UI",
-	Long: `Launch an interactive terminal UI for managing tasks.
+// logStderr logs a timestamped line to stderr for long-running commands.
+func logStderr(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format(time.TimeOnly), fmt.Sprintf(format, args...))
+}
 
-Navigation:
-  j/k or arrows    Move cursor up/down
-  g/G or home/end  Jump to first/last item
-  enter or l       View task details
-  esc or h         Go back to list
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "List lifecycle hooks and which are installed",
+	Long: `List the lifecycle hooks prog runs and which are installed.
 
-Actions:
-  s   Start task (open -> in_progress)
-  d   Mark done (in_progress -> done)
-  o   Reopen task (any status -> open)
-  L   Log progress (prompts for message)
-  c   Cancel task (prompts for optional reason)
-  n   Create new task (inherits project from selected item)
-  D   Delete task
-  a   Add dependency (prompts for blocker ID)
-  r   Refresh task list
+Hooks are executables in ~/.prog/hooks (next to the database), named for when
+they run, like git hooks. A hook in ~/.prog/hooks/<project>/ takes precedence
+over one of the same name for that project's tasks.
 
-Filtering:
-  /       Search by title/ID/description
-  p       Filter by project
-  1-7     Toggle status: 1=draft 2=open 3=in_progress 4=blocked 5=reviewing 6=done 7=canceled
-  0       Show all statuses
-  esc     Clear filters, or quit if none set
+  pre-<event>   Runs before the change; a non-zero exit or timeout rejects it
+  post-<event>  Runs after the change is saved; a failure is reported but
+                the change stands
 
-Press q to quit.`,
+Events are start, review, done, block, cancel, open and draft, for a task
+moving to that status (claims run the start hooks), and learn for a new
+learning. Each hook receives the item or learning as JSON on stdin, with
+PROG_HOOK, PROG_PROJECT, PROG_ACTOR, PROG_ITEM, PROG_FROM and PROG_TO set in its
+environment. Its output goes to stderr.
+
+Hooks are killed after 5 minutes. A file next to a hook named for it with a
+.timeout suffix, such as pre-done.timeout holding "20m", gives it longer.
+
+Example ~/.prog/hooks/myproject/pre-done, which keeps tasks from being marked
+done while the tests fail:
+
+  #!/bin/sh
+  cd ~/src/myproject && go test ./...`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		database, err := openDB()
+		dir, err := defaultHooksDir()
 		if err != nil {
 			return err
 		}
-		defer func() { _ = database.Close() }()
+		runner := hooks.New(hooks.Config{Dir: dir})
 
-		return tui.Run(database)
+		fmt.Printf("Hooks directory: %s\n\n", dir)
+		for _, name := range hooks.Names {
+			path := runner.Path(name, flagProject)
+			if path == "" {
+				fmt.Printf("%-12s  -\n", name)
+				continue
+			}
+			timeout, err := runner.Timeout(path)
+			if err != nil {
+				fmt.Printf("%-12s  %s (%v)\n", name, path, err)
+				continue
+			}
+			fmt.Printf("%-12s  %s (timeout %s)\n", name, path, timeout)
+		}
+		return nil
 	},
 }
 
+// defaultHooksDir places the hooks directory next to the database.
+func defaultHooksDir() (string, error) {
+	path, err := db.DefaultPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "hooks"), nil
+}
+
+// defaultSocketPath places the daemon socket next to the database.
+func defaultSocketPath() (string, error) {
+	path, err := db.DefaultPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "daemon.sock"), nil
+}
+
+// listenUnix listens on a Unix socket, replacing a stale socket file left by a
+// daemon that exited uncleanly but refusing to steal one that is still served.
+func listenUnix(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("another prog process is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return ln, nil
+}
+
 func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVarP(&flagProject, "project", "p", "", "Project scope")
+	rootCmd.PersistentFlags().StringVar(&flagActor, "as", "", "Actor to record changes as (default: $PROG_ACTOR, then $USER)")
 
 	// add flags
 	addCmd.Flags().BoolVarP(&flagEpic, "epic", "e", false, "Create an epic instead of a task")
@@ -2285,7 +4791,8 @@ func init() {
 	addCmd.Flags().StringVar(&flagParent, "parent", "", "Parent epic ID")
 	addCmd.Flags().StringVar(&flagBlocks, "blocks", "", "ID of task this will block")
 	addCmd.Flags().StringArrayVarP(&flagAddLabels, "label", "l", nil, "Label to attach (can be repeated)")
-	addCmd.Flags().StringVar(&flagDoD, "dod", "", "Definition of done (completion criteria)")
+	addCmd.Flags().StringArrayVar(&flagAddAreas, "area", nil, "Code area the task touches (path, glob or name; can be repeated)")
+	addCmd.Flags().StringVar(&flagDoD, "dod", "", "Definition of done, criteria separated by semicolons")
 	addCmd.Flags().StringVarP(&flagDesc, "desc", "d", "", "Description body")
 
 	// list flags
@@ -2297,6 +4804,8 @@ func init() {
 	listCmd.Flags().BoolVar(&flagHasBlockers, "has-blockers", false, "Show only items with unresolved blockers")
 	listCmd.Flags().BoolVar(&flagNoBlockers, "no-blockers", false, "Show only items with no blockers")
 	listCmd.Flags().StringArrayVarP(&flagFilterLabels, "label", "l", nil, "Filter by label (can be repeated, AND logic)")
+	listCmd.Flags().StringVar(&flagAssignee, "assignee", "", "Filter by the actor working on the item")
+	listCmd.Flags().StringVar(&flagCreatedBy, "created-by", "", "Filter by the actor who created the item")
 	listCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
 
 	// onboard flags
@@ -2304,15 +4813,75 @@ func init() {
 
 	// edit flags
 	editCmd.Flags().StringVar(&flagEditTitle, "title", "", "New title for the task")
-	editCmd.Flags().StringVar(&flagDoD, "dod", "", "Definition of done (use \"\" to clear)")
+	editCmd.Flags().StringVar(&flagDoD, "dod", "", "Definition of done, criteria separated by semicolons (use \"\" to clear)")
+
+	// done flags
+	doneCmd.Flags().BoolVar(&flagForce, "force", false, "Complete even if definition of done criteria are unchecked or review is not approved")
+
+	// dod flags
+	dodCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
+	dodAddCmd.Flags().StringVar(&flagDoDCommand, "cmd", "", "Shell command that verifies the criterion")
+	dodCheckCmd.Flags().StringVar(&flagDoDNote, "note", "", "Evidence that the criterion is met")
+	dodCmd.AddCommand(dodAddCmd)
+	dodCmd.AddCommand(dodCheckCmd)
+	dodCmd.AddCommand(dodUncheckCmd)
+	dodCmd.AddCommand(dodRmCmd)
+
+	// verify command flags
+	verifyCmd.Flags().StringVar(&flagVerifyDir, "dir", "", "Workspace to run the commands in (default: current directory)")
+	verifyCmd.Flags().DurationVar(&flagVerifyTimeout, "timeout", verify.DefaultTimeout, "Kill a command that runs longer than this")
+	verifyCmd.Flags().BoolVarP(&flagVerifyVerbose, "verbose", "v", false, "Stream command output as it runs")
+
+	// review command flags
+	reviewCmd.Flags().StringArrayVar(&flagReviewers, "reviewer", nil, "Ask someone to review the task (can be repeated)")
+	reviewApproveCmd.Flags().StringVar(&flagReviewNote, "note", "", "What you checked")
+	reviewRequestChangesCmd.Flags().StringVar(&flagReviewNote, "note", "", "What needs to change (required)")
+	reviewQueueCmd.Flags().StringVar(&flagReviewFor, "for", "", "Only show what is waiting on this person")
+	reviewQueueCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
+	reviewCmd.AddCommand(reviewApproveCmd)
+	reviewCmd.AddCommand(reviewRequestChangesCmd)
+	reviewCmd.AddCommand(reviewAssignCmd)
+	reviewCmd.AddCommand(reviewUnassignCmd)
+	reviewCmd.AddCommand(reviewQueueCmd)
 
 	// show flags
 	showCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
+	showCmd.Flags().StringVar(&flagLogsBy, "by", "", "Only show logs written by this actor")
 
 	// ready flags
 	readyCmd.Flags().StringArrayVarP(&flagFilterLabels, "label", "l", nil, "Filter by label (can be repeated, AND logic)")
+	readyCmd.Flags().BoolVar(&flagNoConflicts, "no-conflicts", false, "Hide tasks whose areas overlap in-progress work")
 	readyCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
 
+	// history flags
+	historyCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
+	historyCmd.Flags().StringVar(&flagLogsBy, "by", "", "Only show changes made by this actor")
+
+	// watch flags
+	watchCmd.Flags().BoolVar(&flagJSON, "json", false, "Output newline-delimited JSON")
+	watchCmd.Flags().Int64Var(&flagWatchSince, "since", -1, "Resume after this sequence number (default: only new changes)")
+
+	// undo flags
+	undoCmd.Flags().IntVar(&flagUndoSteps, "steps", 1, "Number of changes to undo")
+	undoCmd.Flags().StringVar(&flagLogsBy, "by", "", "Undo this actor's changes instead of your own")
+
+	// trash flags
+	trashCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
+	trashPurgeCmd.Flags().StringVar(&flagOlderThan, "older-than", "0", "Only purge items deleted at least this long ago (e.g. 30d, 12h)")
+	trashCmd.AddCommand(trashPurgeCmd)
+
+	// graph flags
+	graphCmd.Flags().BoolVar(&flagGraphCheck, "check", false, "Check for dependency cycles and edges to deleted items")
+	graphCmd.Flags().StringVar(&flagGraphFormat, "format", "text", "Output format (text, dot, mermaid, json)")
+	graphCmd.Flags().StringVar(&flagGraphEpic, "epic", "", "Only include this epic's subtree")
+
+	// plan flags
+	planCmd.Flags().BoolVar(&flagPlanWaves, "waves", false, "List the tasks in each wave")
+	planCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
+
+	// conflicts flags
+	conflictsCmd.Flags().BoolVar(&flagJSON, "json", false, "Output as JSON")
+
 	// status flags
 	statusCmd.Flags().BoolVar(&flagStatusAll, "all", false, "Show all ready tasks (default: limit to 10)")
 	statusCmd.Flags().StringArrayVarP(&flagFilterLabels, "label", "l", nil, "Filter by label (can be repeated, AND logic)")
@@ -2326,6 +4895,8 @@ func init() {
 	learnCmd.AddCommand(learnEditCmd)
 	learnCmd.AddCommand(learnStaleCmd)
 	learnCmd.AddCommand(learnRmCmd)
+	learnCmd.AddCommand(learnAuditCmd)
+	learnCmd.AddCommand(learnReviewedCmd)
 
 	// learn edit flags
 	learnEditCmd.Flags().StringVar(&flagLearnEditSummary, "summary", "", "New summary for the learning")
@@ -2334,16 +4905,30 @@ func init() {
 	// learn stale flags
 	learnStaleCmd.Flags().StringVar(&flagLearnStaleReason, "reason", "", "Reason for marking as stale")
 
+	// learn audit flags
+	learnAuditCmd.Flags().Float64Var(&flagLearnAuditThreshold, "threshold", audit.DefaultThreshold, "Fraction of a file that must change (0-1)")
+	learnAuditCmd.Flags().BoolVar(&flagLearnAuditDryRun, "dry-run", false, "Report learnings without flagging them")
+
 	// concepts flags
 	conceptsCmd.Flags().BoolVar(&flagConceptsRecent, "recent", false, "Sort by last updated instead of learning count")
 	conceptsCmd.Flags().StringVar(&flagConceptsRelated, "related", "", "Suggest concepts related to a task")
 	conceptsCmd.Flags().StringVar(&flagConceptsSummary, "summary", "", "Set concept summary (requires concept name as argument)")
 	conceptsCmd.Flags().StringVar(&flagConceptsRename, "rename", "", "Rename concept (requires concept name as argument)")
 	conceptsCmd.Flags().BoolVar(&flagConceptsStats, "stats", false, "Show statistics (count and oldest learning age)")
+	conceptsCmd.Flags().StringArrayVar(&flagConceptsSynonym, "synonym", nil, "Add a synonym that widens searches (can be repeated; requires concept name as argument)")
+	conceptsCmd.Flags().StringArrayVar(&flagConceptsUnsynonym, "remove-synonym", nil, "Remove a synonym (can be repeated; requires concept name as argument)")
 
 	// labels flags
 	labelsAddCmd.Flags().StringVar(&flagLabelsColor, "color", "", "Label color (hex, e.g. #ff0000)")
 
+	// webhooks flags
+	webhooksAddCmd.Flags().StringSliceVar(&flagWebhookEvents, "event", nil, "Status that triggers a delivery (repeatable; default: reviewing, done, blocked)")
+	webhooksAddCmd.Flags().StringVar(&flagWebhookSecret, "secret", "", "Signing secret (default: generated)")
+	webhooksDeliverCmd.Flags().BoolVar(&flagWebhookFollow, "follow", false, "Keep delivering until interrupted")
+	webhooksCmd.AddCommand(webhooksAddCmd)
+	webhooksCmd.AddCommand(webhooksRmCmd)
+	webhooksCmd.AddCommand(webhooksDeliverCmd)
+
 	// labels subcommands
 	labelsCmd.AddCommand(labelsAddCmd)
 	labelsCmd.AddCommand(labelsRmCmd)
@@ -2351,11 +4936,54 @@ func init() {
 
 	// context flags
 	contextCmd.Flags().StringArrayVarP(&flagContextConcept, "concept", "c", nil, "Concept to retrieve learnings for (can be repeated)")
-	contextCmd.Flags().StringVarP(&flagContextQuery, "query", "q", "", "Full-text search query")
+	contextCmd.Flags().StringVarP(&flagContextQuery, "query", "q", "", "Search query (plain words)")
 	contextCmd.Flags().BoolVar(&flagContextStale, "include-stale", false, "Include stale learnings in results")
 	contextCmd.Flags().BoolVar(&flagContextSummary, "summary", false, "Show one-liner per learning (no detail)")
 	contextCmd.Flags().StringVar(&flagContextID, "id", "", "Load specific learning by ID")
 	contextCmd.Flags().BoolVar(&flagContextJSON, "json", false, "Output as JSON for machine processing")
+	contextCmd.Flags().StringArrayVarP(&flagContextFile, "file", "f", nil, "File or directory to retrieve learnings about (can be repeated)")
+	contextCmd.Flags().BoolVar(&flagContextStdin, "stdin", false, "Read files from stdin, one per line (e.g. from 'git diff --name-only')")
+
+	// context subcommands
+	contextSearchCmd.Flags().BoolVar(&flagContextStale, "include-stale", false, "Include stale learnings in results")
+	contextSearchCmd.Flags().BoolVar(&flagContextJSON, "json", false, "Output as JSON for machine processing")
+	contextCmd.AddCommand(contextSearchCmd)
+	contextCmd.AddCommand(contextOpenCmd)
+	contextCmd.AddCommand(contextUpsertCmd)
+	contextCmd.AddCommand(contextReindexCmd)
+	contextCmd.AddCommand(contextFeedbackCmd)
+
+	// context feedback flags
+	contextFeedbackCmd.Flags().BoolVar(&flagFeedbackRelevant, "relevant", false, "The learning applied to the task")
+	contextFeedbackCmd.Flags().BoolVar(&flagFeedbackNotRelevant, "not-relevant", false, "The learning didn't apply to the task")
+	contextFeedbackCmd.Flags().BoolVar(&flagFeedbackUnexpected, "unexpected", false, "The learning didn't look relevant before you read it")
+	contextFeedbackCmd.Flags().StringVar(&flagFeedbackReason, "reason", "", "Why it didn't apply (e.g. stale info, wrong subsystem)")
+	contextFeedbackCmd.Flags().StringVar(&flagFeedbackTask, "task", "", "Task it was retrieved for (default: the in-progress task)")
+	contextFeedbackCmd.Flags().StringVar(&flagFeedbackContext, "task-context", "", "Task type or scope (e.g. \"bugfix, db\")")
+	contextFeedbackCmd.Flags().IntVar(&flagFeedbackLimit, "limit", 20, "Learnings to report (0 for all)")
+	contextFeedbackCmd.Flags().BoolVar(&flagJSON, "json", false, "Output the report as JSON")
+
+	// claim flags
+	claimCmd.Flags().DurationVar(&flagClaimTTL, "ttl", db.DefaultLeaseTTL, "Lease duration before the claim must be renewed")
+	claimCmd.Flags().BoolVar(&flagClaimRenew, "renew", false, "Extend an existing lease instead of claiming")
+	claimCmd.Flags().BoolVar(&flagClaimRelease, "release", false, "Release the lease and return the task to open")
+
+	// next flags
+	nextCmd.Flags().StringArrayVarP(&flagFilterLabels, "label", "l", nil, "Filter by label (can be repeated, AND logic)")
+	nextCmd.Flags().BoolVar(&flagNextClaim, "claim", false, "Atomically claim the picked task")
+	nextCmd.Flags().BoolVar(&flagNoConflicts, "no-conflicts", false, "Skip tasks whose areas overlap in-progress work")
+	nextCmd.Flags().DurationVar(&flagClaimTTL, "ttl", db.DefaultLeaseTTL, "Lease duration before the claim must be renewed")
+
+	// daemon flags
+	daemonCmd.Flags().StringVar(&flagDaemonSocket, "socket", "", "Unix socket path (default: daemon.sock next to the database)")
+	daemonCmd.Flags().DurationVar(&flagDaemonTTL, "heartbeat-ttl", orchestrator.DefaultHeartbeatTTL, "Remove agents that miss heartbeats for this long")
+	daemonCmd.Flags().BoolVar(&flagAutoRequeue, "auto-requeue", false, "Requeue a lost agent's task even if it reported progress")
+	daemonCmd.Flags().IntVar(&flagStealThreshold, "steal-threshold", orchestrator.DefaultStealThreshold, "Minimum tasks an agent must hold before idle agents steal from its inbox")
+	daemonCmd.Flags().StringArrayVarP(&flagFilterLabels, "label", "l", nil, "Only auto-assign ready tasks with this label (can be repeated, AND logic)")
+
+	// serve flags
+	serveCmd.Flags().StringVar(&flagServeAddr, "addr", "127.0.0.1:7373", "TCP address to listen on")
+	serveCmd.Flags().StringVar(&flagServeSocket, "socket", "", "Listen on this Unix socket instead of TCP")
 
 	// backup flags
 	backupCmd.Flags().BoolVarP(&flagBackupQuiet, "quiet", "q", false, "Silent backup (no output)")
@@ -2366,6 +4994,8 @@ func init() {
 	rootCmd.AddCommand(readyCmd)
 	rootCmd.AddCommand(showCmd)
 	rootCmd.AddCommand(startCmd)
+	rootCmd.AddCommand(claimCmd)
+	rootCmd.AddCommand(nextCmd)
 	rootCmd.AddCommand(doneCmd)
 	rootCmd.AddCommand(reviewCmd)
 	rootCmd.AddCommand(cancelCmd)
@@ -2373,17 +5003,28 @@ func init() {
 	rootCmd.AddCommand(openCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(logCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(trashCmd)
+	rootCmd.AddCommand(restoreItemCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(projectsCmd)
 	rootCmd.AddCommand(graphCmd)
+	rootCmd.AddCommand(planCmd)
 	rootCmd.AddCommand(appendCmd)
 	rootCmd.AddCommand(descCmd)
 	rootCmd.AddCommand(editCmd)
+	rootCmd.AddCommand(dodCmd)
+	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(parentCmd)
 	rootCmd.AddCommand(projectCmd)
 	rootCmd.AddCommand(blocksCmd)
 	rootCmd.AddCommand(labelCmd)
 	rootCmd.AddCommand(unlabelCmd)
+	rootCmd.AddCommand(areaCmd)
+	rootCmd.AddCommand(unareaCmd)
+	rootCmd.AddCommand(conflictsCmd)
 	rootCmd.AddCommand(learnCmd)
 	rootCmd.AddCommand(conceptsCmd)
 	rootCmd.AddCommand(labelsCmd)
@@ -2392,6 +5033,11 @@ func init() {
 	rootCmd.AddCommand(compactCmd)
 	rootCmd.AddCommand(onboardCmd)
 	rootCmd.AddCommand(tuiCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(mcpCmd)
+	rootCmd.AddCommand(webhooksCmd)
+	rootCmd.AddCommand(hooksCmd)
 	rootCmd.AddCommand(backupCmd)
 	rootCmd.AddCommand(backupsCmd)
 	rootCmd.AddCommand(restoreCmd)
@@ -2418,6 +5064,9 @@ func printItemsTable(items []model.Item) {
 		if len(item.Labels) > 0 {
 			title = formatLabels(item.Labels) + " " + title
 		}
+		if item.Assignee != "" {
+			title += " @" + item.Assignee
+		}
 		fmt.Printf("%-12s %-12s %-4d %s\n", item.ID, item.Status, item.Priority, title)
 	}
 }
@@ -2454,7 +5103,7 @@ func formatLabels(labels []string) string {
 	return strings.Join(parts, " ")
 }
 
-func printItemDetail(item *model.Item, logs []model.Log, deps []string, concepts []model.Concept) {
+func printItemDetail(item *model.Item, criteria []model.Criterion, reviews []model.Review, lease *model.Lease, logs []model.Log, deps []string, concepts []model.Concept) {
 	fmt.Printf("ID:          %s\n", item.ID)
 	fmt.Printf("Type:        %s\n", item.Type)
 	fmt.Printf("Project:     %s\n", item.Project)
@@ -2467,13 +5116,31 @@ func printItemDetail(item *model.Item, logs []model.Log, deps []string, concepts
 	if len(item.Labels) > 0 {
 		fmt.Printf("Labels:      %s\n", strings.Join(item.Labels, ", "))
 	}
+	if len(item.Areas) > 0 {
+		fmt.Printf("Areas:       %s\n", strings.Join(item.Areas, ", "))
+	}
+	if item.CreatedBy != "" {
+		fmt.Printf("Created by:  %s\n", item.CreatedBy)
+	}
+	if item.Assignee != "" {
+		fmt.Printf("Assignee:    %s\n", item.Assignee)
+	}
+	if lease != nil {
+		fmt.Printf("Claimed by:  %s (lease expires %s)\n", lease.Actor, formatTimeUntil(lease.ExpiresAt))
+	}
 
 	if item.Description != "" {
 		fmt.Printf("\nDescription:\n%s\n", item.Description)
 	}
 
-	if item.DefinitionOfDone != nil && *item.DefinitionOfDone != "" {
-		fmt.Printf("\nDefinition of Done:\n%s\n", *item.DefinitionOfDone)
+	if len(criteria) > 0 {
+		fmt.Printf("\nDefinition of Done (%d/%d):\n", countChecked(criteria), len(criteria))
+		printCriteria(criteria)
+	}
+
+	if len(reviews) > 0 {
+		fmt.Printf("\nReviewers:\n")
+		printReviews(reviews)
 	}
 
 	if len(deps) > 0 {
@@ -2486,7 +5153,11 @@ func printItemDetail(item *model.Item, logs []model.Log, deps []string, concepts
 	if len(logs) > 0 {
 		fmt.Printf("\nLogs:\n")
 		for _, log := range logs {
-			fmt.Printf("  [%s] %s\n", log.CreatedAt.Format("2006-01-02 15:04"), log.Message)
+			if log.Actor != "" {
+				fmt.Printf("  [%s] %s: %s\n", log.CreatedAt.Format("2006-01-02 15:04"), log.Actor, log.Message)
+			} else {
+				fmt.Printf("  [%s] %s\n", log.CreatedAt.Format("2006-01-02 15:04"), log.Message)
+			}
 		}
 	}
 
@@ -2505,6 +5176,58 @@ func printItemDetail(item *model.Item, logs []model.Log, deps []string, concepts
 	}
 }
 
+// printCriteria prints definition of done criteria as a checklist, with the
+// evidence for checked ones and the command that verifies each.
+func printCriteria(criteria []model.Criterion) {
+	for _, c := range criteria {
+		mark := " "
+		if c.Checked {
+			mark = "x"
+		}
+		fmt.Printf("  [%s] %d. %s\n", mark, c.Position, c.Text)
+		if c.Command != "" {
+			fmt.Printf("         $ %s\n", c.Command)
+		}
+		if v := c.Verification; v != nil {
+			result := "passed"
+			if !v.Passed() {
+				result = fmt.Sprintf("FAILED with exit code %d", v.ExitCode)
+			}
+			fmt.Printf("         %s in %s (%s, %s)\n", result, formatRunDuration(v.Duration()), v.RanBy, formatTimeAgo(v.RanAt))
+			if !v.Passed() {
+				printOutputTail(v.Output, 5, "         ")
+			}
+			if c.Note == v.Note() {
+				continue // Checked off by this run
+			}
+		}
+		if c.Checked {
+			by := c.CheckedBy
+			if by == "" {
+				by = "-"
+			}
+			if c.CheckedAt != nil {
+				by += ", " + formatTimeAgo(*c.CheckedAt)
+			}
+			if c.Note != "" {
+				fmt.Printf("         %s (%s)\n", c.Note, by)
+			} else {
+				fmt.Printf("         (%s)\n", by)
+			}
+		}
+	}
+}
+
+func countChecked(criteria []model.Criterion) int {
+	n := 0
+	for _, c := range criteria {
+		if c.Checked {
+			n++
+		}
+	}
+	return n
+}
+
 func printStatusReport(report *db.StatusReport, showAll bool) {
 	project := report.Project
 	if project == "" {
@@ -2615,6 +5338,23 @@ func printConceptsStats(stats []db.ConceptStats) {
 	}
 }
 
+// parseAge parses a duration like time.ParseDuration, also accepting whole
+// days such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q (use e.g. 30d or 12h)", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (use e.g. 30d or 12h)", s)
+	}
+	return d, nil
+}
+
 func formatDurationShort(d time.Duration) string {
 	days := int(d.Hours() / 24)
 	if days > 0 {
@@ -2639,6 +5379,17 @@ func printLabelsTable(labels []model.Label) {
 	}
 }
 
+// learningStatusTag marks a learning that isn't active, for listings.
+func learningStatusTag(l model.Learning) string {
+	switch l.Status {
+	case model.LearningStatusStale:
+		return " [stale]"
+	case model.LearningStatusNeedsReview:
+		return " [needs review]"
+	}
+	return ""
+}
+
 func printLearnings(learnings []model.Learning) {
 	for i, l := range learnings {
 		if i > 0 {
@@ -2646,13 +5397,17 @@ func printLearnings(learnings []model.Learning) {
 		}
 
 		// Header with ID, status, and age
-		status := ""
-		if l.Status == model.LearningStatusStale {
-			status = " [stale]"
+		status := learningStatusTag(l)
+		by := ""
+		if l.Actor != "" {
+			by = " by " + l.Actor
 		}
-		fmt.Printf("## %s%s (%s)\n", l.ID, status, formatTimeAgo(l.CreatedAt))
+		fmt.Printf("## %s%s (%s%s)\n", l.ID, status, formatTimeAgo(l.CreatedAt), by)
 
 		// Summary
+		if l.IsPage() {
+			fmt.Println(l.Title)
+		}
 		fmt.Println(l.Summary)
 
 		// Detail if present
@@ -2670,6 +5425,15 @@ func printLearnings(learnings []model.Learning) {
 		if l.TaskID != nil {
 			fmt.Printf("Task: %s\n", *l.TaskID)
 		}
+		if l.ReviewReason != "" {
+			fmt.Printf("Needs review: %s\n", l.ReviewReason)
+		}
+		if l.IsPage() {
+			if len(l.Provenance) > 0 {
+				fmt.Printf("Provenance: %s\n", strings.Join(l.Provenance, ", "))
+			}
+			fmt.Printf("Page: %s (prog context open %s)\n", l.Path, l.ID)
+		}
 	}
 }
 
@@ -2684,18 +5448,139 @@ type ItemReadyJSON struct {
 
 // ItemShowJSON is the JSON serialization format for show (full detail).
 type ItemShowJSON struct {
-	ID               string    `json:"id"`
-	Title            string    `json:"title"`
-	Type             string    `json:"type"`
-	Status           string    `json:"status"`
-	Priority         int       `json:"priority"`
-	Project          string    `json:"project"`
-	Parent           *string   `json:"parent"`
-	Description      string    `json:"description"`
-	DefinitionOfDone *string   `json:"definition_of_done"`
-	Labels           []string  `json:"labels"`
-	Dependencies     []string  `json:"dependencies"`
-	Logs             []LogJSON `json:"logs"`
+	ID               string            `json:"id"`
+	Title            string            `json:"title"`
+	Type             string            `json:"type"`
+	Status           string            `json:"status"`
+	Priority         int               `json:"priority"`
+	Project          string            `json:"project"`
+	Parent           *string           `json:"parent"`
+	Description      string            `json:"description"`
+	DefinitionOfDone *string           `json:"definition_of_done"`
+	Criteria         []model.Criterion `json:"criteria"`
+	Reviews          []model.Review    `json:"reviews"` // Each reviewer's latest review
+	Labels           []string          `json:"labels"`
+	Areas            []string          `json:"areas"`
+	Dependencies     []string          `json:"dependencies"`
+	Logs             []LogJSON         `json:"logs"`
+	Lease            *LeaseJSON        `json:"lease,omitempty"`
+	CreatedBy        string            `json:"created_by"`
+	Assignee         string            `json:"assignee"`
+}
+
+// LeaseJSON is the JSON serialization format for a task claim.
+type LeaseJSON struct {
+	Actor     string `json:"actor"`
+	ClaimedAt string `json:"claimed_at"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// ConflictsJSON is the JSON serialization format for conflicts.
+type ConflictsJSON struct {
+	InProgress []ConflictJSON `json:"in_progress"`
+	HeldBack   []ConflictJSON `json:"held_back"`
+}
+
+// ConflictJSON is one overlapping pair: the task, the task it overlaps, and
+// the areas that overlap.
+type ConflictJSON struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Area      string `json:"area"`
+	Other     string `json:"other"`
+	OtherArea string `json:"other_area"`
+}
+
+// PlanJSON is the JSON serialization format for plan.
+type PlanJSON struct {
+	Tasks          int                 `json:"tasks"`
+	Waves          [][]PlanTaskJSON    `json:"waves"`
+	CriticalPath   []string            `json:"critical_path"`
+	MaxParallelism int                 `json:"max_parallelism"`
+	External       map[string][]string `json:"external_blockers"`
+}
+
+// PlanTaskJSON is one task in a plan wave.
+type PlanTaskJSON struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Status   string `json:"status"`
+	Priority int    `json:"priority"`
+}
+
+// EventJSON is the JSON serialization format for one history entry.
+type EventJSON struct {
+	Field     string `json:"field"`
+	OldValue  string `json:"old_value"`
+	NewValue  string `json:"new_value"`
+	Actor     string `json:"actor"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ChangeJSON is the JSON serialization format for one change feed entry.
+type ChangeJSON struct {
+	Seq       int64  `json:"seq"`
+	Kind      string `json:"kind"`
+	Action    string `json:"action"`
+	Target    string `json:"target"`
+	Project   string `json:"project"`
+	Actor     string `json:"actor"`
+	OldValue  string `json:"old_value"`
+	NewValue  string `json:"new_value"`
+	CreatedAt string `json:"created_at"`
+}
+
+func changeJSON(c model.Change) ChangeJSON {
+	return ChangeJSON{
+		Seq:       c.Seq,
+		Kind:      c.Kind,
+		Action:    c.Action,
+		Target:    c.Target,
+		Project:   c.Project,
+		Actor:     c.Actor,
+		OldValue:  c.OldValue,
+		NewValue:  c.NewValue,
+		CreatedAt: c.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// GraphJSON is the JSON serialization format for graph --format json.
+type GraphJSON struct {
+	Nodes []GraphNodeJSON `json:"nodes"`
+	Edges []GraphEdgeJSON `json:"edges"`
+}
+
+// GraphNodeJSON is an item in an exported graph.
+type GraphNodeJSON struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	Type     string  `json:"type"`
+	Status   string  `json:"status"`
+	Priority int     `json:"priority"`
+	Parent   *string `json:"parent"`
+}
+
+// GraphEdgeJSON is a dependency in an exported graph: item_id waits on depends_on.
+type GraphEdgeJSON struct {
+	ItemID    string `json:"item_id"`
+	DependsOn string `json:"depends_on"`
+}
+
+// NextJSON is the JSON serialization format for next: the picked task plus
+// its ranking signals, and the lease when it was claimed.
+type NextJSON struct {
+	ID               string     `json:"id"`
+	Title            string     `json:"title"`
+	Status           string     `json:"status"`
+	Priority         int        `json:"priority"`
+	Project          string     `json:"project"`
+	Parent           *string    `json:"parent"`
+	Description      string     `json:"description"`
+	DefinitionOfDone *string    `json:"definition_of_done"`
+	Labels           []string   `json:"labels"`
+	Unblocks         int        `json:"unblocks"`
+	Downstream       int        `json:"downstream"`
+	Lease            *LeaseJSON `json:"lease,omitempty"`
 }
 
 // ItemListJSON is the JSON serialization format for list (show schema minus logs).
@@ -2711,14 +5596,39 @@ type ItemListJSON struct {
 	DefinitionOfDone *string  `json:"definition_of_done"`
 	Labels           []string `json:"labels"`
 	Dependencies     []string `json:"dependencies"`
+	CreatedBy        string   `json:"created_by"`
+	Assignee         string   `json:"assignee"`
+}
+
+// TrashJSON is the JSON serialization format for trash.
+type TrashJSON struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+	Status    string `json:"status"`
+	Project   string `json:"project"`
+	DeletedAt string `json:"deleted_at"`
 }
 
 // LogJSON is the JSON serialization format for log entries.
 type LogJSON struct {
 	Message   string `json:"message"`
+	Actor     string `json:"actor"`
 	CreatedAt string `json:"created_at"`
 }
 
+// ReviewWaitJSON is the JSON serialization format for review queue entries.
+type ReviewWaitJSON struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	Project    string `json:"project"`
+	Status     string `json:"status"`
+	WaitingOn  string `json:"waiting_on"`  // Empty if nobody is assigned to review
+	WaitingFor string `json:"waiting_for"` // review, changes or merge
+	Since      string `json:"since"`
+	Note       string `json:"note,omitempty"`
+}
+
 // LearningJSON is the JSON serialization format for learnings.
 type LearningJSON struct {
 	ID        string   `json:"id"`
@@ -2728,6 +5638,14 @@ type LearningJSON struct {
 	Files     []string `json:"files,omitempty"`
 	CreatedAt string   `json:"created_at"`
 	Status    string   `json:"status"`
+	Actor     string   `json:"actor,omitempty"`
+
+	ReviewReason string `json:"review_reason,omitempty"` // Why it needs review
+
+	// Set for stubs of learning pages
+	Path       string   `json:"path,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Provenance []string `json:"provenance,omitempty"`
 }
 
 func printLearningsJSON(learnings []model.Learning) error {
@@ -2741,6 +5659,13 @@ func printLearningsJSON(learnings []model.Learning) error {
 			Files:     l.Files,
 			CreatedAt: l.CreatedAt.Format(time.RFC3339),
 			Status:    string(l.Status),
+			Actor:     l.Actor,
+
+			ReviewReason: l.ReviewReason,
+
+			Path:       l.Path,
+			Title:      l.Title,
+			Provenance: l.Provenance,
 		}
 		if lj.Concepts == nil {
 			lj.Concepts = []string{}
@@ -2770,10 +5695,7 @@ func printLearningSummaries(learnings []model.Learning, requestedConcepts []stri
 
 	// Print one-liner per learning
 	for _, l := range learnings {
-		status := ""
-		if l.Status == model.LearningStatusStale {
-			status = " [stale]"
-		}
+		status := learningStatusTag(l)
 		fmt.Printf("  %s: %s%s\n", l.ID, l.Summary, status)
 	}
 }
@@ -2812,10 +5734,7 @@ func printAllLearningSummaries(learnings []model.Learning, conceptSummaries map[
 		fmt.Printf("%s: %s\n", conceptName, summary)
 
 		for _, l := range group.learnings {
-			status := ""
-			if l.Status == model.LearningStatusStale {
-				status = " [stale]"
-			}
+			status := learningStatusTag(l)
 			fmt.Printf("  %s: %s%s\n", l.ID, l.Summary, status)
 		}
 	}
@@ -2837,6 +5756,23 @@ func formatTimeAgo(t time.Time) string {
 	}
 }
 
+// formatTimeUntil is the future-facing counterpart of formatTimeAgo.
+func formatTimeUntil(t time.Time) string {
+	d := time.Until(t)
+	switch {
+	case d <= 0:
+		return "now"
+	case d < time.Minute:
+		return "in <1m"
+	case d < time.Hour:
+		return fmt.Sprintf("in %dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("in %dh", int(d.Hours()))
+	default:
+		return t.Format("2006-01-02 15:04")
+	}
+}
+
 func printDepGraph(edges []db.DepEdge) {
 	// Group by item
 	type depInfo struct {
@@ -2868,6 +5804,313 @@ func printDepGraph(edges []db.DepEdge) {
 	}
 }
 
+func printHistory(events []model.Event) {
+	fmt.Printf("%-16s %-14s %-18s %s\n", "WHEN", "ACTOR", "FIELD", "CHANGE")
+	for _, e := range events {
+		actor := e.Actor
+		if actor == "" {
+			actor = "-"
+		}
+		fmt.Printf("%-16s %-14s %-18s %s\n", e.CreatedAt.Local().Format("2006-01-02 15:04"), actor, e.Field, describeEvent(e))
+	}
+}
+
+// printChange prints one change feed entry on one line.
+func printChange(c model.Change) {
+	actor := c.Actor
+	if actor == "" {
+		actor = "-"
+	}
+	var change string
+	switch c.Kind {
+	case db.ChangeItem:
+		change = describeChange(model.Event{Field: c.Action, OldValue: c.OldValue, NewValue: c.NewValue})
+		switch c.Action {
+		case db.EventCreated, db.EventDeleted, db.EventPurged:
+		default:
+			change = c.Action + ": " + change
+		}
+	case db.ChangeLog:
+		change = "log: " + c.NewValue
+	case db.ChangeDep, db.ChangeLabel:
+		change = c.Kind + " " + describeChange(model.Event{Field: db.EventLabel, OldValue: c.OldValue, NewValue: c.NewValue})
+	default:
+		change = c.Kind + " " + c.Action
+		if c.NewValue != "" {
+			change += ": " + historyValue(c.NewValue)
+		}
+	}
+	fmt.Printf("%-6d %s %-14s %-10s %s\n", c.Seq, c.CreatedAt.Local().Format("15:04:05"), actor, c.Target, change)
+}
+
+// describeEvent renders an event's change on one line.
+func describeEvent(e model.Event) string {
+	if e.Reverts != 0 {
+		return "undo: " + describeChange(e)
+	}
+	return describeChange(e)
+}
+
+func describeChange(e model.Event) string {
+	switch e.Field {
+	case db.EventCreated:
+		if e.NewValue == "" {
+			return "removed"
+		}
+		return "created as " + e.NewValue
+	case db.EventDeleted:
+		if e.OldValue == "" {
+			return fmt.Sprintf("restored (%s)", e.NewValue)
+		}
+		return fmt.Sprintf("deleted (%s)", e.OldValue)
+	case db.EventPurged:
+		return fmt.Sprintf("purged (%s)", e.OldValue)
+	case db.EventDependency, db.EventLabel, db.EventArea, db.EventReviewer:
+		switch {
+		case e.OldValue == "":
+			return "+ " + e.NewValue
+		case e.NewValue == "":
+			return "- " + e.OldValue
+		}
+		return e.OldValue + " -> " + e.NewValue
+	case db.EventDescription, db.EventDefinitionOfDone:
+		return fmt.Sprintf("%d chars -> %d chars", len(e.OldValue), len(e.NewValue))
+	case db.EventCriterion:
+		if e.OldValue == "" {
+			return "checked " + historyValue(e.NewValue)
+		}
+		return "unchecked " + historyValue(e.OldValue)
+	case db.EventReview:
+		return strings.ReplaceAll(e.NewValue, "_", " ")
+	}
+	return historyValue(e.OldValue) + " -> " + historyValue(e.NewValue)
+}
+
+func historyValue(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	if len(v) > 40 {
+		return v[:37] + "..."
+	}
+	return v
+}
+
+func printGraphIssues(issues *db.GraphIssues) {
+	if len(issues.Cycles) > 0 {
+		fmt.Println("Cycles (each waits on the next):")
+		for _, cycle := range issues.Cycles {
+			fmt.Printf("  %s\n", strings.Join(cycle, " -> "))
+		}
+	}
+	if len(issues.Dangling) > 0 {
+		if len(issues.Cycles) > 0 {
+			fmt.Println()
+		}
+		fmt.Println("Dependencies on deleted items:")
+		for _, d := range issues.Dangling {
+			fmt.Printf("  %s depends on %s (%s not found)\n", d.ItemID, d.DependsOn, d.Missing)
+		}
+	}
+}
+
+func printPlan(plan *db.Plan, showWaves bool) {
+	if plan.TaskCount() == 0 {
+		fmt.Println("No unfinished tasks")
+		return
+	}
+
+	fmt.Printf("Tasks:           %d\n", plan.TaskCount())
+	fmt.Printf("Waves:           %d\n", len(plan.Waves))
+	fmt.Printf("Max parallelism: %d\n", plan.MaxParallelism)
+
+	path := make([]string, 0, len(plan.CriticalPath))
+	for _, item := range plan.CriticalPath {
+		path = append(path, item.ID)
+	}
+	fmt.Printf("Critical path:   %d (%s)\n", len(plan.CriticalPath), strings.Join(path, " -> "))
+
+	if showWaves {
+		for i, wave := range plan.Waves {
+			fmt.Printf("\nWave %d (%d):\n", i+1, len(wave))
+			for _, item := range wave {
+				fmt.Printf("  %s [%s] %s\n", item.ID, item.Status, item.Title)
+			}
+		}
+	}
+
+	if len(plan.External) > 0 {
+		fmt.Printf("\nBlocked outside this plan:\n")
+		for _, wave := range plan.Waves {
+			for _, item := range wave {
+				if blockers := plan.External[item.ID]; len(blockers) > 0 {
+					fmt.Printf("  %s waits on %s\n", item.ID, strings.Join(blockers, ", "))
+				}
+			}
+		}
+	}
+}
+
+// statusColors are the fill colors for graph nodes by status.
+var statusColors = map[model.Status]string{
+	model.StatusDraft:      "#f1f3f5",
+	model.StatusOpen:       "#ffffff",
+	model.StatusInProgress: "#fff3bf",
+	model.StatusBlocked:    "#ffc9c9",
+	model.StatusReviewing:  "#d0ebff",
+	model.StatusDone:       "#d3f9d8",
+	model.StatusCanceled:   "#dee2e6",
+}
+
+// graphTree groups a graph's nodes under their parent epics. Nodes whose
+// parent isn't in the graph are roots.
+func graphTree(graph *db.DepGraph) (roots []model.Item, children map[string][]model.Item, endpoints map[string]bool) {
+	inGraph := make(map[string]bool, len(graph.Nodes))
+	for _, n := range graph.Nodes {
+		inGraph[n.ID] = true
+	}
+	children = make(map[string][]model.Item)
+	for _, n := range graph.Nodes {
+		if n.ParentID != nil && inGraph[*n.ParentID] {
+			children[*n.ParentID] = append(children[*n.ParentID], n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	endpoints = make(map[string]bool)
+	for _, e := range graph.Edges {
+		endpoints[e.ItemID] = true
+		endpoints[e.DependsOnID] = true
+	}
+	return roots, children, endpoints
+}
+
+// renderGraphDOT renders a dependency graph in Graphviz DOT. Epics with
+// children become clusters; an epic that is itself a dependency also gets a
+// node inside its cluster for edges to attach to.
+func renderGraphDOT(graph *db.DepGraph) string {
+	roots, children, endpoints := graphTree(graph)
+	quote := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		s = strings.ReplaceAll(s, `"`, `\"`)
+		return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph prog {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+
+	var writeNode func(n model.Item, indent string)
+	writeNode = func(n model.Item, indent string) {
+		kids := children[n.ID]
+		if n.Type == model.ItemTypeEpic && len(kids) > 0 {
+			fmt.Fprintf(&b, "%ssubgraph %s {\n", indent, quote("cluster_"+n.ID))
+			fmt.Fprintf(&b, "%s  label=%s;\n", indent, quote(fmt.Sprintf("%s [%s] %s", n.ID, n.Status, n.Title)))
+			fmt.Fprintf(&b, "%s  style=\"rounded,filled\";\n", indent)
+			fmt.Fprintf(&b, "%s  fillcolor=%s;\n", indent, quote(statusColors[n.Status]))
+			if endpoints[n.ID] {
+				fmt.Fprintf(&b, "%s  %s [label=%s, shape=folder, fillcolor=%s];\n", indent, quote(n.ID), quote(n.ID), quote(statusColors[n.Status]))
+			}
+			for _, kid := range kids {
+				writeNode(kid, indent+"  ")
+			}
+			fmt.Fprintf(&b, "%s}\n", indent)
+			return
+		}
+		shape := ""
+		if n.Type == model.ItemTypeEpic {
+			shape = ", shape=folder"
+		}
+		fmt.Fprintf(&b, "%s%s [label=%s, fillcolor=%s%s];\n", indent, quote(n.ID), quote(n.ID+"\n"+n.Title), quote(statusColors[n.Status]), shape)
+	}
+	for _, n := range roots {
+		writeNode(n, "  ")
+	}
+
+	for _, e := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s;\n", quote(e.DependsOnID), quote(e.ItemID))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// renderGraphMermaid renders a dependency graph as a Mermaid flowchart. Epics
+// with children become subgraphs, which edges can point at directly.
+func renderGraphMermaid(graph *db.DepGraph) string {
+	roots, children, _ := graphTree(graph)
+	// Mermaid IDs can't contain '-'; labels keep the real ID
+	id := func(s string) string { return strings.ReplaceAll(s, "-", "_") }
+	label := func(s string) string {
+		s = strings.ReplaceAll(s, `"`, "#quot;")
+		return `"` + strings.ReplaceAll(s, "\n", " ") + `"`
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	used := make(map[model.Status]bool)
+
+	var writeNode func(n model.Item, indent string)
+	writeNode = func(n model.Item, indent string) {
+		kids := children[n.ID]
+		if n.Type == model.ItemTypeEpic && len(kids) > 0 {
+			fmt.Fprintf(&b, "%ssubgraph %s [%s]\n", indent, id(n.ID), label(fmt.Sprintf("%s [%s] %s", n.ID, n.Status, n.Title)))
+			for _, kid := range kids {
+				writeNode(kid, indent+"  ")
+			}
+			fmt.Fprintf(&b, "%send\n", indent)
+			// Subgraphs don't take :::class, so the epic's status is applied after
+			fmt.Fprintf(&b, "%sclass %s %s\n", indent, id(n.ID), n.Status)
+			used[n.Status] = true
+			return
+		}
+		open, closing := "[", "]"
+		if n.Type == model.ItemTypeEpic {
+			open, closing = "[[", "]]"
+		}
+		fmt.Fprintf(&b, "%s%s%s%s%s:::%s\n", indent, id(n.ID), open, label(n.ID+": "+n.Title), closing, n.Status)
+		used[n.Status] = true
+	}
+	for _, n := range roots {
+		writeNode(n, "  ")
+	}
+
+	for _, e := range graph.Edges {
+		fmt.Fprintf(&b, "  %s --> %s\n", id(e.DependsOnID), id(e.ItemID))
+	}
+
+	for _, status := range []model.Status{
+		model.StatusDraft, model.StatusOpen, model.StatusInProgress, model.StatusBlocked,
+		model.StatusReviewing, model.StatusDone, model.StatusCanceled,
+	} {
+		if used[status] {
+			fmt.Fprintf(&b, "  classDef %s fill:%s,stroke:#495057\n", status, statusColors[status])
+		}
+	}
+	return b.String()
+}
+
+func graphToJSON(graph *db.DepGraph) GraphJSON {
+	output := GraphJSON{
+		Nodes: make([]GraphNodeJSON, 0, len(graph.Nodes)),
+		Edges: make([]GraphEdgeJSON, 0, len(graph.Edges)),
+	}
+	for _, n := range graph.Nodes {
+		output.Nodes = append(output.Nodes, GraphNodeJSON{
+			ID:       n.ID,
+			Title:    n.Title,
+			Type:     string(n.Type),
+			Status:   string(n.Status),
+			Priority: n.Priority,
+			Parent:   n.ParentID,
+		})
+	}
+	for _, e := range graph.Edges {
+		output.Edges = append(output.Edges, GraphEdgeJSON{ItemID: e.ItemID, DependsOn: e.DependsOnID})
+	}
+	return output
+}
+
 func printPrimeContent(report *db.StatusReport) {
 	fmt.Println(`# Prog CLI Context
 
@@ -2880,9 +6123,18 @@ When picking up a task:
 1. prog show <task>                 # See task + suggested concepts
 2. prog context -c X -c Y           # Load relevant concepts
    prog context -c X --summary      # Or scan first if many learnings
+   prog context search "query"      # Or search stubs of learning pages
+   prog context -f path/to/file     # Or learnings about files you'll edit
+3. prog context open <id>           # Read a page in full before changing its area
+4. prog context feedback <id> --relevant   # Or --not-relevant --reason "...",
+                                           # so misleading learnings rank lower
 
 Load context that's relevant to your task. Don't skip it, don't load everything.
 
+Learnings that have a page (docs/learnings/*.md) are kept in the page, not in
+prog: to add or change one, edit or create the page, then run
+'prog context upsert <path>' so future agents find it.
+
 ## SESSION CLOSE PROTOCOL
 
 Before ending ANY session, you MUST complete ALL of these steps:
@@ -2946,10 +6198,10 @@ Work is NOT complete until prog reflects reality.
 ## Before Completing Work
 
 If a task has a Definition of Done:
-1. Run 'prog show <id>' to see the DoD criteria
-2. Verify each criterion is met before marking complete
-3. Run any commands mentioned in the DoD
-4. Only then call 'prog done <id>'
+1. Run 'prog dod <id>' to see the DoD criteria
+2. Run 'prog verify <id>' to run the criteria that have commands
+3. Verify the rest and check them off with evidence: prog dod check <id> <n> --note "..."
+4. Only then call 'prog done <id>' (it refuses while criteria are unchecked)
 
 Tasks with DoD show [DoD] in 'prog ready' output.
 
@@ -2962,9 +6214,11 @@ prog show <id>           # Full details + suggested concepts
 
 # Working
 prog start <id>          # Claim a task
+prog claim <id> --as me  # Claim atomically with a lease (shared databases)
 prog log <id> "message"  # Log progress
 prog done <id>           # Mark complete
 prog review <id>         # Mark as reviewing (awaiting merge)
+prog review queue        # Reviews waiting on you and others
 prog open <id>           # Reopen a task
 
 # Creating
@@ -2980,6 +6234,10 @@ prog label <id> <name>         # Add label to task
 # Context retrieval
 prog context -c concept        # Load learnings for a concept
 prog context -c X --summary    # Scan one-liners first
+prog context -f path/to/file   # Learnings about a file
+prog context search "query"    # Stubs: title, one-liner, summary, path
+prog context open <id>         # Full learning page
+prog context upsert <path>     # Index a new or edited page
 prog concepts                  # List available concepts
 prog learn "summary" -c X --detail "explanation"  # Log with both parts
 
@@ -3019,7 +6277,7 @@ prog ready -p myproject        # Ready in project`)
 	}
 }
 
-func printCompactContent(stats []db.ConceptStats) {
+func printCompactContent(stats []db.ConceptStats, misleading []db.FeedbackStats, needsReview []model.Learning) {
 	fmt.Println(`# Compact Learnings
 
 Groom learnings and concepts using two phases: **discovery** then **selection**.
@@ -3040,6 +6298,8 @@ Scan all learning summaries grouped by concept:
 
 ` + "```" + `bash
 prog context -p <project> --summary   # All learnings, grouped by concept
+prog context feedback -p <project>    # Learnings that misled agents
+prog learn audit -p <project>         # Flag learnings whose files changed
 ` + "```" + `
 
 Flag candidates:
@@ -3064,6 +6324,9 @@ For each candidate, determine action:
 - **Consolidate**: Merge related → archive originals, create new combined learning
 - **Keep**: No changes needed
 
+Learnings with a page (shown with Page: in full output) are groomed in the
+page: edit or delete the Markdown, then run ` + "`prog context reindex`" + `.
+
 Present changes to user. Execute after approval.
 
 ## Repeat
@@ -3102,4 +6365,22 @@ After each batch:
 			fmt.Printf("\nCompaction candidates (5+ learnings): %s\n", strings.Join(candidates, ", "))
 		}
 	}
+
+	if len(misleading) > 0 {
+		fmt.Println("\n## Misleading Learnings")
+		fmt.Println("\nThese looked relevant to agents but didn't apply. Reword the summary, fix the concepts, or mark stale:")
+		fmt.Println()
+		printMisleading(misleading)
+	}
+
+	if len(needsReview) > 0 {
+		fmt.Println("\n## Needs Review")
+		fmt.Println("\nThe files these are about have changed since they were written. Check each against the code,")
+		fmt.Println("then keep it (`prog learn reviewed <id>`), update it, or mark it stale:")
+		fmt.Println()
+		for _, l := range needsReview {
+			fmt.Printf("  %s: %s\n", l.ID, l.Summary)
+			fmt.Printf("  %s  %s\n", strings.Repeat(" ", len(l.ID)), l.ReviewReason)
+		}
+	}
 }
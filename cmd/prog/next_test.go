@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+func TestPickNext_NothingReady(t *testing.T) {
+	database := setupTestDB(t)
+
+	next, err := pickNext(database, db.ReadyFilter{Project: "test"}, "", time.Minute)
+	if err != nil {
+		t.Fatalf("pickNext failed: %v", err)
+	}
+	if next != nil {
+		t.Errorf("expected nil, got %+v", next)
+	}
+}
+
+func TestPickNext_WithoutClaimLeavesTaskOpen(t *testing.T) {
+	database := setupTestDB(t)
+	task := &model.Item{
+		ID: "ts-nxt001", Project: "test", Type: model.ItemTypeTask, Title: "Ready",
+		Status: model.StatusOpen, Priority: 2, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	if err := database.CreateItem(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	next, err := pickNext(database, db.ReadyFilter{Project: "test"}, "", time.Minute)
+	if err != nil {
+		t.Fatalf("pickNext failed: %v", err)
+	}
+	if next == nil || next.ID != task.ID {
+		t.Fatalf("expected %s, got %+v", task.ID, next)
+	}
+	if next.Lease != nil {
+		t.Error("expected no lease without --claim")
+	}
+
+	item, _ := database.GetItem(task.ID)
+	if item.Status != model.StatusOpen {
+		t.Errorf("status = %q, want open", item.Status)
+	}
+}
+
+func TestPickNext_ClaimSkipsTakenTasks(t *testing.T) {
+	database := setupTestDB(t)
+	for i, id := range []string{"ts-nxt001", "ts-nxt002"} {
+		task := &model.Item{
+			ID: id, Project: "test", Type: model.ItemTypeTask, Title: "Task",
+			Status: model.StatusOpen, Priority: i + 1, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+		}
+		if err := database.CreateItem(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+	}
+
+	first, err := pickNext(database, db.ReadyFilter{Project: "test"}, "agent-1", time.Minute)
+	if err != nil {
+		t.Fatalf("pickNext failed: %v", err)
+	}
+	if first == nil || first.ID != "ts-nxt001" {
+		t.Fatalf("expected ts-nxt001, got %+v", first)
+	}
+	if first.Lease == nil || first.Lease.Actor != "agent-1" {
+		t.Errorf("expected lease for agent-1, got %+v", first.Lease)
+	}
+	if first.Status != string(model.StatusInProgress) {
+		t.Errorf("status = %q, want in_progress", first.Status)
+	}
+
+	second, err := pickNext(database, db.ReadyFilter{Project: "test"}, "agent-2", time.Minute)
+	if err != nil {
+		t.Fatalf("pickNext failed: %v", err)
+	}
+	if second == nil || second.ID != "ts-nxt002" {
+		t.Fatalf("expected ts-nxt002, got %+v", second)
+	}
+
+	third, err := pickNext(database, db.ReadyFilter{Project: "test"}, "agent-3", time.Minute)
+	if err != nil {
+		t.Fatalf("pickNext failed: %v", err)
+	}
+	if third != nil {
+		t.Errorf("expected nothing left, got %+v", third)
+	}
+}
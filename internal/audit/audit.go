@@ -0,0 +1,191 @@
+// Package audit checks learnings against git history, to find those whose
+// files have been rewritten or deleted since they were recorded. A learning
+// about code that has changed may no longer hold, so it needs review.
+//
+// A learning's files are paths, directories or globs, as for areas. Each is
+// checked with git log and git ls-files in the repository, so directories
+// and globs cover every file they match.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// DefaultThreshold is how much of a file must change for a learning about it
+// to need review; see FileChange.Churn.
+const DefaultThreshold = 0.5
+
+// FileChange is how one of a learning's files changed in git history.
+type FileChange struct {
+	Path    string // As recorded on the learning
+	Commits int    // Commits that touched it since the learning was updated
+	Added   int    // Lines added by those commits
+	Deleted int    // Lines deleted by those commits
+	Lines   int    // Lines it has now
+	Missing bool   // Nothing in the repo matches it any more
+}
+
+// Churn is the fraction of the file that changed: lines added and deleted,
+// over its lines before and after. Rewriting every line is 1; doubling a
+// file, or deleting half of it, is a third.
+func (c FileChange) Churn() float64 {
+	before := c.Lines - c.Added + c.Deleted
+	total := before + c.Lines
+	if total <= 0 {
+		return 0
+	}
+	return float64(c.Added+c.Deleted) / float64(total)
+}
+
+// String describes the change, e.g. "auth/token.go changed 72% in 3 commits".
+func (c FileChange) String() string {
+	if c.Missing {
+		return c.Path + " no longer exists"
+	}
+	commits := "commits"
+	if c.Commits == 1 {
+		commits = "commit"
+	}
+	return fmt.Sprintf("%s changed %.0f%% in %d %s", c.Path, min(c.Churn(), 1)*100, c.Commits, commits)
+}
+
+// Result is the outcome of auditing a learning.
+type Result struct {
+	Learning model.Learning
+	Changes  []FileChange // Of each file that changed or is missing
+	Flagged  []FileChange // The changes that mean it needs review
+}
+
+// NeedsReview reports whether the learning's files changed enough that it
+// needs review.
+func (r *Result) NeedsReview() bool {
+	return len(r.Flagged) > 0
+}
+
+// Reason says why the learning needs review.
+func (r *Result) Reason() string {
+	reasons := make([]string, len(r.Flagged))
+	for i, c := range r.Flagged {
+		reasons[i] = c.String()
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Auditor checks learnings against the git history of the repository at Root.
+type Auditor struct {
+	Root      string  // Repository root; learnings' files are relative to it
+	Threshold float64 // Churn at which a file needs review (default DefaultThreshold)
+}
+
+// Audit checks each of a learning's files for commits since the learning
+// was last updated. A file that is missing, or whose churn reaches the
+// threshold, flags the learning.
+func (a *Auditor) Audit(ctx context.Context, l model.Learning) (*Result, error) {
+	threshold := a.Threshold
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	result := &Result{Learning: l}
+	for _, file := range l.Files {
+		file = strings.TrimPrefix(strings.TrimSpace(file), "./")
+		if file == "" {
+			continue
+		}
+		c, err := a.check(ctx, file, l.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if c.Commits == 0 && !c.Missing {
+			continue
+		}
+		result.Changes = append(result.Changes, *c)
+		if c.Missing || c.Churn() >= threshold {
+			result.Flagged = append(result.Flagged, *c)
+		}
+	}
+	return result, nil
+}
+
+// check measures how file changed in commits since since.
+func (a *Auditor) check(ctx context.Context, file string, since time.Time) (*FileChange, error) {
+	c := &FileChange{Path: file}
+	spec := strings.TrimSuffix(file, "/")
+	if strings.ContainsAny(spec, "*?[") {
+		spec = ":(glob)" + spec
+	}
+
+	// --since is inclusive and to the second, so commits from the second the
+	// learning was updated in are skipped below: most likely it was written
+	// with them in mind.
+	out, err := a.git(ctx, "log", "--since="+since.Format(time.RFC3339), "--format=tformat:commit %ct", "--numstat", "--", spec)
+	if err != nil {
+		return nil, err
+	}
+	counting := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if committed, ok := strings.CutPrefix(line, "commit "); ok {
+			at, _ := strconv.ParseInt(committed, 10, 64)
+			counting = at > since.Unix()
+			if counting {
+				c.Commits++
+			}
+			continue
+		}
+		// "added<TAB>deleted<TAB>path", with "-" for binary files
+		fields := strings.SplitN(line, "\t", 3)
+		if !counting || len(fields) != 3 {
+			continue
+		}
+		added, _ := strconv.Atoi(fields[0])
+		deleted, _ := strconv.Atoi(fields[1])
+		c.Added += added
+		c.Deleted += deleted
+	}
+
+	out, err = a.git(ctx, "ls-files", "-z", "--", spec)
+	if err != nil {
+		return nil, err
+	}
+	tracked := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(out) == 0 {
+		tracked = nil
+	}
+	for _, f := range tracked {
+		data, err := os.ReadFile(filepath.Join(a.Root, f))
+		if err != nil {
+			continue // Deleted but not yet committed; git log has the lines it had
+		}
+		c.Lines += bytes.Count(data, []byte("\n"))
+	}
+	if len(tracked) == 0 {
+		// Untracked files still count as present
+		if _, err := os.Stat(filepath.Join(a.Root, filepath.FromSlash(strings.TrimSuffix(file, "/")))); err != nil {
+			c.Missing = true
+		}
+	}
+	return c, nil
+}
+
+func (a *Auditor) git(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", a.Root}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
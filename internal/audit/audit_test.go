@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// testRepo is a throwaway git repository with commits at given times.
+type testRepo struct {
+	t    *testing.T
+	root string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	r := &testRepo{t: t, root: t.TempDir()}
+	r.git("init", "-q")
+	return r
+}
+
+func (r *testRepo) write(path, content string) {
+	r.t.Helper()
+	full := filepath.Join(r.root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		r.t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		r.t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func (r *testRepo) commit(at time.Time) {
+	r.t.Helper()
+	r.git("add", "-A")
+	date := at.Format(time.RFC3339)
+	cmd := exec.Command("git", "-C", r.root, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "change")
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		r.t.Fatalf("git commit failed: %v: %s", err, out)
+	}
+}
+
+func (r *testRepo) git(args ...string) {
+	r.t.Helper()
+	if out, err := exec.Command("git", append([]string{"-C", r.root}, args...)...).CombinedOutput(); err != nil {
+		r.t.Fatalf("git %s failed: %v: %s", args[0], err, out)
+	}
+}
+
+func lines(n int, word string) string {
+	return strings.Repeat(word+"\n", n)
+}
+
+func TestAudit(t *testing.T) {
+	r := newTestRepo(t)
+	now := time.Now()
+	r.write("auth/token.go", lines(10, "old"))
+	r.write("auth/session.go", lines(10, "old"))
+	r.write("db/query.go", lines(10, "old"))
+	r.write("api/handler.go", lines(10, "old"))
+	r.commit(now.Add(-24 * time.Hour))
+
+	// Rewritten, lightly touched, deleted, and untouched since the learning
+	r.write("auth/token.go", lines(10, "new"))
+	r.write("auth/session.go", lines(10, "old")+"one more\n")
+	if err := os.Remove(filepath.Join(r.root, "db/query.go")); err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+	r.commit(now.Add(-time.Hour))
+
+	a := &Auditor{Root: r.root}
+	learning := func(files ...string) model.Learning {
+		return model.Learning{ID: "lrn-test", Files: files, UpdatedAt: now.Add(-12 * time.Hour)}
+	}
+	tests := []struct {
+		name   string
+		files  []string
+		reason string // Empty when it doesn't need review
+	}{
+		{"rewritten", []string{"auth/token.go"}, "auth/token.go changed 100% in 1 commit"},
+		{"lightly touched", []string{"auth/session.go"}, ""},
+		{"deleted", []string{"db/query.go"}, "db/query.go no longer exists"},
+		{"untouched", []string{"api/handler.go"}, ""},
+		{"never existed", []string{"nope.go"}, "nope.go no longer exists"},
+		{"directory", []string{"auth/"}, "auth/ changed 51% in 1 commit"},
+		{"glob", []string{"**/token.go"}, "**/token.go changed 100% in 1 commit"},
+		{"several", []string{"api/handler.go", "./auth/token.go", "db/query.go"}, "auth/token.go changed 100% in 1 commit; db/query.go no longer exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := a.Audit(context.Background(), learning(tt.files...))
+			if err != nil {
+				t.Fatalf("Audit failed: %v", err)
+			}
+			if result.NeedsReview() != (tt.reason != "") || result.Reason() != tt.reason {
+				t.Errorf("Audit(%v) = needs review %v, %q; want %q", tt.files, result.NeedsReview(), result.Reason(), tt.reason)
+			}
+		})
+	}
+
+	// Changes from before the learning was updated don't count
+	result, err := a.Audit(context.Background(), model.Learning{Files: []string{"auth/token.go"}, UpdatedAt: now.Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if result.NeedsReview() || len(result.Changes) != 0 {
+		t.Errorf("changes before the learning was updated: %+v", result.Changes)
+	}
+
+	// Nor do those from the same second, as git dates commits to the second
+	sameSecond := now.Add(-time.Hour).Truncate(time.Second).Add(500 * time.Millisecond)
+	result, err = a.Audit(context.Background(), model.Learning{Files: []string{"auth/token.go"}, UpdatedAt: sameSecond})
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if result.NeedsReview() {
+		t.Errorf("changes in the second the learning was updated: %+v", result.Changes)
+	}
+
+	// A lower threshold flags smaller changes
+	a.Threshold = 0.01
+	result, err = a.Audit(context.Background(), learning("auth/session.go"))
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if !result.NeedsReview() {
+		t.Errorf("Audit with threshold 0.01 should flag %+v", result.Changes)
+	}
+}
+
+func TestFileChange_Churn(t *testing.T) {
+	tests := []struct {
+		change FileChange
+		want   float64
+	}{
+		{FileChange{Added: 10, Deleted: 10, Lines: 10}, 1},
+		{FileChange{Added: 10, Lines: 20}, 1.0 / 3},
+		{FileChange{Deleted: 10, Lines: 10}, 1.0 / 3},
+		{FileChange{Added: 1, Lines: 11}, 1.0 / 21},
+		{FileChange{Added: 5, Lines: 5}, 1},
+		{FileChange{}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.change.Churn(); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("%+v.Churn() = %v, want %v", tt.change, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package db
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Areas record which parts of a codebase a task touches, so that tasks likely
+// to collide are not worked on in parallel. An area is either:
+//   - a path ("internal/db", "cmd/prog/main.go"), covering itself and everything beneath it
+//   - a glob ("internal/db/*.go", "docs/**/*.md"), where ** matches any number of directories
+//   - a name ("schema", "auth"), which only overlaps the same name
+//
+// Names and single-segment paths are the same thing; the distinction is only
+// in how people use them.
+
+// NormalizeArea cleans up an area so equivalent spellings compare equal.
+func NormalizeArea(area string) string {
+	area = strings.TrimSpace(area)
+	area = strings.TrimPrefix(area, "./")
+	if area == "" {
+		return ""
+	}
+	return path.Clean(area)
+}
+
+// AddItemArea records that an item touches area. Adding an existing area is a no-op.
+// Items that don't exist or are in the trash are refused.
+func (db *DB) AddItemArea(itemID, area string) error {
+	return addItemArea(db, itemID, area, db.actor)
+}
+
+func addItemArea(q querier, itemID, area, actor string) error {
+	area = NormalizeArea(area)
+	if area == "" {
+		return fmt.Errorf("area cannot be empty")
+	}
+	if _, err := path.Match(strings.ReplaceAll(area, "**", "*"), ""); err != nil {
+		return fmt.Errorf("invalid area pattern %q: %w", area, err)
+	}
+	if _, err := getItem(q, itemID); err != nil {
+		return err
+	}
+	result, err := q.Exec(`INSERT OR IGNORE INTO item_areas (item_id, area) VALUES (?, ?)`, itemID, area)
+	if err != nil {
+		return fmt.Errorf("failed to add area: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		return recordEvent(q, itemID, EventArea, "", area, actor)
+	}
+	return nil
+}
+
+// RemoveItemArea removes an area from an item.
+func (db *DB) RemoveItemArea(itemID, area string) error {
+	area = NormalizeArea(area)
+	result, err := db.Exec(`DELETE FROM item_areas WHERE item_id = ? AND area = ?`, itemID, area)
+	if err != nil {
+		return fmt.Errorf("failed to remove area: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("item does not have area: %s", area)
+	}
+	return recordEvent(db, itemID, EventArea, area, "", db.actor)
+}
+
+// GetItemAreas returns the areas an item touches, sorted.
+func (db *DB) GetItemAreas(itemID string) ([]string, error) {
+	rows, err := db.Query(`SELECT area FROM item_areas WHERE item_id = ? ORDER BY area`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get areas: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var areas []string
+	for rows.Next() {
+		var area string
+		if err := rows.Scan(&area); err != nil {
+			return nil, fmt.Errorf("failed to scan area: %w", err)
+		}
+		areas = append(areas, area)
+	}
+	return areas, rows.Err()
+}
+
+// inFlightAreas returns the areas of in_progress items, keyed by item ID.
+// If project is non-empty only that project's items are included.
+func (db *DB) inFlightAreas(project string) (map[string][]string, error) {
+	query := `
+		SELECT a.item_id, a.area FROM item_areas a
+		JOIN items i ON a.item_id = i.id
+		WHERE i.status = 'in_progress' AND i.deleted_at IS NULL`
+	args := []any{}
+	if project != "" {
+		query += ` AND i.project = ?`
+		args = append(args, project)
+	}
+	query += ` ORDER BY a.item_id, a.area`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query areas: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	areas := make(map[string][]string)
+	for rows.Next() {
+		var id, area string
+		if err := rows.Scan(&id, &area); err != nil {
+			return nil, fmt.Errorf("failed to scan area: %w", err)
+		}
+		areas[id] = append(areas[id], area)
+	}
+	return areas, rows.Err()
+}
+
+// Conflict is a pair of items whose areas overlap.
+type Conflict struct {
+	Item      model.Item
+	Other     model.Item
+	Area      string // Item's area
+	OtherArea string // Other's overlapping area
+}
+
+// Conflicts reports in_progress tasks whose areas overlap each other.
+// Each pair is reported once per overlapping pair of areas.
+func (db *DB) Conflicts(project string) ([]Conflict, error) {
+	status := model.StatusInProgress
+	items, err := db.ListItemsFiltered(ListFilter{Project: project, Status: &status, Type: string(model.ItemTypeTask)})
+	if err != nil {
+		return nil, err
+	}
+	areas, err := db.inFlightAreas(project)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []Conflict
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			a, b := items[i], items[j]
+			// Different projects are different codebases
+			if a.Project != b.Project {
+				continue
+			}
+			for _, areaA := range areas[a.ID] {
+				for _, areaB := range areas[b.ID] {
+					if AreasOverlap(areaA, areaB) {
+						conflicts = append(conflicts, Conflict{Item: a, Other: b, Area: areaA, OtherArea: areaB})
+					}
+				}
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// HeldBack reports ready tasks that are kept out of conflict-free ready lists
+// because their areas overlap in_progress work.
+func (db *DB) HeldBack(project string) ([]Conflict, error) {
+	ready, err := db.ReadyItemsFiltered(project, nil)
+	if err != nil {
+		return nil, err
+	}
+	return db.conflictsWithInFlight(ready, project)
+}
+
+// conflictsWithInFlight pairs each item with the in_progress items it overlaps.
+func (db *DB) conflictsWithInFlight(items []model.Item, project string) ([]Conflict, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	inFlight, err := db.inFlightAreas(project)
+	if err != nil {
+		return nil, err
+	}
+	if len(inFlight) == 0 {
+		return nil, nil
+	}
+
+	var conflicts []Conflict
+	for _, item := range items {
+		areas, err := db.GetItemAreas(item.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(areas) == 0 {
+			continue
+		}
+		for _, otherID := range sortedKeys(inFlight) {
+			if otherID == item.ID {
+				continue
+			}
+			var other *model.Item
+			for _, area := range areas {
+				for _, otherArea := range inFlight[otherID] {
+					if !AreasOverlap(area, otherArea) {
+						continue
+					}
+					if other == nil {
+						if other, err = db.GetItem(otherID); err != nil {
+							return nil, err
+						}
+					}
+					if other.Project != item.Project {
+						continue
+					}
+					conflicts = append(conflicts, Conflict{Item: item, Other: *other, Area: area, OtherArea: otherArea})
+				}
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AreasOverlap reports whether two areas could refer to the same files.
+// The check is conservative: two globs overlap whenever one's fixed directory
+// prefix contains the other's, even if no actual file could match both.
+func AreasOverlap(a, b string) bool {
+	a, b = NormalizeArea(a), NormalizeArea(b)
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	globA, globB := isGlob(a), isGlob(b)
+	switch {
+	case !globA && !globB:
+		return pathContains(a, b) || pathContains(b, a)
+	case globA && !globB:
+		return globTouches(a, b)
+	case !globA && globB:
+		return globTouches(b, a)
+	default:
+		dirA, dirB := globDir(a), globDir(b)
+		return pathContains(dirA, dirB) || pathContains(dirB, dirA)
+	}
+}
+
+// globTouches reports whether glob matches p, anything beneath p (p taken as
+// a directory), or whether p is a directory holding the glob's fixed prefix.
+func globTouches(glob, p string) bool {
+	return matchGlob(glob, p) ||
+		matchPrefix(strings.Split(glob, "/"), strings.Split(p, "/")) ||
+		pathContains(p, globDir(glob))
+}
+
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// globDir returns the directory prefix of a glob before its first wildcard
+// segment, or "" if the glob starts with one.
+func globDir(glob string) string {
+	segs := strings.Split(glob, "/")
+	for i, seg := range segs {
+		if isGlob(seg) {
+			return strings.Join(segs[:i], "/")
+		}
+	}
+	return glob
+}
+
+// pathContains reports whether dir is p or an ancestor of p. The empty dir
+// contains everything.
+func pathContains(dir, p string) bool {
+	return dir == "" || dir == p || strings.HasPrefix(p, dir+"/")
+}
+
+// matchGlob matches a slash-separated path against a glob where ** matches
+// zero or more whole segments and other segments use path.Match syntax.
+func matchGlob(glob, p string) bool {
+	return matchSegments(strings.Split(glob, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(glob, p []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			// Try every possible number of segments for **
+			for i := 0; i <= len(p); i++ {
+				if matchSegments(glob[1:], p[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(p) == 0 {
+			return false
+		}
+		if ok, err := path.Match(glob[0], p[0]); err != nil || !ok {
+			return false
+		}
+		glob, p = glob[1:], p[1:]
+	}
+	return len(p) == 0
+}
+
+// matchPrefix reports whether p could be a leading directory of some path
+// matching glob.
+func matchPrefix(glob, p []string) bool {
+	for len(p) > 0 {
+		if len(glob) == 0 {
+			return false
+		}
+		if glob[0] == "**" {
+			return true
+		}
+		if ok, err := path.Match(glob[0], p[0]); err != nil || !ok {
+			return false
+		}
+		glob, p = glob[1:], p[1:]
+	}
+	return len(glob) > 0
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func TestAreasOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"internal/db", "internal/db", true},
+		{"./internal/db/", "internal/db", true},
+		{"internal/db", "internal/db/items.go", true},
+		{"internal/db", "internal/dbx", false},
+		{"internal/db", "cmd/prog", false},
+		{"schema", "schema", true},
+		{"schema", "auth", false},
+		{"internal/db/*.go", "internal/db/items.go", true},
+		{"internal/db/*.go", "internal/db/sub/items.go", false},
+		{"internal/db/*.go", "internal/db", true},
+		{"internal/db/*.go", "internal", true},
+		{"internal/db/*.go", "cmd/prog/main.go", false},
+		{"internal/**/*.go", "internal/db/sub/items.go", true},
+		{"**/*_test.go", "cmd/prog/next_test.go", true},
+		{"*.md", "README.md", true},
+		{"*.md", "main.go", false},
+		{"internal/db/*.go", "internal/*/queries.go", true},
+		{"internal/db/*.go", "cmd/**", false},
+		{"", "internal/db", false},
+	}
+
+	for _, tt := range tests {
+		if got := AreasOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("AreasOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := AreasOverlap(tt.b, tt.a); got != tt.want {
+			t.Errorf("AreasOverlap(%q, %q) = %v, want %v (reversed)", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestItemAreas(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Touches db")
+
+	for _, area := range []string{"internal/db", "./cmd/prog/", "internal/db"} {
+		if err := db.AddItemArea(task.ID, area); err != nil {
+			t.Fatalf("failed to add area %q: %v", area, err)
+		}
+	}
+
+	areas, err := db.GetItemAreas(task.ID)
+	if err != nil {
+		t.Fatalf("failed to get areas: %v", err)
+	}
+	if len(areas) != 2 || areas[0] != "cmd/prog" || areas[1] != "internal/db" {
+		t.Errorf("areas = %v, want [cmd/prog internal/db]", areas)
+	}
+
+	if err := db.RemoveItemArea(task.ID, "cmd/prog"); err != nil {
+		t.Fatalf("failed to remove area: %v", err)
+	}
+	if err := db.RemoveItemArea(task.ID, "cmd/prog"); err == nil {
+		t.Error("expected error removing missing area")
+	}
+
+	if err := db.AddItemArea(task.ID, "  "); err == nil {
+		t.Error("expected error for empty area")
+	}
+	if err := db.AddItemArea(task.ID, "internal/[db"); err == nil {
+		t.Error("expected error for malformed glob")
+	}
+
+	if err := db.AddItemArea("ts-000000", "internal/db"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing item, got %v", err)
+	}
+
+	if err := db.DeleteItem(task.ID); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	if err := db.AddItemArea(task.ID, "internal/api"); !errors.Is(err, ErrInTrash) {
+		t.Errorf("expected ErrInTrash for a trashed item, got %v", err)
+	}
+	if _, err := db.PurgeTrash("", time.Now()); err != nil {
+		t.Fatalf("failed to purge trash: %v", err)
+	}
+	areas, err = db.GetItemAreas(task.ID)
+	if err != nil {
+		t.Fatalf("failed to get areas: %v", err)
+	}
+	if len(areas) != 0 {
+		t.Errorf("areas after purge = %v, want none", areas)
+	}
+}
+
+func TestReadyItemsMatching_NoConflicts(t *testing.T) {
+	db := setupTestDB(t)
+
+	running := createTestItemWithProject(t, db, "Running", "test", model.StatusInProgress, 2)
+	clash := createTestItemWithProject(t, db, "Clash", "test", model.StatusOpen, 2)
+	clear := createTestItemWithProject(t, db, "Clear", "test", model.StatusOpen, 2)
+	untagged := createTestItemWithProject(t, db, "Untagged", "test", model.StatusOpen, 2)
+	otherProject := createTestItemWithProject(t, db, "Elsewhere", "other", model.StatusOpen, 2)
+
+	mustAddArea(t, db, running.ID, "internal/db")
+	mustAddArea(t, db, clash.ID, "internal/db/*.go")
+	mustAddArea(t, db, clear.ID, "cmd/prog")
+	mustAddArea(t, db, otherProject.ID, "internal/db")
+
+	all, err := db.ReadyItemsMatching(ReadyFilter{})
+	if err != nil {
+		t.Fatalf("ReadyItemsMatching failed: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("without NoConflicts got %d items, want 4", len(all))
+	}
+
+	filtered, err := db.ReadyItemsMatching(ReadyFilter{NoConflicts: true})
+	if err != nil {
+		t.Fatalf("ReadyItemsMatching failed: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, item := range filtered {
+		got[item.ID] = true
+	}
+	if got[clash.ID] {
+		t.Error("task overlapping in-progress work should be held back")
+	}
+	for _, item := range []*model.Item{clear, untagged, otherProject} {
+		if !got[item.ID] {
+			t.Errorf("%s should be ready", item.Title)
+		}
+	}
+
+	// Finishing the running task releases the area
+	if err := db.UpdateStatus(running.ID, model.StatusDone); err != nil {
+		t.Fatalf("failed to finish task: %v", err)
+	}
+	filtered, err = db.ReadyItemsMatching(ReadyFilter{NoConflicts: true})
+	if err != nil {
+		t.Fatalf("ReadyItemsMatching failed: %v", err)
+	}
+	if len(filtered) != 4 {
+		t.Errorf("after finishing got %d items, want 4", len(filtered))
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	db := setupTestDB(t)
+
+	a := createTestItemWithProject(t, db, "A", "test", model.StatusInProgress, 2)
+	b := createTestItemWithProject(t, db, "B", "test", model.StatusInProgress, 2)
+	c := createTestItemWithProject(t, db, "C", "test", model.StatusInProgress, 2)
+	waiting := createTestItemWithProject(t, db, "Waiting", "test", model.StatusOpen, 2)
+
+	mustAddArea(t, db, a.ID, "schema")
+	mustAddArea(t, db, b.ID, "schema")
+	mustAddArea(t, db, c.ID, "docs")
+	mustAddArea(t, db, waiting.ID, "docs/**/*.md")
+
+	conflicts, err := db.Conflicts("test")
+	if err != nil {
+		t.Fatalf("Conflicts failed: %v", err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1: %+v", len(conflicts), conflicts)
+	}
+	pair := map[string]bool{conflicts[0].Item.ID: true, conflicts[0].Other.ID: true}
+	if !pair[a.ID] || !pair[b.ID] || conflicts[0].Area != "schema" {
+		t.Errorf("conflict = %+v, want %s and %s on schema", conflicts[0], a.ID, b.ID)
+	}
+
+	held, err := db.HeldBack("test")
+	if err != nil {
+		t.Fatalf("HeldBack failed: %v", err)
+	}
+	if len(held) != 1 || held[0].Item.ID != waiting.ID || held[0].Other.ID != c.ID {
+		t.Errorf("held back = %+v, want %s waiting on %s", held, waiting.ID, c.ID)
+	}
+}
+
+func mustAddArea(t *testing.T, db *DB, itemID, area string) {
+	t.Helper()
+	if err := db.AddItemArea(itemID, area); err != nil {
+		t.Fatalf("failed to add area %q: %v", area, err)
+	}
+}
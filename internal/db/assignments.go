@@ -0,0 +1,137 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// CreateAssignment records that a task was handed to an agent. Sets a.ID.
+func (db *DB) CreateAssignment(a *model.Assignment) error {
+	if a.State == "" {
+		a.State = model.AssignmentQueued
+	}
+	now := time.Now()
+	a.CreatedAt, a.UpdatedAt = now, now
+	result, err := db.Exec(`
+		INSERT INTO assignments (item_id, agent_id, role, state, progress, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		a.ItemID, a.AgentID, a.Role, a.State, a.Progress, a.CreatedAt, a.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create assignment: %w", err)
+	}
+	a.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get assignment id: %w", err)
+	}
+	return nil
+}
+
+// SetAssignmentState moves an assignment to a new state.
+func (db *DB) SetAssignmentState(id int64, state model.AssignmentState) error {
+	result, err := db.Exec(`
+		UPDATE assignments SET state = ?, updated_at = ? WHERE id = ?`,
+		state, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update assignment: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("assignment %w: %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+// MarkAssignmentProgress records that the agent reported progress on an assignment.
+func (db *DB) MarkAssignmentProgress(id int64) error {
+	_, err := db.Exec(`
+		UPDATE assignments SET progress = 1, updated_at = ? WHERE id = ?`,
+		time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update assignment: %w", err)
+	}
+	return nil
+}
+
+// OpenAssignments returns queued and active assignments in the order they were made.
+// The daemon uses this to rebuild agent inboxes after a restart.
+func (db *DB) OpenAssignments() ([]model.Assignment, error) {
+	return db.queryAssignments(`
+		SELECT id, item_id, agent_id, role, state, progress, created_at, updated_at
+		FROM assignments WHERE state IN ('queued', 'active') ORDER BY id`)
+}
+
+// GetAssignments returns every assignment ever made for a task, oldest first.
+func (db *DB) GetAssignments(itemID string) ([]model.Assignment, error) {
+	return db.queryAssignments(`
+		SELECT id, item_id, agent_id, role, state, progress, created_at, updated_at
+		FROM assignments WHERE item_id = ? ORDER BY id`, itemID)
+}
+
+func (db *DB) queryAssignments(query string, args ...any) ([]model.Assignment, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query assignments: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var assignments []model.Assignment
+	for rows.Next() {
+		var a model.Assignment
+		if err := rows.Scan(&a.ID, &a.ItemID, &a.AgentID, &a.Role, &a.State, &a.Progress, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan assignment: %w", err)
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// MoveAssignment hands a queued assignment from one agent to another, moving
+// the task's lease with it and noting the move in the task's log.
+// Fails if from no longer holds the lease.
+func (db *DB) MoveAssignment(id int64, taskID, from, to string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.Exec(`UPDATE leases SET actor = ? WHERE item_id = ? AND actor = ?`, to, taskID, from)
+	if err != nil {
+		return fmt.Errorf("failed to move lease: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("%s holds no lease on %s", from, taskID)
+	}
+
+	now := time.Now()
+	result, err = tx.Exec(`
+		UPDATE assignments SET agent_id = ?, updated_at = ?
+		WHERE id = ? AND agent_id = ? AND state = 'queued'`,
+		to, now, id, from)
+	if err != nil {
+		return fmt.Errorf("failed to move assignment: %w", err)
+	}
+	rows, _ = result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("assignment %d is not queued for %s", id, from)
+	}
+
+	if _, err := tx.Exec(`UPDATE items SET assignee = ? WHERE id = ?`, to, taskID); err != nil {
+		return fmt.Errorf("failed to reassign task: %w", err)
+	}
+
+	if err := addLog(tx, taskID, fmt.Sprintf("Moved from agent %s to agent %s (work stealing)", from, to), db.actor); err != nil {
+		return err
+	}
+	if err := recordEvent(tx, taskID, EventLease, from, to, db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func TestAssignments(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Assigned")
+
+	a := &model.Assignment{ItemID: task.ID, AgentID: "abc123", Role: "implementer"}
+	if err := db.CreateAssignment(a); err != nil {
+		t.Fatalf("failed to create assignment: %v", err)
+	}
+	if a.ID == 0 {
+		t.Error("expected assignment ID to be set")
+	}
+	if a.State != model.AssignmentQueued {
+		t.Errorf("state = %q, want queued", a.State)
+	}
+
+	open, err := db.OpenAssignments()
+	if err != nil {
+		t.Fatalf("failed to list open assignments: %v", err)
+	}
+	if len(open) != 1 || open[0].AgentID != "abc123" {
+		t.Fatalf("open = %+v, want one for abc123", open)
+	}
+
+	if err := db.SetAssignmentState(a.ID, model.AssignmentActive); err != nil {
+		t.Fatalf("failed to set state: %v", err)
+	}
+	if err := db.MarkAssignmentProgress(a.ID); err != nil {
+		t.Fatalf("failed to mark progress: %v", err)
+	}
+	got, err := db.GetAssignments(task.ID)
+	if err != nil {
+		t.Fatalf("failed to get assignments: %v", err)
+	}
+	if len(got) != 1 || got[0].State != model.AssignmentActive || !got[0].Progress {
+		t.Errorf("got %+v, want active with progress", got)
+	}
+
+	if err := db.SetAssignmentState(a.ID, model.AssignmentDone); err != nil {
+		t.Fatalf("failed to set state: %v", err)
+	}
+	open, _ = db.OpenAssignments()
+	if len(open) != 0 {
+		t.Errorf("open = %+v, want none after done", open)
+	}
+
+	if err := db.SetAssignmentState(9999, model.AssignmentDone); err == nil {
+		t.Error("expected error for missing assignment")
+	}
+}
+
+func TestDeleteItem_RemovesAssignments(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Doomed")
+
+	if err := db.CreateAssignment(&model.Assignment{ItemID: task.ID, AgentID: "abc123", Role: "implementer"}); err != nil {
+		t.Fatalf("failed to create assignment: %v", err)
+	}
+	if err := db.DeleteItem(task.ID); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	got, _ := db.GetAssignments(task.ID)
+	if len(got) != 0 {
+		t.Errorf("assignments = %+v, want none", got)
+	}
+}
+
+func TestMoveAssignment(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Stolen")
+
+	if _, err := db.ClaimTask(task.ID, "agent1", DefaultLeaseTTL); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	a := &model.Assignment{ItemID: task.ID, AgentID: "agent1", Role: "implementer"}
+	if err := db.CreateAssignment(a); err != nil {
+		t.Fatalf("failed to create assignment: %v", err)
+	}
+
+	if err := db.MoveAssignment(a.ID, task.ID, "agent3", "agent2"); err == nil {
+		t.Error("expected error moving from an agent that holds no lease")
+	}
+	if err := db.MoveAssignment(a.ID, task.ID, "agent1", "agent2"); err != nil {
+		t.Fatalf("failed to move assignment: %v", err)
+	}
+
+	lease, _ := db.GetLease(task.ID)
+	if lease == nil || lease.Actor != "agent2" {
+		t.Errorf("lease = %+v, want held by agent2", lease)
+	}
+	got, _ := db.GetAssignments(task.ID)
+	if len(got) != 1 || got[0].AgentID != "agent2" {
+		t.Errorf("assignments = %+v, want moved to agent2", got)
+	}
+	logs, _ := db.GetLogs(task.ID)
+	if len(logs) != 1 || logs[0].Message != "Moved from agent agent1 to agent agent2 (work stealing)" {
+		t.Errorf("logs = %+v", logs)
+	}
+
+	// Only queued assignments can move
+	if err := db.SetAssignmentState(a.ID, model.AssignmentActive); err != nil {
+		t.Fatalf("failed to set state: %v", err)
+	}
+	if err := db.MoveAssignment(a.ID, task.ID, "agent2", "agent1"); err == nil {
+		t.Error("expected error moving an active assignment")
+	}
+	lease, _ = db.GetLease(task.ID)
+	if lease == nil || lease.Actor != "agent2" {
+		t.Errorf("failed move should leave lease with agent2, got %+v", lease)
+	}
+}
@@ -0,0 +1,343 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// A definition of done is a list of criteria, each checked off with a note
+// as the work is verified. The item's definition_of_done column keeps the
+// criteria as "; "-separated text, so lists and history show it as before.
+
+// ErrDoDIncomplete is wrapped by RequireCriteriaChecked errors when a task
+// has unchecked criteria.
+var ErrDoDIncomplete = errors.New("definition of done is incomplete")
+
+// SplitCriteria splits a definition of done written as text into criteria,
+// one per line or semicolon-separated.
+func SplitCriteria(text string) []string {
+	var criteria []string
+	for _, part := range strings.FieldsFunc(text, func(r rune) bool { return r == ';' || r == '\n' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			criteria = append(criteria, part)
+		}
+	}
+	return criteria
+}
+
+// criteriaText is the text form of criteria stored in definition_of_done,
+// or nil if there are none.
+func criteriaText(criteria []model.Criterion) *string {
+	if len(criteria) == 0 {
+		return nil
+	}
+	texts := make([]string, len(criteria))
+	for i, c := range criteria {
+		texts[i] = c.Text
+	}
+	text := strings.Join(texts, "; ")
+	return &text
+}
+
+// textCriteria returns unchecked criteria for the text form of a definition
+// of done.
+func textCriteria(text string) []model.Criterion {
+	var criteria []model.Criterion
+	for _, t := range SplitCriteria(text) {
+		criteria = append(criteria, model.Criterion{Text: t})
+	}
+	return criteria
+}
+
+// GetCriteria returns an item's definition of done criteria in order.
+func (db *DB) GetCriteria(itemID string) ([]model.Criterion, error) {
+	return getCriteria(db, itemID)
+}
+
+func getCriteria(q querier, itemID string) ([]model.Criterion, error) {
+	rows, err := q.Query(`
+		SELECT position, text, command, checked, note, checked_by, checked_at
+		FROM dod_criteria WHERE item_id = ? ORDER BY position`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get criteria: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var criteria []model.Criterion
+	for rows.Next() {
+		var c model.Criterion
+		var checkedAt sql.NullTime
+		if err := rows.Scan(&c.Position, &c.Text, &c.Command, &c.Checked, &c.Note, &c.CheckedBy, &checkedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan criterion: %w", err)
+		}
+		if checkedAt.Valid {
+			c.CheckedAt = &checkedAt.Time
+		}
+		criteria = append(criteria, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(criteria) == 0 {
+		return criteria, nil
+	}
+
+	// Attach the latest run of each criterion's current command
+	latest, err := latestVerifications(q, itemID)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range criteria {
+		if v := latest[c.Text]; v != nil && v.Command == c.Command {
+			criteria[i].Verification = v
+		}
+	}
+	return criteria, nil
+}
+
+// writeCriteria replaces an item's criteria, numbering them in order. A
+// criterion with the same text as a current one keeps its check state, and
+// its command unless a new one is given, so rewording one criterion doesn't
+// lose the progress on the others.
+func writeCriteria(q querier, itemID string, criteria []model.Criterion) error {
+	current, err := getCriteria(q, itemID)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(`DELETE FROM dod_criteria WHERE item_id = ?`, itemID); err != nil {
+		return fmt.Errorf("failed to replace criteria: %w", err)
+	}
+	for i, c := range criteria {
+		for j, old := range current {
+			if old.Text == c.Text && old.Position != 0 {
+				if c.Command == "" {
+					c.Command = old.Command
+				}
+				c.Checked, c.Note, c.CheckedBy, c.CheckedAt = old.Checked, old.Note, old.CheckedBy, old.CheckedAt
+				current[j].Position = 0 // Each old criterion matches once
+				break
+			}
+		}
+		_, err := q.Exec(`
+			INSERT INTO dod_criteria (item_id, position, text, command, checked, note, checked_by, checked_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			itemID, i+1, c.Text, c.Command, c.Checked, c.Note, c.CheckedBy, c.CheckedAt)
+		if err != nil {
+			return fmt.Errorf("failed to write criterion: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetDefinitionOfDone sets or clears an item's definition of done from its
+// text form, one criterion per line or semicolon-separated. Criteria that
+// are unchanged stay checked. Pass nil to clear the DoD.
+func (db *DB) SetDefinitionOfDone(id string, dod *string) error {
+	var criteria []model.Criterion
+	if dod != nil {
+		criteria = textCriteria(*dod)
+	}
+	return db.updateCriteria(id, "set definition of done", func([]model.Criterion) ([]model.Criterion, error) {
+		return criteria, nil
+	})
+}
+
+// AddCriterion appends a criterion to an item's definition of done, with an
+// optional shell command that verifies it.
+func (db *DB) AddCriterion(id, text, command string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("criterion cannot be empty")
+	}
+	if strings.ContainsAny(text, ";\n") {
+		return fmt.Errorf("criterion cannot contain semicolons or newlines; add each one separately")
+	}
+	return db.updateCriteria(id, "add criterion", func(current []model.Criterion) ([]model.Criterion, error) {
+		return append(current, model.Criterion{Text: text, Command: strings.TrimSpace(command)}), nil
+	})
+}
+
+// RemoveCriterion removes the criterion at position (1-based) from an item's
+// definition of done. Later criteria move up.
+func (db *DB) RemoveCriterion(id string, position int) error {
+	return db.updateCriteria(id, "remove criterion", func(current []model.Criterion) ([]model.Criterion, error) {
+		if position < 1 || position > len(current) {
+			return nil, criterionNotFound(id, position)
+		}
+		return append(current[:position-1:position-1], current[position:]...), nil
+	})
+}
+
+// updateCriteria replaces an item's criteria with update(current), keeping
+// definition_of_done in step and recording the change in history.
+func (db *DB) updateCriteria(id, action string, update func([]model.Criterion) ([]model.Criterion, error)) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := replaceCriteria(tx, id, action, db.actor, update); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// replaceCriteria is updateCriteria inside a transaction.
+func replaceCriteria(tx *sql.Tx, id, action, actor string, update func([]model.Criterion) ([]model.Criterion, error)) error {
+	var old sql.NullString
+	err := tx.QueryRow(`SELECT definition_of_done FROM items WHERE id = ? AND deleted_at IS NULL`, id).Scan(&old)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+
+	current, err := getCriteria(tx, id)
+	if err != nil {
+		return err
+	}
+	criteria, err := update(current)
+	if err != nil {
+		return err
+	}
+	if err := writeCriteria(tx, id, criteria); err != nil {
+		return err
+	}
+
+	updated := criteriaText(criteria)
+	if _, err := tx.Exec(`UPDATE items SET definition_of_done = ?, updated_at = ? WHERE id = ?`, updated, time.Now(), id); err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+	newValue := ""
+	if updated != nil {
+		newValue = *updated
+	}
+	if newValue != old.String {
+		return recordEvent(tx, id, EventDefinitionOfDone, old.String, newValue, actor)
+	}
+	return nil
+}
+
+// CheckCriterion checks off the criterion at position (1-based), with a note
+// giving the evidence, e.g. a CI link or test output.
+func (db *DB) CheckCriterion(id string, position int, note string) error {
+	return db.setCriterionChecked(id, position, true, strings.TrimSpace(note))
+}
+
+// UncheckCriterion marks the criterion at position (1-based) as not met
+// again, clearing its note.
+func (db *DB) UncheckCriterion(id string, position int) error {
+	return db.setCriterionChecked(id, position, false, "")
+}
+
+func (db *DB) setCriterionChecked(id string, position int, checked bool, note string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM items WHERE id = ? AND deleted_at IS NULL`, id).Scan(&n); err != nil {
+		return fmt.Errorf("failed to get item: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
+	}
+
+	var text string
+	var was bool
+	err = tx.QueryRow(`SELECT text, checked FROM dod_criteria WHERE item_id = ? AND position = ?`, id, position).Scan(&text, &was)
+	if err == sql.ErrNoRows {
+		return criterionNotFound(id, position)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get criterion: %w", err)
+	}
+
+	if err := applyCheck(tx, id, position, text, was, checked, note, db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// applyCheck marks a criterion that was (or wasn't) checked, recording the
+// change in history if its check state changed.
+func applyCheck(tx *sql.Tx, id string, position int, text string, was, checked bool, note, actor string) error {
+	if err := markCriterion(tx, id, position, checked, note, actor); err != nil {
+		return err
+	}
+	if was == checked {
+		return nil
+	}
+	oldValue, newValue := "", text
+	if !checked {
+		oldValue, newValue = text, ""
+	}
+	return recordEvent(tx, id, EventCriterion, oldValue, newValue, actor)
+}
+
+// markCriterion sets a criterion's check state without recording history.
+func markCriterion(ex execer, id string, position int, checked bool, note, actor string) error {
+	var checkedAt any
+	if checked {
+		checkedAt = time.Now()
+	} else {
+		actor = ""
+	}
+	_, err := ex.Exec(`
+		UPDATE dod_criteria SET checked = ?, note = ?, checked_by = ?, checked_at = ?
+		WHERE item_id = ? AND position = ?`,
+		checked, note, actor, checkedAt, id, position)
+	if err != nil {
+		return fmt.Errorf("failed to update criterion: %w", err)
+	}
+	_, err = ex.Exec(`UPDATE items SET updated_at = ? WHERE id = ?`, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update item: %w", err)
+	}
+	return nil
+}
+
+func criterionNotFound(id string, position int) error {
+	return fmt.Errorf("criterion %w: %s has no criterion %d (use 'prog dod %s' to see its criteria)", ErrNotFound, id, position, id)
+}
+
+// RequireCriteriaChecked returns an error wrapping ErrDoDIncomplete, listing
+// what is left, if the item has unchecked criteria.
+func (db *DB) RequireCriteriaChecked(id string) error {
+	return requireCriteriaChecked(db, id)
+}
+
+func requireCriteriaChecked(q querier, id string) error {
+	criteria, err := getCriteria(q, id)
+	if err != nil {
+		return err
+	}
+	var unchecked []string
+	for _, c := range criteria {
+		if !c.Checked {
+			unchecked = append(unchecked, fmt.Sprintf("%d. %s", c.Position, c.Text))
+		}
+	}
+	if len(unchecked) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s has %d of %d criteria unchecked:\n  %s",
+		ErrDoDIncomplete, id, len(unchecked), len(criteria), strings.Join(unchecked, "\n  "))
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func criteriaSummary(t *testing.T, db *DB, id string) []string {
+	t.Helper()
+	criteria, err := db.GetCriteria(id)
+	if err != nil {
+		t.Fatalf("failed to get criteria: %v", err)
+	}
+	var got []string
+	for _, c := range criteria {
+		mark := "[ ]"
+		if c.Checked {
+			mark = "[x]"
+		}
+		s := mark + " " + c.Text
+		if c.Command != "" {
+			s += " $ " + c.Command
+		}
+		if c.Note != "" {
+			s += " (" + c.Note + " by " + c.CheckedBy + ")"
+		}
+		got = append(got, s)
+	}
+	return got
+}
+
+func setDoD(t *testing.T, db *DB, id, dod string) {
+	t.Helper()
+	if err := db.SetDefinitionOfDone(id, &dod); err != nil {
+		t.Fatalf("failed to set definition of done: %v", err)
+	}
+}
+
+func TestSetDefinitionOfDone_SplitsCriteria(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Task")
+
+	setDoD(t, db, task.ID, "Tests pass;Docs updated\n No lint warnings ;")
+	assertEvents(t, criteriaSummary(t, db, task.ID), []string{
+		"[ ] Tests pass",
+		"[ ] Docs updated",
+		"[ ] No lint warnings",
+	})
+	item, _ := db.GetItem(task.ID)
+	if item.DefinitionOfDone == nil || *item.DefinitionOfDone != "Tests pass; Docs updated; No lint warnings" {
+		t.Errorf("definition_of_done = %v, want criteria joined with '; '", item.DefinitionOfDone)
+	}
+
+	if err := db.SetDefinitionOfDone(task.ID, nil); err != nil {
+		t.Fatalf("failed to clear: %v", err)
+	}
+	if got := criteriaSummary(t, db, task.ID); len(got) != 0 {
+		t.Errorf("criteria after clearing = %v", got)
+	}
+}
+
+func TestCriteria_CheckAndEdit(t *testing.T) {
+	db := setupTestDB(t).WithActor("alice")
+	task := createTestItem(t, db, "Task")
+	setDoD(t, db, task.ID, "Tests pass; Docs updated")
+	if err := db.AddCriterion(task.ID, "Builds", "go build ./..."); err != nil {
+		t.Fatalf("failed to add criterion: %v", err)
+	}
+
+	if err := db.CheckCriterion(task.ID, 1, "CI run 42 green"); err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	if err := db.CheckCriterion(task.ID, 3, ""); err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	if err := db.CheckCriterion(task.ID, 4, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("checking a missing criterion: expected ErrNotFound, got %v", err)
+	}
+
+	// Rewording one criterion keeps progress on the others
+	setDoD(t, db, task.ID, "Tests pass; User docs updated; Builds")
+	assertEvents(t, criteriaSummary(t, db, task.ID), []string{
+		"[x] Tests pass (CI run 42 green by alice)",
+		"[ ] User docs updated",
+		"[x] Builds $ go build ./...",
+	})
+
+	if err := db.RemoveCriterion(task.ID, 2); err != nil {
+		t.Fatalf("failed to remove criterion: %v", err)
+	}
+	if err := db.UncheckCriterion(task.ID, 2); err != nil {
+		t.Fatalf("failed to uncheck: %v", err)
+	}
+	assertEvents(t, criteriaSummary(t, db, task.ID), []string{
+		"[x] Tests pass (CI run 42 green by alice)",
+		"[ ] Builds $ go build ./...",
+	})
+
+	events, _ := db.GetEvents(task.ID)
+	var checks []string
+	for _, e := range events {
+		if e.Field == EventCriterion {
+			checks = append(checks, e.OldValue+">"+e.NewValue)
+		}
+	}
+	assertEvents(t, checks, []string{">Tests pass", ">Builds", "Builds>"})
+}
+
+func TestRequireCriteriaChecked(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Task")
+	if err := db.RequireCriteriaChecked(task.ID); err != nil {
+		t.Errorf("task without criteria: %v", err)
+	}
+
+	setDoD(t, db, task.ID, "Tests pass; Docs updated")
+	if err := db.CheckCriterion(task.ID, 2, ""); err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	err := db.RequireCriteriaChecked(task.ID)
+	if !errors.Is(err, ErrDoDIncomplete) {
+		t.Fatalf("expected ErrDoDIncomplete, got %v", err)
+	}
+	if err := db.CheckCriterion(task.ID, 1, ""); err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	if err := db.RequireCriteriaChecked(task.ID); err != nil {
+		t.Errorf("all criteria checked: %v", err)
+	}
+}
+
+func TestUndo_Criteria(t *testing.T) {
+	db := setupTestDB(t).WithActor("alice")
+	task := createTestItem(t, db, "Task")
+	setDoD(t, db, task.ID, "Tests pass; Docs updated")
+	if err := db.CheckCriterion(task.ID, 1, "green"); err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	setDoD(t, db, task.ID, "Tests pass")
+
+	// Undo the edit, then the check
+	if _, err := db.Undo("alice", 1); err != nil {
+		t.Fatalf("failed to undo edit: %v", err)
+	}
+	assertEvents(t, criteriaSummary(t, db, task.ID), []string{
+		"[x] Tests pass (green by alice)",
+		"[ ] Docs updated",
+	})
+	if _, err := db.Undo("alice", 1); err != nil {
+		t.Fatalf("failed to undo check: %v", err)
+	}
+	assertEvents(t, criteriaSummary(t, db, task.ID), []string{
+		"[ ] Tests pass",
+		"[ ] Docs updated",
+	})
+}
+
+func TestMigrate_SplitsDefinitionOfDone(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Task")
+	other := createTestItem(t, db, "Other")
+
+	// Roll back to before criteria existed, with free-text DoDs
+	for _, stmt := range []string{
+		`DROP TABLE dod_criteria`,
+		`DROP INDEX idx_learnings_path`,
+		`DROP TRIGGER learnings_ai`,
+		`DROP TRIGGER learnings_ad`,
+		`DROP TRIGGER learnings_au`,
+		`ALTER TABLE learnings DROP COLUMN path`,
+		`ALTER TABLE learnings DROP COLUMN title`,
+		`ALTER TABLE learnings DROP COLUMN provenance`,
+		`ALTER TABLE learnings DROP COLUMN page_hash`,
+		`ALTER TABLE learnings DROP COLUMN review_reason`,
+		`UPDATE items SET definition_of_done = 'Tests pass; Docs updated' || char(10) || 'Reviewed' WHERE id = '` + task.ID + `'`,
+		`UPDATE items SET definition_of_done = '  ' WHERE id = '` + other.ID + `'`,
+		`PRAGMA user_version = 12`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to run %q: %v", stmt, err)
+		}
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	assertEvents(t, criteriaSummary(t, db, task.ID), []string{
+		"[ ] Tests pass",
+		"[ ] Docs updated",
+		"[ ] Reviewed",
+	})
+	if got := criteriaSummary(t, db, other.ID); len(got) != 0 {
+		t.Errorf("blank DoD became criteria %v", got)
+	}
+	criteria, _ := db.GetCriteria(task.ID)
+	if criteria[2].Position != 3 {
+		t.Errorf("positions = %+v, want 1-based and consecutive", criteria)
+	}
+}
@@ -6,6 +6,7 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,7 +16,11 @@ import (
 
 // SchemaVersion is the current schema version.
 // Increment this when adding new migrations.
-const SchemaVersion = 3
+const SchemaVersion = 20
+
+// ErrNotFound is wrapped by errors for items, labels, learnings and other
+// records that don't exist.
+var ErrNotFound = errors.New("not found")
 
 // baseSchema is the original schema (version 1).
 // New tables should be added via migrations, not here.
@@ -143,12 +148,324 @@ CREATE INDEX IF NOT EXISTS idx_item_labels_label ON item_labels(label_id);
 	// Version 3: Add definition_of_done to items
 	`
 ALTER TABLE items ADD COLUMN definition_of_done TEXT;
+`,
+	// Version 4: Add leases for atomic task claiming.
+	// Times are stored as Unix milliseconds so expiry can be compared in SQL.
+	`
+CREATE TABLE IF NOT EXISTS leases (
+	item_id TEXT PRIMARY KEY REFERENCES items(id),
+	actor TEXT NOT NULL,
+	claimed_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_leases_expires ON leases(expires_at);
+`,
+	// Version 5: Add orchestrator daemon assignments
+	`
+CREATE TABLE IF NOT EXISTS assignments (
+	id INTEGER PRIMARY KEY,
+	item_id TEXT NOT NULL REFERENCES items(id),
+	agent_id TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'implementer',
+	state TEXT NOT NULL DEFAULT 'queued',
+	progress INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignments_item ON assignments(item_id);
+CREATE INDEX IF NOT EXISTS idx_assignments_state ON assignments(state);
+`,
+	// Version 6: Add item areas for conflict detection
+	`
+CREATE TABLE IF NOT EXISTS item_areas (
+	item_id TEXT NOT NULL REFERENCES items(id),
+	area TEXT NOT NULL,
+	PRIMARY KEY (item_id, area)
+);
+
+CREATE INDEX IF NOT EXISTS idx_item_areas_area ON item_areas(area);
+`,
+	// Version 7: Add item change history
+	`
+CREATE TABLE IF NOT EXISTS item_events (
+	id INTEGER PRIMARY KEY,
+	item_id TEXT NOT NULL,
+	field TEXT NOT NULL,
+	old_value TEXT,
+	new_value TEXT,
+	actor TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_item_events_item ON item_events(item_id);
+`,
+	// Version 8: Record who created, works on, logs and learns
+	`
+ALTER TABLE items ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE items ADD COLUMN assignee TEXT NOT NULL DEFAULT '';
+ALTER TABLE logs ADD COLUMN actor TEXT NOT NULL DEFAULT '';
+ALTER TABLE learnings ADD COLUMN actor TEXT NOT NULL DEFAULT '';
+
+-- Tasks already claimed are assigned to their lease holder
+UPDATE items SET assignee = (SELECT actor FROM leases WHERE leases.item_id = items.id)
+WHERE id IN (SELECT item_id FROM leases);
+
+CREATE INDEX IF NOT EXISTS idx_items_assignee ON items(assignee);
+`,
+	// Version 9: Make item history reversible for undo. Deletions keep a
+	// snapshot of the item; undo appends events that point at what they revert.
+	`
+ALTER TABLE item_events ADD COLUMN snapshot TEXT;
+ALTER TABLE item_events ADD COLUMN reverts INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_item_events_actor ON item_events(actor);
+CREATE INDEX IF NOT EXISTS idx_item_events_reverts ON item_events(reverts);
+`,
+	// Version 10: Soft delete. Deleted items stay in the trash until purged.
+	`
+ALTER TABLE items ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_items_deleted ON items(deleted_at);
+`,
+	// Version 11: Change feed. Every item, log, dependency, label and learning
+	// change is appended in order so readers can follow along from a cursor.
+	`
+CREATE TABLE IF NOT EXISTS changes (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	project TEXT NOT NULL DEFAULT '',
+	actor TEXT NOT NULL DEFAULT '',
+	old_value TEXT NOT NULL DEFAULT '',
+	new_value TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_changes_project ON changes(project);
+`,
+	// Version 12: Outgoing webhooks. Status transitions queue deliveries in
+	// an outbox that is drained, with retries, by a dispatcher. Attempt
+	// times are Unix milliseconds so due deliveries can be found in SQL.
+	`
+CREATE TABLE IF NOT EXISTS webhooks (
+	id TEXT PRIMARY KEY,
+	project TEXT NOT NULL,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	events TEXT NOT NULL,
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id INTEGER PRIMARY KEY,
+	webhook_id TEXT NOT NULL REFERENCES webhooks(id),
+	event TEXT NOT NULL,
+	item_id TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	state TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt INTEGER NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_project ON webhooks(project);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(state, next_attempt);
+`,
+	// Version 13: Checkable definition of done. Each criterion is a row that
+	// can be checked off with a note; definition_of_done keeps the text form.
+	// Existing text is split into criteria on semicolons and newlines.
+	`
+CREATE TABLE IF NOT EXISTS dod_criteria (
+	item_id TEXT NOT NULL REFERENCES items(id),
+	position INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	command TEXT NOT NULL DEFAULT '',
+	checked INTEGER NOT NULL DEFAULT 0,
+	note TEXT NOT NULL DEFAULT '',
+	checked_by TEXT NOT NULL DEFAULT '',
+	checked_at DATETIME,
+	PRIMARY KEY (item_id, position)
+);
+
+INSERT INTO dod_criteria (item_id, position, text)
+WITH RECURSIVE split(item_id, n, part, rest) AS (
+	SELECT id, 0, '', REPLACE(definition_of_done, char(10), ';') || ';'
+	FROM items WHERE TRIM(COALESCE(definition_of_done, '')) != ''
+	UNION ALL
+	SELECT item_id, n + 1, TRIM(SUBSTR(rest, 1, INSTR(rest, ';') - 1)), SUBSTR(rest, INSTR(rest, ';') + 1)
+	FROM split WHERE rest != ''
+)
+SELECT item_id, ROW_NUMBER() OVER (PARTITION BY item_id ORDER BY n), part
+FROM split WHERE part != '';
+`,
+	// Version 14: Verification records. prog verify runs each criterion's
+	// command and records the result; records find their criterion by text,
+	// so they follow it when criteria are renumbered.
+	`
+CREATE TABLE IF NOT EXISTS verifications (
+	id INTEGER PRIMARY KEY,
+	item_id TEXT NOT NULL REFERENCES items(id),
+	criterion TEXT NOT NULL,
+	command TEXT NOT NULL,
+	dir TEXT NOT NULL DEFAULT '',
+	exit_code INTEGER NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	output TEXT NOT NULL DEFAULT '',
+	ran_by TEXT NOT NULL DEFAULT '',
+	ran_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_verifications_item ON verifications(item_id, criterion);
+`,
+	// Version 15: Reviews. Assigning a reviewer adds a pending review, which
+	// the reviewer's verdict decides; a resubmitted task gets new rows.
+	`
+CREATE TABLE IF NOT EXISTS reviews (
+	id INTEGER PRIMARY KEY,
+	item_id TEXT NOT NULL REFERENCES items(id),
+	reviewer TEXT NOT NULL,
+	verdict TEXT NOT NULL DEFAULT 'pending',
+	note TEXT NOT NULL DEFAULT '',
+	requested_by TEXT NOT NULL DEFAULT '',
+	requested_at DATETIME NOT NULL,
+	decided_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_item ON reviews(item_id);
+CREATE INDEX IF NOT EXISTS idx_reviews_verdict ON reviews(verdict, reviewer);
+`,
+	// Version 16: Learning pages. A learning indexed from a Markdown page in
+	// the repo is a stub that points to it by path; page_hash skips pages
+	// that haven't changed when reindexing. The title joins the FTS index.
+	`
+ALTER TABLE learnings ADD COLUMN path TEXT;
+ALTER TABLE learnings ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE learnings ADD COLUMN provenance TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE learnings ADD COLUMN page_hash TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_learnings_path ON learnings(project, path) WHERE path IS NOT NULL;
+
+DROP TRIGGER IF EXISTS learnings_ai;
+DROP TRIGGER IF EXISTS learnings_ad;
+DROP TRIGGER IF EXISTS learnings_au;
+DROP TABLE IF EXISTS learnings_fts;
+
+CREATE VIRTUAL TABLE learnings_fts USING fts5(
+	title,
+	summary,
+	detail,
+	content='learnings',
+	content_rowid='rowid'
+);
+
+CREATE TRIGGER learnings_ai AFTER INSERT ON learnings BEGIN
+	INSERT INTO learnings_fts(rowid, title, summary, detail)
+	VALUES (NEW.rowid, NEW.title, NEW.summary, NEW.detail);
+END;
+
+CREATE TRIGGER learnings_ad AFTER DELETE ON learnings BEGIN
+	INSERT INTO learnings_fts(learnings_fts, rowid, title, summary, detail)
+	VALUES ('delete', OLD.rowid, OLD.title, OLD.summary, OLD.detail);
+END;
+
+CREATE TRIGGER learnings_au AFTER UPDATE ON learnings BEGIN
+	INSERT INTO learnings_fts(learnings_fts, rowid, title, summary, detail)
+	VALUES ('delete', OLD.rowid, OLD.title, OLD.summary, OLD.detail);
+	INSERT INTO learnings_fts(rowid, title, summary, detail)
+	VALUES (NEW.rowid, NEW.title, NEW.summary, NEW.detail);
+END;
+
+INSERT INTO learnings_fts(learnings_fts) VALUES ('rebuild');
+`,
+	// Version 17: Relevance feedback. Agents record whether a learning they
+	// retrieved looked relevant and whether it was; learnings that often
+	// look relevant but aren't rank lower.
+	`
+CREATE TABLE IF NOT EXISTS learning_feedback (
+	id INTEGER PRIMARY KEY,
+	learning_id TEXT NOT NULL REFERENCES learnings(id),
+	task_id TEXT REFERENCES items(id),
+	expected_relevant INTEGER NOT NULL,
+	actually_relevant INTEGER NOT NULL,
+	mismatch_reason TEXT NOT NULL DEFAULT '',
+	task_context TEXT NOT NULL DEFAULT '',
+	actor TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_learning_feedback_learning ON learning_feedback(learning_id);
+`,
+	// Version 18: Learning files. The files a learning is about, one row per
+	// path or glob, so learnings can be looked up by the file being edited.
+	// Backfilled from the files JSON, which is kept for reading.
+	`
+CREATE TABLE IF NOT EXISTS learning_files (
+	learning_id TEXT NOT NULL REFERENCES learnings(id),
+	path TEXT NOT NULL,
+	glob INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (learning_id, path)
+);
+
+CREATE INDEX IF NOT EXISTS idx_learning_files_path ON learning_files(path);
+CREATE INDEX IF NOT EXISTS idx_learning_files_glob ON learning_files(glob);
+
+INSERT OR IGNORE INTO learning_files (learning_id, path, glob)
+SELECT id, path, path GLOB '*[*?[]*' FROM (
+	SELECT l.id, RTRIM(CASE WHEN TRIM(j.value) LIKE './%' THEN SUBSTR(TRIM(j.value), 3) ELSE TRIM(j.value) END, '/') AS path
+	FROM learnings l, json_each(l.files) j
+	WHERE json_valid(l.files) AND j.type = 'text'
+) WHERE path != '';
+`,
+	// Version 19: Why a learning needs review. prog learn audit flags
+	// learnings whose files changed since and records what changed.
+	`
+ALTER TABLE learnings ADD COLUMN review_reason TEXT NOT NULL DEFAULT '';
+`,
+	// Version 20: Hybrid search. Each learning's words and their trigrams,
+	// weighted for TF-IDF scoring (see internal/search), and synonyms that
+	// expand queries mentioning a concept. Learnings are indexed as they are
+	// written; those from before are indexed by the first search.
+	`
+CREATE TABLE IF NOT EXISTS learning_terms (
+	learning_id TEXT NOT NULL REFERENCES learnings(id),
+	term TEXT NOT NULL,
+	weight REAL NOT NULL,
+	PRIMARY KEY (learning_id, term)
+);
+
+CREATE INDEX IF NOT EXISTS idx_learning_terms_term ON learning_terms(term);
+
+CREATE TABLE IF NOT EXISTS concept_synonyms (
+	concept_id TEXT NOT NULL REFERENCES concepts(id),
+	synonym TEXT NOT NULL,
+	PRIMARY KEY (concept_id, synonym)
+);
 `,
 }
 
 // DB wraps a SQL database connection with task-specific operations.
 type DB struct {
 	*sql.DB
+	actor string // Who changes are attributed to; see WithActor
+	hooks Hooks  // Lifecycle hooks; see WithHooks
+}
+
+// WithActor returns a DB that attributes the changes it makes to actor: in
+// item history, as the creator of new items and the author of logs and
+// learnings, and as the assignee of tasks it starts. It shares the
+// connection pool and hooks with db.
+func (db *DB) WithActor(actor string) *DB {
+	return &DB{DB: db.DB, actor: actor, hooks: db.hooks}
+}
+
+// Actor returns who changes made through db are attributed to.
+func (db *DB) Actor() string {
+	return db.actor
 }
 
 // DefaultPath returns the default database path (~/.prog/prog.db)
@@ -172,7 +489,11 @@ func Open(path string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", path)
+	// busy_timeout is also passed in the DSN so it applies to every pooled
+	// connection, not just the one that runs the PRAGMA below. Without it,
+	// concurrent writers (e.g. agents racing on 'prog claim') fail immediately
+	// with SQLITE_BUSY on any connection other than the first.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -199,7 +520,7 @@ func Open(path string) (*DB, error) {
 		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
 }
 
 // Init creates the schema for a fresh database.
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -132,8 +133,8 @@ func TestGetItem_NotFound(t *testing.T) {
 	db := setupTestDB(t)
 
 	_, err := db.GetItem("nonexistent")
-	if err == nil {
-		t.Error("expected error for nonexistent item")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
 	}
 }
 
@@ -472,3 +473,37 @@ func TestSetDefinitionOfDone_NotFound(t *testing.T) {
 		t.Error("expected error for nonexistent item")
 	}
 }
+
+func TestEditItem(t *testing.T) {
+	db := setupTestDB(t)
+	epic := createTestEpic(t, db, "Epic", "")
+	task := createTestItem(t, db, "Task")
+	if err := db.AddCriterion(task.ID, "Tests pass", ""); err != nil {
+		t.Fatalf("failed to add criterion: %v", err)
+	}
+
+	// A rejected change leaves the others undone too
+	title, done := "Renamed", model.StatusDone
+	err := db.EditItem(task.ID, ItemEdit{Title: &title, Parent: &task.ID})
+	if err == nil {
+		t.Fatal("expected error for a task as parent")
+	}
+	err = db.EditItem(task.ID, ItemEdit{Title: &title, Status: &done})
+	if !errors.Is(err, ErrDoDIncomplete) {
+		t.Fatalf("expected ErrDoDIncomplete, got %v", err)
+	}
+	got, _ := db.GetItem(task.ID)
+	if got.Title != "Task" || got.Status != model.StatusOpen {
+		t.Errorf("task = %q/%s, want it unchanged", got.Title, got.Status)
+	}
+
+	// The done gates see the definition of done as edited
+	none := ""
+	if err := db.EditItem(task.ID, ItemEdit{Title: &title, DefinitionOfDone: &none, Parent: &epic.ID, Status: &done}); err != nil {
+		t.Fatalf("failed to edit: %v", err)
+	}
+	got, _ = db.GetItem(task.ID)
+	if got.Title != title || got.DefinitionOfDone != nil || got.ParentID == nil || *got.ParentID != epic.ID || got.Status != done {
+		t.Errorf("task = %+v, want every change made", got)
+	}
+}
@@ -1,32 +1,159 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/baiirun/prog/internal/model"
 )
 
-// AddDep adds a dependency between items.
+// ErrDepCycle is returned when a dependency would make an item wait on itself.
+var ErrDepCycle = errors.New("dependency cycle")
+
+// AddDep adds a dependency between items. A dependency that would create a
+// cycle is rejected with ErrDepCycle and the cycle's path. An epic waits on
+// its children, so those count too: a task can't depend on its own epic.
 func (db *DB) AddDep(itemID, dependsOnID string) error {
 	// Verify both items exist
 	var count int
-	err := db.QueryRow(`SELECT COUNT(*) FROM items WHERE id IN (?, ?)`, itemID, dependsOnID).Scan(&count)
+	err := db.QueryRow(`SELECT COUNT(*) FROM items WHERE id IN (?, ?) AND deleted_at IS NULL`, itemID, dependsOnID).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("failed to verify items: %w", err)
 	}
-	if count != 2 {
-		return fmt.Errorf("one or both items not found: %s, %s (use 'prog list' to see available items)", itemID, dependsOnID)
+	if itemID != dependsOnID && count != 2 {
+		return fmt.Errorf("one or both items %w: %s, %s (use 'prog list' to see available items)", ErrNotFound, itemID, dependsOnID)
+	}
+	if count == 0 {
+		return fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, itemID)
+	}
+
+	// Insert first so the transaction holds the write lock while it checks:
+	// otherwise two opposite edges added at once could each pass the check
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	_, err = db.Exec(`
+	result, err := tx.Exec(`
 		INSERT OR IGNORE INTO deps (item_id, depends_on) VALUES (?, ?)`,
 		itemID, dependsOnID)
 	if err != nil {
 		return fmt.Errorf("failed to add dependency: %w", err)
 	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil
+	}
+
+	// Reject edges that would close a loop: those items could never become ready
+	path, err := depPath(tx, dependsOnID, itemID)
+	if err != nil {
+		return err
+	}
+	if path != nil {
+		cycle := append([]string{itemID}, path...)
+		return fmt.Errorf("%w: %s (each waits on the next)", ErrDepCycle, strings.Join(cycle, " -> "))
+	}
+	if err := recordEvent(tx, itemID, EventDependency, "", dependsOnID, db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
+// depPath returns the chain of dependencies leading from one item to another,
+// both ends included, or nil if to isn't reachable from from. Epics lead to
+// their children, as in waitEdges.
+func depPath(q querier, from, to string) ([]string, error) {
+	if from == to {
+		return []string{from}, nil
+	}
+	edges, err := waitEdges(q)
+	if err != nil {
+		return nil, err
+	}
+
+	// Breadth-first so the reported cycle is the shortest one
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[cur] {
+			if _, seen := prev[next]; seen {
+				continue
+			}
+			prev[next] = cur
+			if next == to {
+				var path []string
+				for id := to; id != ""; id = prev[id] {
+					path = append([]string{id}, path...)
+				}
+				return path, nil
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil, nil
+}
+
+// depEdges returns every dependency as item -> items it depends on. Edges
+// touching items in the trash are left out.
+func depEdges(q querier) (map[string][]string, error) {
+	rows, err := q.Query(`
+		SELECT item_id, depends_on FROM deps
+		WHERE item_id NOT IN (SELECT id FROM items WHERE deleted_at IS NOT NULL)
+		  AND depends_on NOT IN (SELECT id FROM items WHERE deleted_at IS NOT NULL)
+		ORDER BY item_id, depends_on`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deps: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	edges := make(map[string][]string)
+	for rows.Next() {
+		var itemID, dependsOn string
+		if err := rows.Scan(&itemID, &dependsOn); err != nil {
+			return nil, fmt.Errorf("failed to scan dep: %w", err)
+		}
+		edges[itemID] = append(edges[itemID], dependsOn)
+	}
+	return edges, rows.Err()
+}
+
+// waitEdges returns depEdges plus an edge from every epic to each of its
+// children: an epic's derived status waits on its children as surely as an
+// item waits on its dependencies, so both can close a loop.
+func waitEdges(q querier) (map[string][]string, error) {
+	edges, err := depEdges(q)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(`
+		SELECT parent_id, id FROM items
+		WHERE parent_id IS NOT NULL AND deleted_at IS NULL
+		  AND parent_id NOT IN (SELECT id FROM items WHERE deleted_at IS NOT NULL)
+		ORDER BY parent_id, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query children: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var parentID, childID string
+		if err := rows.Scan(&parentID, &childID); err != nil {
+			return nil, fmt.Errorf("failed to scan child: %w", err)
+		}
+		edges[parentID] = append(edges[parentID], childID)
+	}
+	return edges, rows.Err()
+}
+
 // GetDeps returns the IDs of items that the given item depends on.
 func (db *DB) GetDeps(itemID string) ([]string, error) {
 	rows, err := db.Query(`SELECT depends_on FROM deps WHERE item_id = ?`, itemID)
@@ -80,11 +207,12 @@ func (db *DB) GetAllDeps(project string) ([]DepEdge, error) {
 			d.depends_on, i2.title, i2.status, i2.type
 		FROM deps d
 		JOIN items i1 ON d.item_id = i1.id
-		JOIN items i2 ON d.depends_on = i2.id`
+		JOIN items i2 ON d.depends_on = i2.id
+		WHERE i1.deleted_at IS NULL AND i2.deleted_at IS NULL`
 	args := []any{}
 
 	if project != "" {
-		query += ` WHERE i1.project = ?`
+		query += ` AND i1.project = ?`
 		args = append(args, project)
 	}
 	query += ` ORDER BY i1.priority, i1.id`
@@ -122,3 +250,240 @@ func (db *DB) GetAllDeps(project string) ([]DepEdge, error) {
 	}
 	return edges, rows.Err()
 }
+
+// DepGraph is a dependency graph ready for export: the items involved, with
+// the epics containing them, and the edges between them.
+type DepGraph struct {
+	Nodes []model.Item // Ordered by priority, then age; epic statuses are derived
+	Edges []DepEdge
+}
+
+// GetDepGraph returns the dependency graph of a project, or of one epic's
+// subtree when epicID is set. An epic's subtree includes all its descendants,
+// with or without dependencies, plus the items they depend on or block.
+// Ancestor epics of every node are included so the graph can be drawn with
+// epics grouping their children.
+func (db *DB) GetDepGraph(project, epicID string) (*DepGraph, error) {
+	items, err := db.queryItems(`
+		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_by, assignee, created_at, updated_at
+		FROM items
+		WHERE deleted_at IS NULL
+		ORDER BY priority ASC, created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.Item, len(items))
+	children := make(map[string][]string)
+	for i := range items {
+		byID[items[i].ID] = &items[i]
+		if items[i].ParentID != nil {
+			children[*items[i].ParentID] = append(children[*items[i].ParentID], items[i].ID)
+		}
+	}
+
+	include := make(map[string]bool)
+	graph := &DepGraph{}
+	if epicID != "" {
+		epic, ok := byID[epicID]
+		if !ok {
+			return nil, fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, epicID)
+		}
+		if epic.Type != model.ItemTypeEpic {
+			return nil, fmt.Errorf("%s is not an epic", epicID)
+		}
+		var walk func(string)
+		walk = func(id string) {
+			include[id] = true
+			for _, child := range children[id] {
+				walk(child)
+			}
+		}
+		walk(epicID)
+
+		all, err := db.GetAllDeps("")
+		if err != nil {
+			return nil, err
+		}
+		members := make(map[string]bool, len(include))
+		for id := range include {
+			members[id] = true
+		}
+		for _, e := range all {
+			if members[e.ItemID] || members[e.DependsOnID] {
+				graph.Edges = append(graph.Edges, e)
+				include[e.ItemID] = true
+				include[e.DependsOnID] = true
+			}
+		}
+	} else {
+		graph.Edges, err = db.GetAllDeps(project)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range graph.Edges {
+			include[e.ItemID] = true
+			include[e.DependsOnID] = true
+		}
+	}
+
+	// Containing epics, so children can be grouped under them
+	for id := range include {
+		for item := byID[id]; item != nil && item.ParentID != nil; item = byID[*item.ParentID] {
+			include[*item.ParentID] = true
+		}
+	}
+
+	for _, item := range items {
+		if include[item.ID] {
+			graph.Nodes = append(graph.Nodes, item)
+		}
+	}
+	return graph, nil
+}
+
+// DanglingDep is a dependency edge with an endpoint that no longer exists.
+type DanglingDep struct {
+	ItemID    string
+	DependsOn string
+	Missing   string // The endpoint that doesn't exist (ItemID if both are gone)
+}
+
+// GraphIssues are integrity problems found in the dependency graph.
+type GraphIssues struct {
+	Cycles   [][]string    // Each cycle as a path starting and ending at the same item
+	Dangling []DanglingDep // Edges to or from deleted items
+}
+
+// Count returns the total number of problems.
+func (g *GraphIssues) Count() int {
+	return len(g.Cycles) + len(g.Dangling)
+}
+
+// CheckGraph finds dependency cycles and edges to deleted items, which older
+// databases may contain. Items in a cycle never become ready. Cycles through
+// an epic and its children are found too (see waitEdges). If project is
+// non-empty only problems touching that project's items are reported.
+func (db *DB) CheckGraph(project string) (*GraphIssues, error) {
+	projects, err := db.itemProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	edges, err := waitEdges(db)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(edges))
+	for id := range edges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	inScope := func(id string) bool {
+		p, ok := projects[id]
+		return ok && (project == "" || p == project)
+	}
+
+	issues := &GraphIssues{}
+	for _, id := range ids {
+		for _, dep := range edges[id] {
+			_, itemExists := projects[id]
+			_, depExists := projects[dep]
+			if itemExists && depExists {
+				continue
+			}
+			if project != "" && !inScope(id) && !inScope(dep) {
+				continue
+			}
+			missing := dep
+			if !itemExists {
+				missing = id
+			}
+			issues.Dangling = append(issues.Dangling, DanglingDep{ItemID: id, DependsOn: dep, Missing: missing})
+		}
+	}
+
+	for _, cycle := range findCycles(ids, edges) {
+		for _, id := range cycle {
+			if inScope(id) {
+				issues.Cycles = append(issues.Cycles, cycle)
+				break
+			}
+		}
+	}
+	return issues, nil
+}
+
+// itemProjects returns the project of every item, keyed by ID.
+func (db *DB) itemProjects() (map[string]string, error) {
+	rows, err := db.Query(`SELECT id, project FROM items`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query items: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	projects := make(map[string]string)
+	for rows.Next() {
+		var id, project string
+		if err := rows.Scan(&id, &project); err != nil {
+			return nil, fmt.Errorf("failed to scan item: %w", err)
+		}
+		projects[id] = project
+	}
+	return projects, rows.Err()
+}
+
+// findCycles walks the graph depth-first and returns a cycle for every back
+// edge found, rotated to start at its smallest ID. Every strongly connected
+// component with a loop yields at least one cycle.
+func findCycles(ids []string, edges map[string][]string) [][]string {
+	const (
+		unvisited = iota
+		onStack
+		finished
+	)
+	state := make(map[string]int)
+	seen := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = onStack
+		stack = append(stack, id)
+		for _, next := range edges[id] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case onStack:
+				start := len(stack) - 1
+				for stack[start] != next {
+					start--
+				}
+				loop := append([]string(nil), stack[start:]...)
+				// Rotate so the same cycle found from another entry point dedupes
+				minIdx := 0
+				for i, v := range loop {
+					if v < loop[minIdx] {
+						minIdx = i
+					}
+				}
+				loop = append(loop[minIdx:], loop[:minIdx]...)
+				key := strings.Join(loop, " ")
+				if !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, append(loop, loop[0]))
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = finished
+	}
+
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return cycles
+}
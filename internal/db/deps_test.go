@@ -1,6 +1,10 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -286,3 +290,303 @@ func TestGetAllDeps_Empty(t *testing.T) {
 		t.Errorf("expected 0 edges, got %d", len(edges))
 	}
 }
+
+func TestAddDep_RejectsSelf(t *testing.T) {
+	db := setupTestDB(t)
+
+	task := createTestItem(t, db, "Task 1")
+
+	err := db.AddDep(task.ID, task.ID)
+	if !errors.Is(err, ErrDepCycle) {
+		t.Fatalf("err = %v, want ErrDepCycle", err)
+	}
+
+	deps, _ := db.GetDeps(task.ID)
+	if len(deps) != 0 {
+		t.Errorf("self dependency was stored: %v", deps)
+	}
+}
+
+func TestAddDep_RejectsCycle(t *testing.T) {
+	db := setupTestDB(t)
+
+	a := createTestItem(t, db, "A")
+	b := createTestItem(t, db, "B")
+	c := createTestItem(t, db, "C")
+
+	// c depends on b, b depends on a
+	if err := db.AddDep(c.ID, b.ID); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+	if err := db.AddDep(b.ID, a.ID); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+
+	// a depending on c would close the loop a -> c -> b -> a
+	err := db.AddDep(a.ID, c.ID)
+	if !errors.Is(err, ErrDepCycle) {
+		t.Fatalf("err = %v, want ErrDepCycle", err)
+	}
+	want := strings.Join([]string{a.ID, c.ID, b.ID, a.ID}, " -> ")
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("err = %q, want path %q", err, want)
+	}
+
+	// Unrelated edges are still fine
+	d := createTestItem(t, db, "D")
+	if err := db.AddDep(a.ID, d.ID); err != nil {
+		t.Errorf("non-cyclic dep rejected: %v", err)
+	}
+}
+
+func TestAddDep_ConcurrentOppositeEdges(t *testing.T) {
+	db := setupTestDB(t)
+
+	for range 10 {
+		a := createTestItem(t, db, "A")
+		b := createTestItem(t, db, "B")
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i, edge := range [][2]string{{a.ID, b.ID}, {b.ID, a.ID}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = db.AddDep(edge[0], edge[1])
+			}()
+		}
+		wg.Wait()
+
+		// One wins; the other sees its edge and is refused
+		if (errs[0] == nil) == (errs[1] == nil) {
+			t.Fatalf("errs = %v, want exactly one edge added", errs)
+		}
+		for _, err := range errs {
+			if err != nil && !errors.Is(err, ErrDepCycle) {
+				t.Fatalf("err = %v, want ErrDepCycle", err)
+			}
+		}
+	}
+}
+
+func TestAddDep_RejectsCycleThroughEpic(t *testing.T) {
+	db := setupTestDB(t)
+
+	epic := createTestEpic(t, db, "Epic", "test")
+	sub := createTestEpic(t, db, "Sub-epic", "test")
+	child := createTestItem(t, db, "Child")
+	other := createTestItem(t, db, "Other")
+	mustSetParent(t, db, sub.ID, epic.ID)
+	mustSetParent(t, db, child.ID, sub.ID)
+
+	// The epic waits on its descendants, so a child can't wait on it
+	err := db.AddDep(child.ID, epic.ID)
+	if !errors.Is(err, ErrDepCycle) {
+		t.Fatalf("child on ancestor epic: err = %v, want ErrDepCycle", err)
+	}
+	want := strings.Join([]string{child.ID, epic.ID, sub.ID, child.ID}, " -> ")
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("err = %q, want path %q", err, want)
+	}
+
+	// Nor can something the child waits on wait on the epic
+	mustAddDep(t, db, child.ID, other.ID)
+	err = db.AddDep(other.ID, epic.ID)
+	if !errors.Is(err, ErrDepCycle) {
+		t.Fatalf("blocker of a child on the epic: err = %v, want ErrDepCycle", err)
+	}
+	want = strings.Join([]string{other.ID, epic.ID, sub.ID, child.ID, other.ID}, " -> ")
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("err = %q, want path %q", err, want)
+	}
+
+	// Nor can an item become a child of an epic it waits on
+	waiter := createTestItem(t, db, "Waiter")
+	mustAddDep(t, db, waiter.ID, epic.ID)
+	err = db.SetParent(waiter.ID, sub.ID)
+	if !errors.Is(err, ErrDepCycle) {
+		t.Fatalf("reparent under a waiting epic: err = %v, want ErrDepCycle", err)
+	}
+
+	// The epic waiting on something outside it is fine
+	if err := db.AddDep(epic.ID, other.ID); err != nil {
+		t.Errorf("epic on an outside item rejected: %v", err)
+	}
+}
+
+func TestCheckGraph(t *testing.T) {
+	db := setupTestDB(t)
+
+	a := createTestItem(t, db, "A")
+	b := createTestItem(t, db, "B")
+	c := createTestItem(t, db, "C")
+	other := createTestItemWithProject(t, db, "Other", "other", model.StatusOpen, 2)
+
+	// Older databases accepted these; write them directly, on a connection
+	// without foreign key enforcement like the one they were made with
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	if _, err := conn.ExecContext(context.Background(), `PRAGMA foreign_keys = OFF`); err != nil {
+		t.Fatalf("failed to disable foreign keys: %v", err)
+	}
+	for _, edge := range [][2]string{
+		{a.ID, b.ID},
+		{b.ID, a.ID},
+		{c.ID, c.ID},
+		{c.ID, "ts-gone01"},
+		{other.ID, "ts-gone02"},
+	} {
+		if _, err := conn.ExecContext(context.Background(), `INSERT INTO deps (item_id, depends_on) VALUES (?, ?)`, edge[0], edge[1]); err != nil {
+			t.Fatalf("failed to insert dep: %v", err)
+		}
+	}
+	_ = conn.Close()
+
+	issues, err := db.CheckGraph("")
+	if err != nil {
+		t.Fatalf("CheckGraph failed: %v", err)
+	}
+	if len(issues.Cycles) != 2 {
+		t.Fatalf("got %d cycles, want 2: %v", len(issues.Cycles), issues.Cycles)
+	}
+	var cycles []string
+	for _, cycle := range issues.Cycles {
+		cycles = append(cycles, strings.Join(cycle, " -> "))
+	}
+	lo, hi := a.ID, b.ID
+	if hi < lo {
+		lo, hi = hi, lo
+	}
+	for _, want := range []string{lo + " -> " + hi + " -> " + lo, c.ID + " -> " + c.ID} {
+		found := false
+		for _, got := range cycles {
+			found = found || got == want
+		}
+		if !found {
+			t.Errorf("cycles = %v, missing %q", cycles, want)
+		}
+	}
+	if len(issues.Dangling) != 2 {
+		t.Errorf("got %d dangling deps, want 2: %+v", len(issues.Dangling), issues.Dangling)
+	}
+
+	// Scoped to a project, only its problems are reported
+	issues, err = db.CheckGraph("other")
+	if err != nil {
+		t.Fatalf("CheckGraph failed: %v", err)
+	}
+	if len(issues.Cycles) != 0 || len(issues.Dangling) != 1 || issues.Dangling[0].Missing != "ts-gone02" {
+		t.Errorf("issues for other = %+v, want only the dangling ts-gone02 edge", issues)
+	}
+}
+
+func TestCheckGraph_EpicChildren(t *testing.T) {
+	db := setupTestDB(t)
+
+	epic := createTestEpic(t, db, "Epic", "test")
+	child := createTestItem(t, db, "Child")
+	mustSetParent(t, db, child.ID, epic.ID)
+
+	// Older databases accepted a child waiting on its epic
+	if _, err := db.Exec(`INSERT INTO deps (item_id, depends_on) VALUES (?, ?)`, child.ID, epic.ID); err != nil {
+		t.Fatalf("failed to insert dep: %v", err)
+	}
+
+	issues, err := db.CheckGraph("")
+	if err != nil {
+		t.Fatalf("CheckGraph failed: %v", err)
+	}
+	if len(issues.Cycles) != 1 || len(issues.Cycles[0]) != 3 {
+		t.Fatalf("cycles = %v, want the child and its epic", issues.Cycles)
+	}
+}
+
+func TestCheckGraph_Clean(t *testing.T) {
+	db := setupTestDB(t)
+
+	a := createTestItem(t, db, "A")
+	b := createTestItem(t, db, "B")
+	if err := db.AddDep(b.ID, a.ID); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+
+	issues, err := db.CheckGraph("")
+	if err != nil {
+		t.Fatalf("CheckGraph failed: %v", err)
+	}
+	if issues.Count() != 0 {
+		t.Errorf("issues = %+v, want none", issues)
+	}
+}
+
+func TestGetDepGraph(t *testing.T) {
+	db := setupTestDB(t)
+
+	epic := createTestEpic(t, db, "Epic", "test")
+	inside := createTestItem(t, db, "Inside")
+	loner := createTestItem(t, db, "Loner") // in the epic, no deps
+	blocker := createTestItem(t, db, "Blocker")
+	unrelatedA := createTestItem(t, db, "Unrelated A")
+	unrelatedB := createTestItem(t, db, "Unrelated B")
+	for _, id := range []string{inside.ID, loner.ID} {
+		if err := db.SetParent(id, epic.ID); err != nil {
+			t.Fatalf("failed to set parent: %v", err)
+		}
+	}
+	if err := db.AddDep(inside.ID, blocker.ID); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+	if err := db.AddDep(unrelatedB.ID, unrelatedA.ID); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+
+	nodeIDs := func(g *DepGraph) map[string]bool {
+		ids := make(map[string]bool)
+		for _, n := range g.Nodes {
+			ids[n.ID] = true
+		}
+		return ids
+	}
+
+	// Whole project: dependency endpoints plus their containing epic
+	graph, err := db.GetDepGraph("test", "")
+	if err != nil {
+		t.Fatalf("GetDepGraph failed: %v", err)
+	}
+	ids := nodeIDs(graph)
+	for _, id := range []string{epic.ID, inside.ID, blocker.ID, unrelatedA.ID, unrelatedB.ID} {
+		if !ids[id] {
+			t.Errorf("project graph missing %s", id)
+		}
+	}
+	if ids[loner.ID] {
+		t.Error("project graph should only include items with dependencies and their epics")
+	}
+	if len(graph.Edges) != 2 {
+		t.Errorf("project graph has %d edges, want 2", len(graph.Edges))
+	}
+
+	// Epic subtree: every child, plus what they depend on
+	graph, err = db.GetDepGraph("", epic.ID)
+	if err != nil {
+		t.Fatalf("GetDepGraph failed: %v", err)
+	}
+	ids = nodeIDs(graph)
+	for _, id := range []string{epic.ID, inside.ID, loner.ID, blocker.ID} {
+		if !ids[id] {
+			t.Errorf("epic graph missing %s", id)
+		}
+	}
+	if ids[unrelatedA.ID] || ids[unrelatedB.ID] {
+		t.Error("epic graph should not include unrelated items")
+	}
+	if len(graph.Edges) != 1 || graph.Edges[0].ItemID != inside.ID {
+		t.Errorf("epic graph edges = %+v, want only %s's dependency", graph.Edges, inside.ID)
+	}
+
+	if _, err := db.GetDepGraph("", inside.ID); err == nil {
+		t.Error("expected error for non-epic scope")
+	}
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Fields recorded in item history. Values for dependency, label and area
+// events are the dependency ID, label name or area being added or removed;
+// for criterion events, the text of the criterion being checked or
+// unchecked; for reviewer events, the reviewer assigned or unassigned. Review
+// events record a verdict as the new value.
+const (
+	EventCreated          = "created"
+	EventDeleted          = "deleted"
+	EventStatus           = "status"
+	EventTitle            = "title"
+	EventDescription      = "description"
+	EventDefinitionOfDone = "definition_of_done"
+	EventCriterion        = "criterion"
+	EventReviewer         = "reviewer"
+	EventReview           = "review"
+	EventParent           = "parent"
+	EventProject          = "project"
+	EventDependency       = "dependency"
+	EventLabel            = "label"
+	EventArea             = "area"
+	EventLease            = "lease"
+	EventPurged           = "purged"
+)
+
+// ActorLeaseExpiry is the actor recorded when a lapsed lease reopens a task.
+const ActorLeaseExpiry = "lease-expiry"
+
+// execer is satisfied by both *sql.DB and *sql.Tx, so events can be recorded
+// inside the transaction that makes the change.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// querier is an execer that can also read, for work inside a transaction
+// that depends on the current state.
+type querier interface {
+	execer
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// recordEvent appends a change to an item's history.
+func recordEvent(ex querier, itemID, field, oldValue, newValue, actor string) error {
+	return insertEvent(ex, model.Event{ItemID: itemID, Field: field, OldValue: oldValue, NewValue: newValue, Actor: actor})
+}
+
+// insertEvent appends e to history, including which event it reverts, and
+// to the change feed. Status changes also queue any webhooks they trigger.
+func insertEvent(ex querier, e model.Event) error {
+	var reverts any
+	if e.Reverts != 0 {
+		reverts = e.Reverts
+	}
+	_, err := ex.Exec(`
+		INSERT INTO item_events (item_id, field, old_value, new_value, actor, created_at, reverts)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.ItemID, e.Field, e.OldValue, e.NewValue, e.Actor, time.Now(), reverts)
+	if err != nil {
+		return fmt.Errorf("failed to record event: %w", err)
+	}
+	if err := appendChange(ex, eventChange(e)); err != nil {
+		return err
+	}
+	if e.Field == EventStatus {
+		return queueWebhooks(ex, e)
+	}
+	return nil
+}
+
+// GetEvents returns an item's history, oldest first. History is kept after
+// the item is deleted.
+func (db *DB) GetEvents(itemID string) ([]model.Event, error) {
+	rows, err := db.Query(`
+		SELECT id, item_id, field, COALESCE(old_value, ''), COALESCE(new_value, ''), actor, created_at, COALESCE(reverts, 0)
+		FROM item_events WHERE item_id = ? ORDER BY created_at ASC, id ASC`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []model.Event
+	for rows.Next() {
+		var e model.Event
+		if err := rows.Scan(&e.ID, &e.ItemID, &e.Field, &e.OldValue, &e.NewValue, &e.Actor, &e.CreatedAt, &e.Reverts); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func eventSummary(t *testing.T, db *DB, itemID string) []string {
+	t.Helper()
+	events, err := db.GetEvents(itemID)
+	if err != nil {
+		t.Fatalf("failed to get events: %v", err)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Field+":"+e.OldValue+">"+e.NewValue+"@"+e.Actor)
+	}
+	return got
+}
+
+func assertEvents(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEvents_RecordsMutations(t *testing.T) {
+	db := setupTestDB(t).WithActor("alice")
+	task := createTestItem(t, db, "Original")
+	blocker := createTestItem(t, db, "Blocker")
+
+	if err := db.UpdateStatus(task.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	// Unchanged values aren't recorded
+	if err := db.UpdateStatus(task.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	if err := db.SetTitle(task.ID, "Renamed"); err != nil {
+		t.Fatalf("failed to set title: %v", err)
+	}
+	mustAddDep(t, db, task.ID, blocker.ID)
+	if err := db.AddLabelToItem(task.ID, "test", "bug"); err != nil {
+		t.Fatalf("failed to add label: %v", err)
+	}
+	if err := db.RemoveLabelFromItem(task.ID, "test", "bug"); err != nil {
+		t.Fatalf("failed to remove label: %v", err)
+	}
+	mustAddArea(t, db.WithActor("bob"), task.ID, "internal/db")
+
+	assertEvents(t, eventSummary(t, db, task.ID), []string{
+		"created:>open@alice",
+		"status:open>in_progress@alice",
+		"title:Original>Renamed@alice",
+		"dependency:>" + blocker.ID + "@alice",
+		"label:>bug@alice",
+		"label:bug>@alice",
+		"area:>internal/db@bob",
+	})
+}
+
+func TestEvents_Leases(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Leased")
+
+	if _, err := db.ClaimTask(task.ID, "agent-1", time.Minute); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if _, err := db.ExpireLeases(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to expire leases: %v", err)
+	}
+
+	assertEvents(t, eventSummary(t, db, task.ID), []string{
+		"created:>open@",
+		"status:open>in_progress@agent-1",
+		"status:in_progress>open@" + ActorLeaseExpiry,
+	})
+}
+
+func TestEvents_SurviveDelete(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Doomed")
+
+	if err := db.DeleteItem(task.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if err := db.DeleteItem(task.ID); err == nil {
+		t.Error("expected error deleting a missing item")
+	}
+
+	assertEvents(t, eventSummary(t, db, task.ID), []string{
+		"created:>open@",
+		"deleted:Doomed>@",
+	})
+}
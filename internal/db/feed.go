@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Kinds of change in the change feed.
+const (
+	ChangeItem     = "item"
+	ChangeLog      = "log"
+	ChangeDep      = "dep"
+	ChangeLabel    = "label"
+	ChangeLearning = "learning"
+)
+
+// Actions for dependencies and labels, and for logs and learnings. Item
+// changes use the history field (status, title, ...) as their action.
+const (
+	ActionAdded   = "added"
+	ActionRemoved = "removed"
+	ActionRenamed = "renamed"
+	ActionCreated = "created"
+	ActionDeleted = "deleted"
+)
+
+// appendChange adds c to the change feed. An empty project is filled in from
+// the item or learning the change targets.
+func appendChange(ex execer, c model.Change) error {
+	_, err := ex.Exec(`
+		INSERT INTO changes (kind, action, target, project, actor, old_value, new_value, created_at)
+		VALUES (?1, ?2, ?3, COALESCE(NULLIF(?4, ''),
+			(SELECT project FROM items WHERE id = ?3),
+			(SELECT project FROM learnings WHERE id = ?3), ''), ?5, ?6, ?7, ?8)`,
+		c.Kind, c.Action, c.Target, c.Project, c.Actor, c.OldValue, c.NewValue, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record change: %w", err)
+	}
+	return nil
+}
+
+// eventChange is the feed entry for an item history event. Dependency and
+// label events become their own kinds, named by whether a value was added,
+// removed or renamed.
+func eventChange(e model.Event) model.Change {
+	c := model.Change{
+		Kind:     ChangeItem,
+		Action:   e.Field,
+		Target:   e.ItemID,
+		Actor:    e.Actor,
+		OldValue: e.OldValue,
+		NewValue: e.NewValue,
+	}
+	switch e.Field {
+	case EventDependency, EventLabel:
+		c.Kind = ChangeDep
+		if e.Field == EventLabel {
+			c.Kind = ChangeLabel
+		}
+		switch {
+		case e.OldValue == "":
+			c.Action = ActionAdded
+		case e.NewValue == "":
+			c.Action = ActionRemoved
+		default:
+			c.Action = ActionRenamed
+		}
+	}
+	return c
+}
+
+// ChangeFilter selects changes from the feed.
+type ChangeFilter struct {
+	After   int64  // Only changes with a greater sequence number
+	Project string // Empty for all projects
+	Limit   int    // Maximum changes to return; 0 for no limit
+}
+
+// Changes returns changes in the order they were made.
+func (db *DB) Changes(f ChangeFilter) ([]model.Change, error) {
+	query := `
+		SELECT seq, kind, action, target, project, actor, old_value, new_value, created_at
+		FROM changes WHERE seq > ?`
+	args := []any{f.After}
+	if f.Project != "" {
+		query += ` AND project = ?`
+		args = append(args, f.Project)
+	}
+	query += ` ORDER BY seq`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var changes []model.Change
+	for rows.Next() {
+		var c model.Change
+		if err := rows.Scan(&c.Seq, &c.Kind, &c.Action, &c.Target, &c.Project, &c.Actor, &c.OldValue, &c.NewValue, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// LatestChange returns the sequence number of the newest change, or 0 if
+// the feed is empty. Following from it yields only changes made afterwards.
+func (db *DB) LatestChange() (int64, error) {
+	var seq int64
+	if err := db.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM changes`).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to get latest change: %w", err)
+	}
+	return seq, nil
+}
+
+// FollowChanges calls fn with each batch of changes matching f as they are
+// made, in order, checking for new ones every interval. Other processes
+// write to the same database, so the feed is polled rather than pushed. It
+// returns when ctx is done or fn returns an error.
+func (db *DB) FollowChanges(ctx context.Context, f ChangeFilter, interval time.Duration, fn func([]model.Change) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		changes, err := db.Changes(f)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			if err := fn(changes); err != nil {
+				return err
+			}
+			f.After = changes[len(changes)-1].Seq
+			if f.Limit > 0 && len(changes) == f.Limit {
+				continue // More are waiting
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func changeSummary(t *testing.T, db *DB, f ChangeFilter) []string {
+	t.Helper()
+	changes, err := db.Changes(f)
+	if err != nil {
+		t.Fatalf("failed to get changes: %v", err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Kind+"."+c.Action+":"+c.OldValue+">"+c.NewValue+"@"+c.Project)
+	}
+	return got
+}
+
+func TestChanges_RecordsEachKind(t *testing.T) {
+	db := setupTestDB(t).WithActor("alice")
+	task := createTestItem(t, db, "Task")
+	blocker := createTestItem(t, db, "Blocker")
+	start, err := db.LatestChange()
+	if err != nil {
+		t.Fatalf("failed to get latest change: %v", err)
+	}
+
+	if err := db.UpdateStatus(task.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	if err := db.AddLog(task.ID, "Started"); err != nil {
+		t.Fatalf("failed to add log: %v", err)
+	}
+	mustAddDep(t, db, task.ID, blocker.ID)
+	if err := db.AddLabelToItem(task.ID, "test", "bug"); err != nil {
+		t.Fatalf("failed to add label: %v", err)
+	}
+	learning := &model.Learning{
+		ID:        model.GenerateLearningID(),
+		Project:   "test",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Summary:   "Learned",
+		Status:    model.LearningStatusActive,
+		Concepts:  []string{"testing"},
+	}
+	if err := db.CreateLearning(learning); err != nil {
+		t.Fatalf("failed to create learning: %v", err)
+	}
+	if err := db.UpdateLearningStatus(learning.ID, model.LearningStatusStale); err != nil {
+		t.Fatalf("failed to update learning: %v", err)
+	}
+
+	assertEvents(t, changeSummary(t, db, ChangeFilter{After: start}), []string{
+		"item.status:open>in_progress@test",
+		"log.added:>Started@test",
+		"dep.added:>" + blocker.ID + "@test",
+		"label.added:>bug@test",
+		"learning.created:>Learned@test",
+		"learning.status:>stale@test",
+	})
+	if got := changeSummary(t, db, ChangeFilter{After: start, Project: "other"}); len(got) != 0 {
+		t.Errorf("other project's changes = %v, want none", got)
+	}
+}
+
+func TestChanges_PurgeKeepsProject(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Doomed")
+	if err := db.DeleteItem(task.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	start, _ := db.LatestChange()
+	if _, err := db.PurgeTrash("test", time.Now()); err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	assertEvents(t, changeSummary(t, db, ChangeFilter{After: start}), []string{"item.purged:Doomed>@test"})
+}
+
+func TestFollowChanges(t *testing.T) {
+	db := setupTestDB(t)
+	createTestItem(t, db, "Before")
+	start, _ := db.LatestChange()
+
+	stop := errors.New("stop")
+	var got []string
+	done := make(chan error, 1)
+	go func() {
+		done <- db.FollowChanges(context.Background(), ChangeFilter{After: start, Limit: 1}, 10*time.Millisecond, func(changes []model.Change) error {
+			for _, c := range changes {
+				got = append(got, c.NewValue)
+			}
+			if len(got) == 2 {
+				return stop
+			}
+			return nil
+		})
+	}()
+
+	task := createTestItem(t, db, "After")
+	if err := db.AddLog(task.ID, "Logged"); err != nil {
+		t.Fatalf("failed to add log: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, stop) {
+			t.Fatalf("FollowChanges returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for changes")
+	}
+	assertEvents(t, got, []string{"open", "Logged"})
+}
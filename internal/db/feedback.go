@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Relevance feedback folds into ranking as a score per learning: how often
+// it applied when read, out of the times it was read, smoothed so that a
+// learning without feedback scores 0.5 and a single evaluation moves it only
+// part of the way. Only misleading evaluations count against a learning; a
+// learning that didn't look relevant and wasn't did its job.
+
+// feedbackScores is a subquery of learning_id and score for learnings with
+// feedback. Rank by COALESCE(f.score, 0.5) when joined as f.
+const feedbackScores = `(
+	SELECT learning_id,
+		(SUM(actually_relevant) + 1.0) / (SUM(actually_relevant) + SUM(expected_relevant AND NOT actually_relevant) + 2.0) AS score
+	FROM learning_feedback GROUP BY learning_id
+)`
+
+// RecordFeedback records an evaluation of a learning. TaskID defaults to the
+// in-progress task in the learning's project, Actor to the DB's actor.
+func (db *DB) RecordFeedback(f *model.Feedback) error {
+	var project string
+	if err := db.QueryRow(`SELECT project FROM learnings WHERE id = ?`, f.LearningID).Scan(&project); err != nil {
+		return fmt.Errorf("learning %w: %s", ErrNotFound, f.LearningID)
+	}
+	if f.TaskID == nil {
+		taskID, err := db.GetCurrentTaskID(project)
+		if err != nil {
+			return err
+		}
+		f.TaskID = taskID
+	} else if _, err := db.GetItem(*f.TaskID); err != nil {
+		return err
+	}
+	if f.Actor == "" {
+		f.Actor = db.actor
+	}
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now()
+	}
+	f.MismatchReason = strings.TrimSpace(f.MismatchReason)
+	f.TaskContext = strings.TrimSpace(f.TaskContext)
+
+	result, err := db.Exec(`
+		INSERT INTO learning_feedback (learning_id, task_id, expected_relevant, actually_relevant, mismatch_reason, task_context, actor, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.LearningID, f.TaskID, f.ExpectedRelevant, f.ActuallyRelevant, f.MismatchReason, f.TaskContext, f.Actor, f.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record feedback: %w", err)
+	}
+	f.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetFeedback returns the feedback recorded for a learning, newest first.
+func (db *DB) GetFeedback(learningID string) ([]model.Feedback, error) {
+	rows, err := db.Query(`
+		SELECT id, learning_id, task_id, expected_relevant, actually_relevant, mismatch_reason, task_context, actor, created_at
+		FROM learning_feedback WHERE learning_id = ?
+		ORDER BY created_at DESC, id DESC`, learningID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+	defer rows.Close()
+
+	var feedback []model.Feedback
+	for rows.Next() {
+		var f model.Feedback
+		if err := rows.Scan(&f.ID, &f.LearningID, &f.TaskID, &f.ExpectedRelevant, &f.ActuallyRelevant,
+			&f.MismatchReason, &f.TaskContext, &f.Actor, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		feedback = append(feedback, f)
+	}
+	return feedback, rows.Err()
+}
+
+// FeedbackStats summarizes the feedback on a learning.
+type FeedbackStats struct {
+	Learning    model.Learning
+	Evaluations int      // Times it was evaluated
+	Relevant    int      // Times it applied to the task
+	Misleading  int      // Times it looked relevant but didn't apply
+	Score       float64  // The ranking score; see feedbackScores
+	Reasons     []string // Mismatch reasons given, most common first
+}
+
+// MisleadingLearnings returns the learnings in project (all projects if
+// empty) that most often looked relevant but weren't, worst first, for
+// grooming. Only learnings that are retrieved, stale or not, with
+// misleading feedback are included. A limit of 0 returns them all.
+func (db *DB) MisleadingLearnings(project string, limit int) ([]FeedbackStats, error) {
+	query := `
+		SELECT l.id, COUNT(*),
+			SUM(fb.actually_relevant),
+			SUM(fb.expected_relevant AND NOT fb.actually_relevant) AS misleading,
+			f.score
+		FROM learnings l
+		JOIN learning_feedback fb ON fb.learning_id = l.id
+		JOIN ` + feedbackScores + ` f ON f.learning_id = l.id
+		WHERE l.status IN ('active', 'needs-review', 'stale') AND (?1 = '' OR l.project = ?1)
+		GROUP BY l.id
+		HAVING misleading > 0
+		ORDER BY f.score, misleading DESC, l.id`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := db.Query(query, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+	var stats []FeedbackStats
+	for rows.Next() {
+		var s FeedbackStats
+		if err := rows.Scan(&s.Learning.ID, &s.Evaluations, &s.Relevant, &s.Misleading, &s.Score); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		l, err := db.GetLearning(stats[i].Learning.ID)
+		if err != nil {
+			return nil, err
+		}
+		stats[i].Learning = *l
+		if stats[i].Reasons, err = mismatchReasons(db, l.ID); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// mismatchReasons returns the distinct reasons a learning was misleading,
+// most common first.
+func mismatchReasons(q querier, learningID string) ([]string, error) {
+	rows, err := q.Query(`
+		SELECT mismatch_reason FROM learning_feedback
+		WHERE learning_id = ? AND mismatch_reason != '' AND expected_relevant AND NOT actually_relevant
+		GROUP BY mismatch_reason
+		ORDER BY COUNT(*) DESC, MAX(created_at) DESC`, learningID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+	defer rows.Close()
+
+	var reasons []string
+	for rows.Next() {
+		var reason string
+		if err := rows.Scan(&reason); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		reasons = append(reasons, reason)
+	}
+	return reasons, rows.Err()
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func createTestLearning(t *testing.T, db *DB, summary string, concepts ...string) *model.Learning {
+	t.Helper()
+	l := &model.Learning{
+		ID:        model.GenerateLearningID(),
+		Project:   "test",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Summary:   summary,
+		Status:    model.LearningStatusActive,
+		Concepts:  concepts,
+	}
+	if err := db.CreateLearning(l); err != nil {
+		t.Fatalf("failed to create learning: %v", err)
+	}
+	return l
+}
+
+func evaluate(t *testing.T, db *DB, l *model.Learning, expected, actual bool, reason string) {
+	t.Helper()
+	f := &model.Feedback{LearningID: l.ID, ExpectedRelevant: expected, ActuallyRelevant: actual, MismatchReason: reason}
+	if err := db.RecordFeedback(f); err != nil {
+		t.Fatalf("failed to record feedback: %v", err)
+	}
+}
+
+func TestRecordFeedback(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Task")
+	if err := db.UpdateStatus(task.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to start task: %v", err)
+	}
+	l := createTestLearning(t, db, "Cache keys include the tenant", "cache")
+
+	f := &model.Feedback{LearningID: l.ID, ExpectedRelevant: true, MismatchReason: " wrong subsystem ", TaskContext: "bugfix"}
+	if err := db.WithActor("agent-x").RecordFeedback(f); err != nil {
+		t.Fatalf("failed to record feedback: %v", err)
+	}
+	got, err := db.GetFeedback(l.ID)
+	if err != nil || len(got) != 1 {
+		t.Fatalf("feedback = %+v, %v", got, err)
+	}
+	if got[0].TaskID == nil || *got[0].TaskID != task.ID {
+		t.Errorf("task = %v, want the in-progress task %s", got[0].TaskID, task.ID)
+	}
+	if !got[0].Misleading() || got[0].MismatchReason != "wrong subsystem" || got[0].Actor != "agent-x" {
+		t.Errorf("feedback = %+v", got[0])
+	}
+
+	if err := db.RecordFeedback(&model.Feedback{LearningID: "lrn-000000"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("feedback on missing learning = %v, want ErrNotFound", err)
+	}
+
+	// Deleting the learning deletes its feedback
+	if err := db.DeleteLearning(l.ID); err != nil {
+		t.Fatalf("failed to delete learning: %v", err)
+	}
+	if got, _ := db.GetFeedback(l.ID); len(got) != 0 {
+		t.Errorf("feedback left after delete: %+v", got)
+	}
+}
+
+func TestFeedbackRanking(t *testing.T) {
+	db := setupTestDB(t)
+	misleading := createTestLearning(t, db, "Cache invalidation runs on write", "cache")
+	plain := createTestLearning(t, db, "Cache warms on startup", "cache")
+	helpful := createTestLearning(t, db, "Cache entries expire after an hour", "cache")
+
+	evaluate(t, db, misleading, true, false, "stale info")
+	evaluate(t, db, misleading, true, false, "stale info")
+	evaluate(t, db, misleading, true, false, "wrong subsystem")
+	evaluate(t, db, helpful, true, true, "")
+	evaluate(t, db, plain, false, false, "") // Didn't look relevant and wasn't: no penalty
+
+	want := []string{helpful.ID, plain.ID, misleading.ID}
+	byConcept, err := db.GetLearningsByConcepts("test", []string{"cache"}, false)
+	if err != nil {
+		t.Fatalf("failed to get learnings: %v", err)
+	}
+	if got := learningIDs(byConcept); !slices.Equal(got, want) {
+		t.Errorf("by concept = %v, want %v", got, want)
+	}
+	searched, err := db.SearchLearnings("test", "cache", false)
+	if err != nil {
+		t.Fatalf("failed to search learnings: %v", err)
+	}
+	if got := learningIDs(searched); !slices.Equal(got, want) {
+		t.Errorf("search = %v, want %v", got, want)
+	}
+
+	report, err := db.MisleadingLearnings("test", 0)
+	if err != nil {
+		t.Fatalf("failed to get report: %v", err)
+	}
+	if len(report) != 1 || report[0].Learning.ID != misleading.ID {
+		t.Fatalf("report = %+v, want only %s", report, misleading.ID)
+	}
+	s := report[0]
+	if s.Evaluations != 3 || s.Misleading != 3 || s.Relevant != 0 || s.Score != 0.2 {
+		t.Errorf("stats = %+v", s)
+	}
+	if !slices.Equal(s.Reasons, []string{"stale info", "wrong subsystem"}) {
+		t.Errorf("reasons = %q", s.Reasons)
+	}
+}
+
+func learningIDs(learnings []model.Learning) []string {
+	ids := make([]string, len(learnings))
+	for i, l := range learnings {
+		ids[i] = l.ID
+	}
+	return ids
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// A learning's files are paths or globs, like areas (see areas.go): a
+// learning about "internal/auth" applies to every file beneath it, and one
+// about "internal/db/*.go" to the files the glob matches. They are kept in
+// learning_files, normalized, so a lookup by file uses the path index
+// rather than reading every learning's files JSON.
+
+// writeLearningFiles replaces a learning's rows in learning_files.
+func writeLearningFiles(ex execer, learningID string, files []string) error {
+	if _, err := ex.Exec(`DELETE FROM learning_files WHERE learning_id = ?`, learningID); err != nil {
+		return fmt.Errorf("failed to replace files: %w", err)
+	}
+	for _, f := range files {
+		f = NormalizeArea(f)
+		if f == "" {
+			continue
+		}
+		_, err := ex.Exec(`INSERT OR IGNORE INTO learning_files (learning_id, path, glob) VALUES (?, ?, ?)`, learningID, f, isGlob(f))
+		if err != nil {
+			return fmt.Errorf("failed to add file: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetLearningsByFiles returns learnings about any of files: learnings whose
+// files include one of them, a directory containing one, or a glob matching
+// one. A file that is a directory also finds the learnings about files
+// beneath it. Only returns active learnings and those needing review by
+// default, ordered like GetLearningsByConcepts.
+func (db *DB) GetLearningsByFiles(project string, files []string, includeStale bool) ([]model.Learning, error) {
+	ids := make(map[string]bool)
+	for _, f := range files {
+		f = NormalizeArea(f)
+		if f == "" || f == "." {
+			continue
+		}
+		if err := db.matchLearningFiles(f, ids); err != nil {
+			return nil, err
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, 0, len(ids))
+	args := []any{project}
+	for id := range ids {
+		placeholders = append(placeholders, "?")
+		args = append(args, id)
+	}
+	statusFilter := learningStatusFilter(includeStale)
+
+	learnings, err := db.queryLearnings(`
+		SELECT `+learningColumns+`
+		FROM learnings l
+		LEFT JOIN `+feedbackScores+` f ON f.learning_id = l.id
+		WHERE l.project = ? AND l.id IN (`+strings.Join(placeholders, ",")+`)
+		`+statusFilter+`
+		ORDER BY l.path IS NULL, COALESCE(f.score, 0.5) DESC, l.created_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query learnings: %w", err)
+	}
+	return learnings, nil
+}
+
+// matchLearningFiles adds the IDs of learnings whose files cover f to ids.
+// The file itself, its ancestors and its descendants are found by path;
+// globs are few, so each is fetched and matched.
+func (db *DB) matchLearningFiles(f string, ids map[string]bool) error {
+	var ancestors []any
+	for p := f; p != "." && p != "/"; p = path.Dir(p) {
+		ancestors = append(ancestors, p)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ancestors)), ",")
+	// Paths beneath f sort between "f/" and "f0", '0' being the byte after '/'
+	args := append(ancestors, f+"/", f+"0")
+
+	rows, err := db.Query(`
+		SELECT learning_id, path, glob FROM learning_files
+		WHERE path IN (`+placeholders+`)
+			OR (path > ? AND path < ?)
+			OR glob = 1`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, p string
+		var glob bool
+		if err := rows.Scan(&id, &p, &glob); err != nil {
+			return fmt.Errorf("failed to scan file: %w", err)
+		}
+		if !glob || AreasOverlap(p, f) {
+			ids[id] = true
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func createFileLearning(t *testing.T, db *DB, summary string, files ...string) *model.Learning {
+	t.Helper()
+	l := &model.Learning{
+		ID:        model.GenerateLearningID(),
+		Project:   "test",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Summary:   summary,
+		Status:    model.LearningStatusActive,
+		Files:     files,
+	}
+	if err := db.CreateLearning(l); err != nil {
+		t.Fatalf("failed to create learning: %v", err)
+	}
+	return l
+}
+
+func TestGetLearningsByFiles(t *testing.T) {
+	db := setupTestDB(t)
+	exact := createFileLearning(t, db, "Token refresh races", "./auth/token.go")
+	dir := createFileLearning(t, db, "Auth errors are wrapped", "auth/")
+	glob := createFileLearning(t, db, "Go files in auth use the clock interface", "auth/*.go")
+	deep := createFileLearning(t, db, "Middleware order matters", "auth/middleware/chain.go")
+	other := createFileLearning(t, db, "Unrelated", "authz/policy.go", "db/*.go")
+
+	tests := []struct {
+		name  string
+		files []string
+		want  []*model.Learning
+	}{
+		{"file", []string{"auth/token.go"}, []*model.Learning{exact, dir, glob}},
+		{"directory", []string{"auth"}, []*model.Learning{exact, dir, glob, deep}},
+		{"nested file", []string{"auth/middleware/chain.go"}, []*model.Learning{dir, deep}},
+		{"several", []string{"authz/policy.go", "auth/middleware/chain.go"}, []*model.Learning{dir, deep, other}},
+		{"glob only", []string{"db/db.go"}, []*model.Learning{other}},
+		{"none", []string{"cmd/main.go", ""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetLearningsByFiles("test", tt.files, false)
+			if err != nil {
+				t.Fatalf("failed to get learnings: %v", err)
+			}
+			var want []string
+			for _, l := range tt.want {
+				want = append(want, l.ID)
+			}
+			gotIDs := learningIDs(got)
+			slices.Sort(want)
+			slices.Sort(gotIDs)
+			if !slices.Equal(gotIDs, want) {
+				t.Errorf("learnings = %v, want %v", gotIDs, want)
+			}
+		})
+	}
+
+	// Deleting a learning removes its files
+	if err := db.DeleteLearning(exact.ID); err != nil {
+		t.Fatalf("failed to delete learning: %v", err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM learning_files WHERE learning_id = ?`, exact.ID).Scan(&n); err != nil || n != 0 {
+		t.Errorf("files left after delete: %d, %v", n, err)
+	}
+}
+
+func TestMigrate_BackfillsLearningFiles(t *testing.T) {
+	db := setupTestDB(t)
+	l := createFileLearning(t, db, "Config precedence", "./config/load.go", "config/", "internal/*.go")
+
+	// Roll back to before learning_files existed
+	for _, stmt := range []string{
+		`DROP TABLE learning_files`,
+		`ALTER TABLE learnings DROP COLUMN review_reason`,
+		`PRAGMA user_version = 17`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to run %q: %v", stmt, err)
+		}
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	for _, file := range []string{"config/load.go", "internal/db.go"} {
+		got, err := db.GetLearningsByFiles("test", []string{file}, false)
+		if err != nil || len(got) != 1 || got[0].ID != l.ID {
+			t.Errorf("learnings for %s = %v, %v", file, learningIDs(got), err)
+		}
+	}
+}
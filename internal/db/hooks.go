@@ -0,0 +1,115 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Hook describes one run of a lifecycle hook.
+type Hook struct {
+	Name    string // e.g. "pre-done", "post-start", "post-learn"
+	Project string
+	Actor   string
+	ItemID  string // Set for item hooks
+	From    string // Status before a transition, for item hooks
+	To      string // Status after a transition, for item hooks
+	Input   any    // Passed to the hook as JSON: the item or learning
+}
+
+// Hooks runs lifecycle hooks around changes; see internal/hooks. Run returns
+// nil when no hook of that name is installed.
+type Hooks interface {
+	Run(h Hook) error
+}
+
+// ErrHookRejected is wrapped by errors from a pre-* hook that exited
+// non-zero, aborting the change.
+var ErrHookRejected = errors.New("rejected by hook")
+
+// WithHooks returns a DB that runs hooks around status transitions and new
+// learnings. It shares the connection pool and actor with db.
+func (db *DB) WithHooks(hooks Hooks) *DB {
+	return &DB{DB: db.DB, actor: db.actor, hooks: hooks}
+}
+
+// statusHooks names the hooks run when an item moves to each status, after
+// the command that usually makes the move: pre-start, post-done, ...
+var statusHooks = map[model.Status]string{
+	model.StatusDraft:      "draft",
+	model.StatusOpen:       "open",
+	model.StatusInProgress: "start",
+	model.StatusBlocked:    "block",
+	model.StatusReviewing:  "review",
+	model.StatusDone:       "done",
+	model.StatusCanceled:   "cancel",
+}
+
+// runStatusHook runs the pre- or post- hook for item moving from its
+// current status to status. Errors from pre- hooks wrap ErrHookRejected;
+// post- hooks run after the change is committed, so their errors are
+// ignored.
+func (db *DB) runStatusHook(phase string, item *model.Item, from, to model.Status, actor string) error {
+	if db.hooks == nil || from == to {
+		return nil
+	}
+	labels, err := itemLabelNames(db, item.ID)
+	if err != nil {
+		return err
+	}
+	item.Labels = labels
+
+	name := phase + "-" + statusHooks[to]
+	err = db.hooks.Run(Hook{
+		Name:    name,
+		Project: item.Project,
+		Actor:   actor,
+		ItemID:  item.ID,
+		From:    string(from),
+		To:      string(to),
+		Input:   item,
+	})
+	if err != nil && phase == "pre" {
+		return fmt.Errorf("%w: %s: %v", ErrHookRejected, name, err)
+	}
+	return nil
+}
+
+// runPostStatusHook runs the post- hook for an item that moved from one
+// status to another, with the item as it is now. The change is already
+// committed, so nothing here can fail it.
+func (db *DB) runPostStatusHook(id string, from, to model.Status, actor string) {
+	if db.hooks == nil || from == to {
+		return
+	}
+	if item, err := db.GetItem(id); err == nil {
+		_ = db.runStatusHook("post", item, from, to, actor)
+	}
+}
+
+// runLearningHook runs the pre- or post-learn hook for l.
+func (db *DB) runLearningHook(phase string, l *model.Learning) error {
+	if db.hooks == nil {
+		return nil
+	}
+	input := *l
+	if input.Files == nil {
+		input.Files = []string{}
+	}
+	if input.Concepts == nil {
+		input.Concepts = []string{}
+	}
+
+	name := phase + "-learn"
+	err := db.hooks.Run(Hook{
+		Name:    name,
+		Project: l.Project,
+		Actor:   l.Actor,
+		Input:   input,
+	})
+	if err != nil && phase == "pre" {
+		return fmt.Errorf("%w: %s: %v", ErrHookRejected, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// fakeHooks records the hooks run and rejects those listed in reject.
+type fakeHooks struct {
+	ran    []string
+	reject map[string]bool
+}
+
+func (f *fakeHooks) Run(h Hook) error {
+	f.ran = append(f.ran, fmt.Sprintf("%s %s>%s by %s", h.Name, h.From, h.To, h.Actor))
+	if f.reject[h.Name] {
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func TestUpdateStatus_RunsHooks(t *testing.T) {
+	hooks := &fakeHooks{}
+	db := setupTestDB(t).WithActor("alice").WithHooks(hooks)
+	task := createTestItem(t, db, "Task")
+
+	if err := db.UpdateStatus(task.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	// No transition, no hooks
+	if err := db.UpdateStatus(task.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to restart: %v", err)
+	}
+	assertEvents(t, hooks.ran, []string{
+		"pre-start open>in_progress by alice",
+		"post-start open>in_progress by alice",
+	})
+
+	// Hooks survive WithActor
+	hooks.ran = nil
+	if err := db.WithActor("bob").UpdateStatus(task.ID, model.StatusReviewing); err != nil {
+		t.Fatalf("failed to review: %v", err)
+	}
+	assertEvents(t, hooks.ran, []string{
+		"pre-review in_progress>reviewing by bob",
+		"post-review in_progress>reviewing by bob",
+	})
+}
+
+func TestUpdateStatus_PreHookRejects(t *testing.T) {
+	hooks := &fakeHooks{reject: map[string]bool{"pre-done": true, "post-cancel": true}}
+	db := setupTestDB(t).WithHooks(hooks)
+	task := createTestItem(t, db, "Task")
+
+	err := db.UpdateStatus(task.ID, model.StatusDone)
+	if !errors.Is(err, ErrHookRejected) {
+		t.Fatalf("expected ErrHookRejected, got %v", err)
+	}
+	item, _ := db.GetItem(task.ID)
+	if item.Status != model.StatusOpen {
+		t.Errorf("status = %s, want open after rejected transition", item.Status)
+	}
+	if events, _ := db.GetEvents(task.ID); len(events) != 1 {
+		t.Errorf("expected only the creation event, got %d events", len(events))
+	}
+
+	// Post hooks can't undo a committed change
+	if err := db.UpdateStatus(task.ID, model.StatusCanceled); err != nil {
+		t.Fatalf("post hook failure should not fail the change: %v", err)
+	}
+}
+
+func TestClaimTask_RunsStartHooks(t *testing.T) {
+	hooks := &fakeHooks{reject: map[string]bool{"pre-start": true}}
+	db := setupTestDB(t).WithHooks(hooks)
+	task := createTestItem(t, db, "Task")
+
+	if _, err := db.ClaimTask(task.ID, "agent-1", time.Minute); !errors.Is(err, ErrHookRejected) {
+		t.Fatalf("expected ErrHookRejected, got %v", err)
+	}
+	hooks.reject = nil
+	if _, err := db.ClaimTask(task.ID, "agent-1", time.Minute); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	assertEvents(t, hooks.ran, []string{
+		"pre-start open>in_progress by agent-1",
+		"pre-start open>in_progress by agent-1",
+		"post-start open>in_progress by agent-1",
+	})
+}
+
+func TestCreateLearning_RunsHooks(t *testing.T) {
+	hooks := &fakeHooks{reject: map[string]bool{"pre-learn": true}}
+	db := setupTestDB(t).WithActor("alice").WithHooks(hooks)
+	newLearning := func() *model.Learning {
+		return &model.Learning{
+			ID:        model.GenerateLearningID(),
+			Project:   "test",
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Summary:   "Learned",
+			Status:    model.LearningStatusActive,
+		}
+	}
+
+	rejected := newLearning()
+	if err := db.CreateLearning(rejected); !errors.Is(err, ErrHookRejected) {
+		t.Fatalf("expected ErrHookRejected, got %v", err)
+	}
+	if _, err := db.GetLearning(rejected.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("rejected learning was saved: %v", err)
+	}
+
+	hooks.reject = nil
+	if err := db.CreateLearning(newLearning()); err != nil {
+		t.Fatalf("failed to create learning: %v", err)
+	}
+	assertEvents(t, hooks.ran, []string{
+		"pre-learn > by alice",
+		"pre-learn > by alice",
+		"post-learn > by alice",
+	})
+}
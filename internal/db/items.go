@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/baiirun/prog/internal/model"
@@ -10,6 +11,9 @@ import (
 
 // CreateItem inserts a new item into the database.
 // If the item has a project, it will be auto-created if it doesn't exist.
+// CreatedBy defaults to db's actor. A ParentID must name an epic, and any
+// Labels and Areas are attached along with the item, so if one of them is
+// rejected the item isn't created.
 func (db *DB) CreateItem(item *model.Item) error {
 	if !item.Type.IsValid() {
 		return fmt.Errorf("invalid item type: %s", item.Type)
@@ -18,43 +22,104 @@ func (db *DB) CreateItem(item *model.Item) error {
 		return fmt.Errorf("invalid status: %s", item.Status)
 	}
 
+	if item.CreatedBy == "" {
+		item.CreatedBy = db.actor
+	}
+
+	var criteria []model.Criterion
+	if item.DefinitionOfDone != nil {
+		criteria = textCriteria(*item.DefinitionOfDone)
+		item.DefinitionOfDone = criteriaText(criteria)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	// Auto-create project if specified
 	if item.Project != "" {
-		if err := db.EnsureProject(item.Project); err != nil {
+		if err := ensureProject(tx, item.Project); err != nil {
+			return err
+		}
+	}
+	if item.ParentID != nil {
+		if err := checkParent(tx, item.ID, *item.ParentID); err != nil {
 			return err
 		}
 	}
 
-	_, err := db.Exec(`
-		INSERT INTO items (id, project, type, title, description, definition_of_done, status, priority, parent_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	_, err = tx.Exec(`
+		INSERT INTO items (id, project, type, title, description, definition_of_done, status, priority, parent_id, created_by, assignee, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		item.ID, item.Project, item.Type, item.Title, item.Description, item.DefinitionOfDone,
-		item.Status, item.Priority, item.ParentID, item.CreatedAt, item.UpdatedAt,
+		item.Status, item.Priority, item.ParentID, item.CreatedBy, item.Assignee, item.CreatedAt, item.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create item: %w", err)
 	}
+	if err := writeCriteria(tx, item.ID, criteria); err != nil {
+		return err
+	}
+	if err := recordEvent(tx, item.ID, EventCreated, "", string(item.Status), db.actor); err != nil {
+		return err
+	}
+	for _, name := range item.Labels {
+		if err := addItemLabel(tx, item.ID, item.Project, name, db.actor); err != nil {
+			return err
+		}
+	}
+	for _, area := range item.Areas {
+		if err := addItemArea(tx, item.ID, area, db.actor); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-// GetItem retrieves an item by ID.
+// GetItem retrieves an item by ID. Items in the trash are reported as such.
 func (db *DB) GetItem(id string) (*model.Item, error) {
-	row := db.QueryRow(`
-		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_at, updated_at
+	item, err := getItem(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive epic status from children at query time
+	if err := db.applyDerivedEpicStatus(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// getItem reads an item as stored, without deriving epic status, so it can
+// be used inside a transaction.
+func getItem(q querier, id string) (*model.Item, error) {
+	row := q.QueryRow(`
+		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_by, assignee, created_at, updated_at, deleted_at
 		FROM items WHERE id = ?`, id)
 
 	item := &model.Item{}
 	var parentID, definitionOfDone sql.NullString
+	var deletedAt sql.NullTime
 	err := row.Scan(
 		&item.ID, &item.Project, &item.Type, &item.Title, &item.Description, &definitionOfDone,
-		&item.Status, &item.Priority, &parentID, &item.CreatedAt, &item.UpdatedAt,
+		&item.Status, &item.Priority, &parentID, &item.CreatedBy, &item.Assignee, &item.CreatedAt, &item.UpdatedAt, &deletedAt,
 	)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
+		return nil, fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get item: %w", err)
 	}
+	if deletedAt.Valid {
+		return nil, fmt.Errorf("%w: %s (use 'prog restore-item %s' to bring it back)", ErrInTrash, id, id)
+	}
 
 	if parentID.Valid {
 		item.ParentID = &parentID.String
@@ -62,12 +127,6 @@ func (db *DB) GetItem(id string) (*model.Item, error) {
 	if definitionOfDone.Valid {
 		item.DefinitionOfDone = &definitionOfDone.String
 	}
-
-	// Derive epic status from children at query time
-	if err := db.applyDerivedEpicStatus(item); err != nil {
-		return nil, err
-	}
-
 	return item, nil
 }
 
@@ -75,77 +134,251 @@ func (db *DB) GetItem(id string) (*model.Item, error) {
 // For epics, only terminal statuses (done, canceled) are accepted as manual overrides.
 // Non-terminal epic statuses are rejected because derivation from children would
 // silently override whatever is stored.
+//
+// With hooks installed, the pre- hook for the new status (pre-done, ...) can
+// reject the change, and the post- hook runs once it is committed.
 func (db *DB) UpdateStatus(id string, status model.Status) error {
 	if !status.IsValid() {
 		return fmt.Errorf("invalid status: %s", status)
 	}
 
+	// Hooks may take a while (pre-done running a test suite), so they run
+	// outside the transaction rather than holding the database locked.
+	if db.hooks != nil {
+		item, err := db.GetItem(id)
+		if err != nil {
+			return err
+		}
+		if err := db.runStatusHook("pre", item, item.Status, status, db.actor); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	oldStatus, err := applyStatus(tx, id, status, db.actor)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	db.runPostStatusHook(id, oldStatus, status, db.actor)
+	return nil
+}
+
+// applyStatus is UpdateStatus inside a transaction, without the hooks. It
+// returns the status the item had before.
+func applyStatus(tx *sql.Tx, id string, status model.Status, actor string) (model.Status, error) {
 	// Check if item is an epic — only allow terminal status overrides
-	var itemType string
-	err := db.QueryRow(`SELECT type FROM items WHERE id = ?`, id).Scan(&itemType)
+	var itemType, oldStatus string
+	err := tx.QueryRow(`SELECT type, status FROM items WHERE id = ? AND deleted_at IS NULL`, id).Scan(&itemType, &oldStatus)
 	if err != nil {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
+		return "", fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
 	}
 	if itemType == string(model.ItemTypeEpic) && status != model.StatusDone && status != model.StatusCanceled {
-		return fmt.Errorf("epic status is derived from children; only 'done' and 'canceled' can be set manually (to force-close)")
+		return "", fmt.Errorf("epic status is derived from children; only 'done' and 'canceled' can be set manually (to force-close)")
+	}
+
+	// Starting a task assigns it to whoever started it; reopening unassigns it.
+	// NULL keeps the current assignee.
+	var assignee sql.NullString
+	if oldStatus != string(status) {
+		switch {
+		case status == model.StatusInProgress && actor != "":
+			assignee = sql.NullString{String: actor, Valid: true}
+		case status == model.StatusOpen || status == model.StatusDraft:
+			assignee = sql.NullString{Valid: true}
+		}
 	}
 
-	result, err := db.Exec(`
-		UPDATE items SET status = ?, updated_at = ? WHERE id = ?`,
-		status, time.Now(), id)
+	result, err := tx.Exec(`
+		UPDATE items SET status = ?, assignee = COALESCE(?, assignee), updated_at = ? WHERE id = ?`,
+		status, assignee, time.Now(), id)
 	if err != nil {
-		return fmt.Errorf("failed to update status: %w", err)
+		return "", fmt.Errorf("failed to update status: %w", err)
 	}
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
+		return "", fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
 	}
-	return nil
+
+	// A lease only makes sense while the task is in progress
+	if status != model.StatusInProgress {
+		if _, err := tx.Exec(`DELETE FROM leases WHERE item_id = ?`, id); err != nil {
+			return "", fmt.Errorf("failed to release lease: %w", err)
+		}
+	}
+
+	if oldStatus != string(status) {
+		if err := recordEvent(tx, id, EventStatus, oldStatus, string(status), actor); err != nil {
+			return "", err
+		}
+	}
+	return model.Status(oldStatus), nil
 }
 
-// AppendDescription appends text to an item's description.
-func (db *DB) AppendDescription(id string, text string) error {
-	result, err := db.Exec(`
-		UPDATE items
-		SET description = COALESCE(description, '') || ? || char(10) || ?,
-		    updated_at = ?
-		WHERE id = ?`,
-		"\n", text, time.Now(), id)
+// CompleteItem marks an item done once its gates pass: every definition of
+// done criterion checked off (see RequireCriteriaChecked) and every reviewer
+// approved (see RequireApproval). force skips the gates. Anything that
+// completes tasks on request should use this rather than UpdateStatus.
+func (db *DB) CompleteItem(id string, force bool) error {
+	if !force {
+		if err := db.RequireCriteriaChecked(id); err != nil {
+			return err
+		}
+		if err := db.RequireApproval(id); err != nil {
+			return err
+		}
+	}
+	return db.UpdateStatus(id, model.StatusDone)
+}
+
+// ItemEdit is a set of changes to make to an item at once. Nil fields are
+// left as they are.
+type ItemEdit struct {
+	Title            *string
+	Description      *string
+	DefinitionOfDone *string // Empty clears it
+	Project          *string
+	Parent           *string // Epic ID
+	Status           *model.Status
+}
+
+// EditItem applies every change in edit in one transaction, so if any of
+// them is rejected the item is left as it was. A status of done has to pass
+// CompleteItem's gates, checked against the definition of done as edited.
+func (db *DB) EditItem(id string, edit ItemEdit) error {
+	if edit.Status != nil && !edit.Status.IsValid() {
+		return fmt.Errorf("invalid status: %s", *edit.Status)
+	}
+	item, err := db.GetItem(id)
 	if err != nil {
-		return fmt.Errorf("failed to append description: %w", err)
+		return err
+	}
+	// As in UpdateStatus, the pre- hook runs before the transaction
+	if edit.Status != nil {
+		if err := db.runStatusHook("pre", item, item.Status, *edit.Status, db.actor); err != nil {
+			return err
+		}
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if edit.Title != nil {
+		title := *edit.Title
+		if err := setField(tx, id, "title", EventTitle, "set title", db.actor, func(string) *string { return &title }); err != nil {
+			return err
+		}
+	}
+	if edit.Description != nil {
+		text := *edit.Description
+		if err := setField(tx, id, "description", EventDescription, "set description", db.actor, func(string) *string { return &text }); err != nil {
+			return err
+		}
+	}
+	if edit.DefinitionOfDone != nil {
+		criteria := textCriteria(*edit.DefinitionOfDone)
+		err := replaceCriteria(tx, id, "set definition of done", db.actor, func([]model.Criterion) ([]model.Criterion, error) {
+			return criteria, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if edit.Project != nil {
+		project := *edit.Project
+		if project != "" {
+			if err := ensureProject(tx, project); err != nil {
+				return err
+			}
+		}
+		if err := setField(tx, id, "project", EventProject, "set project", db.actor, func(string) *string { return &project }); err != nil {
+			return err
+		}
+	}
+	if edit.Parent != nil {
+		parentID := *edit.Parent
+		if err := checkParent(tx, id, parentID); err != nil {
+			return err
+		}
+		if err := setField(tx, id, "parent_id", EventParent, "set parent", db.actor, func(string) *string { return &parentID }); err != nil {
+			return err
+		}
+	}
+	var oldStatus model.Status
+	if edit.Status != nil {
+		if *edit.Status == model.StatusDone {
+			if err := requireCriteriaChecked(tx, id); err != nil {
+				return err
+			}
+			if err := requireApproval(tx, id); err != nil {
+				return err
+			}
+		}
+		if oldStatus, err = applyStatus(tx, id, *edit.Status, db.actor); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if edit.Status != nil {
+		db.runPostStatusHook(id, oldStatus, *edit.Status, db.actor)
 	}
 	return nil
 }
 
+// AppendDescription appends text to an item's description.
+func (db *DB) AppendDescription(id string, text string) error {
+	return db.setItemField(id, "description", EventDescription, "append description", func(old string) *string {
+		appended := old + "\n\n" + text
+		return &appended
+	})
+}
+
 // SetParent sets an item's parent to an epic.
 func (db *DB) SetParent(itemID, parentID string) error {
+	if err := checkParent(db, itemID, parentID); err != nil {
+		return err
+	}
+	return db.setItemField(itemID, "parent_id", EventParent, "set parent", func(string) *string {
+		return &parentID
+	})
+}
+
+// checkParent returns an error unless parentID is an epic that itemID can
+// be moved under.
+func checkParent(q querier, itemID, parentID string) error {
 	// Verify parent exists and is an epic
 	var itemType string
-	err := db.QueryRow(`SELECT type FROM items WHERE id = ?`, parentID).Scan(&itemType)
+	err := q.QueryRow(`SELECT type FROM items WHERE id = ? AND deleted_at IS NULL`, parentID).Scan(&itemType)
 	if err != nil {
-		return fmt.Errorf("parent not found: %s (use 'prog list' to see available items)", parentID)
+		return fmt.Errorf("parent %w: %s (use 'prog list' to see available items)", ErrNotFound, parentID)
 	}
 	if itemType != string(model.ItemTypeEpic) {
 		return fmt.Errorf("parent must be an epic, got %s", itemType)
 	}
 
-	// Update the item's parent
-	result, err := db.Exec(`
-		UPDATE items SET parent_id = ?, updated_at = ? WHERE id = ?`,
-		parentID, time.Now(), itemID)
+	// The epic will wait on the item, so the item mustn't already wait on it
+	path, err := depPath(q, itemID, parentID)
 	if err != nil {
-		return fmt.Errorf("failed to set parent: %w", err)
+		return err
 	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", itemID)
+	if path != nil {
+		cycle := append([]string{parentID}, path...)
+		return fmt.Errorf("%w: %s (each waits on the next)", ErrDepCycle, strings.Join(cycle, " -> "))
 	}
 	return nil
 }
@@ -159,74 +392,68 @@ func (db *DB) SetProject(id string, project string) error {
 		}
 	}
 
-	result, err := db.Exec(`
-		UPDATE items SET project = ?, updated_at = ? WHERE id = ?`,
-		project, time.Now(), id)
-	if err != nil {
-		return fmt.Errorf("failed to set project: %w", err)
-	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
-	}
-	return nil
+	return db.setItemField(id, "project", EventProject, "set project", func(string) *string {
+		return &project
+	})
 }
 
 // SetDescription replaces an item's description entirely.
 func (db *DB) SetDescription(id string, text string) error {
-	result, err := db.Exec(`
-		UPDATE items
-		SET description = ?,
-		    updated_at = ?
-		WHERE id = ?`,
-		text, time.Now(), id)
-	if err != nil {
-		return fmt.Errorf("failed to set description: %w", err)
-	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
-	}
-	return nil
+	return db.setItemField(id, "description", EventDescription, "set description", func(string) *string {
+		return &text
+	})
 }
 
 // SetTitle replaces an item's title.
 func (db *DB) SetTitle(id string, title string) error {
-	result, err := db.Exec(`
-		UPDATE items
-		SET title = ?,
-		    updated_at = ?
-		WHERE id = ?`,
-		title, time.Now(), id)
+	return db.setItemField(id, "title", EventTitle, "set title", func(string) *string {
+		return &title
+	})
+}
+
+// setItemField replaces one column of an item with value(old) and records the
+// change in the item's history. column must be a trusted column name; action
+// describes the change in error messages.
+func (db *DB) setItemField(id, column, field, action string, value func(old string) *string) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to set title: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
+	if err := setField(tx, id, column, field, action, db.actor, value); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
 
-// SetDefinitionOfDone sets or clears an item's definition of done.
-// Pass nil to clear the DoD.
-func (db *DB) SetDefinitionOfDone(id string, dod *string) error {
-	result, err := db.Exec(`
-		UPDATE items
-		SET definition_of_done = ?,
-		    updated_at = ?
-		WHERE id = ?`,
-		dod, time.Now(), id)
+// setField is setItemField inside a transaction.
+func setField(tx *sql.Tx, id, column, field, action, actor string, value func(old string) *string) error {
+	var old sql.NullString
+	err := tx.QueryRow(`SELECT `+column+` FROM items WHERE id = ? AND deleted_at IS NULL`, id).Scan(&old)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to set definition of done: %w", err)
+		return fmt.Errorf("failed to %s: %w", action, err)
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
+	updated := value(old.String)
+	_, err = tx.Exec(`UPDATE items SET `+column+` = ?, updated_at = ? WHERE id = ?`, updated, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+
+	newValue := ""
+	if updated != nil {
+		newValue = *updated
+	}
+	if newValue != old.String {
+		return recordEvent(tx, id, field, old.String, newValue, actor)
 	}
 	return nil
 }
@@ -250,7 +477,7 @@ func (db *DB) DeriveEpicStatus(epicID string) (model.Status, error) {
 	var itemType string
 	err := db.QueryRow(`SELECT type, status FROM items WHERE id = ?`, epicID).Scan(&itemType, &rawStatus)
 	if err == sql.ErrNoRows {
-		return "", fmt.Errorf("item not found: %s", epicID)
+		return "", fmt.Errorf("item %w: %s", ErrNotFound, epicID)
 	}
 	if err != nil {
 		return "", fmt.Errorf("failed to get item: %w", err)
@@ -280,7 +507,7 @@ func (db *DB) deriveFromChildren(epicID string, storedStatus model.Status) (mode
 	// Count children by status
 	rows, err := db.Query(`
 		SELECT status, COUNT(*) FROM items
-		WHERE parent_id = ?
+		WHERE parent_id = ? AND deleted_at IS NULL
 		GROUP BY status`, epicID)
 	if err != nil {
 		return "", fmt.Errorf("failed to count children: %w", err)
@@ -367,36 +594,3 @@ func (db *DB) applyDerivedEpicStatus(item *model.Item) error {
 	item.Status = derived
 	return nil
 }
-
-// DeleteItem removes an item and its associated logs and dependencies.
-func (db *DB) DeleteItem(id string) error {
-	// Check if item exists first
-	var count int
-	err := db.QueryRow(`SELECT COUNT(*) FROM items WHERE id = ?`, id).Scan(&count)
-	if err != nil {
-		return fmt.Errorf("failed to check item: %w", err)
-	}
-	if count == 0 {
-		return fmt.Errorf("item not found: %s (use 'prog list' to see available items)", id)
-	}
-
-	// Delete logs
-	_, err = db.Exec(`DELETE FROM logs WHERE item_id = ?`, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete logs: %w", err)
-	}
-
-	// Delete dependencies (both directions)
-	_, err = db.Exec(`DELETE FROM deps WHERE item_id = ? OR depends_on = ?`, id, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete dependencies: %w", err)
-	}
-
-	// Delete the item
-	_, err = db.Exec(`DELETE FROM items WHERE id = ?`, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete item: %w", err)
-	}
-
-	return nil
-}
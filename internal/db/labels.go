@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -9,7 +10,11 @@ import (
 
 // CreateLabel inserts a new label.
 func (db *DB) CreateLabel(l *model.Label) error {
-	_, err := db.Exec(`
+	return createLabel(db, l)
+}
+
+func createLabel(ex execer, l *model.Label) error {
+	_, err := ex.Exec(`
 		INSERT INTO labels (id, name, project, color, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?)
 	`, l.ID, l.Name, l.Project, l.Color, l.CreatedAt, l.UpdatedAt)
@@ -22,14 +27,18 @@ func (db *DB) CreateLabel(l *model.Label) error {
 // GetLabelByName retrieves a label by name and project.
 // This is the primary lookup method for labels.
 func (db *DB) GetLabelByName(project, name string) (*model.Label, error) {
+	return getLabelByName(db, project, name)
+}
+
+func getLabelByName(q querier, project, name string) (*model.Label, error) {
 	var l model.Label
 	var color *string
-	err := db.QueryRow(`
+	err := q.QueryRow(`
 		SELECT id, name, project, color, created_at, updated_at
 		FROM labels WHERE name = ? AND project = ?
 	`, name, project).Scan(&l.ID, &l.Name, &l.Project, &color, &l.CreatedAt, &l.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("label not found: %s", name)
+		return nil, fmt.Errorf("label %w: %s", ErrNotFound, name)
 	}
 	if color != nil {
 		l.Color = *color
@@ -46,7 +55,7 @@ func (db *DB) GetLabel(id string) (*model.Label, error) {
 		FROM labels WHERE id = ?
 	`, id).Scan(&l.ID, &l.Name, &l.Project, &color, &l.CreatedAt, &l.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("label not found: %s", id)
+		return nil, fmt.Errorf("label %w: %s", ErrNotFound, id)
 	}
 	if color != nil {
 		l.Color = *color
@@ -85,16 +94,28 @@ func (db *DB) ListLabels(project string) ([]model.Label, error) {
 
 // RenameLabel changes a label's name.
 func (db *DB) RenameLabel(project, oldName, newName string) error {
-	result, err := db.Exec(`
-		UPDATE labels SET name = ?, updated_at = ?
-		WHERE name = ? AND project = ?
-	`, newName, time.Now(), oldName, project)
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var labelID string
+	err = tx.QueryRow(`SELECT id FROM labels WHERE name = ? AND project = ?`, oldName, project).Scan(&labelID)
+	if err != nil {
+		return fmt.Errorf("label %w: %s", ErrNotFound, oldName)
+	}
+
+	_, err = tx.Exec(`UPDATE labels SET name = ?, updated_at = ? WHERE id = ?`, newName, time.Now(), labelID)
 	if err != nil {
 		return fmt.Errorf("failed to rename label: %w", err)
 	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("label not found: %s", oldName)
+	if err := recordLabelEvents(tx, labelID, oldName, newName, db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
@@ -111,7 +132,11 @@ func (db *DB) DeleteLabel(project, name string) error {
 	var labelID string
 	err = tx.QueryRow(`SELECT id FROM labels WHERE name = ? AND project = ?`, name, project).Scan(&labelID)
 	if err != nil {
-		return fmt.Errorf("label not found: %s", name)
+		return fmt.Errorf("label %w: %s", ErrNotFound, name)
+	}
+
+	if err := recordLabelEvents(tx, labelID, name, "", db.actor); err != nil {
+		return err
 	}
 
 	// Delete item associations
@@ -132,10 +157,42 @@ func (db *DB) DeleteLabel(project, name string) error {
 	return nil
 }
 
+// recordLabelEvents records a label change on every item carrying the label.
+func recordLabelEvents(tx *sql.Tx, labelID, oldName, newName, actor string) error {
+	rows, err := tx.Query(`SELECT item_id FROM item_labels WHERE label_id = ? ORDER BY item_id`, labelID)
+	if err != nil {
+		return fmt.Errorf("failed to query labeled items: %w", err)
+	}
+	var itemIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan item: %w", err)
+		}
+		itemIDs = append(itemIDs, id)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range itemIDs {
+		if err := recordEvent(tx, id, EventLabel, oldName, newName, actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // EnsureLabel creates a label if it doesn't exist, returns the label.
 func (db *DB) EnsureLabel(project, name string) (*model.Label, error) {
+	return ensureLabel(db, project, name)
+}
+
+func ensureLabel(q querier, project, name string) (*model.Label, error) {
 	// Try to get existing label
-	label, err := db.GetLabelByName(project, name)
+	label, err := getLabelByName(q, project, name)
 	if err == nil {
 		return label, nil
 	}
@@ -149,29 +206,41 @@ func (db *DB) EnsureLabel(project, name string) (*model.Label, error) {
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
-	if err := db.CreateLabel(label); err != nil {
+	if err := createLabel(q, label); err != nil {
 		return nil, err
 	}
 	return label, nil
 }
 
 // AddLabelToItem attaches a label to an item.
-// Creates the label if it doesn't exist.
+// Creates the label if it doesn't exist. Items that don't exist or are in the
+// trash are refused.
 func (db *DB) AddLabelToItem(itemID, project, labelName string) error {
+	return addItemLabel(db, itemID, project, labelName, db.actor)
+}
+
+func addItemLabel(q querier, itemID, project, labelName, actor string) error {
+	if _, err := getItem(q, itemID); err != nil {
+		return err
+	}
+
 	// Ensure label exists
-	label, err := db.EnsureLabel(project, labelName)
+	label, err := ensureLabel(q, project, labelName)
 	if err != nil {
 		return fmt.Errorf("failed to ensure label: %w", err)
 	}
 
 	// Add association (ignore if already exists)
-	_, err = db.Exec(`
+	result, err := q.Exec(`
 		INSERT OR IGNORE INTO item_labels (item_id, label_id)
 		VALUES (?, ?)
 	`, itemID, label.ID)
 	if err != nil {
 		return fmt.Errorf("failed to add label to item: %w", err)
 	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		return recordEvent(q, itemID, EventLabel, "", label.Name, actor)
+	}
 	return nil
 }
 
@@ -193,7 +262,7 @@ func (db *DB) RemoveLabelFromItem(itemID, project, labelName string) error {
 	if rows == 0 {
 		return fmt.Errorf("item does not have label: %s", labelName)
 	}
-	return nil
+	return recordEvent(db, itemID, EventLabel, label.Name, "", db.actor)
 }
 
 // GetItemLabels returns all labels attached to an item.
@@ -288,7 +357,7 @@ func (db *DB) SetLabelColor(project, name, color string) error {
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("label not found: %s", name)
+		return fmt.Errorf("label %w: %s", ErrNotFound, name)
 	}
 	return nil
 }
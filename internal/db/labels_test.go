@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -248,6 +249,13 @@ func TestAddLabelToItem(t *testing.T) {
 	if labels[0].ID != label.ID {
 		t.Error("wrong label attached to item")
 	}
+
+	if err := db.DeleteItem(item.ID); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	if err := db.AddLabelToItem(item.ID, "test", "other"); !errors.Is(err, ErrInTrash) {
+		t.Errorf("expected ErrInTrash for a trashed item, got %v", err)
+	}
 }
 
 func TestAddLabelToItem_Idempotent(t *testing.T) {
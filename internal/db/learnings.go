@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -10,8 +11,17 @@ import (
 )
 
 // CreateLearning inserts a new learning and its concept associations.
-// Creates concepts that don't exist yet.
+// Creates concepts that don't exist yet. Actor defaults to db's actor. With
+// hooks installed, pre-learn can reject the learning and post-learn runs once
+// it is saved.
 func (db *DB) CreateLearning(l *model.Learning) error {
+	if l.Actor == "" {
+		l.Actor = db.actor
+	}
+	if err := db.runLearningHook("pre", l); err != nil {
+		return err
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -30,18 +40,42 @@ func (db *DB) CreateLearning(l *model.Learning) error {
 
 	// Insert learning
 	_, err = tx.Exec(`
-		INSERT INTO learnings (id, project, created_at, updated_at, task_id, summary, detail, files, status)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, l.ID, l.Project, l.CreatedAt, l.UpdatedAt, l.TaskID, l.Summary, l.Detail, filesJSON, l.Status)
+		INSERT INTO learnings (id, project, created_at, updated_at, task_id, summary, detail, files, status, actor)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, l.ID, l.Project, l.CreatedAt, l.UpdatedAt, l.TaskID, l.Summary, l.Detail, filesJSON, l.Status, l.Actor)
 	if err != nil {
 		return fmt.Errorf("failed to insert learning: %w", err)
 	}
 
-	// Ensure concepts exist and create associations
+	if err := linkConcepts(tx, l); err != nil {
+		return err
+	}
+	if err := writeLearningFiles(tx, l.ID, l.Files); err != nil {
+		return err
+	}
+	if err := writeLearningTerms(tx, l.ID, l.Title, l.Summary, l.Detail); err != nil {
+		return err
+	}
+
+	if err := appendChange(tx, model.Change{Kind: ChangeLearning, Action: ActionCreated, Target: l.ID, Project: l.Project, Actor: l.Actor, NewValue: l.Summary}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	_ = db.runLearningHook("post", l)
+	return nil
+}
+
+// linkConcepts associates a learning with its concepts, creating concepts
+// that don't exist yet.
+func linkConcepts(tx *sql.Tx, l *model.Learning) error {
 	for _, conceptName := range l.Concepts {
 		// Check if concept exists
 		var conceptID string
-		err = tx.QueryRow(`SELECT id FROM concepts WHERE name = ? AND project = ?`, conceptName, l.Project).Scan(&conceptID)
+		err := tx.QueryRow(`SELECT id FROM concepts WHERE name = ? AND project = ?`, conceptName, l.Project).Scan(&conceptID)
 		if err != nil {
 			// Concept doesn't exist, create it
 			conceptID = model.GenerateConceptID()
@@ -69,28 +103,33 @@ func (db *DB) CreateLearning(l *model.Learning) error {
 			return fmt.Errorf("failed to create concept association: %w", err)
 		}
 	}
+	return nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
+// learningColumns are the columns scanLearning reads, from learnings as l.
+const learningColumns = `l.id, l.project, l.created_at, l.updated_at, l.task_id,
+	l.summary, l.detail, l.files, l.status, l.actor, l.path, l.title, l.provenance, l.review_reason`
 
-	return nil
+// learningStatusFilter restricts learnings as l to those retrieved for
+// context: active ones and those that need review, plus stale ones if
+// includeStale.
+func learningStatusFilter(includeStale bool) string {
+	if includeStale {
+		return "AND l.status IN ('active', 'needs-review', 'stale')"
+	}
+	return "AND l.status IN ('active', 'needs-review')"
 }
 
-// GetLearning retrieves a learning by ID.
-func (db *DB) GetLearning(id string) (*model.Learning, error) {
+// scanLearning scans a row of learningColumns. Concepts are not loaded.
+func scanLearning(row interface{ Scan(...any) error }) (*model.Learning, error) {
 	var l model.Learning
-	var filesJSON string
-	var taskID *string
-
-	err := db.QueryRow(`
-		SELECT id, project, created_at, updated_at, task_id, summary, detail, files, status
-		FROM learnings WHERE id = ?
-	`, id).Scan(&l.ID, &l.Project, &l.CreatedAt, &l.UpdatedAt, &taskID, &l.Summary, &l.Detail, &filesJSON, &l.Status)
-	if err != nil {
-		return nil, fmt.Errorf("learning not found: %s", id)
+	var filesJSON, provenanceJSON string
+	var path sql.NullString
+	if err := row.Scan(&l.ID, &l.Project, &l.CreatedAt, &l.UpdatedAt, &l.TaskID,
+		&l.Summary, &l.Detail, &filesJSON, &l.Status, &l.Actor, &path, &l.Title, &provenanceJSON, &l.ReviewReason); err != nil {
+		return nil, err
 	}
-	l.TaskID = taskID
+	l.Path = path.String
 
 	// Parse files JSON
 	if filesJSON != "" && filesJSON != "[]" {
@@ -98,9 +137,45 @@ func (db *DB) GetLearning(id string) (*model.Learning, error) {
 			return nil, fmt.Errorf("failed to unmarshal files: %w", err)
 		}
 	}
+	if provenanceJSON != "" && provenanceJSON != "[]" {
+		if err := json.Unmarshal([]byte(provenanceJSON), &l.Provenance); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal provenance: %w", err)
+		}
+	}
+	return &l, nil
+}
 
-	// Get associated concepts
-	rows, err := db.Query(`
+// queryLearnings runs a query selecting learningColumns and loads each
+// learning's concepts.
+func (db *DB) queryLearnings(query string, args ...any) ([]model.Learning, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var learnings []model.Learning
+	for rows.Next() {
+		l, err := scanLearning(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan learning: %w", err)
+		}
+		learnings = append(learnings, *l)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	for i := range learnings {
+		if learnings[i].Concepts, err = getLearningConcepts(db, learnings[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return learnings, nil
+}
+
+// getLearningConcepts returns the names of a learning's concepts.
+func getLearningConcepts(q querier, id string) ([]string, error) {
+	rows, err := q.Query(`
 		SELECT c.name FROM learning_concepts lc
 		JOIN concepts c ON c.id = lc.concept_id
 		WHERE lc.learning_id = ?
@@ -110,15 +185,29 @@ func (db *DB) GetLearning(id string) (*model.Learning, error) {
 	}
 	defer rows.Close()
 
+	var concepts []string
 	for rows.Next() {
 		var concept string
 		if err := rows.Scan(&concept); err != nil {
 			return nil, fmt.Errorf("failed to scan concept: %w", err)
 		}
-		l.Concepts = append(l.Concepts, concept)
+		concepts = append(concepts, concept)
 	}
+	return concepts, rows.Err()
+}
 
-	return &l, nil
+// GetLearning retrieves a learning by ID.
+func (db *DB) GetLearning(id string) (*model.Learning, error) {
+	l, err := scanLearning(db.QueryRow(`SELECT `+learningColumns+` FROM learnings l WHERE l.id = ?`, id))
+	if err != nil {
+		return nil, fmt.Errorf("learning %w: %s", ErrNotFound, id)
+	}
+
+	// Get associated concepts
+	if l.Concepts, err = getLearningConcepts(db, id); err != nil {
+		return nil, err
+	}
+	return l, nil
 }
 
 // GetCurrentTaskID returns the ID of the first in-progress task for a project.
@@ -127,7 +216,7 @@ func (db *DB) GetCurrentTaskID(project string) (*string, error) {
 	var taskID string
 	err := db.QueryRow(`
 		SELECT id FROM items
-		WHERE status = 'in_progress' AND project = ?
+		WHERE status = 'in_progress' AND project = ? AND deleted_at IS NULL
 		ORDER BY updated_at DESC
 		LIMIT 1
 	`, project).Scan(&taskID)
@@ -192,7 +281,7 @@ func (db *DB) SetConceptSummary(name, project, summary string) error {
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("concept not found: %s", name)
+		return fmt.Errorf("concept %w: %s", ErrNotFound, name)
 	}
 	return nil
 }
@@ -208,15 +297,19 @@ func (db *DB) UpdateLearningSummary(id, summary string) error {
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("learning not found: %s", id)
+		return fmt.Errorf("learning %w: %s", ErrNotFound, id)
 	}
-	return nil
+	if err := reindexLearningTerms(db, id); err != nil {
+		return err
+	}
+	return appendChange(db, model.Change{Kind: ChangeLearning, Action: "summary", Target: id, Actor: db.actor, NewValue: summary})
 }
 
-// UpdateLearningStatus updates a learning's status (active, stale, archived).
+// UpdateLearningStatus updates a learning's status (active, stale, archived),
+// clearing why it needed review.
 func (db *DB) UpdateLearningStatus(id string, status model.LearningStatus) error {
 	result, err := db.Exec(`
-		UPDATE learnings SET status = ?, updated_at = ?
+		UPDATE learnings SET status = ?, review_reason = '', updated_at = ?
 		WHERE id = ?
 	`, status, time.Now(), id)
 	if err != nil {
@@ -224,9 +317,9 @@ func (db *DB) UpdateLearningStatus(id string, status model.LearningStatus) error
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("learning not found: %s", id)
+		return fmt.Errorf("learning %w: %s", ErrNotFound, id)
 	}
-	return nil
+	return appendChange(db, model.Change{Kind: ChangeLearning, Action: "status", Target: id, Actor: db.actor, NewValue: string(status)})
 }
 
 // UpdateLearningDetail updates a learning's detail.
@@ -240,12 +333,16 @@ func (db *DB) UpdateLearningDetail(id, detail string) error {
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("learning not found: %s", id)
+		return fmt.Errorf("learning %w: %s", ErrNotFound, id)
 	}
-	return nil
+	if err := reindexLearningTerms(db, id); err != nil {
+		return err
+	}
+	return appendChange(db, model.Change{Kind: ChangeLearning, Action: "detail", Target: id, Actor: db.actor, NewValue: detail})
 }
 
-// DeleteLearning removes a learning and its concept associations.
+// DeleteLearning removes a learning, its concept associations, files,
+// search terms and feedback.
 func (db *DB) DeleteLearning(id string) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -253,12 +350,32 @@ func (db *DB) DeleteLearning(id string) error {
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	// Recorded first, while the learning's project can still be looked up
+	if err := appendChange(tx, model.Change{Kind: ChangeLearning, Action: ActionDeleted, Target: id, Actor: db.actor}); err != nil {
+		return err
+	}
+
 	// Delete concept associations
 	_, err = tx.Exec(`DELETE FROM learning_concepts WHERE learning_id = ?`, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete concept associations: %w", err)
 	}
 
+	_, err = tx.Exec(`DELETE FROM learning_feedback WHERE learning_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete feedback: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM learning_files WHERE learning_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete files: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM learning_terms WHERE learning_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete terms: %w", err)
+	}
+
 	// Delete learning
 	result, err := tx.Exec(`DELETE FROM learnings WHERE id = ?`, id)
 	if err != nil {
@@ -266,7 +383,7 @@ func (db *DB) DeleteLearning(id string) error {
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("learning not found: %s", id)
+		return fmt.Errorf("learning %w: %s", ErrNotFound, id)
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -286,13 +403,15 @@ func (db *DB) RenameConcept(oldName, newName, project string) error {
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("concept not found: %s", oldName)
+		return fmt.Errorf("concept %w: %s", ErrNotFound, oldName)
 	}
 	return nil
 }
 
 // GetLearningsByConcepts returns learnings that have any of the specified concepts.
-// Only returns active learnings by default. Results are sorted by created_at desc.
+// Only returns active learnings and those needing review by default. Page
+// stubs come first, then results are sorted by relevance feedback, then
+// created_at desc.
 func (db *DB) GetLearningsByConcepts(project string, conceptNames []string, includeStale bool) ([]model.Learning, error) {
 	if len(conceptNames) == 0 {
 		return nil, nil
@@ -307,135 +426,23 @@ func (db *DB) GetLearningsByConcepts(project string, conceptNames []string, incl
 		args = append(args, name)
 	}
 
-	statusFilter := "AND l.status = 'active'"
-	if includeStale {
-		statusFilter = "AND l.status IN ('active', 'stale')"
-	}
+	statusFilter := learningStatusFilter(includeStale)
 
 	query := `
-		SELECT DISTINCT l.id, l.project, l.created_at, l.updated_at, l.task_id,
-			l.summary, l.detail, l.files, l.status
+		SELECT DISTINCT ` + learningColumns + `
 		FROM learnings l
 		JOIN learning_concepts lc ON lc.learning_id = l.id
 		JOIN concepts c ON c.id = lc.concept_id
+		LEFT JOIN ` + feedbackScores + ` f ON f.learning_id = l.id
 		WHERE l.project = ? AND c.name IN (` + strings.Join(placeholders, ",") + `)
 		` + statusFilter + `
-		ORDER BY l.created_at DESC
+		ORDER BY l.path IS NULL, COALESCE(f.score, 0.5) DESC, l.created_at DESC
 	`
 
-	rows, err := db.Query(query, args...)
+	learnings, err := db.queryLearnings(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query learnings: %w", err)
 	}
-	defer rows.Close()
-
-	var learnings []model.Learning
-	for rows.Next() {
-		var l model.Learning
-		var filesJSON string
-		var taskID *string
-		if err := rows.Scan(&l.ID, &l.Project, &l.CreatedAt, &l.UpdatedAt, &taskID,
-			&l.Summary, &l.Detail, &filesJSON, &l.Status); err != nil {
-			return nil, fmt.Errorf("failed to scan learning: %w", err)
-		}
-		l.TaskID = taskID
-
-		// Parse files JSON
-		if filesJSON != "" && filesJSON != "[]" {
-			if err := json.Unmarshal([]byte(filesJSON), &l.Files); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal files: %w", err)
-			}
-		}
-
-		// Get associated concepts
-		conceptRows, err := db.Query(`
-			SELECT c.name FROM learning_concepts lc
-			JOIN concepts c ON c.id = lc.concept_id
-			WHERE lc.learning_id = ?
-		`, l.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get concepts: %w", err)
-		}
-		for conceptRows.Next() {
-			var concept string
-			if err := conceptRows.Scan(&concept); err != nil {
-				conceptRows.Close()
-				return nil, fmt.Errorf("failed to scan concept: %w", err)
-			}
-			l.Concepts = append(l.Concepts, concept)
-		}
-		conceptRows.Close()
-
-		learnings = append(learnings, l)
-	}
-
-	return learnings, nil
-}
-
-// SearchLearnings performs full-text search on learnings.
-// Returns learnings matching the query, sorted by relevance.
-func (db *DB) SearchLearnings(project string, query string, includeStale bool) ([]model.Learning, error) {
-	statusFilter := "AND l.status = 'active'"
-	if includeStale {
-		statusFilter = "AND l.status IN ('active', 'stale')"
-	}
-
-	sqlQuery := `
-		SELECT l.id, l.project, l.created_at, l.updated_at, l.task_id,
-			l.summary, l.detail, l.files, l.status
-		FROM learnings l
-		JOIN learnings_fts fts ON l.rowid = fts.rowid
-		WHERE learnings_fts MATCH ? AND l.project = ?
-		` + statusFilter + `
-		ORDER BY rank
-	`
-
-	rows, err := db.Query(sqlQuery, query, project)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search learnings: %w", err)
-	}
-	defer rows.Close()
-
-	var learnings []model.Learning
-	for rows.Next() {
-		var l model.Learning
-		var filesJSON string
-		var taskID *string
-		if err := rows.Scan(&l.ID, &l.Project, &l.CreatedAt, &l.UpdatedAt, &taskID,
-			&l.Summary, &l.Detail, &filesJSON, &l.Status); err != nil {
-			return nil, fmt.Errorf("failed to scan learning: %w", err)
-		}
-		l.TaskID = taskID
-
-		// Parse files JSON
-		if filesJSON != "" && filesJSON != "[]" {
-			if err := json.Unmarshal([]byte(filesJSON), &l.Files); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal files: %w", err)
-			}
-		}
-
-		// Get associated concepts
-		conceptRows, err := db.Query(`
-			SELECT c.name FROM learning_concepts lc
-			JOIN concepts c ON c.id = lc.concept_id
-			WHERE lc.learning_id = ?
-		`, l.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get concepts: %w", err)
-		}
-		for conceptRows.Next() {
-			var concept string
-			if err := conceptRows.Scan(&concept); err != nil {
-				conceptRows.Close()
-				return nil, fmt.Errorf("failed to scan concept: %w", err)
-			}
-			l.Concepts = append(l.Concepts, concept)
-		}
-		conceptRows.Close()
-
-		learnings = append(learnings, l)
-	}
-
 	return learnings, nil
 }
 
@@ -454,7 +461,7 @@ func (db *DB) ListConceptsWithStats(project string) ([]ConceptStats, error) {
 			MIN(l.created_at) as oldest
 		FROM concepts c
 		LEFT JOIN learning_concepts lc ON lc.concept_id = c.id
-		LEFT JOIN learnings l ON l.id = lc.learning_id AND l.status = 'active'
+		LEFT JOIN learnings l ON l.id = lc.learning_id AND l.status IN ('active', 'needs-review')
 		WHERE c.project = ?
 		GROUP BY c.id
 		ORDER BY count DESC, c.name
@@ -495,69 +502,24 @@ func (db *DB) ListConceptsWithStats(project string) ([]ConceptStats, error) {
 	return stats, nil
 }
 
-// GetAllLearnings returns all learnings for a project, sorted by created_at desc.
-// Only returns active learnings by default.
+// GetAllLearnings returns all learnings for a project, page stubs first,
+// sorted by created_at desc.
+// Only returns active learnings and those needing review by default.
 func (db *DB) GetAllLearnings(project string, includeStale bool) ([]model.Learning, error) {
-	statusFilter := "AND l.status = 'active'"
-	if includeStale {
-		statusFilter = "AND l.status IN ('active', 'stale')"
-	}
+	statusFilter := learningStatusFilter(includeStale)
 
 	query := `
-		SELECT l.id, l.project, l.created_at, l.updated_at, l.task_id,
-			l.summary, l.detail, l.files, l.status
+		SELECT ` + learningColumns + `
 		FROM learnings l
 		WHERE l.project = ?
 		` + statusFilter + `
-		ORDER BY l.created_at DESC
+		ORDER BY l.path IS NULL, l.created_at DESC
 	`
 
-	rows, err := db.Query(query, project)
+	learnings, err := db.queryLearnings(query, project)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query learnings: %w", err)
 	}
-	defer rows.Close()
-
-	var learnings []model.Learning
-	for rows.Next() {
-		var l model.Learning
-		var filesJSON string
-		var taskID *string
-		if err := rows.Scan(&l.ID, &l.Project, &l.CreatedAt, &l.UpdatedAt, &taskID,
-			&l.Summary, &l.Detail, &filesJSON, &l.Status); err != nil {
-			return nil, fmt.Errorf("failed to scan learning: %w", err)
-		}
-		l.TaskID = taskID
-
-		// Parse files JSON
-		if filesJSON != "" && filesJSON != "[]" {
-			if err := json.Unmarshal([]byte(filesJSON), &l.Files); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal files: %w", err)
-			}
-		}
-
-		// Get associated concepts
-		conceptRows, err := db.Query(`
-			SELECT c.name FROM learning_concepts lc
-			JOIN concepts c ON c.id = lc.concept_id
-			WHERE lc.learning_id = ?
-		`, l.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get concepts: %w", err)
-		}
-		for conceptRows.Next() {
-			var concept string
-			if err := conceptRows.Scan(&concept); err != nil {
-				conceptRows.Close()
-				return nil, fmt.Errorf("failed to scan concept: %w", err)
-			}
-			l.Concepts = append(l.Concepts, concept)
-		}
-		conceptRows.Close()
-
-		learnings = append(learnings, l)
-	}
-
 	return learnings, nil
 }
 
@@ -594,3 +556,34 @@ func (db *DB) GetRelatedConcepts(taskID string) ([]model.Concept, error) {
 
 	return related, nil
 }
+
+// MarkNeedsReview flags a learning as needing review, saying why. Its
+// updated time is kept: the learning itself hasn't changed.
+func (db *DB) MarkNeedsReview(id, reason string) error {
+	result, err := db.Exec(`
+		UPDATE learnings SET status = ?, review_reason = ?
+		WHERE id = ?
+	`, model.LearningStatusNeedsReview, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to update learning status: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("learning %w: %s", ErrNotFound, id)
+	}
+	return appendChange(db, model.Change{Kind: ChangeLearning, Action: "status", Target: id, Actor: db.actor, NewValue: string(model.LearningStatusNeedsReview)})
+}
+
+// GetLearningsNeedingReview returns the learnings flagged as needing review
+// in project (all projects if empty), longest flagged first.
+func (db *DB) GetLearningsNeedingReview(project string) ([]model.Learning, error) {
+	learnings, err := db.queryLearnings(`
+		SELECT `+learningColumns+`
+		FROM learnings l
+		WHERE l.status = ?1 AND (?2 = '' OR l.project = ?2)
+		ORDER BY l.updated_at, l.id`, model.LearningStatusNeedsReview, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query learnings: %w", err)
+	}
+	return learnings, nil
+}
@@ -40,7 +40,7 @@ func TestCreateLearning(t *testing.T) {
 		Concepts:  []string{"auth", "concurrency"},
 	}
 
-	if err := db.CreateLearning(learning); err != nil {
+	if err := db.WithActor("agent-x").CreateLearning(learning); err != nil {
 		t.Fatalf("failed to create learning: %v", err)
 	}
 
@@ -71,6 +71,9 @@ func TestCreateLearning(t *testing.T) {
 	if len(got.Concepts) != 2 {
 		t.Errorf("concepts count = %d, want 2", len(got.Concepts))
 	}
+	if got.Actor != "agent-x" {
+		t.Errorf("actor = %q, want %q", got.Actor, "agent-x")
+	}
 }
 
 func TestCreateLearning_CreatesConceptsOnFirstUse(t *testing.T) {
@@ -270,6 +273,57 @@ func TestUpdateLearningStatus(t *testing.T) {
 	}
 }
 
+func TestMarkNeedsReview(t *testing.T) {
+	db := setupTestDB(t)
+
+	flagged := createTestLearning(t, db, "Tokens refresh under a mutex", "auth")
+	createTestLearning(t, db, "Sessions expire after an hour", "auth")
+
+	if err := db.MarkNeedsReview(flagged.ID, "auth/token.go changed 80% in 2 commits"); err != nil {
+		t.Fatalf("MarkNeedsReview failed: %v", err)
+	}
+	got, _ := db.GetLearning(flagged.ID)
+	if got.Status != model.LearningStatusNeedsReview || got.ReviewReason != "auth/token.go changed 80% in 2 commits" {
+		t.Errorf("flagged learning = %q, %q", got.Status, got.ReviewReason)
+	}
+	if !got.UpdatedAt.Equal(flagged.UpdatedAt) {
+		t.Errorf("updated_at changed from %v to %v", flagged.UpdatedAt, got.UpdatedAt)
+	}
+
+	// Still retrieved, unlike stale learnings
+	learnings, err := db.GetLearningsByConcepts("test", []string{"auth"}, false)
+	if err != nil {
+		t.Fatalf("GetLearningsByConcepts failed: %v", err)
+	}
+	if len(learnings) != 2 {
+		t.Errorf("got %d learnings, want both", len(learnings))
+	}
+
+	review, err := db.GetLearningsNeedingReview("test")
+	if err != nil {
+		t.Fatalf("GetLearningsNeedingReview failed: %v", err)
+	}
+	if ids := learningIDs(review); len(ids) != 1 || ids[0] != flagged.ID {
+		t.Errorf("needing review = %v, want [%s]", ids, flagged.ID)
+	}
+
+	// Reviewing it makes it active again
+	if err := db.UpdateLearningStatus(flagged.ID, model.LearningStatusActive); err != nil {
+		t.Fatalf("UpdateLearningStatus failed: %v", err)
+	}
+	got, _ = db.GetLearning(flagged.ID)
+	if got.Status != model.LearningStatusActive || got.ReviewReason != "" {
+		t.Errorf("reviewed learning = %q, %q", got.Status, got.ReviewReason)
+	}
+	if review, _ := db.GetLearningsNeedingReview("test"); len(review) != 0 {
+		t.Errorf("needing review after review = %v", learningIDs(review))
+	}
+
+	if err := db.MarkNeedsReview("lrn-nope", "gone"); err == nil {
+		t.Error("MarkNeedsReview on a missing learning should fail")
+	}
+}
+
 func TestDeleteLearning(t *testing.T) {
 	db := setupTestDB(t)
 
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// DefaultLeaseTTL is how long a claim lasts before it must be renewed.
+const DefaultLeaseTTL = 30 * time.Minute
+
+// ErrNotClaimable is returned by ClaimTask when the task is not ready to be
+// claimed, usually because another actor claimed it first.
+var ErrNotClaimable = errors.New("task is not claimable")
+
+// ClaimTask atomically moves an open, unblocked task to in_progress and records
+// a lease for actor that expires after ttl.
+//
+// The status check and transition happen in a single conditional UPDATE, so when
+// several agents race on the same task exactly one of them wins. The losers get
+// an error wrapping ErrNotClaimable.
+func (db *DB) ClaimTask(id, actor string, ttl time.Duration) (*model.Lease, error) {
+	if actor == "" {
+		return nil, fmt.Errorf("actor is required to claim a task")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lease TTL must be positive, got %s", ttl)
+	}
+
+	// Free up tasks whose previous holder went away, so they can be claimed again
+	now := time.Now()
+	if _, err := db.ExpireLeases(now); err != nil {
+		return nil, err
+	}
+
+	// A claim starts the task, so it runs the same hooks as UpdateStatus
+	if db.hooks != nil {
+		item, err := db.GetItem(id)
+		if err != nil {
+			return nil, err
+		}
+		if item.Status == model.StatusOpen {
+			if err := db.runStatusHook("pre", item, item.Status, model.StatusInProgress, actor); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.Exec(`
+		UPDATE items SET status = 'in_progress', assignee = ?, updated_at = ?
+		WHERE id = ?
+		  AND type = 'task'
+		  AND status = 'open'
+		  AND deleted_at IS NULL
+		  AND id NOT IN (
+		    SELECT d.item_id FROM deps d
+		    JOIN items i ON d.depends_on = i.id
+		    WHERE `+depUnresolvedExpr+`
+		  )`,
+		actor, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim task: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return nil, claimFailure(tx, id)
+	}
+
+	lease := &model.Lease{
+		ItemID:    id,
+		Actor:     actor,
+		ClaimedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO leases (item_id, actor, claimed_at, expires_at)
+		VALUES (?, ?, ?, ?)`,
+		lease.ItemID, lease.Actor, lease.ClaimedAt.UnixMilli(), lease.ExpiresAt.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to record lease: %w", err)
+	}
+	if err := recordEvent(tx, id, EventStatus, string(model.StatusOpen), string(model.StatusInProgress), actor); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	db.runPostStatusHook(id, model.StatusOpen, model.StatusInProgress, actor)
+	return lease, nil
+}
+
+// claimFailure explains why the conditional claim UPDATE matched no rows.
+func claimFailure(tx *sql.Tx, id string) error {
+	var itemType, status string
+	var deletedAt sql.NullTime
+	err := tx.QueryRow(`SELECT type, status, deleted_at FROM items WHERE id = ?`, id).Scan(&itemType, &status, &deletedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get item: %w", err)
+	}
+	if deletedAt.Valid {
+		return fmt.Errorf("%w: %s", ErrInTrash, id)
+	}
+	if itemType != string(model.ItemTypeTask) {
+		return fmt.Errorf("only tasks can be claimed, %s is an %s", id, itemType)
+	}
+	if status == string(model.StatusOpen) {
+		return fmt.Errorf("%w: %s has unmet dependencies", ErrNotClaimable, id)
+	}
+	var holder string
+	_ = tx.QueryRow(`SELECT actor FROM leases WHERE item_id = ?`, id).Scan(&holder)
+	if holder != "" {
+		return fmt.Errorf("%w: %s is %s (claimed by %s)", ErrNotClaimable, id, status, holder)
+	}
+	return fmt.Errorf("%w: %s is %s", ErrNotClaimable, id, status)
+}
+
+// RenewLease extends the lease actor holds on a task to ttl from now.
+// Fails if the lease has already expired or is held by someone else.
+func (db *DB) RenewLease(id, actor string, ttl time.Duration) (*model.Lease, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lease TTL must be positive, got %s", ttl)
+	}
+
+	now := time.Now()
+	result, err := db.Exec(`
+		UPDATE leases SET expires_at = ?
+		WHERE item_id = ? AND actor = ? AND expires_at > ?`,
+		now.Add(ttl).UnixMilli(), id, actor, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew lease: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		lease, err := db.GetLease(id)
+		if err != nil {
+			return nil, err
+		}
+		if lease == nil || !lease.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("no active lease on %s (claim it again with 'prog claim %s')", id, id)
+		}
+		return nil, fmt.Errorf("lease on %s is held by %s", id, lease.Actor)
+	}
+	return db.GetLease(id)
+}
+
+// ReleaseLease gives up actor's claim on a task and returns it to open.
+func (db *DB) ReleaseLease(id, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.Exec(`DELETE FROM leases WHERE item_id = ? AND actor = ?`, id, actor)
+	if err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("%s holds no lease on %s", actor, id)
+	}
+
+	result, err = tx.Exec(`
+		UPDATE items SET status = 'open', assignee = '', updated_at = ?
+		WHERE id = ? AND status = 'in_progress'`,
+		time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to reopen task: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		if err := recordEvent(tx, id, EventStatus, string(model.StatusInProgress), string(model.StatusOpen), actor); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetLease returns the lease on a task, or nil if it has none.
+// Expired leases that have not been swept yet are still returned.
+func (db *DB) GetLease(id string) (*model.Lease, error) {
+	var lease model.Lease
+	var claimedAt, expiresAt int64
+	err := db.QueryRow(`
+		SELECT item_id, actor, claimed_at, expires_at
+		FROM leases WHERE item_id = ?`, id).Scan(&lease.ItemID, &lease.Actor, &claimedAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lease: %w", err)
+	}
+	lease.ClaimedAt = time.UnixMilli(claimedAt)
+	lease.ExpiresAt = time.UnixMilli(expiresAt)
+	return &lease, nil
+}
+
+// ExpireLeases drops leases that expired at or before now and returns their
+// tasks to open. Returns the IDs of the affected tasks.
+//
+// Only tasks still in_progress are reopened; a task that moved on (e.g. to
+// reviewing) just loses its stale lease.
+func (db *DB) ExpireLeases(now time.Time) ([]string, error) {
+	// Cheap read first so the common case doesn't take the write lock
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM leases WHERE expires_at <= ?`, now.UnixMilli()).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check leases: %w", err)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Write first to take the lock before reading the set we act on
+	reopenedRows, err := tx.Query(`
+		UPDATE items SET status = 'open', assignee = '', updated_at = ?
+		WHERE status = 'in_progress'
+		  AND id IN (SELECT item_id FROM leases WHERE expires_at <= ?)
+		RETURNING id`,
+		now, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen expired tasks: %w", err)
+	}
+	var reopened []string
+	for reopenedRows.Next() {
+		var id string
+		if err := reopenedRows.Scan(&id); err != nil {
+			_ = reopenedRows.Close()
+			return nil, fmt.Errorf("failed to scan task: %w", err)
+		}
+		reopened = append(reopened, id)
+	}
+	_ = reopenedRows.Close()
+	if err := reopenedRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to reopen expired tasks: %w", err)
+	}
+	for _, id := range reopened {
+		if err := recordEvent(tx, id, EventStatus, string(model.StatusInProgress), string(model.StatusOpen), ActorLeaseExpiry); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.Query(`SELECT item_id FROM leases WHERE expires_at <= ? ORDER BY item_id`, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired leases: %w", err)
+	}
+	var expired []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan lease: %w", err)
+		}
+		expired = append(expired, id)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM leases WHERE expires_at <= ?`, now.UnixMilli()); err != nil {
+		return nil, fmt.Errorf("failed to delete expired leases: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return expired, nil
+}
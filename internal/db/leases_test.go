@@ -0,0 +1,251 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func TestClaimTask(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Claim me")
+
+	lease, err := db.ClaimTask(task.ID, "agent-1", time.Minute)
+	if err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if lease.Actor != "agent-1" {
+		t.Errorf("actor = %q, want %q", lease.Actor, "agent-1")
+	}
+	if !lease.ExpiresAt.After(lease.ClaimedAt) {
+		t.Errorf("expires_at %v should be after claimed_at %v", lease.ExpiresAt, lease.ClaimedAt)
+	}
+
+	got, err := db.GetItem(task.ID)
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if got.Status != model.StatusInProgress {
+		t.Errorf("status = %q, want %q", got.Status, model.StatusInProgress)
+	}
+
+	stored, err := db.GetLease(task.ID)
+	if err != nil {
+		t.Fatalf("failed to get lease: %v", err)
+	}
+	if stored == nil || stored.Actor != "agent-1" {
+		t.Errorf("stored lease = %+v, want actor agent-1", stored)
+	}
+}
+
+func TestClaimTask_AlreadyClaimed(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Contended")
+
+	if _, err := db.ClaimTask(task.ID, "agent-1", time.Minute); err != nil {
+		t.Fatalf("first claim failed: %v", err)
+	}
+
+	_, err := db.ClaimTask(task.ID, "agent-2", time.Minute)
+	if !errors.Is(err, ErrNotClaimable) {
+		t.Fatalf("second claim err = %v, want ErrNotClaimable", err)
+	}
+
+	// The original holder keeps the lease
+	lease, _ := db.GetLease(task.ID)
+	if lease == nil || lease.Actor != "agent-1" {
+		t.Errorf("lease = %+v, want held by agent-1", lease)
+	}
+}
+
+func TestClaimTask_ConcurrentSingleWinner(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Raced")
+
+	const agents = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	wins := 0
+	for i := 0; i < agents; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			_, err := db.ClaimTask(task.ID, "agent-"+string(rune('a'+n)), time.Minute)
+			if err == nil {
+				mu.Lock()
+				wins++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrNotClaimable) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if wins != 1 {
+		t.Errorf("wins = %d, want exactly 1", wins)
+	}
+}
+
+func TestClaimTask_UnmetDeps(t *testing.T) {
+	db := setupTestDB(t)
+	blocker := createTestItem(t, db, "Blocker")
+	task := createTestItem(t, db, "Blocked")
+	if err := db.AddDep(task.ID, blocker.ID); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+
+	_, err := db.ClaimTask(task.ID, "agent-1", time.Minute)
+	if !errors.Is(err, ErrNotClaimable) {
+		t.Fatalf("err = %v, want ErrNotClaimable", err)
+	}
+}
+
+func TestClaimTask_RejectsEpicAndMissing(t *testing.T) {
+	db := setupTestDB(t)
+	epic := createTestEpic(t, db, "Epic", "test")
+
+	if _, err := db.ClaimTask(epic.ID, "agent-1", time.Minute); err == nil {
+		t.Error("expected error claiming an epic")
+	}
+	if _, err := db.ClaimTask("ts-nope00", "agent-1", time.Minute); err == nil {
+		t.Error("expected error claiming a missing task")
+	}
+}
+
+func TestClaimTask_RequiresActorAndTTL(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Task")
+
+	if _, err := db.ClaimTask(task.ID, "", time.Minute); err == nil {
+		t.Error("expected error for empty actor")
+	}
+	if _, err := db.ClaimTask(task.ID, "agent-1", 0); err == nil {
+		t.Error("expected error for zero TTL")
+	}
+}
+
+func TestRenewLease(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Long task")
+
+	first, err := db.ClaimTask(task.ID, "agent-1", time.Minute)
+	if err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+
+	renewed, err := db.RenewLease(task.ID, "agent-1", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to renew: %v", err)
+	}
+	if !renewed.ExpiresAt.After(first.ExpiresAt) {
+		t.Errorf("renewed expiry %v should be after %v", renewed.ExpiresAt, first.ExpiresAt)
+	}
+
+	if _, err := db.RenewLease(task.ID, "agent-2", time.Hour); err == nil {
+		t.Error("expected error renewing another actor's lease")
+	}
+}
+
+func TestReleaseLease(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Give back")
+
+	if _, err := db.ClaimTask(task.ID, "agent-1", time.Minute); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if err := db.ReleaseLease(task.ID, "agent-2"); err == nil {
+		t.Error("expected error releasing another actor's lease")
+	}
+	if err := db.ReleaseLease(task.ID, "agent-1"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+
+	got, _ := db.GetItem(task.ID)
+	if got.Status != model.StatusOpen {
+		t.Errorf("status = %q, want %q", got.Status, model.StatusOpen)
+	}
+	lease, _ := db.GetLease(task.ID)
+	if lease != nil {
+		t.Errorf("lease = %+v, want nil", lease)
+	}
+}
+
+func TestExpireLeases(t *testing.T) {
+	db := setupTestDB(t)
+	stale := createTestItem(t, db, "Abandoned")
+	live := createTestItem(t, db, "Active")
+
+	if _, err := db.ClaimTask(stale.ID, "agent-1", time.Minute); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if _, err := db.ClaimTask(live.ID, "agent-2", time.Hour); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+
+	expired, err := db.ExpireLeases(time.Now().Add(2 * time.Minute))
+	if err != nil {
+		t.Fatalf("failed to expire: %v", err)
+	}
+	if len(expired) != 1 || expired[0] != stale.ID {
+		t.Errorf("expired = %v, want [%s]", expired, stale.ID)
+	}
+
+	got, _ := db.GetItem(stale.ID)
+	if got.Status != model.StatusOpen {
+		t.Errorf("abandoned status = %q, want open", got.Status)
+	}
+	got, _ = db.GetItem(live.ID)
+	if got.Status != model.StatusInProgress {
+		t.Errorf("active status = %q, want in_progress", got.Status)
+	}
+
+	// The expired task can be claimed by someone else
+	if _, err := db.ClaimTask(stale.ID, "agent-3", time.Minute); err != nil {
+		t.Errorf("reclaim after expiry failed: %v", err)
+	}
+}
+
+func TestExpireLeases_KeepsFinishedTasks(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Finished")
+
+	if _, err := db.ClaimTask(task.ID, "agent-1", time.Minute); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	// Bypass UpdateStatus so the lease is left behind
+	if _, err := db.Exec(`UPDATE items SET status = 'reviewing' WHERE id = ?`, task.ID); err != nil {
+		t.Fatalf("failed to set status: %v", err)
+	}
+
+	if _, err := db.ExpireLeases(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to expire: %v", err)
+	}
+	got, _ := db.GetItem(task.ID)
+	if got.Status != model.StatusReviewing {
+		t.Errorf("status = %q, want reviewing", got.Status)
+	}
+}
+
+func TestUpdateStatus_DropsLease(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Done soon")
+
+	if _, err := db.ClaimTask(task.ID, "agent-1", time.Minute); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if err := db.UpdateStatus(task.ID, model.StatusDone); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+
+	lease, err := db.GetLease(task.ID)
+	if err != nil {
+		t.Fatalf("failed to get lease: %v", err)
+	}
+	if lease != nil {
+		t.Errorf("lease = %+v, want nil after done", lease)
+	}
+}
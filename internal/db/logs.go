@@ -6,21 +6,25 @@ import (
 	"github.com/baiirun/prog/internal/model"
 )
 
-// AddLog adds a log entry to an item.
+// AddLog adds a log entry to an item, written by db's actor.
 func (db *DB) AddLog(itemID, message string) error {
-	_, err := db.Exec(`
-		INSERT INTO logs (item_id, message) VALUES (?, ?)`,
-		itemID, message)
+	return addLog(db, itemID, message, db.actor)
+}
+
+func addLog(ex execer, itemID, message, actor string) error {
+	_, err := ex.Exec(`
+		INSERT INTO logs (item_id, message, actor) VALUES (?, ?, ?)`,
+		itemID, message, actor)
 	if err != nil {
 		return fmt.Errorf("failed to add log: %w", err)
 	}
-	return nil
+	return appendChange(ex, model.Change{Kind: ChangeLog, Action: ActionAdded, Target: itemID, Actor: actor, NewValue: message})
 }
 
 // GetLogs retrieves all logs for an item, ordered by creation time.
 func (db *DB) GetLogs(itemID string) ([]model.Log, error) {
 	rows, err := db.Query(`
-		SELECT id, item_id, message, created_at
+		SELECT id, item_id, message, actor, created_at
 		FROM logs WHERE item_id = ? ORDER BY created_at ASC`, itemID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get logs: %w", err)
@@ -30,7 +34,7 @@ func (db *DB) GetLogs(itemID string) ([]model.Log, error) {
 	var logs []model.Log
 	for rows.Next() {
 		var log model.Log
-		if err := rows.Scan(&log.ID, &log.ItemID, &log.Message, &log.CreatedAt); err != nil {
+		if err := rows.Scan(&log.ID, &log.ItemID, &log.Message, &log.Actor, &log.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan log: %w", err)
 		}
 		logs = append(logs, log)
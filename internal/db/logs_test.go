@@ -47,6 +47,26 @@ func TestAddLog(t *testing.T) {
 	}
 }
 
+func TestAddLog_RecordsActor(t *testing.T) {
+	db := setupTestDB(t)
+	item := createTestItem(t, db, "Test")
+
+	if err := db.WithActor("agent-x").AddLog(item.ID, "Picked up"); err != nil {
+		t.Fatalf("failed to add log: %v", err)
+	}
+	if err := db.AddLog(item.ID, "Anonymous"); err != nil {
+		t.Fatalf("failed to add log: %v", err)
+	}
+
+	logs, err := db.GetLogs(item.ID)
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 2 || logs[0].Actor != "agent-x" || logs[1].Actor != "" {
+		t.Errorf("logs = %+v, want actors agent-x and none", logs)
+	}
+}
+
 func TestGetLogs_Empty(t *testing.T) {
 	db := setupTestDB(t)
 
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Learning pages are Markdown files in a repo; see internal/pages. Each is
+// indexed as a stub learning with the page's path, so it is listed and
+// searched like any learning while the page stays the source of truth.
+
+// IndexPage creates or updates the stub for the learning page at l.Path,
+// with hash the page content's hash. A new stub gets a stable ID from its
+// project and path; an existing one keeps its ID and creation time, and is
+// made active again. The stub's concepts and files are replaced with
+// l.Concepts and l.Files.
+// Reports whether the stub was created.
+func (db *DB) IndexPage(l *model.Learning, hash string) (bool, error) {
+	if l.Actor == "" {
+		l.Actor = db.actor
+	}
+	files, err := jsonList(l.Files)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal files: %w", err)
+	}
+	provenance, err := jsonList(l.Provenance)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal provenance: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id string
+	err = tx.QueryRow(`SELECT id FROM learnings WHERE project = ? AND path = ?`, l.Project, l.Path).Scan(&id)
+	created := err == sql.ErrNoRows
+	if err != nil && !created {
+		return false, fmt.Errorf("failed to get learning: %w", err)
+	}
+
+	l.Status = model.LearningStatusActive
+	if created {
+		l.ID = model.PageLearningID(l.Project, l.Path)
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM learnings WHERE id = ?`, l.ID).Scan(&n); err != nil {
+			return false, fmt.Errorf("failed to get learning: %w", err)
+		}
+		if n > 0 {
+			l.ID = model.GenerateLearningID() // Another page's ID hashed the same
+		}
+		if l.CreatedAt.IsZero() {
+			l.CreatedAt = l.UpdatedAt
+		}
+		_, err = tx.Exec(`
+			INSERT INTO learnings (id, project, created_at, updated_at, task_id, summary, detail, files, status, actor, path, title, provenance, page_hash)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, l.ID, l.Project, l.CreatedAt, l.UpdatedAt, l.TaskID, l.Summary, l.Detail, files, l.Status, l.Actor, l.Path, l.Title, provenance, hash)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert learning: %w", err)
+		}
+	} else {
+		l.ID = id
+		_, err = tx.Exec(`
+			UPDATE learnings SET updated_at = ?, summary = ?, detail = ?, files = ?, status = ?, review_reason = '', actor = ?, title = ?, provenance = ?, page_hash = ?
+			WHERE id = ?
+		`, l.UpdatedAt, l.Summary, l.Detail, files, l.Status, l.Actor, l.Title, provenance, hash, l.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to update learning: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM learning_concepts WHERE learning_id = ?`, l.ID); err != nil {
+			return false, fmt.Errorf("failed to replace concept associations: %w", err)
+		}
+	}
+
+	if err := linkConcepts(tx, l); err != nil {
+		return false, err
+	}
+	if err := writeLearningFiles(tx, l.ID, l.Files); err != nil {
+		return false, err
+	}
+	if err := writeLearningTerms(tx, l.ID, l.Title, l.Summary, l.Detail); err != nil {
+		return false, err
+	}
+
+	action := "page"
+	if created {
+		action = ActionCreated
+	}
+	if err := appendChange(tx, model.Change{Kind: ChangeLearning, Action: action, Target: l.ID, Project: l.Project, Actor: l.Actor, NewValue: l.Summary}); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return created, nil
+}
+
+// PageHashes returns the content hash each indexed page had when it was
+// last indexed, by path, for a project's pages that aren't archived.
+func (db *DB) PageHashes(project string) (map[string]string, error) {
+	rows, err := db.Query(`
+		SELECT path, page_hash FROM learnings
+		WHERE project = ? AND path IS NOT NULL AND status != 'archived'
+	`, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pages: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var path, hash string
+		if err := rows.Scan(&path, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan page: %w", err)
+		}
+		hashes[path] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// GetLearningByPath returns the stub for the learning page at path.
+func (db *DB) GetLearningByPath(project, path string) (*model.Learning, error) {
+	var id string
+	err := db.QueryRow(`SELECT id FROM learnings WHERE project = ? AND path = ?`, project, path).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("learning %w: no page indexed at %s", ErrNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get learning: %w", err)
+	}
+	return db.GetLearning(id)
+}
+
+// ArchivePage archives the stub for a learning page that no longer exists.
+// Its ID still resolves, and it comes back if the page is indexed again.
+func (db *DB) ArchivePage(project, path string) error {
+	l, err := db.GetLearningByPath(project, path)
+	if err != nil {
+		return err
+	}
+	if l.Status == model.LearningStatusArchived {
+		return nil
+	}
+	_, err = db.Exec(`UPDATE learnings SET status = ?, updated_at = ? WHERE id = ?`, model.LearningStatusArchived, time.Now(), l.ID)
+	if err != nil {
+		return fmt.Errorf("failed to archive learning: %w", err)
+	}
+	return appendChange(db, model.Change{Kind: ChangeLearning, Action: "status", Target: l.ID, Actor: db.actor, NewValue: string(model.LearningStatusArchived)})
+}
+
+// jsonList encodes a list for a JSON column, as [] when empty.
+func jsonList(values []string) (string, error) {
+	if len(values) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(values)
+	return string(b), err
+}
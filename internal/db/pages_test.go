@@ -0,0 +1,104 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func pageStub(path, summary string, concepts ...string) *model.Learning {
+	return &model.Learning{
+		Project:   "test",
+		UpdatedAt: time.Now(),
+		Path:      path,
+		Title:     "Title of " + path,
+		Summary:   summary,
+		Detail:    "Stub summary.",
+		Concepts:  concepts,
+	}
+}
+
+func TestIndexPage(t *testing.T) {
+	db := setupTestDB(t)
+
+	legacy := &model.Learning{
+		ID:        model.GenerateLearningID(),
+		Project:   "test",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Summary:   "Migrations run in order",
+		Status:    model.LearningStatusActive,
+		Concepts:  []string{"db"},
+	}
+	if err := db.CreateLearning(legacy); err != nil {
+		t.Fatalf("failed to create learning: %v", err)
+	}
+
+	stub := pageStub("docs/learnings/migrations.md", "Make migrations re-runnable", "db", "migrations")
+	stub.Provenance = []string{"ts-a1b2c3"}
+	created, err := db.IndexPage(stub, "hash1")
+	if err != nil || !created {
+		t.Fatalf("failed to index page: created %v, %v", created, err)
+	}
+	if stub.ID != model.PageLearningID("test", stub.Path) {
+		t.Errorf("id = %s, want the stable page ID", stub.ID)
+	}
+
+	// Reindexing updates the stub in place and replaces its concepts
+	if err := db.UpdateLearningStatus(stub.ID, model.LearningStatusStale); err != nil {
+		t.Fatalf("failed to mark stale: %v", err)
+	}
+	again := pageStub(stub.Path, "Make migrations idempotent", "sqlite")
+	created, err = db.IndexPage(again, "hash2")
+	if err != nil || created {
+		t.Fatalf("failed to reindex page: created %v, %v", created, err)
+	}
+	got, err := db.GetLearningByPath("test", stub.Path)
+	if err != nil {
+		t.Fatalf("failed to get page: %v", err)
+	}
+	if got.ID != stub.ID || got.Summary != "Make migrations idempotent" || got.Status != model.LearningStatusActive {
+		t.Errorf("reindexed stub = %+v", got)
+	}
+	if len(got.Concepts) != 1 || got.Concepts[0] != "sqlite" {
+		t.Errorf("concepts = %q, want [sqlite]", got.Concepts)
+	}
+	if len(got.Provenance) != 0 || got.Title != "Title of "+stub.Path {
+		t.Errorf("title %q, provenance %q", got.Title, got.Provenance)
+	}
+
+	// Stubs come first, and the title is searchable
+	all, err := db.GetAllLearnings("test", false)
+	if err != nil || len(all) != 2 || all[0].ID != stub.ID {
+		t.Errorf("learnings = %+v, %v; want the stub first", all, err)
+	}
+	found, err := db.SearchLearnings("test", "title", false)
+	if err != nil || len(found) != 1 || found[0].ID != stub.ID {
+		t.Errorf("search by title = %+v, %v", found, err)
+	}
+
+	hashes, err := db.PageHashes("test")
+	if err != nil || len(hashes) != 1 || hashes[stub.Path] != "hash2" {
+		t.Errorf("hashes = %v, %v", hashes, err)
+	}
+
+	// A removed page is archived, and returns when indexed again
+	if err := db.ArchivePage("test", stub.Path); err != nil {
+		t.Fatalf("failed to archive page: %v", err)
+	}
+	if hashes, _ := db.PageHashes("test"); len(hashes) != 0 {
+		t.Errorf("archived page still listed: %v", hashes)
+	}
+	if _, err := db.IndexPage(pageStub(stub.Path, "Back"), "hash3"); err != nil {
+		t.Fatalf("failed to reindex page: %v", err)
+	}
+	if got, _ := db.GetLearning(stub.ID); got.Status != model.LearningStatusActive {
+		t.Errorf("status = %s, want active", got.Status)
+	}
+
+	if _, err := db.GetLearningByPath("test", "docs/learnings/none.md"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing page = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,239 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Plan is a parallel execution plan for a set of unfinished tasks.
+type Plan struct {
+	// Waves groups tasks that can run in parallel: every task in a wave depends
+	// only on tasks in earlier waves. Within a wave tasks keep ready-list order.
+	Waves [][]model.Item
+	// CriticalPath is the longest dependency chain, first task to last. Its
+	// length is the minimum number of sequential steps to finish the plan.
+	CriticalPath []model.Item
+	// MaxParallelism is the widest wave: more agents than this sit idle.
+	MaxParallelism int
+	// External maps task IDs to unfinished blockers outside the plan's scope.
+	// Those tasks can't start until the blockers finish elsewhere.
+	External map[string][]string
+}
+
+// TaskCount returns the number of tasks in the plan.
+func (p *Plan) TaskCount() int {
+	n := 0
+	for _, wave := range p.Waves {
+		n += len(wave)
+	}
+	return n
+}
+
+// PlanWaves sorts the unfinished tasks of a project, or of an epic and its
+// sub-epics when epicID is set, into parallel waves along their dependencies.
+// Dependencies on an epic stand for its unfinished tasks, matching how ready
+// resolves them.
+func (db *DB) PlanWaves(project, epicID string) (*Plan, error) {
+	if epicID != "" {
+		epic, err := db.GetItem(epicID)
+		if err != nil {
+			return nil, err
+		}
+		if epic.Type != model.ItemTypeEpic {
+			return nil, fmt.Errorf("%s is not an epic", epicID)
+		}
+	}
+
+	// Every unfinished item, so blockers outside the scope are still recognized
+	items, err := db.queryItems(`
+		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_by, assignee, created_at, updated_at
+		FROM items
+		WHERE status NOT IN ('done', 'canceled') AND deleted_at IS NULL
+		ORDER BY priority ASC, created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*model.Item, len(items))
+	children := make(map[string][]string)
+	for i := range items {
+		item := &items[i]
+		// Derived epic status can be terminal even though the stored one isn't
+		if item.Status == model.StatusDone || item.Status == model.StatusCanceled {
+			continue
+		}
+		byID[item.ID] = item
+		if item.ParentID != nil {
+			children[*item.ParentID] = append(children[*item.ParentID], item.ID)
+		}
+	}
+
+	inScope := make(map[string]bool)
+	var scope []string
+	var addScope func(id string)
+	addScope = func(id string) {
+		item := byID[id]
+		if item.Type == model.ItemTypeTask && !inScope[id] {
+			inScope[id] = true
+			scope = append(scope, id)
+		}
+		for _, child := range children[id] {
+			addScope(child)
+		}
+	}
+	if epicID != "" {
+		for _, child := range children[epicID] {
+			addScope(child)
+		}
+		// Keep ready-list order regardless of tree shape
+		order := make(map[string]int, len(items))
+		for i, item := range items {
+			order[item.ID] = i
+		}
+		sort.Slice(scope, func(a, b int) bool { return order[scope[a]] < order[scope[b]] })
+	} else {
+		for _, item := range items {
+			if item.Type == model.ItemTypeTask && byID[item.ID] != nil && (project == "" || item.Project == project) {
+				inScope[item.ID] = true
+				scope = append(scope, item.ID)
+			}
+		}
+	}
+
+	deps, err := db.unfinishedDeps(byID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve each task's blockers to tasks inside or outside the plan
+	blockers := make(map[string][]string)
+	dependents := make(map[string][]string)
+	external := make(map[string][]string)
+	for _, id := range scope {
+		seen := make(map[string]bool)
+		for _, dep := range deps[id] {
+			for _, blocker := range expandEpic(dep, byID, children) {
+				if seen[blocker] || blocker == id {
+					continue
+				}
+				seen[blocker] = true
+				if inScope[blocker] {
+					blockers[id] = append(blockers[id], blocker)
+					dependents[blocker] = append(dependents[blocker], id)
+				} else {
+					external[id] = append(external[id], blocker)
+				}
+			}
+		}
+	}
+
+	// Kahn's algorithm, one wave per round
+	remaining := make(map[string]int, len(scope))
+	for _, id := range scope {
+		remaining[id] = len(blockers[id])
+	}
+	level := make(map[string]int, len(scope))
+	plan := &Plan{External: external}
+	done := 0
+	for done < len(scope) {
+		var wave []model.Item
+		for _, id := range scope {
+			if _, placed := level[id]; !placed && remaining[id] == 0 {
+				wave = append(wave, *byID[id])
+			}
+		}
+		if len(wave) == 0 {
+			var stuck []string
+			for _, id := range scope {
+				if _, placed := level[id]; !placed {
+					stuck = append(stuck, id)
+				}
+			}
+			// Whatever is left waits on itself somewhere
+			if cycles := findCycles(stuck, blockers); len(cycles) > 0 {
+				return nil, fmt.Errorf("%w: %s (run 'prog graph --check')", ErrDepCycle, strings.Join(cycles[0], " -> "))
+			}
+			return nil, fmt.Errorf("%w among: %s", ErrDepCycle, strings.Join(stuck, ", "))
+		}
+		for _, item := range wave {
+			level[item.ID] = len(plan.Waves)
+			for _, dep := range dependents[item.ID] {
+				remaining[dep]--
+			}
+		}
+		plan.Waves = append(plan.Waves, wave)
+		if len(wave) > plan.MaxParallelism {
+			plan.MaxParallelism = len(wave)
+		}
+		done += len(wave)
+	}
+
+	// Walk back from the first task of the last wave through blockers one wave
+	// earlier; each task's wave is one past its latest blocker's, so one exists.
+	if len(plan.Waves) > 0 {
+		last := plan.Waves[len(plan.Waves)-1][0].ID
+		path := []model.Item{*byID[last]}
+		for level[last] > 0 {
+			for _, blocker := range scope {
+				if level[blocker] == level[last]-1 && slices.Contains(blockers[last], blocker) {
+					last = blocker
+					break
+				}
+			}
+			path = append(path, *byID[last])
+		}
+		for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+			path[i], path[j] = path[j], path[i]
+		}
+		plan.CriticalPath = path
+	}
+
+	return plan, nil
+}
+
+// unfinishedDeps returns, for each item, the unfinished items it depends on.
+func (db *DB) unfinishedDeps(unfinished map[string]*model.Item) (map[string][]string, error) {
+	edges, err := depEdges(db)
+	if err != nil {
+		return nil, err
+	}
+	deps := make(map[string][]string)
+	for itemID, dependsOn := range edges {
+		if unfinished[itemID] == nil {
+			continue
+		}
+		for _, dep := range dependsOn {
+			if unfinished[dep] != nil {
+				deps[itemID] = append(deps[itemID], dep)
+			}
+		}
+	}
+	return deps, nil
+}
+
+// expandEpic returns the unfinished tasks under id if it is an epic with any,
+// or id itself otherwise.
+func expandEpic(id string, byID map[string]*model.Item, children map[string][]string) []string {
+	if byID[id].Type != model.ItemTypeEpic {
+		return []string{id}
+	}
+	var tasks []string
+	var walk func(string)
+	walk = func(parent string) {
+		for _, child := range children[parent] {
+			if byID[child].Type == model.ItemTypeTask {
+				tasks = append(tasks, child)
+			}
+			walk(child)
+		}
+	}
+	walk(id)
+	if len(tasks) == 0 {
+		return []string{id}
+	}
+	return tasks
+}
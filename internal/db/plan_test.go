@@ -0,0 +1,155 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func waveIDs(plan *Plan) [][]string {
+	var waves [][]string
+	for _, wave := range plan.Waves {
+		var ids []string
+		for _, item := range wave {
+			ids = append(ids, item.ID)
+		}
+		waves = append(waves, ids)
+	}
+	return waves
+}
+
+func mustAddDep(t *testing.T, db *DB, itemID, dependsOn string) {
+	t.Helper()
+	if err := db.AddDep(itemID, dependsOn); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+}
+
+func mustSetParent(t *testing.T, db *DB, itemID, parentID string) {
+	t.Helper()
+	if err := db.SetParent(itemID, parentID); err != nil {
+		t.Fatalf("failed to set parent: %v", err)
+	}
+}
+
+func TestPlanWaves(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Diamond: a -> (b, c) -> d, plus an independent task e and a finished f
+	a := createTestItemWithProject(t, db, "A", "test", model.StatusInProgress, 1)
+	b := createTestItemWithProject(t, db, "B", "test", model.StatusOpen, 1)
+	c := createTestItemWithProject(t, db, "C", "test", model.StatusOpen, 2)
+	d := createTestItemWithProject(t, db, "D", "test", model.StatusOpen, 2)
+	e := createTestItemWithProject(t, db, "E", "test", model.StatusOpen, 3)
+	f := createTestItemWithProject(t, db, "F", "test", model.StatusDone, 2)
+	createTestItemWithProject(t, db, "Other project", "other", model.StatusOpen, 2)
+
+	mustAddDep(t, db, b.ID, a.ID)
+	mustAddDep(t, db, c.ID, a.ID)
+	mustAddDep(t, db, d.ID, b.ID)
+	mustAddDep(t, db, d.ID, c.ID)
+	mustAddDep(t, db, e.ID, f.ID) // resolved, doesn't hold e back
+
+	plan, err := db.PlanWaves("test", "")
+	if err != nil {
+		t.Fatalf("PlanWaves failed: %v", err)
+	}
+
+	got := waveIDs(plan)
+	want := [][]string{{a.ID, e.ID}, {b.ID, c.ID}, {d.ID}}
+	if len(got) != len(want) {
+		t.Fatalf("waves = %v, want %v", got, want)
+	}
+	for i := range want {
+		if strings.Join(got[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("wave %d = %v, want %v", i+1, got[i], want[i])
+		}
+	}
+
+	if plan.TaskCount() != 5 {
+		t.Errorf("TaskCount = %d, want 5", plan.TaskCount())
+	}
+	if plan.MaxParallelism != 2 {
+		t.Errorf("MaxParallelism = %d, want 2", plan.MaxParallelism)
+	}
+	var path []string
+	for _, item := range plan.CriticalPath {
+		path = append(path, item.ID)
+	}
+	if strings.Join(path, ",") != strings.Join([]string{a.ID, b.ID, d.ID}, ",") {
+		t.Errorf("critical path = %v, want [%s %s %s]", path, a.ID, b.ID, d.ID)
+	}
+	if len(plan.External) != 0 {
+		t.Errorf("External = %v, want none", plan.External)
+	}
+}
+
+func TestPlanWaves_EpicScope(t *testing.T) {
+	db := setupTestDB(t)
+
+	epic := createTestEpic(t, db, "Epic", "test")
+	sub := createTestEpic(t, db, "Sub-epic", "test")
+	mustSetParent(t, db, sub.ID, epic.ID)
+
+	first := createTestItemWithProject(t, db, "First", "test", model.StatusOpen, 2)
+	nested := createTestItemWithProject(t, db, "Nested", "test", model.StatusOpen, 2)
+	outside := createTestItemWithProject(t, db, "Outside", "test", model.StatusOpen, 2)
+	waiting := createTestItemWithProject(t, db, "Waiting", "test", model.StatusOpen, 2)
+	mustSetParent(t, db, first.ID, epic.ID)
+	mustSetParent(t, db, nested.ID, sub.ID)
+	mustSetParent(t, db, waiting.ID, epic.ID)
+
+	// Depending on the sub-epic means depending on its tasks
+	mustAddDep(t, db, waiting.ID, sub.ID)
+	mustAddDep(t, db, first.ID, outside.ID)
+
+	plan, err := db.PlanWaves("", epic.ID)
+	if err != nil {
+		t.Fatalf("PlanWaves failed: %v", err)
+	}
+
+	got := waveIDs(plan)
+	if len(got) != 2 || strings.Join(got[0], ",") != first.ID+","+nested.ID || strings.Join(got[1], ",") != waiting.ID {
+		t.Errorf("waves = %v, want [[%s %s] [%s]]", got, first.ID, nested.ID, waiting.ID)
+	}
+	if ext := plan.External[first.ID]; len(ext) != 1 || ext[0] != outside.ID {
+		t.Errorf("External[%s] = %v, want [%s]", first.ID, ext, outside.ID)
+	}
+
+	if _, err := db.PlanWaves("", first.ID); err == nil {
+		t.Error("expected error planning a task as an epic")
+	}
+}
+
+func TestPlanWaves_Cycle(t *testing.T) {
+	db := setupTestDB(t)
+
+	a := createTestItem(t, db, "A")
+	b := createTestItem(t, db, "B")
+	// Written directly: cycles can predate any validation in AddDep
+	if _, err := db.Exec(`INSERT INTO deps (item_id, depends_on) VALUES (?, ?), (?, ?)`, a.ID, b.ID, b.ID, a.ID); err != nil {
+		t.Fatalf("failed to insert deps: %v", err)
+	}
+
+	_, err := db.PlanWaves("test", "")
+	if !errors.Is(err, ErrDepCycle) {
+		t.Fatalf("err = %v, want ErrDepCycle", err)
+	}
+	if !strings.Contains(err.Error(), a.ID) || !strings.Contains(err.Error(), b.ID) {
+		t.Errorf("err = %v, want the cycle's path", err)
+	}
+}
+
+func TestPlanWaves_Empty(t *testing.T) {
+	db := setupTestDB(t)
+
+	plan, err := db.PlanWaves("nothing", "")
+	if err != nil {
+		t.Fatalf("PlanWaves failed: %v", err)
+	}
+	if plan.TaskCount() != 0 || len(plan.CriticalPath) != 0 || plan.MaxParallelism != 0 {
+		t.Errorf("plan = %+v, want empty", plan)
+	}
+}
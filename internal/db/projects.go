@@ -8,7 +8,11 @@ import (
 // EnsureProject creates a project if it doesn't exist.
 // This is idempotent - calling it multiple times with the same name is safe.
 func (db *DB) EnsureProject(name string) error {
-	_, err := db.Exec(`
+	return ensureProject(db, name)
+}
+
+func ensureProject(ex execer, name string) error {
+	_, err := ex.Exec(`
 		INSERT INTO projects (name, created_at, updated_at)
 		VALUES (?, ?, ?)
 		ON CONFLICT(name) DO NOTHING`,
@@ -3,25 +3,29 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 
 	"github.com/baiirun/prog/internal/model"
 )
 
 // depUnresolvedExpr is a SQL expression (referencing alias "i" for the dependency item)
 // that is true when the dependency is NOT resolved. A dependency is resolved when:
+//   - It is in the trash, OR
 //   - Its stored status is done or canceled, OR
 //   - It's an epic with children and ALL children are done or canceled.
 //
 // This handles derived epic status at the SQL level so that tasks depending on
 // an epic become unblocked when all the epic's children complete.
-const depUnresolvedExpr = `NOT (
+const depUnresolvedExpr = `i.deleted_at IS NULL AND NOT (
 			-- Direct resolution: stored status is terminal
 			i.status IN ('done', 'canceled')
 			OR (
 				-- Derived resolution: epic with children, all children terminal
 				i.type = 'epic'
-				AND EXISTS (SELECT 1 FROM items c WHERE c.parent_id = i.id)           -- has at least one child
+				AND EXISTS (SELECT 1 FROM items c WHERE c.parent_id = i.id
+				            AND c.deleted_at IS NULL)                                  -- has at least one child
 				AND NOT EXISTS (SELECT 1 FROM items c WHERE c.parent_id = i.id
+				                AND c.deleted_at IS NULL
 				                AND c.status NOT IN ('done', 'canceled'))              -- no non-terminal children
 			)
 		)`
@@ -66,6 +70,8 @@ type ListFilter struct {
 	HasBlockers bool          // Show only items with unresolved blockers
 	NoBlockers  bool          // Show only items with no blockers
 	Labels      []string      // Filter by label names (AND - items must have all)
+	Assignee    string        // Filter by the actor working on the item
+	CreatedBy   string        // Filter by the actor who created the item
 }
 
 // ListItems returns items filtered by project and/or status.
@@ -75,7 +81,7 @@ func (db *DB) ListItems(project string, status *model.Status) ([]model.Item, err
 
 // ListItemsFiltered returns items matching the given filters.
 func (db *DB) ListItemsFiltered(filter ListFilter) ([]model.Item, error) {
-	query := `SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_at, updated_at FROM items WHERE 1=1`
+	query := `SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_by, assignee, created_at, updated_at FROM items WHERE deleted_at IS NULL`
 	args := []any{}
 
 	if filter.Project != "" {
@@ -127,6 +133,14 @@ func (db *DB) ListItemsFiltered(filter ListFilter) ([]model.Item, error) {
 		query += clause
 		args = append(args, labelArgs...)
 	}
+	if filter.Assignee != "" {
+		query += ` AND assignee = ?`
+		args = append(args, filter.Assignee)
+	}
+	if filter.CreatedBy != "" {
+		query += ` AND created_by = ?`
+		args = append(args, filter.CreatedBy)
+	}
 	query += ` ORDER BY priority ASC, created_at ASC`
 
 	items, err := db.queryItems(query, args...)
@@ -154,13 +168,27 @@ func (db *DB) ReadyItems(project string) ([]model.Item, error) {
 	return db.ReadyItemsFiltered(project, nil)
 }
 
+// ReadyFilter contains optional filters for ready items.
+type ReadyFilter struct {
+	Project     string   // Filter by project
+	Labels      []string // Filter by label names (AND - items must have all)
+	NoConflicts bool     // Hide tasks whose areas overlap an in_progress task
+}
+
 // ReadyItemsFiltered returns ready items with optional label filtering.
 func (db *DB) ReadyItemsFiltered(project string, labels []string) ([]model.Item, error) {
+	return db.ReadyItemsMatching(ReadyFilter{Project: project, Labels: labels})
+}
+
+// ReadyItemsMatching returns ready items matching the given filters.
+func (db *DB) ReadyItemsMatching(filter ReadyFilter) ([]model.Item, error) {
+	project, labels := filter.Project, filter.Labels
 	query := `
-		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_at, updated_at
+		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_by, assignee, created_at, updated_at
 		FROM items
 		WHERE status = 'open'
 		  AND type = 'task'
+		  AND deleted_at IS NULL
 		  AND id NOT IN (
 		    SELECT d.item_id FROM deps d
 		    JOIN items i ON d.depends_on = i.id
@@ -178,7 +206,118 @@ func (db *DB) ReadyItemsFiltered(project string, labels []string) ([]model.Item,
 	}
 	query += ` ORDER BY priority ASC, created_at ASC`
 
-	return db.queryItems(query, args...)
+	items, err := db.queryItems(query, args...)
+	if err != nil || !filter.NoConflicts {
+		return items, err
+	}
+
+	conflicts, err := db.conflictsWithInFlight(items, project)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) == 0 {
+		return items, nil
+	}
+	held := make(map[string]bool, len(conflicts))
+	for _, c := range conflicts {
+		held[c.Item.ID] = true
+	}
+	filtered := items[:0]
+	for _, item := range items {
+		if !held[item.ID] {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
+// RankedItem is a ready task annotated with how much work it would unblock.
+type RankedItem struct {
+	model.Item
+	Unblocks   int // Tasks that become ready once this one is done (it is their last blocker)
+	Downstream int // All unfinished items transitively waiting on this one
+}
+
+// RankedReadyItems returns ready tasks ordered by how useful it is to pick them next:
+// priority first, then the number of tasks they would directly unblock, then the
+// size of their downstream dependency tree, then age.
+func (db *DB) RankedReadyItems(filter ReadyFilter) ([]RankedItem, error) {
+	items, err := db.ReadyItemsMatching(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	// Unresolved edges only: finished blockers no longer hold anything back,
+	// and finished dependents have nothing left to unblock.
+	rows, err := db.Query(`
+		SELECT d.item_id, d.depends_on FROM deps d
+		JOIN items i ON d.depends_on = i.id
+		JOIN items x ON d.item_id = x.id
+		WHERE x.status NOT IN ('done', 'canceled')
+		  AND x.deleted_at IS NULL
+		  AND ` + depUnresolvedExpr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deps: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	dependents := make(map[string][]string) // blocker -> items waiting on it
+	blockerCount := make(map[string]int)    // item -> unresolved blockers
+	for rows.Next() {
+		var itemID, dependsOn string
+		if err := rows.Scan(&itemID, &dependsOn); err != nil {
+			return nil, fmt.Errorf("failed to scan dep: %w", err)
+		}
+		dependents[dependsOn] = append(dependents[dependsOn], itemID)
+		blockerCount[itemID]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ranked := make([]RankedItem, len(items))
+	for i, item := range items {
+		ranked[i] = RankedItem{Item: item}
+		for _, dep := range dependents[item.ID] {
+			if blockerCount[dep] == 1 {
+				ranked[i].Unblocks++
+			}
+		}
+		ranked[i].Downstream = countDownstream(item.ID, dependents)
+	}
+
+	// Stable sort keeps created_at order from the query as the final tiebreaker
+	sort.SliceStable(ranked, func(a, b int) bool {
+		if ranked[a].Priority != ranked[b].Priority {
+			return ranked[a].Priority < ranked[b].Priority
+		}
+		if ranked[a].Unblocks != ranked[b].Unblocks {
+			return ranked[a].Unblocks > ranked[b].Unblocks
+		}
+		return ranked[a].Downstream > ranked[b].Downstream
+	})
+	return ranked, nil
+}
+
+// countDownstream counts distinct items reachable from id through the
+// blocker -> dependents graph.
+func countDownstream(id string, dependents map[string][]string) int {
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, dep := range dependents[cur] {
+			if !seen[dep] {
+				seen[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return len(seen) - 1
 }
 
 // StatusReport contains aggregated project status.
@@ -253,8 +392,8 @@ func (db *DB) ProjectStatusFiltered(project string, labels []string) (*StatusRep
 	// Get recent done (last 3, sorted by updated_at desc)
 	// We need to query specifically because we need ordering by updated_at
 	recentQuery := `
-		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_at, updated_at
-		FROM items WHERE status IN ('done', 'canceled')`
+		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_by, assignee, created_at, updated_at
+		FROM items WHERE status IN ('done', 'canceled') AND deleted_at IS NULL`
 	recentArgs := []any{}
 	if project != "" {
 		recentQuery += ` AND project = ?`
@@ -314,7 +453,7 @@ func (db *DB) queryItems(query string, args ...any) ([]model.Item, error) {
 		var parentID, definitionOfDone sql.NullString
 		if err := rows.Scan(
 			&item.ID, &item.Project, &item.Type, &item.Title, &item.Description, &definitionOfDone,
-			&item.Status, &item.Priority, &parentID, &item.CreatedAt, &item.UpdatedAt,
+			&item.Status, &item.Priority, &parentID, &item.CreatedBy, &item.Assignee, &item.CreatedAt, &item.UpdatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan item: %w", err)
 		}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -364,6 +365,54 @@ func TestListItemsFiltered_Type(t *testing.T) {
 	}
 }
 
+func TestListItemsFiltered_Actors(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+
+	started := createTestItemWithProject(t, alice, "Started", "test", model.StatusOpen, 2)
+	claimed := createTestItemWithProject(t, alice, "Claimed", "test", model.StatusOpen, 2)
+	reopened := createTestItemWithProject(t, db.WithActor("bob"), "Reopened", "test", model.StatusOpen, 2)
+
+	if err := alice.UpdateStatus(started.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	if _, err := db.ClaimTask(claimed.ID, "agent-x", time.Minute); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if err := alice.UpdateStatus(reopened.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	if err := db.UpdateStatus(reopened.ID, model.StatusOpen); err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{"assignee alice", ListFilter{Assignee: "alice"}, []string{started.ID}},
+		{"assignee agent-x", ListFilter{Assignee: "agent-x"}, []string{claimed.ID}},
+		{"created by alice", ListFilter{CreatedBy: "alice"}, []string{started.ID, claimed.ID}},
+		{"created by bob", ListFilter{CreatedBy: "bob"}, []string{reopened.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := db.ListItemsFiltered(tt.filter)
+			if err != nil {
+				t.Fatalf("failed to list: %v", err)
+			}
+			var got []string
+			for _, item := range items {
+				got = append(got, item.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestListItemsFiltered_InvalidType(t *testing.T) {
 	db := setupTestDB(t)
 
@@ -1294,3 +1343,99 @@ func TestHasUnmetDeps_EpicDepResolvedByChildren(t *testing.T) {
 		t.Error("expected no unmet deps after epic child completed")
 	}
 }
+
+func TestRankedReadyItems_UnblocksBeforeAge(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Older task blocks nothing; newer one is the sole blocker of two tasks
+	lonely := createTestItemWithProject(t, db, "Lonely", "test", model.StatusOpen, 2)
+	key := createTestItemWithProject(t, db, "Key", "test", model.StatusOpen, 2)
+	for _, title := range []string{"Waiting 1", "Waiting 2"} {
+		w := createTestItemWithProject(t, db, title, "test", model.StatusOpen, 2)
+		if err := db.AddDep(w.ID, key.ID); err != nil {
+			t.Fatalf("failed to add dep: %v", err)
+		}
+	}
+
+	ranked, err := db.RankedReadyItems(ReadyFilter{Project: "test"})
+	if err != nil {
+		t.Fatalf("failed to rank: %v", err)
+	}
+	if len(ranked) != 2 {
+		t.Fatalf("got %d ranked items, want 2", len(ranked))
+	}
+	if ranked[0].ID != key.ID {
+		t.Errorf("first = %s, want %s (unblocks 2)", ranked[0].Title, key.Title)
+	}
+	if ranked[0].Unblocks != 2 || ranked[0].Downstream != 2 {
+		t.Errorf("key unblocks=%d downstream=%d, want 2/2", ranked[0].Unblocks, ranked[0].Downstream)
+	}
+	if ranked[1].ID != lonely.ID || ranked[1].Unblocks != 0 {
+		t.Errorf("second = %s unblocks=%d, want %s unblocks=0", ranked[1].Title, ranked[1].Unblocks, lonely.Title)
+	}
+}
+
+func TestRankedReadyItems_PriorityFirst(t *testing.T) {
+	db := setupTestDB(t)
+
+	low := createTestItemWithProject(t, db, "Low but useful", "test", model.StatusOpen, 3)
+	dep := createTestItemWithProject(t, db, "Dependent", "test", model.StatusOpen, 2)
+	if err := db.AddDep(dep.ID, low.ID); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+	high := createTestItemWithProject(t, db, "High", "test", model.StatusOpen, 1)
+
+	ranked, err := db.RankedReadyItems(ReadyFilter{Project: "test"})
+	if err != nil {
+		t.Fatalf("failed to rank: %v", err)
+	}
+	if len(ranked) != 2 || ranked[0].ID != high.ID {
+		t.Fatalf("expected high priority task first, got %+v", ranked)
+	}
+}
+
+func TestRankedReadyItems_SharedBlockerAndTransitive(t *testing.T) {
+	db := setupTestDB(t)
+
+	a := createTestItemWithProject(t, db, "A", "test", model.StatusOpen, 2)
+	b := createTestItemWithProject(t, db, "B", "test", model.StatusOpen, 2)
+	// c waits on both a and b, so neither alone unblocks it
+	c := createTestItemWithProject(t, db, "C", "test", model.StatusOpen, 2)
+	// d waits only on c, so it is downstream of both a and b
+	d := createTestItemWithProject(t, db, "D", "test", model.StatusOpen, 2)
+	// e waits only on b and is already done, so it doesn't count
+	e := createTestItemWithProject(t, db, "E", "test", model.StatusDone, 2)
+	for _, dep := range [][2]string{{c.ID, a.ID}, {c.ID, b.ID}, {d.ID, c.ID}, {e.ID, b.ID}} {
+		if err := db.AddDep(dep[0], dep[1]); err != nil {
+			t.Fatalf("failed to add dep: %v", err)
+		}
+	}
+
+	ranked, err := db.RankedReadyItems(ReadyFilter{Project: "test"})
+	if err != nil {
+		t.Fatalf("failed to rank: %v", err)
+	}
+	if len(ranked) != 2 {
+		t.Fatalf("got %d ranked items, want 2", len(ranked))
+	}
+	for _, r := range ranked {
+		if r.Unblocks != 0 {
+			t.Errorf("%s unblocks = %d, want 0 (shared blocker)", r.Title, r.Unblocks)
+		}
+		if r.Downstream != 2 {
+			t.Errorf("%s downstream = %d, want 2", r.Title, r.Downstream)
+		}
+	}
+}
+
+func TestRankedReadyItems_Empty(t *testing.T) {
+	db := setupTestDB(t)
+
+	ranked, err := db.RankedReadyItems(ReadyFilter{Project: "test"})
+	if err != nil {
+		t.Fatalf("failed to rank: %v", err)
+	}
+	if len(ranked) != 0 {
+		t.Errorf("got %d ranked items, want 0", len(ranked))
+	}
+}
@@ -0,0 +1,469 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Reviews gate tasks in review. Assigning a reviewer adds a pending review;
+// the reviewer approves it, or requests changes, which sends the task back to
+// in_progress for its assignee. Resubmitting the task asks reviewers who
+// requested changes to review it again, and it can only be completed once
+// every reviewer's latest verdict is an approval.
+
+// ErrReviewPending is wrapped by RequireApproval errors when a task has
+// reviewers who haven't approved it.
+var ErrReviewPending = errors.New("review is not approved")
+
+// AssignReviewer asks reviewer to review an item. Assigning a reviewer who
+// already has a pending review of it is a no-op.
+func (db *DB) AssignReviewer(id, reviewer string) error {
+	reviewer = strings.TrimSpace(reviewer)
+	if reviewer == "" {
+		return fmt.Errorf("reviewer cannot be empty")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := itemStatus(tx, id); err != nil {
+		return err
+	}
+	if _, err := requestReview(tx, id, reviewer, db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// requestReview adds a pending review unless reviewer already has one,
+// reporting whether it did.
+func requestReview(tx *sql.Tx, id, reviewer, actor string) (bool, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM reviews WHERE item_id = ? AND reviewer = ? AND verdict = ?`,
+		id, reviewer, model.VerdictPending).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check reviews: %w", err)
+	}
+	if n > 0 {
+		return false, nil
+	}
+	_, err = tx.Exec(`
+		INSERT INTO reviews (item_id, reviewer, verdict, requested_by, requested_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		id, reviewer, model.VerdictPending, actor, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to assign reviewer: %w", err)
+	}
+	return true, recordEvent(tx, id, EventReviewer, "", reviewer, actor)
+}
+
+// UnassignReviewer withdraws reviewer's pending review of an item.
+func (db *DB) UnassignReviewer(id, reviewer string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := itemStatus(tx, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM reviews WHERE item_id = ? AND reviewer = ? AND verdict = ?`,
+		id, reviewer, model.VerdictPending)
+	if err != nil {
+		return fmt.Errorf("failed to unassign reviewer: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("%s has no pending review from %s", id, reviewer)
+	}
+	if err := recordEvent(tx, id, EventReviewer, reviewer, "", db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RerequestReviews asks each reviewer whose latest verdict requested changes
+// to review an item again, for when it is resubmitted. It returns the
+// reviewers asked.
+func (db *DB) RerequestReviews(id string) ([]string, error) {
+	reviews, err := db.GetReviews(id)
+	if err != nil {
+		return nil, err
+	}
+	var again []string
+	for _, r := range latestReviews(reviews) {
+		if r.Verdict == model.VerdictChangesRequested {
+			again = append(again, r.Reviewer)
+		}
+	}
+	if len(again) == 0 {
+		return nil, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, reviewer := range again {
+		if _, err := requestReview(tx, id, reviewer, db.actor); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return again, nil
+}
+
+// Approve records db's actor approving an item in review, with an optional
+// note.
+func (db *DB) Approve(id, note string) error {
+	return db.recordVerdict(id, model.VerdictApproved, note)
+}
+
+// RequestChanges records db's actor asking for changes to an item in review.
+// The item goes back to in_progress, keeping its assignee, and the note
+// saying what to change is logged on it.
+func (db *DB) RequestChanges(id, note string) error {
+	if strings.TrimSpace(note) == "" {
+		return fmt.Errorf("a note saying what to change is required")
+	}
+	return db.recordVerdict(id, model.VerdictChangesRequested, note)
+}
+
+func (db *DB) recordVerdict(id, verdict, note string) error {
+	note = strings.TrimSpace(note)
+	reopen := verdict == model.VerdictChangesRequested
+
+	// As in UpdateStatus, hooks run outside the transaction
+	if reopen && db.hooks != nil {
+		item, err := db.GetItem(id)
+		if err != nil {
+			return err
+		}
+		if item.Status == model.StatusReviewing {
+			if err := db.runStatusHook("pre", item, item.Status, model.StatusInProgress, db.actor); err != nil {
+				return err
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	status, err := itemStatus(tx, id)
+	if err != nil {
+		return err
+	}
+	if status != model.StatusReviewing {
+		return fmt.Errorf("can only approve or request changes on tasks in review (current status: %s)", status)
+	}
+
+	// Decide the reviewer's pending review, or record one they weren't asked for
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE reviews SET verdict = ?, note = ?, decided_at = ?
+		WHERE id = (SELECT MAX(id) FROM reviews WHERE item_id = ? AND reviewer = ? AND verdict = ?)`,
+		verdict, note, now, id, db.actor, model.VerdictPending)
+	if err != nil {
+		return fmt.Errorf("failed to record review: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		_, err = tx.Exec(`
+			INSERT INTO reviews (item_id, reviewer, verdict, note, requested_by, requested_at, decided_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, db.actor, verdict, note, db.actor, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to record review: %w", err)
+		}
+	}
+	if err := recordEvent(tx, id, EventReview, "", verdict, db.actor); err != nil {
+		return err
+	}
+
+	message := "Approved"
+	if reopen {
+		message = "Changes requested"
+	}
+	if note != "" {
+		message += ": " + note
+	}
+	if err := addLog(tx, id, message, db.actor); err != nil {
+		return err
+	}
+
+	if reopen {
+		_, err := tx.Exec(`UPDATE items SET status = ?, updated_at = ? WHERE id = ?`, model.StatusInProgress, now, id)
+		if err != nil {
+			return fmt.Errorf("failed to update status: %w", err)
+		}
+		if err := recordEvent(tx, id, EventStatus, string(status), string(model.StatusInProgress), db.actor); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if reopen {
+		db.runPostStatusHook(id, status, model.StatusInProgress, db.actor)
+	}
+	return nil
+}
+
+// itemStatus returns the status of an item that isn't in the trash.
+func itemStatus(q querier, id string) (model.Status, error) {
+	var status string
+	err := q.QueryRow(`SELECT status FROM items WHERE id = ? AND deleted_at IS NULL`, id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get item: %w", err)
+	}
+	return model.Status(status), nil
+}
+
+// GetReviews returns every review of an item, oldest first.
+func (db *DB) GetReviews(itemID string) ([]model.Review, error) {
+	return getReviews(db, itemID)
+}
+
+func getReviews(q querier, itemID string) ([]model.Review, error) {
+	rows, err := q.Query(`
+		SELECT id, item_id, reviewer, verdict, note, requested_by, requested_at, decided_at
+		FROM reviews WHERE item_id = ? ORDER BY id`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviews: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	return scanReviews(rows)
+}
+
+func scanReviews(rows *sql.Rows) ([]model.Review, error) {
+	var reviews []model.Review
+	for rows.Next() {
+		var r model.Review
+		var decidedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.ItemID, &r.Reviewer, &r.Verdict, &r.Note, &r.RequestedBy, &r.RequestedAt, &decidedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan review: %w", err)
+		}
+		if decidedAt.Valid {
+			r.DecidedAt = &decidedAt.Time
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// latestReviews returns each reviewer's latest review from reviews, which
+// must be oldest first, in the order reviewers were first assigned.
+func latestReviews(reviews []model.Review) []model.Review {
+	var latest []model.Review
+	index := make(map[string]int)
+	for _, r := range reviews {
+		if i, ok := index[r.Reviewer]; ok {
+			latest[i] = r
+			continue
+		}
+		index[r.Reviewer] = len(latest)
+		latest = append(latest, r)
+	}
+	return latest
+}
+
+// LatestReviews returns each reviewer's latest review of an item: where the
+// review stands.
+func (db *DB) LatestReviews(itemID string) ([]model.Review, error) {
+	reviews, err := db.GetReviews(itemID)
+	if err != nil {
+		return nil, err
+	}
+	return latestReviews(reviews), nil
+}
+
+// RequireApproval returns an error wrapping ErrReviewPending, naming who it
+// is waiting on, unless every reviewer of the item has approved it. Items
+// nobody was asked to review pass.
+func (db *DB) RequireApproval(id string) error {
+	return requireApproval(db, id)
+}
+
+func requireApproval(q querier, id string) error {
+	reviews, err := getReviews(q, id)
+	if err != nil {
+		return err
+	}
+	latest := latestReviews(reviews)
+	var waiting []string
+	for _, r := range latest {
+		switch r.Verdict {
+		case model.VerdictPending:
+			waiting = append(waiting, r.Reviewer+" (pending)")
+		case model.VerdictChangesRequested:
+			waiting = append(waiting, r.Reviewer+" (changes requested)")
+		}
+	}
+	if len(waiting) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is waiting on %s", ErrReviewPending, id, strings.Join(waiting, ", "))
+}
+
+// ReviewWait is a task in the review queue and who it is waiting on.
+type ReviewWait struct {
+	ItemID    string
+	Title     string
+	Project   string
+	Status    model.Status
+	WaitingOn string    // Reviewer, or the assignee once reviewed; empty if nobody is
+	Verdict   string    // pending (waiting on a reviewer), changes_requested or approved
+	Since     time.Time // When the wait started
+	Note      string    // The reviewer's note, for changes requested
+}
+
+// ReviewQueue returns what review is waiting on, oldest first: pending
+// reviews, tasks in review with no reviewer, changes requested of assignees,
+// and approved tasks waiting to be completed. Empty project or waitingOn
+// match all.
+func (db *DB) ReviewQueue(project, waitingOn string) ([]ReviewWait, error) {
+	type queued struct {
+		wait    ReviewWait
+		reviews []model.Review
+	}
+	var items []*queued
+	byID := make(map[string]*queued)
+
+	rows, err := db.Query(`
+		SELECT id, title, project, status, assignee, updated_at FROM items
+		WHERE deleted_at IS NULL AND type = 'task' AND status IN (?, ?)
+		AND (?3 = '' OR project = ?3)
+		ORDER BY created_at`,
+		model.StatusReviewing, model.StatusInProgress, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get review queue: %w", err)
+	}
+	for rows.Next() {
+		q := &queued{}
+		// WaitingOn starts as the assignee, for waits on them
+		if err := rows.Scan(&q.wait.ItemID, &q.wait.Title, &q.wait.Project, &q.wait.Status, &q.wait.WaitingOn, &q.wait.Since); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan item: %w", err)
+		}
+		items = append(items, q)
+		byID[q.wait.ItemID] = q
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT r.id, r.item_id, r.reviewer, r.verdict, r.note, r.requested_by, r.requested_at, r.decided_at
+		FROM reviews r JOIN items i ON i.id = r.item_id
+		WHERE i.deleted_at IS NULL AND i.status IN (?, ?) AND (?3 = '' OR i.project = ?3)
+		ORDER BY r.id`,
+		model.StatusReviewing, model.StatusInProgress, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviews: %w", err)
+	}
+	reviews, err := scanReviews(rows)
+	_ = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reviews {
+		if q := byID[r.ItemID]; q != nil {
+			q.reviews = append(q.reviews, r)
+		}
+	}
+
+	var queue []ReviewWait
+	for _, q := range items {
+		var pending, changes, approved []model.Review
+		for _, r := range latestReviews(q.reviews) {
+			switch r.Verdict {
+			case model.VerdictPending:
+				pending = append(pending, r)
+			case model.VerdictChangesRequested:
+				changes = append(changes, r)
+			case model.VerdictApproved:
+				approved = append(approved, r)
+			}
+		}
+
+		// Waiting on the assignee to make changes, or to complete the task
+		onAssignee := func(verdict string, from []model.Review) {
+			w := q.wait
+			w.Verdict = verdict
+			var notes []string
+			for _, r := range from {
+				if r.DecidedAt != nil && r.DecidedAt.After(w.Since) {
+					w.Since = *r.DecidedAt
+				}
+				if r.Note != "" && verdict == model.VerdictChangesRequested {
+					notes = append(notes, r.Note)
+				}
+			}
+			w.Note = strings.Join(notes, "; ")
+			queue = append(queue, w)
+		}
+
+		switch {
+		case q.wait.Status == model.StatusInProgress:
+			// Pending reviews wait until the task is resubmitted
+			if len(changes) > 0 {
+				onAssignee(model.VerdictChangesRequested, changes)
+			}
+		case len(pending) > 0:
+			for _, r := range pending {
+				w := q.wait
+				w.WaitingOn, w.Verdict, w.Since = r.Reviewer, r.Verdict, r.RequestedAt
+				queue = append(queue, w)
+			}
+		case len(changes) > 0:
+			onAssignee(model.VerdictChangesRequested, changes)
+		case len(approved) > 0:
+			onAssignee(model.VerdictApproved, approved)
+		default:
+			// In review with nobody asked to review it
+			w := q.wait
+			w.WaitingOn, w.Verdict = "", model.VerdictPending
+			queue = append(queue, w)
+		}
+	}
+
+	if waitingOn != "" {
+		var mine []ReviewWait
+		for _, w := range queue {
+			if w.WaitingOn == waitingOn {
+				mine = append(mine, w)
+			}
+		}
+		queue = mine
+	}
+	sort.SliceStable(queue, func(i, j int) bool { return queue[i].Since.Before(queue[j].Since) })
+	return queue, nil
+}
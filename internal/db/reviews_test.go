@@ -0,0 +1,160 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// submitForReview starts a task as alice and moves it to reviewing.
+func submitForReview(t *testing.T, db *DB, id string) {
+	t.Helper()
+	alice := db.WithActor("alice")
+	if err := alice.UpdateStatus(id, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	if err := alice.UpdateStatus(id, model.StatusReviewing); err != nil {
+		t.Fatalf("failed to submit for review: %v", err)
+	}
+}
+
+func verdicts(t *testing.T, db *DB, id string) []string {
+	t.Helper()
+	latest, err := db.LatestReviews(id)
+	if err != nil {
+		t.Fatalf("failed to get reviews: %v", err)
+	}
+	var got []string
+	for _, r := range latest {
+		got = append(got, r.Reviewer+" "+r.Verdict)
+	}
+	return got
+}
+
+func TestReview_ChangesRequestedLoop(t *testing.T) {
+	db := setupTestDB(t)
+	bob, carol := db.WithActor("bob"), db.WithActor("carol")
+	task := createTestItem(t, db, "Task")
+	submitForReview(t, db, task.ID)
+
+	for _, reviewer := range []string{"bob", "carol", "bob"} {
+		if err := db.WithActor("alice").AssignReviewer(task.ID, reviewer); err != nil {
+			t.Fatalf("failed to assign %s: %v", reviewer, err)
+		}
+	}
+	assertEvents(t, verdicts(t, db, task.ID), []string{"bob pending", "carol pending"})
+
+	if err := bob.RequestChanges(task.ID, ""); err == nil {
+		t.Error("expected an error requesting changes without a note")
+	}
+	if err := bob.RequestChanges(task.ID, "Handle expired tokens"); err != nil {
+		t.Fatalf("failed to request changes: %v", err)
+	}
+	item, _ := db.GetItem(task.ID)
+	if item.Status != model.StatusInProgress || item.Assignee != "alice" {
+		t.Errorf("after changes requested: status %s, assignee %q; want in_progress for alice", item.Status, item.Assignee)
+	}
+	logs, _ := db.GetLogs(task.ID)
+	if len(logs) != 1 || logs[0].Message != "Changes requested: Handle expired tokens" || logs[0].Actor != "bob" {
+		t.Errorf("logs = %+v, want the changes requested by bob", logs)
+	}
+	if err := carol.Approve(task.ID, ""); err == nil {
+		t.Error("expected an error approving a task that isn't in review")
+	}
+
+	// Resubmitting asks bob again; carol's review is still pending
+	submitForReview(t, db, task.ID)
+	again, err := db.RerequestReviews(task.ID)
+	if err != nil {
+		t.Fatalf("failed to re-request reviews: %v", err)
+	}
+	assertEvents(t, again, []string{"bob"})
+	if err := db.RequireApproval(task.ID); !errors.Is(err, ErrReviewPending) {
+		t.Errorf("expected ErrReviewPending, got %v", err)
+	}
+
+	if err := bob.Approve(task.ID, "LGTM"); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	if err := carol.Approve(task.ID, ""); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	assertEvents(t, verdicts(t, db, task.ID), []string{"bob approved", "carol approved"})
+	if err := db.RequireApproval(task.ID); err != nil {
+		t.Errorf("approved task: %v", err)
+	}
+	if reviews, _ := db.GetReviews(task.ID); len(reviews) != 3 {
+		t.Errorf("expected 3 reviews over two rounds, got %d", len(reviews))
+	}
+}
+
+func TestUnassignReviewer(t *testing.T) {
+	db := setupTestDB(t)
+	task := createTestItem(t, db, "Task")
+	if err := db.AssignReviewer(task.ID, "bob"); err != nil {
+		t.Fatalf("failed to assign: %v", err)
+	}
+	if err := db.UnassignReviewer(task.ID, "bob"); err != nil {
+		t.Fatalf("failed to unassign: %v", err)
+	}
+	if err := db.UnassignReviewer(task.ID, "bob"); err == nil {
+		t.Error("expected an error unassigning a reviewer twice")
+	}
+	if err := db.AssignReviewer("ts-000000", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := db.RequireApproval(task.ID); err != nil {
+		t.Errorf("task with no reviewers: %v", err)
+	}
+}
+
+func TestReviewQueue(t *testing.T) {
+	db := setupTestDB(t)
+	pending := createTestItem(t, db, "Pending")
+	unassigned := createTestItem(t, db, "Unassigned")
+	changes := createTestItem(t, db, "Changes")
+	approved := createTestItem(t, db, "Approved")
+	createTestItem(t, db, "Not in review")
+	for _, id := range []string{pending.ID, unassigned.ID, changes.ID, approved.ID} {
+		submitForReview(t, db, id)
+	}
+	for _, id := range []string{pending.ID, changes.ID, approved.ID} {
+		if err := db.AssignReviewer(id, "bob"); err != nil {
+			t.Fatalf("failed to assign: %v", err)
+		}
+	}
+	if err := db.AssignReviewer(changes.ID, "carol"); err != nil {
+		t.Fatalf("failed to assign: %v", err)
+	}
+	bob := db.WithActor("bob")
+	if err := bob.RequestChanges(changes.ID, "Add tests"); err != nil {
+		t.Fatalf("failed to request changes: %v", err)
+	}
+	if err := bob.Approve(approved.ID, ""); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+
+	queue, err := db.ReviewQueue("", "")
+	if err != nil {
+		t.Fatalf("failed to get queue: %v", err)
+	}
+	var got []string
+	for _, w := range queue {
+		got = append(got, w.Title+" on "+w.WaitingOn+" "+w.Verdict+" "+w.Note)
+	}
+	assertEvents(t, got, []string{
+		"Unassigned on  pending ",
+		"Pending on bob pending ",
+		"Changes on alice changes_requested Add tests",
+		"Approved on alice approved ",
+	})
+
+	mine, _ := db.ReviewQueue("test", "bob")
+	if len(mine) != 1 || mine[0].ItemID != pending.ID {
+		t.Errorf("bob's queue = %+v, want the pending review", mine)
+	}
+	if other, _ := db.ReviewQueue("other", ""); len(other) != 0 {
+		t.Errorf("other project's queue = %+v", other)
+	}
+}
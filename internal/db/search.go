@@ -0,0 +1,371 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/baiirun/prog/internal/model"
+	"github.com/baiirun/prog/internal/search"
+)
+
+// Learnings are searched two ways and the rankings fused (see
+// internal/search): BM25 over the FTS index of their title, summary and
+// detail, which rewards the query's exact words, and TF-IDF similarity over
+// learning_terms, each learning's weighted words and trigrams, which also
+// finds other forms and misspellings of them. A query that mentions a
+// concept, or one of the synonyms recorded for it, is expanded with the
+// concept's name and its other synonyms, and the learnings tagged with the
+// concept are fused in as a third ranking.
+
+const (
+	// searchCandidates is how many learnings each ranking contributes.
+	searchCandidates = 50
+
+	// minSimilarity is the TF-IDF score below which a learning is taken
+	// to share no more than a few trigrams with the query. Scores run from
+	// 0 to 1 + search.GramWeight.
+	minSimilarity = 0.15
+)
+
+// writeLearningTerms replaces a learning's rows in learning_terms with the
+// vector of its text.
+func writeLearningTerms(ex execer, learningID string, text ...string) error {
+	if _, err := ex.Exec(`DELETE FROM learning_terms WHERE learning_id = ?`, learningID); err != nil {
+		return fmt.Errorf("failed to replace terms: %w", err)
+	}
+	vector, err := json.Marshal(search.DocumentVector(strings.Join(text, "\n")))
+	if err != nil {
+		return fmt.Errorf("failed to marshal terms: %w", err)
+	}
+	_, err = ex.Exec(`
+		INSERT INTO learning_terms (learning_id, term, weight)
+		SELECT ?, key, value FROM json_each(?)
+	`, learningID, string(vector))
+	if err != nil {
+		return fmt.Errorf("failed to add terms: %w", err)
+	}
+	return nil
+}
+
+// reindexLearningTerms rewrites a learning's terms from its current text.
+func reindexLearningTerms(q querier, learningID string) error {
+	var title, summary, detail string
+	err := q.QueryRow(`SELECT title, summary, COALESCE(detail, '') FROM learnings WHERE id = ?`, learningID).Scan(&title, &summary, &detail)
+	if err != nil {
+		return fmt.Errorf("failed to get learning: %w", err)
+	}
+	return writeLearningTerms(q, learningID, title, summary, detail)
+}
+
+// indexMissingTerms indexes a project's learnings that have no terms yet:
+// those written before terms were kept.
+func (db *DB) indexMissingTerms(project string) error {
+	rows, err := db.Query(`
+		SELECT l.id FROM learnings l
+		WHERE l.project = ? AND NOT EXISTS (SELECT 1 FROM learning_terms t WHERE t.learning_id = l.id)
+	`, project)
+	if err != nil {
+		return fmt.Errorf("failed to find unindexed learnings: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan learning: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find unindexed learnings: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, id := range ids {
+		if err := reindexLearningTerms(tx, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SearchLearnings searches learnings for free text, which needn't be FTS
+// syntax: operators and punctuation are taken as plain words. Returns
+// matching learnings, page stubs first, by their fused BM25 and TF-IDF rank
+// weighted by relevance feedback.
+func (db *DB) SearchLearnings(project string, query string, includeStale bool) ([]model.Learning, error) {
+	if err := db.indexMissingTerms(project); err != nil {
+		return nil, err
+	}
+	groups, err := db.conceptGroups(project)
+	if err != nil {
+		return nil, err
+	}
+	expansions := search.Expand(query, groups)
+	statusFilter := learningStatusFilter(includeStale)
+
+	// Learnings tagged with concepts the query mentions
+	var byConcept []string
+	args := []any{project}
+	var placeholders []string
+	for _, group := range groups {
+		if slices.ContainsFunc(group, func(phrase string) bool { return search.Mentions(query, phrase) }) {
+			args = append(args, group[0])
+			placeholders = append(placeholders, "?")
+		}
+	}
+	if len(placeholders) > 0 {
+		byConcept, err = db.queryIDs(`
+			SELECT DISTINCT l.id
+			FROM learnings l
+			JOIN learning_concepts lc ON lc.learning_id = l.id
+			JOIN concepts c ON c.id = lc.concept_id
+			WHERE l.project = ? AND c.name IN (`+strings.Join(placeholders, ",")+`)
+			`+statusFilter+`
+			ORDER BY l.created_at DESC
+			LIMIT ?`, append(args, searchCandidates)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get learnings by concept: %w", err)
+		}
+	}
+
+	// BM25 ranks the query's own words; synonyms would pull in every
+	// learning that mentions a common one, such as "token"
+	var byWords []string
+	if match := search.MatchQuery(query); match != "" {
+		byWords, err = db.queryIDs(`
+			SELECT l.id
+			FROM learnings l
+			JOIN learnings_fts fts ON l.rowid = fts.rowid
+			WHERE learnings_fts MATCH ? AND l.project = ?
+			`+statusFilter+`
+			ORDER BY rank
+			LIMIT ?`, match, project, searchCandidates)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search learnings: %w", err)
+		}
+	}
+
+	bySimilarity, err := db.similarLearnings(project, query, expansions, statusFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	fused := search.Fuse(byWords, bySimilarity, byConcept)
+	if len(fused) == 0 {
+		return nil, nil
+	}
+	scores, err := json.Marshal(fused)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal scores: %w", err)
+	}
+	learnings, err := db.queryLearnings(`
+		SELECT `+learningColumns+`
+		FROM learnings l
+		JOIN json_each(?) s ON s.key = l.id
+		LEFT JOIN `+feedbackScores+` f ON f.learning_id = l.id
+		ORDER BY l.path IS NULL, s.value * COALESCE(f.score, 0.5) DESC, l.created_at DESC
+	`, string(scores))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search learnings: %w", err)
+	}
+	return learnings, nil
+}
+
+// similarLearnings ranks a project's learnings by the TF-IDF similarity of
+// their terms to the query and its expansions, best first, leaving out
+// those below minSimilarity.
+func (db *DB) similarLearnings(project, query string, expansions []string, statusFilter string) ([]string, error) {
+	counts := search.Terms(query)
+	for _, e := range expansions {
+		for term, n := range search.Terms(e) {
+			counts[term] += n * search.ExpansionWeight
+		}
+	}
+	if len(counts) == 0 {
+		return nil, nil
+	}
+	terms, err := json.Marshal(counts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal terms: %w", err)
+	}
+
+	// Document frequencies, for the query's idf weights
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM learnings WHERE project = ?`, project).Scan(&n); err != nil {
+		return nil, fmt.Errorf("failed to count learnings: %w", err)
+	}
+	rows, err := db.Query(`
+		SELECT t.term, COUNT(*)
+		FROM json_each(?) q
+		JOIN learning_terms t ON t.term = q.key
+		JOIN learnings l ON l.id = t.learning_id
+		WHERE l.project = ?
+		GROUP BY t.term
+	`, string(terms), project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count terms: %w", err)
+	}
+	df := make(map[string]int)
+	for rows.Next() {
+		var term string
+		var count int
+		if err := rows.Scan(&term, &count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan term: %w", err)
+		}
+		df[term] = count
+	}
+	rows.Close()
+	if len(df) == 0 {
+		return nil, nil
+	}
+
+	vector, err := json.Marshal(search.QueryVector(counts, func(term string) float64 {
+		return search.IDF(n, df[term])
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+	ids, err := db.queryIDs(`
+		SELECT t.learning_id
+		FROM json_each(?) q
+		JOIN learning_terms t ON t.term = q.key
+		JOIN learnings l ON l.id = t.learning_id
+		WHERE l.project = ?
+		`+statusFilter+`
+		GROUP BY t.learning_id
+		HAVING SUM(t.weight * q.value) >= ?
+		ORDER BY SUM(t.weight * q.value) DESC
+		LIMIT ?`, string(vector), project, minSimilarity, searchCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank learnings: %w", err)
+	}
+	return ids, nil
+}
+
+// queryIDs runs a query that selects a single ID column.
+func (db *DB) queryIDs(query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// conceptID returns the ID of a project's concept.
+func (db *DB) conceptID(name, project string) (string, error) {
+	var id string
+	err := db.QueryRow(`SELECT id FROM concepts WHERE name = ? AND project = ?`, name, project).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("concept %w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get concept: %w", err)
+	}
+	return id, nil
+}
+
+// AddConceptSynonyms records words or phrases that mean the same as a
+// concept, such as "session timeout" and "token expiry" for "sessions". A
+// search that mentions any of them, or the concept's name, also searches
+// for the rest. Synonyms are stored lowercase; ones already recorded are
+// ignored.
+func (db *DB) AddConceptSynonyms(name, project string, synonyms []string) error {
+	id, err := db.conceptID(name, project)
+	if err != nil {
+		return err
+	}
+	for _, s := range synonyms {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if _, err := db.Exec(`INSERT OR IGNORE INTO concept_synonyms (concept_id, synonym) VALUES (?, ?)`, id, s); err != nil {
+			return fmt.Errorf("failed to add synonym: %w", err)
+		}
+	}
+	return nil
+}
+
+// RemoveConceptSynonyms removes synonyms from a concept.
+func (db *DB) RemoveConceptSynonyms(name, project string, synonyms []string) error {
+	id, err := db.conceptID(name, project)
+	if err != nil {
+		return err
+	}
+	for _, s := range synonyms {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if _, err := db.Exec(`DELETE FROM concept_synonyms WHERE concept_id = ? AND synonym = ?`, id, s); err != nil {
+			return fmt.Errorf("failed to remove synonym: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetConceptSynonyms returns a concept's synonyms, sorted.
+func (db *DB) GetConceptSynonyms(name, project string) ([]string, error) {
+	id, err := db.conceptID(name, project)
+	if err != nil {
+		return nil, err
+	}
+	synonyms, err := db.queryIDs(`SELECT synonym FROM concept_synonyms WHERE concept_id = ? ORDER BY synonym`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get synonyms: %w", err)
+	}
+	return synonyms, nil
+}
+
+// conceptGroups returns, for each of a project's concepts, the concept's
+// name followed by its synonyms.
+func (db *DB) conceptGroups(project string) ([][]string, error) {
+	rows, err := db.Query(`
+		SELECT c.name, COALESCE(s.synonym, '')
+		FROM concepts c
+		LEFT JOIN concept_synonyms s ON s.concept_id = c.id
+		WHERE c.project = ?
+		ORDER BY c.name, s.synonym
+	`, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get synonyms: %w", err)
+	}
+	defer rows.Close()
+
+	var groups [][]string
+	for rows.Next() {
+		var name, synonym string
+		if err := rows.Scan(&name, &synonym); err != nil {
+			return nil, fmt.Errorf("failed to scan synonym: %w", err)
+		}
+		if len(groups) == 0 || groups[len(groups)-1][0] != name {
+			groups = append(groups, []string{name})
+		}
+		if synonym != "" && !slices.Contains(groups[len(groups)-1], synonym) {
+			groups[len(groups)-1] = append(groups[len(groups)-1], synonym)
+		}
+	}
+	return groups, rows.Err()
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSearchLearnings_Hybrid(t *testing.T) {
+	db := setupTestDB(t)
+	expiry := createTestLearning(t, db, "Token expiry is checked on every request", "auth")
+	timeout := createTestLearning(t, db, "Session timeout is an hour", "sessions")
+	pool := createTestLearning(t, db, "Database connection pool is capped at ten", "database")
+	refresh := createTestLearning(t, db, "Refresh tokens rotate on use", "auth")
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string // In order
+	}{
+		{"exact words", "token expiry", []string{expiry.ID, refresh.ID}},
+		{"other forms", "expiring", []string{expiry.ID}},
+		{"misspelt", "conection pol", []string{pool.ID}},
+		{"unrelated", "kubernetes", nil},
+		{"stop words only", "the of", nil},
+		{"FTS operators", `pool AND (database OR "capped`, []string{pool.ID}},
+		{"column filter", "summary: session NEAR(", []string{timeout.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.SearchLearnings("test", tt.query, false)
+			if err != nil {
+				t.Fatalf("SearchLearnings(%q) failed: %v", tt.query, err)
+			}
+			if ids := learningIDs(got); !slices.Equal(ids, tt.want) {
+				t.Errorf("SearchLearnings(%q) = %v, want %v", tt.query, ids, tt.want)
+			}
+		})
+	}
+
+	// Synonyms on a concept expand queries that mention any of them
+	if err := db.AddConceptSynonyms("sessions", "test", []string{"Token Expiry", " ttl "}); err != nil {
+		t.Fatalf("AddConceptSynonyms failed: %v", err)
+	}
+	got, err := db.SearchLearnings("test", "token expiry", false)
+	if err != nil {
+		t.Fatalf("SearchLearnings failed: %v", err)
+	}
+	if ids := learningIDs(got); len(ids) == 0 || ids[0] != expiry.ID || !slices.Contains(ids, timeout.ID) {
+		t.Errorf("with synonyms, search = %v, want %s first and %s included", ids, expiry.ID, timeout.ID)
+	}
+	got, _ = db.SearchLearnings("test", "ttl", false)
+	if ids := learningIDs(got); len(ids) == 0 || ids[0] != timeout.ID || slices.Contains(ids, pool.ID) {
+		t.Errorf("search for a synonym = %v, want %s first", ids, timeout.ID)
+	}
+
+	// Edits are reindexed
+	if err := db.UpdateLearningSummary(pool.ID, "Database handles are pooled"); err != nil {
+		t.Fatalf("UpdateLearningSummary failed: %v", err)
+	}
+	if got, _ := db.SearchLearnings("test", "connection", false); len(got) != 0 {
+		t.Errorf("search for an edited-out word = %v", learningIDs(got))
+	}
+	if got, _ := db.SearchLearnings("test", "handle", false); !slices.Equal(learningIDs(got), []string{pool.ID}) {
+		t.Errorf("search for an edited-in word = %v, want [%s]", learningIDs(got), pool.ID)
+	}
+}
+
+func TestSearchLearnings_IndexesOlderLearnings(t *testing.T) {
+	db := setupTestDB(t)
+	l := createTestLearning(t, db, "Migrations run inside a transaction", "database")
+
+	// As if written before terms were kept
+	if _, err := db.Exec(`DELETE FROM learning_terms`); err != nil {
+		t.Fatalf("failed to clear terms: %v", err)
+	}
+	got, err := db.SearchLearnings("test", "migrate transactions", false)
+	if err != nil {
+		t.Fatalf("SearchLearnings failed: %v", err)
+	}
+	if ids := learningIDs(got); !slices.Equal(ids, []string{l.ID}) {
+		t.Errorf("search = %v, want [%s]", ids, l.ID)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM learning_terms WHERE learning_id = ?`, l.ID).Scan(&n); err != nil || n == 0 {
+		t.Errorf("learning was not indexed: %d terms, %v", n, err)
+	}
+
+	if err := db.DeleteLearning(l.ID); err != nil {
+		t.Fatalf("DeleteLearning failed: %v", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM learning_terms`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("%d terms left after delete, %v", n, err)
+	}
+}
+
+func TestConceptSynonyms(t *testing.T) {
+	db := setupTestDB(t)
+	createTestLearning(t, db, "Session timeout is an hour", "sessions")
+
+	if err := db.AddConceptSynonyms("sessions", "test", []string{"TTL", "session timeout", "ttl", ""}); err != nil {
+		t.Fatalf("AddConceptSynonyms failed: %v", err)
+	}
+	got, err := db.GetConceptSynonyms("sessions", "test")
+	if err != nil {
+		t.Fatalf("GetConceptSynonyms failed: %v", err)
+	}
+	if !slices.Equal(got, []string{"session timeout", "ttl"}) {
+		t.Errorf("synonyms = %q", got)
+	}
+
+	if err := db.RemoveConceptSynonyms("sessions", "test", []string{"TTL"}); err != nil {
+		t.Fatalf("RemoveConceptSynonyms failed: %v", err)
+	}
+	got, _ = db.GetConceptSynonyms("sessions", "test")
+	if !slices.Equal(got, []string{"session timeout"}) {
+		t.Errorf("synonyms after remove = %q", got)
+	}
+
+	if err := db.AddConceptSynonyms("nope", "test", []string{"x"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("synonyms for a missing concept = %v, want ErrNotFound", err)
+	}
+}
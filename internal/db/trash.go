@@ -0,0 +1,239 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// ErrInTrash is returned when an operation targets an item that has been
+// deleted but not yet purged.
+var ErrInTrash = errors.New("item is in the trash")
+
+// TrashedItem is a deleted item waiting in the trash.
+type TrashedItem struct {
+	model.Item
+	DeletedAt time.Time
+}
+
+// DeleteItem moves an item to the trash. Trashed items are hidden from every
+// listing and no longer block their dependents, but keep their logs,
+// dependencies and labels so RestoreItem can bring them back intact.
+// PurgeTrash removes them for good.
+func (db *DB) DeleteItem(id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	title, err := trashItem(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := recordEvent(tx, id, EventDeleted, title, "", db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RestoreItem brings an item back from the trash.
+func (db *DB) RestoreItem(id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	title, err := untrashItem(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := recordEvent(tx, id, EventDeleted, "", title, db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ListTrash returns the items in the trash, most recently deleted first.
+// If project is non-empty only that project's items are returned.
+func (db *DB) ListTrash(project string) ([]TrashedItem, error) {
+	query := `
+		SELECT id, project, type, title, description, definition_of_done, status, priority, parent_id, created_by, assignee, created_at, updated_at, deleted_at
+		FROM items WHERE deleted_at IS NOT NULL`
+	args := []any{}
+	if project != "" {
+		query += ` AND project = ?`
+		args = append(args, project)
+	}
+	query += ` ORDER BY deleted_at DESC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var trashed []TrashedItem
+	for rows.Next() {
+		var t TrashedItem
+		var parentID, definitionOfDone sql.NullString
+		if err := rows.Scan(
+			&t.ID, &t.Project, &t.Type, &t.Title, &t.Description, &definitionOfDone,
+			&t.Status, &t.Priority, &parentID, &t.CreatedBy, &t.Assignee, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan item: %w", err)
+		}
+		if parentID.Valid {
+			t.ParentID = &parentID.String
+		}
+		if definitionOfDone.Valid {
+			t.DefinitionOfDone = &definitionOfDone.String
+		}
+		trashed = append(trashed, t)
+	}
+	return trashed, rows.Err()
+}
+
+// PurgeTrash permanently removes items deleted at or before cutoff, along
+// with their logs, dependencies, labels and areas. Learnings linked to them
+// are kept but unlinked, and their children lose their parent. History is
+// kept. Returns the IDs of the purged items.
+func (db *DB) PurgeTrash(project string, cutoff time.Time) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Compared in Go: stored times aren't reliably comparable as SQL strings
+	query := `SELECT id, title, deleted_at FROM items WHERE deleted_at IS NOT NULL`
+	args := []any{}
+	if project != "" {
+		query += ` AND project = ?`
+		args = append(args, project)
+	}
+	rows, err := tx.Query(query+` ORDER BY deleted_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	var ids, titles []string
+	for rows.Next() {
+		var id, title string
+		var deletedAt time.Time
+		if err := rows.Scan(&id, &title, &deletedAt); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan item: %w", err)
+		}
+		if !deletedAt.After(cutoff) {
+			ids = append(ids, id)
+			titles = append(titles, title)
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+
+	for i, id := range ids {
+		// Recorded first, while the item's project can still be looked up
+		if err := recordEvent(tx, id, EventPurged, titles[i], "", db.actor); err != nil {
+			return nil, err
+		}
+		if err := removeItem(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return ids, nil
+}
+
+// trashItem moves a live item to the trash and returns its title. Its lease
+// and orchestrator assignments are dropped since nobody should work on it.
+func trashItem(tx *sql.Tx, id string) (string, error) {
+	title, trashed, err := itemState(tx, id)
+	if err != nil {
+		return "", err
+	}
+	if trashed {
+		return "", fmt.Errorf("%w: %s", ErrInTrash, id)
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE items SET deleted_at = ?, updated_at = ? WHERE id = ?`, now, now, id); err != nil {
+		return "", fmt.Errorf("failed to delete item: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM leases WHERE item_id = ?`, id); err != nil {
+		return "", fmt.Errorf("failed to delete lease: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM assignments WHERE item_id = ?`, id); err != nil {
+		return "", fmt.Errorf("failed to delete assignments: %w", err)
+	}
+	return title, nil
+}
+
+// untrashItem takes an item out of the trash and returns its title.
+func untrashItem(tx *sql.Tx, id string) (string, error) {
+	title, trashed, err := itemState(tx, id)
+	if err != nil {
+		return "", err
+	}
+	if !trashed {
+		return "", fmt.Errorf("%s is not in the trash", id)
+	}
+	if _, err := tx.Exec(`UPDATE items SET deleted_at = NULL, updated_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return "", fmt.Errorf("failed to restore item: %w", err)
+	}
+	return title, nil
+}
+
+// itemState returns an item's title and whether it is in the trash.
+func itemState(tx *sql.Tx, id string) (title string, trashed bool, err error) {
+	var deletedAt sql.NullTime
+	err = tx.QueryRow(`SELECT title, deleted_at FROM items WHERE id = ?`, id).Scan(&title, &deletedAt)
+	if err == sql.ErrNoRows {
+		return "", false, fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, id)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get item: %w", err)
+	}
+	return title, deletedAt.Valid, nil
+}
+
+// removeItem permanently deletes an item and everything attached to it.
+func removeItem(tx *sql.Tx, id string) error {
+	for _, stmt := range []struct{ query, what string }{
+		{`DELETE FROM logs WHERE item_id = ?`, "logs"},
+		{`DELETE FROM deps WHERE item_id = ?1 OR depends_on = ?1`, "dependencies"},
+		{`DELETE FROM item_labels WHERE item_id = ?`, "labels"},
+		{`DELETE FROM item_areas WHERE item_id = ?`, "areas"},
+		{`DELETE FROM dod_criteria WHERE item_id = ?`, "criteria"},
+		{`DELETE FROM verifications WHERE item_id = ?`, "verifications"},
+		{`DELETE FROM reviews WHERE item_id = ?`, "reviews"},
+		{`DELETE FROM leases WHERE item_id = ?`, "lease"},
+		{`DELETE FROM assignments WHERE item_id = ?`, "assignments"},
+		{`UPDATE learnings SET task_id = NULL WHERE task_id = ?`, "learning links"},
+		{`UPDATE learning_feedback SET task_id = NULL WHERE task_id = ?`, "feedback links"},
+		{`UPDATE items SET parent_id = NULL WHERE parent_id = ?`, "child links"},
+		{`DELETE FROM items WHERE id = ?`, "item"},
+	} {
+		if _, err := tx.Exec(stmt.query, id); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", stmt.what, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func TestDeleteItem_MovesToTrash(t *testing.T) {
+	db := setupTestDB(t)
+	blocker := createTestItem(t, db, "Blocker")
+	dependent := createTestItem(t, db, "Dependent")
+	mustAddDep(t, db, dependent.ID, blocker.ID)
+
+	if err := db.DeleteItem(blocker.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	if _, err := db.GetItem(blocker.ID); !errors.Is(err, ErrInTrash) {
+		t.Errorf("err = %v, want ErrInTrash", err)
+	}
+	items, err := db.ListItemsFiltered(ListFilter{Project: "test"})
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != dependent.ID {
+		t.Errorf("list = %v, want only the dependent", items)
+	}
+
+	// A trashed dependency no longer blocks
+	ready, err := db.ReadyItems("test")
+	if err != nil {
+		t.Fatalf("failed to get ready items: %v", err)
+	}
+	if len(ready) != 1 || ready[0].ID != dependent.ID {
+		t.Errorf("ready = %v, want the dependent", ready)
+	}
+
+	trash, err := db.ListTrash("test")
+	if err != nil {
+		t.Fatalf("failed to list trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != blocker.ID || trash[0].DeletedAt.IsZero() {
+		t.Errorf("trash = %+v, want the blocker", trash)
+	}
+
+	if err := db.RestoreItem(blocker.ID); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if err := db.RestoreItem(blocker.ID); err == nil {
+		t.Error("expected error restoring an item that isn't in the trash")
+	}
+	ready, _ = db.ReadyItems("test")
+	if len(ready) != 1 || ready[0].ID != blocker.ID {
+		t.Errorf("ready = %v, want the restored blocker to block again", ready)
+	}
+	if trash, _ := db.ListTrash("test"); len(trash) != 0 {
+		t.Errorf("trash = %+v, want empty", trash)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := setupTestDB(t)
+	epic := createTestEpic(t, db, "Epic", "test")
+	child := createTestItem(t, db, "Child")
+	mustSetParent(t, db, child.ID, epic.ID)
+	if err := db.AddLabelToItem(epic.ID, "test", "bug"); err != nil {
+		t.Fatalf("failed to add label: %v", err)
+	}
+	learning := &model.Learning{
+		ID:        model.GenerateLearningID(),
+		Project:   "test",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		TaskID:    &epic.ID,
+		Summary:   "Learned on the epic",
+		Status:    model.LearningStatusActive,
+	}
+	if err := db.CreateLearning(learning); err != nil {
+		t.Fatalf("failed to create learning: %v", err)
+	}
+
+	if err := db.DeleteItem(epic.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	// Items deleted after the cutoff are kept
+	purged, err := db.PurgeTrash("", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if len(purged) != 0 {
+		t.Fatalf("purged = %v, want nothing", purged)
+	}
+
+	purged, err = db.PurgeTrash("", time.Now())
+	if err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if len(purged) != 1 || purged[0] != epic.ID {
+		t.Fatalf("purged = %v, want [%s]", purged, epic.ID)
+	}
+
+	if _, err := db.GetItem(epic.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+	if err := db.RestoreItem(epic.ID); err == nil {
+		t.Error("expected error restoring a purged item")
+	}
+	if labels, _ := db.GetItemLabels(epic.ID); len(labels) != 0 {
+		t.Errorf("labels = %v, want none", labels)
+	}
+	got, err := db.GetLearning(learning.ID)
+	if err != nil {
+		t.Fatalf("learning should be kept: %v", err)
+	}
+	if got.TaskID != nil {
+		t.Errorf("learning task = %v, want unlinked", *got.TaskID)
+	}
+	if got, _ := db.GetItem(child.ID); got.ParentID != nil {
+		t.Errorf("child parent = %v, want none", *got.ParentID)
+	}
+
+	assertEvents(t, eventSummary(t, db, epic.ID)[2:], []string{
+		"deleted:Epic>@",
+		"purged:Epic>@",
+	})
+}
+
+func TestUndo_Restore(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+	task := createTestItem(t, db, "Task")
+
+	if err := db.DeleteItem(task.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if err := alice.RestoreItem(task.ID); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+
+	mustUndo(t, alice, "alice", 1)
+	if _, err := db.GetItem(task.ID); !errors.Is(err, ErrInTrash) {
+		t.Errorf("err = %v, want ErrInTrash", err)
+	}
+
+	// Purged items are gone for good
+	other := createTestItem(t, db, "Other")
+	if err := alice.DeleteItem(other.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, err := db.PurgeTrash("", time.Now()); err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if _, err := alice.Undo("alice", 1); !errors.Is(err, ErrUndoConflict) {
+		t.Errorf("err = %v, want ErrUndoConflict", err)
+	}
+}
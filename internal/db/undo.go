@@ -0,0 +1,335 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// ErrUndoConflict is returned when a change can't be undone because what it
+// changed has moved on since, e.g. another agent edited the same field.
+var ErrUndoConflict = errors.New("cannot undo")
+
+// undoableFields are the event fields Undo knows how to reverse. Lease moves
+// belong to the orchestrator, and reviews stand as given; both are left alone.
+// Label renames are recorded as label events too, but are skipped: they apply
+// to every item with the label, so are reversed by renaming it back.
+var undoableFields = []any{
+	EventCreated, EventDeleted, EventStatus, EventTitle, EventDescription, EventDefinitionOfDone, EventCriterion,
+	EventParent, EventProject, EventDependency, EventLabel, EventArea,
+}
+
+// itemColumns maps field events to the items column they change.
+var itemColumns = map[string]string{
+	EventTitle:            "title",
+	EventDescription:      "description",
+	EventDefinitionOfDone: "definition_of_done",
+	EventParent:           "parent_id",
+	EventProject:          "project",
+}
+
+// Undo reverses the last steps changes actor made, newest first, and returns
+// the events it reversed. Each reversal is itself recorded in history as an
+// event pointing at the one it reverts, and reverted events are skipped by
+// later undos.
+//
+// Only the targeted changes are reversed, so concurrent work by others is
+// kept. If any of them can't be reversed cleanly — the field has been changed
+// again since, or the item has been purged — nothing is undone and the error
+// wraps ErrUndoConflict.
+func (db *DB) Undo(actor string, steps int) ([]model.Event, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var undone []model.Event
+	for len(undone) < steps {
+		e, err := lastUndoable(tx, actor)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			break
+		}
+		if err := db.revert(tx, e); err != nil {
+			return nil, err
+		}
+		undone = append(undone, *e)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return undone, nil
+}
+
+// lastUndoable returns actor's most recent change that hasn't been undone, or
+// nil if there is none. Label renames, which have both an old and a new
+// value, are passed over rather than blocking every undo behind them.
+func lastUndoable(tx *sql.Tx, actor string) (*model.Event, error) {
+	args := append([]any{actor}, undoableFields...)
+	var e model.Event
+	err := tx.QueryRow(`
+		SELECT id, item_id, field, COALESCE(old_value, ''), COALESCE(new_value, ''), actor, created_at
+		FROM item_events e
+		WHERE actor = ? AND reverts IS NULL
+		  AND field IN (?`+strings.Repeat(", ?", len(undoableFields)-1)+`)
+		  AND NOT (field = '`+EventLabel+`' AND COALESCE(old_value, '') != '' AND COALESCE(new_value, '') != '')
+		  AND NOT EXISTS (SELECT 1 FROM item_events r WHERE r.reverts = e.id)
+		ORDER BY id DESC LIMIT 1`, args...).Scan(
+		&e.ID, &e.ItemID, &e.Field, &e.OldValue, &e.NewValue, &e.Actor, &e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find change to undo: %w", err)
+	}
+	return &e, nil
+}
+
+// revert reverses e and records the reversal.
+func (db *DB) revert(tx *sql.Tx, e *model.Event) error {
+	conflict := func(format string, args ...any) error {
+		return fmt.Errorf("%w %s change on %s (%s): %s", ErrUndoConflict, e.Field, e.ItemID,
+			e.CreatedAt.Local().Format("2006-01-02 15:04"), fmt.Sprintf(format, args...))
+	}
+
+	var project string
+	var deletedAt sql.NullTime
+	err := tx.QueryRow(`SELECT project, deleted_at FROM items WHERE id = ?`, e.ItemID).Scan(&project, &deletedAt)
+	if err == sql.ErrNoRows {
+		return conflict("the item has been purged from the trash")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get item: %w", err)
+	}
+	if deletedAt.Valid && e.Field != EventDeleted {
+		return conflict("the item is in the trash (use 'prog restore-item %s' first)", e.ItemID)
+	}
+
+	now := time.Now()
+	switch e.Field {
+	case EventCreated:
+		// Deleting the item would take everyone else's later changes with it
+		var later int
+		if err := tx.QueryRow(`
+			SELECT COUNT(*) FROM item_events e
+			WHERE item_id = ? AND id > ? AND reverts IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM item_events r WHERE r.reverts = e.id)`,
+			e.ItemID, e.ID).Scan(&later); err != nil {
+			return fmt.Errorf("failed to check history: %w", err)
+		}
+		if later > 0 {
+			return conflict("it has changed since (see 'prog history %s')", e.ItemID)
+		}
+		if _, err := trashItem(tx, e.ItemID); err != nil {
+			return err
+		}
+
+	case EventDeleted:
+		// A deletion is undone by restoring, a restore by deleting again
+		if e.OldValue != "" {
+			if !deletedAt.Valid {
+				return conflict("it has been restored since")
+			}
+			if _, err := untrashItem(tx, e.ItemID); err != nil {
+				return err
+			}
+			break
+		}
+		if deletedAt.Valid {
+			return conflict("it has been deleted again since")
+		}
+		if _, err := trashItem(tx, e.ItemID); err != nil {
+			return err
+		}
+
+	case EventStatus:
+		// Finishing and starting have gates, hooks and a lease that a plain
+		// update would skip, so those are left to 'prog done' and 'prog start'
+		switch model.Status(e.OldValue) {
+		case model.StatusDone:
+			return conflict("it would be marked done again without its checks; use 'prog done %s'", e.ItemID)
+		case model.StatusInProgress:
+			return conflict("it would be in progress with nobody holding it; use 'prog start %s'", e.ItemID)
+		}
+		// Reopening unassigns, as it does in UpdateStatus
+		result, err := tx.Exec(`
+			UPDATE items SET status = ?1,
+				assignee = CASE WHEN ?1 IN ('open', 'draft') THEN '' ELSE assignee END,
+				updated_at = ?2
+			WHERE id = ?3 AND status = ?4`,
+			e.OldValue, now, e.ItemID, e.NewValue)
+		if err != nil {
+			return fmt.Errorf("failed to restore status: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return conflict("status is no longer %s", e.NewValue)
+		}
+		if _, err := tx.Exec(`DELETE FROM leases WHERE item_id = ?`, e.ItemID); err != nil {
+			return fmt.Errorf("failed to release lease: %w", err)
+		}
+
+	case EventTitle, EventDescription, EventDefinitionOfDone, EventParent, EventProject:
+		column := itemColumns[e.Field]
+		var old any = e.OldValue
+		if e.OldValue == "" && (e.Field == EventParent || e.Field == EventDefinitionOfDone) {
+			old = nil
+		}
+		if e.Field == EventParent && e.OldValue != "" {
+			var n int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM items WHERE id = ? AND deleted_at IS NULL`, e.OldValue).Scan(&n); err != nil {
+				return fmt.Errorf("failed to get former parent: %w", err)
+			}
+			if n == 0 {
+				return conflict("former parent %s no longer exists", e.OldValue)
+			}
+			// As in SetParent, the epic will wait on the item, so the item
+			// mustn't have come to wait on it since
+			path, err := depPath(tx, e.ItemID, e.OldValue)
+			if err != nil {
+				return err
+			}
+			if path != nil {
+				return conflict("moving it back under %s would create a cycle: %s", e.OldValue,
+					strings.Join(append([]string{e.OldValue}, path...), " -> "))
+			}
+		}
+		result, err := tx.Exec(`UPDATE items SET `+column+` = ?, updated_at = ? WHERE id = ? AND COALESCE(`+column+`, '') = ?`,
+			old, now, e.ItemID, e.NewValue)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", e.Field, err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return conflict("%s has been changed again since", e.Field)
+		}
+		if e.Field == EventDefinitionOfDone {
+			if err := writeCriteria(tx, e.ItemID, textCriteria(e.OldValue)); err != nil {
+				return err
+			}
+		}
+
+	case EventCriterion:
+		// Find the criterion by its text, since positions move as criteria
+		// are added and removed
+		text, checked := e.NewValue, true
+		if text == "" {
+			text, checked = e.OldValue, false
+		}
+		var position int
+		err := tx.QueryRow(`SELECT position FROM dod_criteria WHERE item_id = ? AND text = ? AND checked = ? ORDER BY position LIMIT 1`,
+			e.ItemID, text, checked).Scan(&position)
+		if err == sql.ErrNoRows {
+			return conflict("criterion %q has been changed since", text)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get criterion: %w", err)
+		}
+		if err := markCriterion(tx, e.ItemID, position, !checked, "", db.actor); err != nil {
+			return err
+		}
+
+	case EventDependency:
+		if e.NewValue == "" {
+			// As in AddDep, a dependency that would close a loop is refused
+			path, err := depPath(tx, e.OldValue, e.ItemID)
+			if err != nil {
+				return err
+			}
+			if path != nil {
+				return conflict("restoring the dependency on %s would create a cycle: %s", e.OldValue,
+					strings.Join(append([]string{e.ItemID}, path...), " -> "))
+			}
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO deps (item_id, depends_on) VALUES (?, ?)`, e.ItemID, e.OldValue); err != nil {
+				return fmt.Errorf("failed to restore dependency: %w", err)
+			}
+			break
+		}
+		result, err := tx.Exec(`DELETE FROM deps WHERE item_id = ? AND depends_on = ?`, e.ItemID, e.NewValue)
+		if err != nil {
+			return fmt.Errorf("failed to remove dependency: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return conflict("the dependency on %s is already gone", e.NewValue)
+		}
+
+	case EventLabel:
+		switch {
+		case e.OldValue != "" && e.NewValue != "":
+			return conflict("label renames apply to every item; rename it back with 'prog labels rename %s %s'", e.NewValue, e.OldValue)
+		case e.NewValue == "":
+			if err := attachLabel(tx, e.ItemID, project, e.OldValue); err != nil {
+				return err
+			}
+		default:
+			result, err := tx.Exec(`
+				DELETE FROM item_labels WHERE item_id = ?
+				AND label_id IN (SELECT id FROM labels WHERE project = ? AND name = ?)`,
+				e.ItemID, project, e.NewValue)
+			if err != nil {
+				return fmt.Errorf("failed to remove label: %w", err)
+			}
+			if rows, _ := result.RowsAffected(); rows == 0 {
+				return conflict("label %q is already gone", e.NewValue)
+			}
+		}
+
+	case EventArea:
+		if e.NewValue == "" {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO item_areas (item_id, area) VALUES (?, ?)`, e.ItemID, e.OldValue); err != nil {
+				return fmt.Errorf("failed to restore area: %w", err)
+			}
+			break
+		}
+		result, err := tx.Exec(`DELETE FROM item_areas WHERE item_id = ? AND area = ?`, e.ItemID, e.NewValue)
+		if err != nil {
+			return fmt.Errorf("failed to remove area: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return conflict("area %q is already gone", e.NewValue)
+		}
+
+	default:
+		return conflict("%s changes can't be undone", e.Field)
+	}
+
+	reversal := model.Event{
+		ItemID:   e.ItemID,
+		Field:    e.Field,
+		OldValue: e.NewValue,
+		NewValue: e.OldValue,
+		Actor:    db.actor,
+		Reverts:  e.ID,
+	}
+	return insertEvent(tx, reversal)
+}
+
+// attachLabel adds a label to an item within tx, recreating the label if it
+// has been deleted.
+func attachLabel(tx *sql.Tx, itemID, project, name string) error {
+	var labelID string
+	err := tx.QueryRow(`SELECT id FROM labels WHERE project = ? AND name = ?`, project, name).Scan(&labelID)
+	if err == sql.ErrNoRows {
+		labelID = model.GenerateLabelID()
+		now := time.Now()
+		_, err = tx.Exec(`INSERT INTO labels (id, name, project, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			labelID, name, project, now, now)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ensure label: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO item_labels (item_id, label_id) VALUES (?, ?)`, itemID, labelID); err != nil {
+		return fmt.Errorf("failed to add label to item: %w", err)
+	}
+	return nil
+}
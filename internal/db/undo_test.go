@@ -0,0 +1,282 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func mustUndo(t *testing.T, db *DB, actor string, steps int) []model.Event {
+	t.Helper()
+	undone, err := db.Undo(actor, steps)
+	if err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	return undone
+}
+
+func TestUndo_FieldChanges(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+	bob := db.WithActor("bob")
+	task := createTestItem(t, db, "Original")
+	epic := createTestEpic(t, db, "Epic", "test")
+
+	if err := alice.SetDescription(task.ID, "first draft"); err != nil {
+		t.Fatalf("failed to set description: %v", err)
+	}
+	if err := alice.SetParent(task.ID, epic.ID); err != nil {
+		t.Fatalf("failed to set parent: %v", err)
+	}
+	if err := alice.UpdateStatus(task.ID, model.StatusCanceled); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	// Concurrent work by someone else survives alice's undo
+	if err := bob.SetTitle(task.ID, "Renamed by bob"); err != nil {
+		t.Fatalf("failed to set title: %v", err)
+	}
+
+	undone := mustUndo(t, alice, "alice", 2)
+	if len(undone) != 2 || undone[0].Field != EventStatus || undone[1].Field != EventParent {
+		t.Fatalf("undone = %+v, want status then parent", undone)
+	}
+
+	got, err := db.GetItem(task.ID)
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if got.Status != model.StatusOpen || got.ParentID != nil {
+		t.Errorf("status = %s, parent = %v; want open and no parent", got.Status, got.ParentID)
+	}
+	if got.Title != "Renamed by bob" || got.Description != "first draft" {
+		t.Errorf("title = %q, description = %q; want bob's title and the draft kept", got.Title, got.Description)
+	}
+
+	// Undone changes are skipped next time
+	undone = mustUndo(t, alice, "alice", 1)
+	if len(undone) != 1 || undone[0].Field != EventDescription {
+		t.Fatalf("undone = %+v, want description", undone)
+	}
+	if got, _ := db.GetItem(task.ID); got.Description != "" {
+		t.Errorf("description = %q, want empty", got.Description)
+	}
+	if undone := mustUndo(t, alice, "alice", 5); len(undone) != 0 {
+		t.Errorf("undone = %+v, want nothing left", undone)
+	}
+}
+
+func TestUndo_Conflict(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+	task := createTestItem(t, db, "Task")
+
+	if err := alice.UpdateStatus(task.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	if err := alice.SetTitle(task.ID, "Alice's title"); err != nil {
+		t.Fatalf("failed to set title: %v", err)
+	}
+	if err := db.WithActor("bob").UpdateStatus(task.ID, model.StatusDone); err != nil {
+		t.Fatalf("failed to finish: %v", err)
+	}
+
+	// The title undoes cleanly but the status moved on, so neither is undone
+	_, err := alice.Undo("alice", 2)
+	if !errors.Is(err, ErrUndoConflict) {
+		t.Fatalf("err = %v, want ErrUndoConflict", err)
+	}
+	got, _ := db.GetItem(task.ID)
+	if got.Title != "Alice's title" || got.Status != model.StatusDone {
+		t.Errorf("item = %q/%s, want it untouched", got.Title, got.Status)
+	}
+}
+
+func TestUndo_Delete(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+	task := createTestItem(t, db, "Doomed")
+	blocker := createTestItem(t, db, "Blocker")
+	dependent := createTestItem(t, db, "Dependent")
+
+	mustAddDep(t, db, task.ID, blocker.ID)
+	mustAddDep(t, db, dependent.ID, task.ID)
+	mustAddArea(t, db, task.ID, "internal/db")
+	if err := db.AddLabelToItem(task.ID, "test", "bug"); err != nil {
+		t.Fatalf("failed to add label: %v", err)
+	}
+	if err := db.WithActor("agent-x").AddLog(task.ID, "Worked on it"); err != nil {
+		t.Fatalf("failed to add log: %v", err)
+	}
+
+	if err := alice.DeleteItem(task.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, err := db.GetItem(task.ID); err == nil {
+		t.Fatal("expected item to be deleted")
+	}
+
+	undone := mustUndo(t, alice, "alice", 1)
+	if len(undone) != 1 || undone[0].Field != EventDeleted {
+		t.Fatalf("undone = %+v, want the deletion", undone)
+	}
+
+	got, err := db.GetItem(task.ID)
+	if err != nil {
+		t.Fatalf("item not restored: %v", err)
+	}
+	if got.Title != "Doomed" {
+		t.Errorf("title = %q, want Doomed", got.Title)
+	}
+	if deps, _ := db.GetDeps(task.ID); len(deps) != 1 || deps[0] != blocker.ID {
+		t.Errorf("deps = %v, want [%s]", deps, blocker.ID)
+	}
+	if deps, _ := db.GetDeps(dependent.ID); len(deps) != 1 || deps[0] != task.ID {
+		t.Errorf("dependent's deps = %v, want [%s]", deps, task.ID)
+	}
+	if areas, _ := db.GetItemAreas(task.ID); len(areas) != 1 {
+		t.Errorf("areas = %v, want restored", areas)
+	}
+	if labels, _ := db.GetItemLabels(task.ID); len(labels) != 1 || labels[0].Name != "bug" {
+		t.Errorf("labels = %v, want [bug]", labels)
+	}
+	logs, _ := db.GetLogs(task.ID)
+	if len(logs) != 1 || logs[0].Actor != "agent-x" {
+		t.Errorf("logs = %+v, want agent-x's entry", logs)
+	}
+}
+
+func TestUndo_Create(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+
+	touched := createTestItem(t, alice, "Touched")
+	if err := db.WithActor("bob").SetTitle(touched.ID, "Bob was here"); err != nil {
+		t.Fatalf("failed to set title: %v", err)
+	}
+	lonely := createTestItem(t, alice, "Lonely")
+
+	undone := mustUndo(t, alice, "alice", 1)
+	if len(undone) != 1 || undone[0].ItemID != lonely.ID {
+		t.Fatalf("undone = %+v, want the creation of %s", undone, lonely.ID)
+	}
+	if _, err := db.GetItem(lonely.ID); err == nil {
+		t.Error("expected created item to be removed")
+	}
+
+	// Removing touched would lose bob's change
+	if _, err := alice.Undo("alice", 1); !errors.Is(err, ErrUndoConflict) {
+		t.Fatalf("err = %v, want ErrUndoConflict", err)
+	}
+	if _, err := db.GetItem(touched.ID); err != nil {
+		t.Errorf("touched item should be kept: %v", err)
+	}
+}
+
+func TestUndo_SkipsLabelRenames(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+	task := createTestItem(t, db, "Task")
+
+	if err := alice.AddLabelToItem(task.ID, "test", "bug"); err != nil {
+		t.Fatalf("failed to add label: %v", err)
+	}
+	if err := alice.UpdateStatus(task.ID, model.StatusCanceled); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if err := alice.RenameLabel("test", "bug", "defect"); err != nil {
+		t.Fatalf("failed to rename label: %v", err)
+	}
+
+	// The rename is passed over, not left blocking alice's earlier changes
+	undone := mustUndo(t, alice, "alice", 1)
+	if len(undone) != 1 || undone[0].Field != EventStatus {
+		t.Fatalf("undone = %+v, want the status change", undone)
+	}
+	if got, _ := db.GetItem(task.ID); got.Status != model.StatusOpen {
+		t.Errorf("status = %s, want open", got.Status)
+	}
+	if labels, _ := db.GetItemLabels(task.ID); len(labels) != 1 || labels[0].Name != "defect" {
+		t.Errorf("labels = %v, want the rename kept", labels)
+	}
+}
+
+func TestUndo_DependencyRemovalCycle(t *testing.T) {
+	db := setupTestDB(t)
+	a := createTestItem(t, db, "A")
+	b := createTestItem(t, db, "B")
+
+	// alice removed a's dependency on b, then bob made b depend on a
+	if err := recordEvent(db, a.ID, EventDependency, b.ID, "", "alice"); err != nil {
+		t.Fatalf("failed to record removal: %v", err)
+	}
+	mustAddDep(t, db.WithActor("bob"), b.ID, a.ID)
+
+	if _, err := db.WithActor("alice").Undo("alice", 1); !errors.Is(err, ErrUndoConflict) {
+		t.Fatalf("err = %v, want ErrUndoConflict", err)
+	}
+	if deps, _ := db.GetDeps(a.ID); len(deps) != 0 {
+		t.Errorf("deps = %v, want the cycle refused", deps)
+	}
+}
+
+func TestUndo_ParentCycle(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+	a := createTestEpic(t, db, "A", "test")
+	p := createTestEpic(t, db, "P", "test")
+	q := createTestEpic(t, db, "Q", "test")
+	mustSetParent(t, db, a.ID, p.ID)
+
+	// alice moves A from P to Q, then P is moved under A
+	if err := alice.SetParent(a.ID, q.ID); err != nil {
+		t.Fatalf("failed to set parent: %v", err)
+	}
+	mustSetParent(t, db.WithActor("bob"), p.ID, a.ID)
+
+	if _, err := alice.Undo("alice", 1); !errors.Is(err, ErrUndoConflict) {
+		t.Fatalf("err = %v, want ErrUndoConflict", err)
+	}
+	if got, _ := db.GetItem(a.ID); got.ParentID == nil || *got.ParentID != q.ID {
+		t.Errorf("parent = %v, want %s kept", got.ParentID, q.ID)
+	}
+}
+
+func TestUndo_StatusWithChecks(t *testing.T) {
+	db := setupTestDB(t)
+	alice := db.WithActor("alice")
+	finished := createTestItem(t, db, "Finished")
+	started := createTestItem(t, db, "Started")
+
+	if err := db.CompleteItem(finished.ID, false); err != nil {
+		t.Fatalf("failed to complete: %v", err)
+	}
+	if err := db.AddCriterion(finished.ID, "Tests pass", ""); err != nil {
+		t.Fatalf("failed to add criterion: %v", err)
+	}
+	if err := alice.UpdateStatus(finished.ID, model.StatusOpen); err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+
+	// Undoing the reopen would skip the unchecked criterion
+	if _, err := alice.Undo("alice", 1); !errors.Is(err, ErrUndoConflict) {
+		t.Fatalf("err = %v, want ErrUndoConflict", err)
+	}
+	if got, _ := db.GetItem(finished.ID); got.Status != model.StatusOpen {
+		t.Errorf("status = %s, want open", got.Status)
+	}
+
+	// Undoing a block would leave the task in progress without a lease
+	if err := db.UpdateStatus(started.ID, model.StatusInProgress); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	if err := alice.UpdateStatus(started.ID, model.StatusBlocked); err != nil {
+		t.Fatalf("failed to block: %v", err)
+	}
+	if _, err := alice.Undo("alice", 1); !errors.Is(err, ErrUndoConflict) {
+		t.Fatalf("err = %v, want ErrUndoConflict", err)
+	}
+	if got, _ := db.GetItem(started.ID); got.Status != model.StatusBlocked {
+		t.Errorf("status = %s, want blocked", got.Status)
+	}
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// RecordVerification saves the result of running a criterion's command and
+// marks the criterion to match: checked with the run as its note if the
+// command passed, unchecked if it failed. The criterion is found by
+// v.Criterion, its text. v.RanBy is set to the DB's actor.
+func (db *DB) RecordVerification(v *model.Verification) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM items WHERE id = ? AND deleted_at IS NULL`, v.ItemID).Scan(&n); err != nil {
+		return fmt.Errorf("failed to get item: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("item %w: %s (use 'prog list' to see available items)", ErrNotFound, v.ItemID)
+	}
+
+	var position int
+	var was bool
+	err = tx.QueryRow(`SELECT position, checked FROM dod_criteria WHERE item_id = ? AND text = ?`, v.ItemID, v.Criterion).Scan(&position, &was)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("criterion %w: %s has no criterion %q (use 'prog dod %s' to see its criteria)", ErrNotFound, v.ItemID, v.Criterion, v.ItemID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get criterion: %w", err)
+	}
+
+	v.RanBy = db.actor
+	if v.RanAt.IsZero() {
+		v.RanAt = time.Now()
+	}
+	result, err := tx.Exec(`
+		INSERT INTO verifications (item_id, criterion, command, dir, exit_code, duration_ms, output, ran_by, ran_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		v.ItemID, v.Criterion, v.Command, v.Dir, v.ExitCode, v.DurationMS, v.Output, v.RanBy, v.RanAt)
+	if err != nil {
+		return fmt.Errorf("failed to record verification: %w", err)
+	}
+	v.ID, _ = result.LastInsertId()
+
+	note := ""
+	if v.Passed() {
+		note = v.Note()
+	}
+	if err := applyCheck(tx, v.ItemID, position, v.Criterion, was, v.Passed(), note, db.actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// latestVerifications returns the most recent verification of each of an
+// item's criteria, by criterion text.
+func latestVerifications(q querier, itemID string) (map[string]*model.Verification, error) {
+	rows, err := q.Query(`
+		SELECT id, item_id, criterion, command, dir, exit_code, duration_ms, output, ran_by, ran_at
+		FROM verifications
+		WHERE id IN (SELECT MAX(id) FROM verifications WHERE item_id = ?1 GROUP BY criterion)`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verifications: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	latest := make(map[string]*model.Verification)
+	for rows.Next() {
+		var v model.Verification
+		if err := rows.Scan(&v.ID, &v.ItemID, &v.Criterion, &v.Command, &v.Dir, &v.ExitCode, &v.DurationMS, &v.Output, &v.RanBy, &v.RanAt); err != nil {
+			return nil, fmt.Errorf("failed to scan verification: %w", err)
+		}
+		latest[v.Criterion] = &v
+	}
+	return latest, rows.Err()
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func TestRecordVerification(t *testing.T) {
+	db := setupTestDB(t).WithActor("alice")
+	task := createTestItem(t, db, "Task")
+	setDoD(t, db, task.ID, "Docs updated")
+	if err := db.AddCriterion(task.ID, "Tests pass", "go test ./..."); err != nil {
+		t.Fatalf("failed to add criterion: %v", err)
+	}
+
+	pass := &model.Verification{ItemID: task.ID, Criterion: "Tests pass", Command: "go test ./...", DurationMS: 1200, Output: "ok\n"}
+	if err := db.RecordVerification(pass); err != nil {
+		t.Fatalf("failed to record verification: %v", err)
+	}
+	if pass.ID == 0 || pass.RanBy != "alice" {
+		t.Errorf("recorded verification = %+v", pass)
+	}
+	assertEvents(t, criteriaSummary(t, db, task.ID), []string{
+		"[ ] Docs updated",
+		"[x] Tests pass $ go test ./... (verified: `go test ./...` passed in 1.2s by alice)",
+	})
+
+	// A later failure unchecks it, and is what show displays
+	fail := &model.Verification{ItemID: task.ID, Criterion: "Tests pass", Command: "go test ./...", ExitCode: 1, Output: "FAIL\n"}
+	if err := db.RecordVerification(fail); err != nil {
+		t.Fatalf("failed to record verification: %v", err)
+	}
+	criteria, _ := db.GetCriteria(task.ID)
+	if c := criteria[1]; c.Checked || c.Verification == nil || c.Verification.ID != fail.ID {
+		t.Errorf("after failing run: %+v", c)
+	}
+	if criteria[0].Verification != nil {
+		t.Errorf("criterion without a command has a verification: %+v", criteria[0].Verification)
+	}
+
+	// The run follows its criterion when it is renumbered, but not a new command
+	if err := db.RemoveCriterion(task.ID, 1); err != nil {
+		t.Fatalf("failed to remove criterion: %v", err)
+	}
+	criteria, _ = db.GetCriteria(task.ID)
+	if criteria[0].Verification == nil || criteria[0].Verification.ExitCode != 1 {
+		t.Errorf("verification lost on renumbering: %+v", criteria[0])
+	}
+	if _, err := db.Exec(`UPDATE dod_criteria SET command = 'make test' WHERE item_id = ?`, task.ID); err != nil {
+		t.Fatalf("failed to change command: %v", err)
+	}
+	criteria, _ = db.GetCriteria(task.ID)
+	if criteria[0].Verification != nil {
+		t.Errorf("verification of an old command shown: %+v", criteria[0].Verification)
+	}
+
+	missing := &model.Verification{ItemID: task.ID, Criterion: "Nope", Command: "true"}
+	if err := db.RecordVerification(missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing criterion, got %v", err)
+	}
+}
@@ -0,0 +1,332 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// DefaultWebhookEvents are the transitions a webhook is sent for when none
+// are given: work ready for review, finished, or stuck.
+var DefaultWebhookEvents = []string{string(model.StatusReviewing), string(model.StatusDone), string(model.StatusBlocked)}
+
+// WebhookPayload is the JSON body POSTed for a delivery.
+type WebhookPayload struct {
+	Event      string     `json:"event"` // The status the item moved to
+	Transition Transition `json:"transition"`
+	Item       model.Item `json:"item"` // The item just after the transition
+	Actor      string     `json:"actor"`
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+// Transition is the status change that triggered a delivery.
+type Transition struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// CreateWebhook subscribes w.URL to status transitions in w.Project. Events
+// defaults to DefaultWebhookEvents and a random secret is generated if none
+// is given.
+func (db *DB) CreateWebhook(w *model.Webhook) error {
+	if w.Project == "" {
+		return fmt.Errorf("project is required")
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: must be an absolute http or https URL", w.URL)
+	}
+	if len(w.Events) == 0 {
+		w.Events = DefaultWebhookEvents
+	}
+	for _, e := range w.Events {
+		if !model.Status(e).IsValid() {
+			return fmt.Errorf("invalid webhook event %q: must be a status such as reviewing, done or blocked", e)
+		}
+	}
+	if w.Secret == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("failed to generate secret: %w", err)
+		}
+		w.Secret = hex.EncodeToString(b)
+	}
+	if w.ID == "" {
+		w.ID = model.GenerateWebhookID()
+	}
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now()
+	}
+	if w.CreatedBy == "" {
+		w.CreatedBy = db.actor
+	}
+
+	events, err := json.Marshal(w.Events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO webhooks (id, project, url, secret, events, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		w.ID, w.Project, w.URL, w.Secret, string(events), w.CreatedBy, w.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// ListWebhooks returns a project's webhooks, or every webhook if project is
+// empty, with their pending and failed delivery counts.
+func (db *DB) ListWebhooks(project string) ([]model.Webhook, error) {
+	rows, err := db.Query(`
+		SELECT w.id, w.project, w.url, w.secret, w.events, w.created_by, w.created_at,
+			(SELECT COUNT(*) FROM webhook_deliveries d WHERE d.webhook_id = w.id AND d.state = 'pending'),
+			(SELECT COUNT(*) FROM webhook_deliveries d WHERE d.webhook_id = w.id AND d.state = 'failed')
+		FROM webhooks w
+		WHERE ? = '' OR w.project = ?
+		ORDER BY w.project, w.created_at`, project, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		var w model.Webhook
+		var events string
+		if err := rows.Scan(&w.ID, &w.Project, &w.URL, &w.Secret, &events, &w.CreatedBy, &w.CreatedAt, &w.Pending, &w.Failed); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		if err := json.Unmarshal([]byte(events), &w.Events); err != nil {
+			return nil, fmt.Errorf("failed to parse events for webhook %s: %w", w.ID, err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook along with its queued deliveries.
+func (db *DB) DeleteWebhook(id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete deliveries: %w", err)
+	}
+	result, err := tx.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("webhook %w: %s (use 'prog webhooks' to see available webhooks)", ErrNotFound, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// queueWebhooks adds a delivery to the outbox for each webhook subscribed to
+// the status an item moved to. It runs in the transaction that changed the
+// status, so a committed transition always has its deliveries queued.
+func queueWebhooks(q querier, e model.Event) error {
+	rows, err := q.Query(`
+		SELECT w.id, w.events FROM webhooks w
+		JOIN items i ON i.project = w.project
+		WHERE i.id = ?`, e.ItemID)
+	if err != nil {
+		return fmt.Errorf("failed to find webhooks: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id, events string
+		if err := rows.Scan(&id, &events); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		var subscribed []string
+		if err := json.Unmarshal([]byte(events), &subscribed); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to parse events for webhook %s: %w", id, err)
+		}
+		if slices.Contains(subscribed, e.NewValue) {
+			ids = append(ids, id)
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find webhooks: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	item, err := getItem(q, e.ItemID)
+	if errors.Is(err, ErrInTrash) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if item.Labels, err = itemLabelNames(q, item.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(WebhookPayload{
+		Event:      e.NewValue,
+		Transition: Transition{From: e.OldValue, To: e.NewValue},
+		Item:       *item,
+		Actor:      e.Actor,
+		Timestamp:  now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	for _, id := range ids {
+		_, err := q.Exec(`
+			INSERT INTO webhook_deliveries (webhook_id, event, item_id, payload, next_attempt, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			id, e.NewValue, e.ItemID, string(payload), now.UnixMilli(), now)
+		if err != nil {
+			return fmt.Errorf("failed to queue webhook: %w", err)
+		}
+	}
+	return nil
+}
+
+func itemLabelNames(q querier, itemID string) ([]string, error) {
+	rows, err := q.Query(`
+		SELECT l.name FROM labels l
+		JOIN item_labels il ON il.label_id = l.id
+		WHERE il.item_id = ? ORDER BY l.name`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item labels: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	names := []string{} // Encodes as [] rather than null in payloads
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan label: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// ClaimDeliveries claims up to limit pending deliveries whose next attempt is
+// at or before now, and returns them in the order they were queued with their
+// webhook's URL and secret. Claiming pushes their next attempt out to until
+// in the statement that selects them, so dispatchers running at the same time
+// in other processes don't send them too. If this one dies before marking
+// them, they come due again at until.
+func (db *DB) ClaimDeliveries(now, until time.Time, limit int) ([]model.Delivery, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	claimed, err := tx.Query(`
+		UPDATE webhook_deliveries SET next_attempt = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE state = 'pending' AND next_attempt <= ?
+			ORDER BY next_attempt, id
+			LIMIT ?)
+		RETURNING id`, until.UnixMilli(), now.UnixMilli(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	var ids []any
+	for claimed.Next() {
+		var id int64
+		if err := claimed.Scan(&id); err != nil {
+			_ = claimed.Close()
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	_ = claimed.Close()
+	if err := claimed.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT d.id, d.webhook_id, w.url, w.secret, d.event, d.item_id, d.payload,
+			d.state, d.attempts, d.next_attempt, d.last_error, d.created_at
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY d.id`, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get claimed deliveries: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var deliveries []model.Delivery
+	for rows.Next() {
+		var d model.Delivery
+		var payload string
+		var next int64
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.Event, &d.ItemID, &payload,
+			&d.State, &d.Attempts, &next, &d.LastError, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		d.Payload = []byte(payload)
+		d.NextAttempt = time.UnixMilli(next)
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get claimed deliveries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deliveries, nil
+}
+
+// MarkDelivered records a successful delivery.
+func (db *DB) MarkDelivered(id int64) error {
+	_, err := db.Exec(`
+		UPDATE webhook_deliveries SET state = 'delivered', attempts = attempts + 1, last_error = ''
+		WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery: %w", err)
+	}
+	return nil
+}
+
+// MarkDeliveryFailed records a failed attempt. The delivery is retried at
+// next, or given up on if next is zero.
+func (db *DB) MarkDeliveryFailed(id int64, reason string, next time.Time) error {
+	state, nextMillis := model.DeliveryPending, next.UnixMilli()
+	if next.IsZero() {
+		state, nextMillis = model.DeliveryFailed, 0
+	}
+	_, err := db.Exec(`
+		UPDATE webhook_deliveries SET state = ?, attempts = attempts + 1, next_attempt = ?, last_error = ?
+		WHERE id = ?`, state, nextMillis, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery: %w", err)
+	}
+	return nil
+}
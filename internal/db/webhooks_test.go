@@ -0,0 +1,121 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func mustCreateWebhook(t *testing.T, db *DB, project string, events ...string) *model.Webhook {
+	t.Helper()
+	w := &model.Webhook{Project: project, URL: "http://127.0.0.1:9/hook", Events: events}
+	if err := db.CreateWebhook(w); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	return w
+}
+
+func TestCreateWebhook_Validates(t *testing.T) {
+	db := setupTestDB(t)
+
+	w := mustCreateWebhook(t, db, "test")
+	if w.Secret == "" || len(w.Events) != len(DefaultWebhookEvents) {
+		t.Errorf("webhook = %+v, want a generated secret and the default events", w)
+	}
+
+	bad := []*model.Webhook{
+		{Project: "test", URL: "ftp://example.com"},
+		{Project: "test", URL: "/relative"},
+		{Project: "test", URL: "http://example.com", Events: []string{"finished"}},
+		{URL: "http://example.com"},
+	}
+	for _, w := range bad {
+		if err := db.CreateWebhook(w); err == nil {
+			t.Errorf("CreateWebhook(%+v) succeeded, want an error", w)
+		}
+	}
+}
+
+func TestQueueWebhooks_OnMatchingTransitions(t *testing.T) {
+	db := setupTestDB(t).WithActor("alice")
+	done := mustCreateWebhook(t, db, "test", "done")
+	mustCreateWebhook(t, db, "other", "done")
+	task := createTestItem(t, db, "Task")
+	if err := db.AddLabelToItem(task.ID, "test", "bug"); err != nil {
+		t.Fatalf("failed to add label: %v", err)
+	}
+
+	for _, s := range []model.Status{model.StatusInProgress, model.StatusDone} {
+		if err := db.UpdateStatus(task.ID, s); err != nil {
+			t.Fatalf("failed to update status: %v", err)
+		}
+	}
+
+	due, err := db.ClaimDeliveries(time.Now(), time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Fatalf("failed to get deliveries: %v", err)
+	}
+	if len(due) != 1 || due[0].WebhookID != done.ID || due[0].Secret != done.Secret {
+		t.Fatalf("due = %+v, want one delivery for the done webhook", due)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(due[0].Payload, &payload); err != nil {
+		t.Fatalf("bad payload: %v", err)
+	}
+	if payload.Event != "done" || payload.Transition.From != "in_progress" || payload.Actor != "alice" ||
+		payload.Item.ID != task.ID || payload.Item.Status != model.StatusDone || len(payload.Item.Labels) != 1 {
+		t.Errorf("payload = %+v, want alice's in_progress -> done with the labeled item", payload)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	db := setupTestDB(t)
+	w := mustCreateWebhook(t, db, "test")
+	task := createTestItem(t, db, "Task")
+	if err := db.UpdateStatus(task.ID, model.StatusDone); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	due, _ := db.ClaimDeliveries(time.Now(), time.Now().Add(time.Minute), 10)
+	if len(due) != 1 {
+		t.Fatalf("due = %d, want 1", len(due))
+	}
+	// Claimed deliveries aren't handed out again until the claim lapses
+	if again, _ := db.ClaimDeliveries(time.Now(), time.Now().Add(time.Minute), 10); len(again) != 0 {
+		t.Errorf("claimed twice: %+v", again)
+	}
+
+	// A retry isn't due until its next attempt
+	next := time.Now().Add(time.Minute)
+	if err := db.MarkDeliveryFailed(due[0].ID, "503", next); err != nil {
+		t.Fatalf("failed to mark delivery: %v", err)
+	}
+	if due, _ := db.ClaimDeliveries(time.Now(), time.Now().Add(time.Minute), 10); len(due) != 0 {
+		t.Errorf("due before retry = %d, want 0", len(due))
+	}
+	due, _ = db.ClaimDeliveries(next, next.Add(time.Minute), 10)
+	if len(due) != 1 || due[0].Attempts != 1 || due[0].LastError != "503" {
+		t.Fatalf("due at retry = %+v, want the delivery after one attempt", due)
+	}
+
+	// Giving up leaves it in the outbox as failed
+	if err := db.MarkDeliveryFailed(due[0].ID, "503", time.Time{}); err != nil {
+		t.Fatalf("failed to mark delivery: %v", err)
+	}
+	webhooks, err := db.ListWebhooks("test")
+	if err != nil {
+		t.Fatalf("failed to list webhooks: %v", err)
+	}
+	if len(webhooks) != 1 || webhooks[0].Pending != 0 || webhooks[0].Failed != 1 {
+		t.Errorf("webhooks = %+v, want one with a failed delivery", webhooks)
+	}
+
+	if err := db.DeleteWebhook(w.ID); err != nil {
+		t.Fatalf("failed to delete webhook: %v", err)
+	}
+	if err := db.DeleteWebhook(w.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete = %v, want ErrNotFound", err)
+	}
+}
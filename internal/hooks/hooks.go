@@ -0,0 +1,191 @@
+// Package hooks runs local lifecycle hooks: executables, like git hooks, that
+// prog runs around status transitions and new learnings.
+//
+// A hook is named for when it runs: pre-<event> before the change, where a
+// non-zero exit rejects it, and post-<event> after it is committed. Item
+// events are named for the status the item moves to (start, review, done,
+// block, cancel, open, draft) and learn is for new learnings, so pre-done can
+// run a test suite before an agent marks a task done.
+//
+// Hooks live in a hooks directory, ~/.prog/hooks by default. A hook in the
+// directory's <project> subdirectory takes precedence over one of the same
+// name at the top level. Each hook receives the item or learning as JSON on
+// stdin, and the details of the change in PROG_* environment variables.
+//
+// A hook that runs longer than its timeout is killed: a pre- hook that times
+// out rejects the change. The timeout is DefaultTimeout unless a file next to
+// the hook, named for it with a .timeout suffix, holds another, e.g. "20m" in
+// pre-done.timeout for a slow test suite.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+)
+
+// Names lists every hook prog runs, in lifecycle order.
+var Names = []string{
+	"pre-start", "post-start",
+	"pre-review", "post-review",
+	"pre-done", "post-done",
+	"pre-block", "post-block",
+	"pre-cancel", "post-cancel",
+	"pre-open", "post-open",
+	"pre-draft", "post-draft",
+	"pre-learn", "post-learn",
+}
+
+// DefaultTimeout is how long a hook may run before it is killed, unless it
+// has a .timeout file.
+const DefaultTimeout = 5 * time.Minute
+
+// waitDelay bounds how long a killed hook's children may hold its output open.
+const waitDelay = 5 * time.Second
+
+// Config controls where hooks are found and where their output goes.
+type Config struct {
+	Dir     string        // Hooks directory
+	Output  io.Writer     // Receives hook stdout and stderr (default os.Stderr)
+	Timeout time.Duration // For hooks without a .timeout file (default DefaultTimeout)
+}
+
+// Runner runs hooks from a hooks directory. It implements db.Hooks.
+type Runner struct {
+	cfg Config
+}
+
+// New creates a runner for the hooks in cfg.Dir.
+func New(cfg Config) *Runner {
+	if cfg.Output == nil {
+		cfg.Output = os.Stderr
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &Runner{cfg: cfg}
+}
+
+// Path returns the hook that runs for name in project, or "" if none is
+// installed. Files that aren't executable are ignored, as git does.
+func (r *Runner) Path(name, project string) string {
+	var candidates []string
+	// Project names are free text; only plain names map to a subdirectory
+	if project != "" && project == filepath.Base(project) && project != "." && project != ".." {
+		candidates = append(candidates, filepath.Join(r.cfg.Dir, project, name))
+	}
+	candidates = append(candidates, filepath.Join(r.cfg.Dir, name))
+
+	for _, path := range candidates {
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
+			return path
+		}
+	}
+	return ""
+}
+
+// Timeout returns how long the hook at path may run: the duration in its
+// .timeout file if it has one, or the configured default.
+func (r *Runner) Timeout(path string) (time.Duration, error) {
+	data, err := os.ReadFile(path + ".timeout")
+	if errors.Is(err, os.ErrNotExist) {
+		return r.cfg.Timeout, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read hook timeout: %w", err)
+	}
+	timeout, err := time.ParseDuration(strings.TrimSpace(string(data)))
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout in %s.timeout: %q (want a duration such as 10m)", path, strings.TrimSpace(string(data)))
+	}
+	return timeout, nil
+}
+
+// Run runs the hook for h, if one is installed, and waits for it to exit or
+// time out. The hook's output is copied to the configured writer; a non-zero
+// exit is returned as an error ending with the last line it printed. Post-
+// hooks can't fail the change they follow, so their errors are also written
+// to the output, where they would otherwise go unseen.
+func (r *Runner) Run(h db.Hook) error {
+	path := r.Path(h.Name, h.Project)
+	if path == "" {
+		return nil
+	}
+	err := r.run(path, h)
+	if err != nil && strings.HasPrefix(h.Name, "post-") {
+		_, _ = fmt.Fprintf(r.cfg.Output, "prog: %s hook failed: %v\n", h.Name, err)
+	}
+	return err
+}
+
+func (r *Runner) run(path string, h db.Hook) error {
+	timeout, err := r.Timeout(path)
+	if err != nil {
+		return err
+	}
+
+	input, err := json.Marshal(h.Input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hook input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var tail tailWriter
+	out := io.MultiWriter(r.cfg.Output, &tail)
+	cmd := exec.CommandContext(ctx, path)
+	cmd.WaitDelay = waitDelay
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = append(os.Environ(),
+		"PROG_HOOK="+h.Name,
+		"PROG_PROJECT="+h.Project,
+		"PROG_ACTOR="+h.Actor,
+		"PROG_ITEM="+h.ItemID,
+		"PROG_FROM="+h.From,
+		"PROG_TO="+h.To,
+	)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		if line := tail.lastLine(); line != "" {
+			return fmt.Errorf("%w: %s", err, line)
+		}
+		return err
+	}
+	return nil
+}
+
+// tailWriter keeps the end of a hook's output for error messages.
+type tailWriter struct {
+	buf []byte
+}
+
+const tailSize = 1024
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > tailSize {
+		w.buf = w.buf[len(w.buf)-tailSize:]
+	}
+	return len(p), nil
+}
+
+func (w *tailWriter) lastLine() string {
+	out := strings.TrimSpace(string(w.buf))
+	return out[strings.LastIndex(out, "\n")+1:]
+}
@@ -0,0 +1,117 @@
+package hooks
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+func writeHook(t *testing.T, path, script string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create hook dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), mode); err != nil {
+		t.Fatalf("failed to write hook: %v", err)
+	}
+}
+
+func TestPath(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, filepath.Join(dir, "pre-done"), "exit 0\n", 0755)
+	writeHook(t, filepath.Join(dir, "demo", "pre-done"), "exit 0\n", 0755)
+	writeHook(t, filepath.Join(dir, "post-done"), "exit 0\n", 0644)
+	r := New(Config{Dir: dir})
+
+	tests := []struct {
+		name, project, want string
+	}{
+		{"pre-done", "demo", filepath.Join(dir, "demo", "pre-done")},
+		{"pre-done", "other", filepath.Join(dir, "pre-done")},
+		{"pre-done", "../demo", filepath.Join(dir, "pre-done")},
+		{"post-done", "demo", ""}, // Not executable
+		{"pre-start", "demo", ""},
+	}
+	for _, tt := range tests {
+		if got := r.Path(tt.name, tt.project); got != tt.want {
+			t.Errorf("Path(%q, %q) = %q, want %q", tt.name, tt.project, got, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, filepath.Join(dir, "post-start"), `echo "$PROG_HOOK $PROG_FROM>$PROG_TO $PROG_ITEM by $PROG_ACTOR"; cat`+"\n", 0755)
+	writeHook(t, filepath.Join(dir, "pre-done"), "echo running tests\necho 'FAIL: TestLogin' >&2\nexit 1\n", 0755)
+	var out bytes.Buffer
+	r := New(Config{Dir: dir, Output: &out})
+
+	item := &model.Item{ID: "ts-a1b2c3", Project: "demo", Title: "Fix login"}
+	err := r.Run(db.Hook{Name: "post-start", Project: "demo", Actor: "alice", ItemID: item.ID, From: "open", To: "in_progress", Input: item})
+	if err != nil {
+		t.Fatalf("post-start failed: %v", err)
+	}
+	got := out.String()
+	if !strings.HasPrefix(got, "post-start open>in_progress ts-a1b2c3 by alice\n") {
+		t.Errorf("hook saw wrong environment: %q", got)
+	}
+	if !strings.Contains(got, `"title":"Fix login"`) {
+		t.Errorf("hook did not receive the item as JSON: %q", got)
+	}
+
+	err = r.Run(db.Hook{Name: "pre-done", Project: "demo", Input: item})
+	if err == nil || !strings.HasSuffix(err.Error(), "exit status 1: FAIL: TestLogin") {
+		t.Errorf("pre-done error = %v, want exit status with last output line", err)
+	}
+
+	if err := r.Run(db.Hook{Name: "pre-cancel", Project: "demo", Input: item}); err != nil {
+		t.Errorf("missing hook should be a no-op, got %v", err)
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, filepath.Join(dir, "pre-done"), "exec sleep 10\n", 0755)
+	writeHook(t, filepath.Join(dir, "post-done"), "exec sleep 10\n", 0755)
+	writeHook(t, filepath.Join(dir, "pre-start"), "sleep 0.2\n", 0755)
+	if err := os.WriteFile(filepath.Join(dir, "pre-start.timeout"), []byte("10s\n"), 0644); err != nil {
+		t.Fatalf("failed to write timeout: %v", err)
+	}
+	var out bytes.Buffer
+	r := New(Config{Dir: dir, Output: &out, Timeout: 100 * time.Millisecond})
+	item := &model.Item{ID: "ts-a1b2c3", Project: "demo"}
+
+	start := time.Now()
+	err := r.Run(db.Hook{Name: "pre-done", Project: "demo", Input: item})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("pre-done error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hook ran for %s after its timeout", elapsed)
+	}
+
+	// Post- hooks can't reject anything, so their failures are reported
+	if err := r.Run(db.Hook{Name: "post-done", Project: "demo", Input: item}); err == nil {
+		t.Error("post-done should have timed out")
+	}
+	if !strings.Contains(out.String(), "post-done hook failed: timed out") {
+		t.Errorf("output = %q, want the post-done timeout reported", out.String())
+	}
+
+	// A .timeout file overrides the default
+	if err := r.Run(db.Hook{Name: "pre-start", Project: "demo", Input: item}); err != nil {
+		t.Errorf("pre-start with a longer timeout failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pre-start.timeout"), []byte("soon"), 0644); err != nil {
+		t.Fatalf("failed to write timeout: %v", err)
+	}
+	if err := r.Run(db.Hook{Name: "pre-start", Project: "demo", Input: item}); err == nil || !strings.Contains(err.Error(), "invalid timeout") {
+		t.Errorf("pre-start with a bad timeout file = %v, want an error", err)
+	}
+}
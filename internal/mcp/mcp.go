@@ -0,0 +1,202 @@
+// Package mcp serves prog to agents over the Model Context Protocol.
+//
+// The server speaks JSON-RPC 2.0 over newline-delimited stdio, as MCP clients
+// expect when they launch 'prog mcp' as a subprocess. It exposes prog's work
+// loop as tools (ready, show, start, log, check, done, learn, context) and each
+// project's status report as a resource. Results use the same JSON
+// representations as the HTTP API in internal/server.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+)
+
+// ProtocolVersion is the newest MCP revision the server implements. Clients
+// asking for an older supported revision get that one back.
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions lists the MCP revisions the server can speak, newest first.
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// maxMessageSize bounds a single JSON-RPC line; learnings can carry long details.
+const maxMessageSize = 4 * 1024 * 1024
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// Config controls server behavior.
+type Config struct {
+	Project string // Default project for tools and resources that take one
+	Version string // Reported to clients as the server version
+}
+
+// Server answers MCP requests against a prog database.
+type Server struct {
+	db  *db.DB
+	cfg Config
+}
+
+// New creates a server backed by database.
+func New(database *db.DB, cfg Config) *Server {
+	if cfg.Version == "" {
+		cfg.Version = "dev"
+	}
+	return &Server{db: database, cfg: cfg}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+func errorf(code int, format string, args ...any) *rpcError {
+	return &rpcError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Serve reads requests from r and writes responses to w until r is exhausted
+// or ctx is canceled. Requests are handled one at a time, in order.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		resp, ok := s.handleLine(line)
+		if !ok {
+			continue
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// handleLine handles one JSON-RPC message. ok is false for notifications,
+// which get no response.
+func (s *Server) handleLine(line []byte) (resp response, ok bool) {
+	resp = response{JSONRPC: "2.0", ID: json.RawMessage("null")}
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		resp.Error = errorf(codeParseError, "invalid JSON: %v", err)
+		return resp, true
+	}
+	if len(req.ID) == 0 {
+		// Notifications such as notifications/initialized need no reply
+		return resp, false
+	}
+	resp.ID = req.ID
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = errorf(codeInvalidRequest, "expected a JSON-RPC 2.0 request")
+		return resp, true
+	}
+
+	result, err := s.Handle(req.Method, req.Params)
+	if err != nil {
+		rerr, isRPC := err.(*rpcError)
+		if !isRPC {
+			rerr = errorf(codeInternalError, "%v", err)
+		}
+		resp.Error = rerr
+		return resp, true
+	}
+	resp.Result = result
+	return resp, true
+}
+
+// Handle dispatches one request by method name and returns its result.
+func (s *Server) Handle(method string, params json.RawMessage) (any, error) {
+	// Return tasks whose claim lapsed to open, as every CLI command does
+	if _, err := s.db.ExpireLeases(time.Now()); err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case "initialize":
+		return s.initialize(params)
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		return s.callTool(params)
+	case "resources/list":
+		return s.listResources()
+	case "resources/templates/list":
+		return map[string]any{"resourceTemplates": []resourceTemplate{statusTemplate}}, nil
+	case "resources/read":
+		return s.readResource(params)
+	}
+	return nil, errorf(codeMethodNotFound, "method not found: %s", method)
+}
+
+func (s *Server) initialize(params json.RawMessage) (any, error) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, errorf(codeInvalidParams, "invalid params: %v", err)
+		}
+	}
+	version := ProtocolVersion
+	if slices.Contains(supportedVersions, p.ProtocolVersion) {
+		version = p.ProtocolVersion
+	}
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities": map[string]any{
+			"tools":     map[string]any{},
+			"resources": map[string]any{},
+		},
+		"serverInfo": map[string]any{
+			"name":    "prog",
+			"version": s.cfg.Version,
+		},
+		"instructions": instructions,
+	}, nil
+}
+
+// instructions tell the agent how the tools fit together.
+const instructions = `prog tracks tasks, epics and learnings across agent sessions.
+
+Typical loop: read the project's status resource (or call ready) to pick a
+task, call context for learnings on its concepts, start it, log progress as
+you go, and call done when its definition of done is met. Before finishing,
+record anything the next agent should know with learn.`
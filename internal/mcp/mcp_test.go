@@ -0,0 +1,239 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+	"github.com/baiirun/prog/internal/server"
+)
+
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if err := database.Init(); err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	return database.WithActor("agent")
+}
+
+func createTestItem(t *testing.T, database *db.DB, title string) *model.Item {
+	t.Helper()
+	now := time.Now()
+	item := &model.Item{
+		ID:        model.GenerateID(model.ItemTypeTask),
+		Project:   "demo",
+		Type:      model.ItemTypeTask,
+		Title:     title,
+		Status:    model.StatusOpen,
+		Priority:  2,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := database.CreateItem(item); err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	return item
+}
+
+// session sends each request through Serve and returns the responses by ID.
+func session(t *testing.T, srv *Server, requests ...string) map[string]response {
+	t.Helper()
+	var out bytes.Buffer
+	if err := srv.Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	responses := make(map[string]response)
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var resp struct {
+			response
+			Result json.RawMessage `json:"result"`
+		}
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		resp.response.Result = resp.Result
+		responses[string(resp.ID)] = resp.response
+	}
+	return responses
+}
+
+func result(t *testing.T, resp response, v any) {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	if err := json.Unmarshal(resp.Result.(json.RawMessage), v); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	srv := New(setupTestDB(t), Config{Project: "demo", Version: "1.2.3"})
+	responses := session(t, srv,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"bogus"}`,
+		`not json`,
+	)
+	if len(responses) != 4 {
+		t.Fatalf("got %d responses, want 4 (none for the notification)", len(responses))
+	}
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	result(t, responses["1"], &init)
+	if init.ProtocolVersion != "2025-03-26" || init.ServerInfo.Version != "1.2.3" {
+		t.Errorf("initialize = %+v, want the client's version and 1.2.3", init)
+	}
+
+	var list struct {
+		Tools []tool `json:"tools"`
+	}
+	result(t, responses["2"], &list)
+	if len(list.Tools) != len(toolHandlers) {
+		t.Errorf("listed %d tools, want %d", len(list.Tools), len(toolHandlers))
+	}
+	for _, tl := range list.Tools {
+		if _, ok := toolHandlers[tl.Name]; !ok || tl.InputSchema["type"] != "object" {
+			t.Errorf("tool %s: missing handler or object schema", tl.Name)
+		}
+	}
+
+	if e := responses["3"].Error; e == nil || e.Code != codeMethodNotFound {
+		t.Errorf("bogus method error = %+v, want method not found", e)
+	}
+	if e := responses["null"].Error; e == nil || e.Code != codeParseError {
+		t.Errorf("bad JSON error = %+v, want parse error", e)
+	}
+}
+
+func TestTools_WorkLoop(t *testing.T) {
+	database := setupTestDB(t)
+	task := createTestItem(t, database, "Fix the parser")
+	srv := New(database, Config{Project: "demo"})
+
+	call := func(name string, args any) toolResult {
+		t.Helper()
+		params, _ := json.Marshal(map[string]any{"name": name, "arguments": args})
+		out, err := srv.Handle("tools/call", params)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return out.(toolResult)
+	}
+
+	ready := call("ready", map[string]any{})
+	if tasks := ready.StructuredContent.(map[string]any)["tasks"].([]server.ItemJSON); len(tasks) != 1 || tasks[0].ID != task.ID {
+		t.Errorf("ready = %+v, want the task", tasks)
+	}
+
+	started := call("start", map[string]any{"id": task.ID})
+	if d := started.StructuredContent.(*server.ItemDetailJSON); d.Status != "in_progress" || d.Assignee != "agent" {
+		t.Errorf("started = %s/%s, want in_progress by agent", d.Status, d.Assignee)
+	}
+	if lease, _ := database.GetLease(task.ID); lease == nil || lease.Actor != "agent" {
+		t.Errorf("lease = %+v, want one held by agent", lease)
+	}
+	// Another agent can't start it too
+	other := New(database.WithActor("other"), Config{Project: "demo"})
+	params, _ := json.Marshal(map[string]any{"name": "start", "arguments": map[string]any{"id": task.ID}})
+	if out, err := other.Handle("tools/call", params); err != nil || !out.(toolResult).IsError {
+		t.Errorf("second start = %+v, %v, want an error result", out, err)
+	}
+	call("log", map[string]any{"id": task.ID, "message": "Found the bug"})
+
+	learned := call("learn", map[string]any{"summary": "Parser needs lookahead", "concepts": []string{"parser"}})
+	if l := learned.StructuredContent.(server.LearningJSON); l.TaskID == nil || *l.TaskID != task.ID {
+		t.Errorf("learning task = %v, want %s", l.TaskID, task.ID)
+	}
+
+	ctx := call("context", map[string]any{"concepts": []string{"parser"}})
+	if ls := ctx.StructuredContent.(map[string]any)["learnings"].([]server.LearningJSON); len(ls) != 1 {
+		t.Errorf("context = %+v, want the learning", ls)
+	}
+
+	// The definition of done gates completion until each criterion is checked
+	dod := "Parser tests pass"
+	if err := database.SetDefinitionOfDone(task.ID, &dod); err != nil {
+		t.Fatalf("failed to set definition of done: %v", err)
+	}
+	if res := call("done", map[string]any{"id": task.ID}); !res.IsError {
+		t.Errorf("done with an unchecked criterion = %+v, want an error result", res)
+	}
+	checked := call("check", map[string]any{"id": task.ID, "criterion": 1, "note": "go test ./parser passes"})
+	if c := checked.StructuredContent.(*server.ItemDetailJSON).Criteria; len(c) != 1 || !c[0].Checked || c[0].CheckedBy != "agent" {
+		t.Errorf("criteria after check = %+v, want checked by agent", c)
+	}
+
+	done := call("done", map[string]any{"id": task.ID})
+	d := done.StructuredContent.(*server.ItemDetailJSON)
+	if d.Status != "done" || len(d.Logs) != 1 || len(done.Content) != 2 {
+		t.Errorf("done = %s with %d logs and %d contents, want done, 1 log and a reflect prompt", d.Status, len(d.Logs), len(done.Content))
+	}
+
+	// Tool failures are results the agent can read, not protocol errors
+	for _, args := range []map[string]any{{"id": "ts-000000"}, {}, {"id": task.ID, "extra": true}} {
+		if res := call("show", args); !res.IsError || res.Content[0].Text == "" {
+			t.Errorf("show %v = %+v, want an error result", args, res)
+		}
+	}
+	if _, err := srv.Handle("tools/call", json.RawMessage(`{"name":"bogus"}`)); err == nil {
+		t.Error("unknown tool succeeded, want an error")
+	}
+}
+
+func TestResources(t *testing.T) {
+	database := setupTestDB(t)
+	createTestItem(t, database, "Task")
+	srv := New(database, Config{})
+
+	responses := session(t, srv,
+		`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"prog://status/demo"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"resources/read","params":{"uri":"prog://nope"}}`,
+	)
+
+	var list struct {
+		Resources []resource `json:"resources"`
+	}
+	result(t, responses["1"], &list)
+	if len(list.Resources) != 1 || list.Resources[0].URI != "prog://status/demo" {
+		t.Errorf("resources = %+v, want demo's status", list.Resources)
+	}
+
+	var read struct {
+		Contents []resourceContents `json:"contents"`
+	}
+	result(t, responses["2"], &read)
+	var status server.StatusJSON
+	if len(read.Contents) != 1 {
+		t.Fatalf("contents = %+v, want one", read.Contents)
+	}
+	if err := json.Unmarshal([]byte(read.Contents[0].Text), &status); err != nil {
+		t.Fatalf("status is not JSON: %v", err)
+	}
+	if status.Counts["ready"] != 1 {
+		t.Errorf("counts = %v, want 1 ready", status.Counts)
+	}
+
+	if e := responses["3"].Error; e == nil || e.Code != codeInvalidParams {
+		t.Errorf("unknown resource error = %+v, want invalid params", e)
+	}
+}
@@ -0,0 +1,84 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/baiirun/prog/internal/server"
+)
+
+// statusURIPrefix names a project's status report: prog://status/<project>.
+const statusURIPrefix = "prog://status/"
+
+type resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+type resourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+type resourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+var statusTemplate = resourceTemplate{
+	URITemplate: statusURIPrefix + "{project}",
+	Name:        "status",
+	Description: "Project status report: counts by status, and the ready, in-progress, blocked and recently done tasks",
+	MimeType:    "application/json",
+}
+
+// listResources returns one status resource per project.
+func (s *Server) listResources() (any, error) {
+	projects, err := s.db.ListProjects()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]resource, 0, len(projects))
+	for _, p := range projects {
+		out = append(out, resource{
+			URI:         statusURIPrefix + p,
+			Name:        p + " status",
+			Description: "Status report for " + p,
+			MimeType:    statusTemplate.MimeType,
+		})
+	}
+	return map[string]any{"resources": out}, nil
+}
+
+func (s *Server) readResource(params json.RawMessage) (any, error) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, errorf(codeInvalidParams, "invalid params: %v", err)
+	}
+	project, ok := strings.CutPrefix(p.URI, statusURIPrefix)
+	if !ok || project == "" {
+		return nil, errorf(codeInvalidParams, "unknown resource: %s", p.URI)
+	}
+
+	report, err := s.db.ProjectStatus(project)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(server.NewStatusJSON(report), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal status: %w", err)
+	}
+	return map[string]any{"contents": []resourceContents{{
+		URI:      p.URI,
+		MimeType: statusTemplate.MimeType,
+		Text:     string(b),
+	}}}, nil
+}
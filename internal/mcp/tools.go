@@ -0,0 +1,395 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+	"github.com/baiirun/prog/internal/server"
+)
+
+// tool describes one callable tool. InputSchema is a JSON Schema object.
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// toolResult is the result of tools/call. Tool failures such as an unknown
+// task ID are reported here with IsError set, so the agent can see and
+// correct them, rather than as protocol errors.
+type toolResult struct {
+	Content           []content `json:"content"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+	IsError           bool      `json:"isError,omitempty"`
+}
+
+// errInvalidArgs marks a tool failure caused by the arguments.
+var errInvalidArgs = errors.New("invalid arguments")
+
+func object(required []string, props map[string]any) map[string]any {
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func str(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func strs(description string) map[string]any {
+	return map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": description}
+}
+
+var (
+	idProp      = str("Task ID, e.g. ts-a1b2c3")
+	projectProp = str("Project name (default: the project prog mcp was started with)")
+)
+
+var tools = []tool{
+	{
+		Name:        "ready",
+		Description: "List tasks ready for work: open, unblocked and not drafts, highest priority first.",
+		InputSchema: object(nil, map[string]any{
+			"project": projectProp,
+			"labels":  strs("Only tasks with all of these labels"),
+		}),
+	},
+	{
+		Name:        "show",
+		Description: "Show a task or epic with its description, definition of done, labels, dependencies, logs and lease.",
+		InputSchema: object([]string{"id"}, map[string]any{"id": idProp}),
+	},
+	{
+		Name:        "start",
+		Description: "Claim a ready task and start working on it: set it to in_progress and assign it to you. Fails if the task is not open and unblocked, e.g. another agent got it first. The claim lapses after 30 minutes without a log entry, returning the task to open.",
+		InputSchema: object([]string{"id"}, map[string]any{"id": idProp}),
+	},
+	{
+		Name:        "log",
+		Description: "Add a timestamped progress entry to a task's log, for the next agent and for review.",
+		InputSchema: object([]string{"id", "message"}, map[string]any{
+			"id":      idProp,
+			"message": str("What was done, decided or discovered"),
+		}),
+	},
+	{
+		Name:        "check",
+		Description: "Check off a criterion in a task's definition of done once it is verified, with a note giving the evidence.",
+		InputSchema: object([]string{"id", "criterion", "note"}, map[string]any{
+			"id":        idProp,
+			"criterion": map[string]any{"type": "integer", "minimum": 1, "description": "Criterion number, as listed by show"},
+			"note":      str("How it was verified, e.g. the test command and its result"),
+		}),
+	},
+	{
+		Name:        "done",
+		Description: "Mark a task done. Every criterion in its definition of done must be checked off first, and every assigned reviewer must have approved it. Record learnings first with learn.",
+		InputSchema: object([]string{"id"}, map[string]any{"id": idProp}),
+	},
+	{
+		Name:        "learn",
+		Description: "Record a learning: a gotcha, pattern or decision future agents should know, tagged with concepts. It is linked to the task in progress, if any.",
+		InputSchema: object([]string{"summary", "concepts"}, map[string]any{
+			"project":  projectProp,
+			"summary":  str("One line, at most 120 characters"),
+			"detail":   str("Full explanation with context, examples and caveats"),
+			"concepts": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "minItems": 1, "description": "Concepts to file it under, created if new"},
+			"files":    strs("Files it relates to"),
+		}),
+	},
+	{
+		Name:        "context",
+		Description: "Retrieve learnings by concept, file or search before starting work. With none, returns every active learning.",
+		InputSchema: object(nil, map[string]any{
+			"project":       projectProp,
+			"concepts":      strs("Learnings tagged with any of these concepts"),
+			"files":         strs("Learnings about any of these files: recorded with the file, a directory containing it, or a glob matching it; used when no concepts are given"),
+			"query":         str("Search in plain words, matching other forms and misspellings and concept synonyms too; used when no concepts are given"),
+			"include_stale": map[string]any{"type": "boolean", "description": "Include learnings marked stale"},
+		}),
+	},
+}
+
+// toolHandlers run a tool with its raw arguments and return its structured
+// result, which must be a JSON object.
+var toolHandlers = map[string]func(s *Server, args json.RawMessage) (any, error){
+	"ready":   (*Server).toolReady,
+	"show":    (*Server).toolShow,
+	"start":   (*Server).toolStart,
+	"log":     (*Server).toolLog,
+	"check":   (*Server).toolCheck,
+	"done":    (*Server).toolDone,
+	"learn":   (*Server).toolLearn,
+	"context": (*Server).toolContext,
+}
+
+func (s *Server) callTool(params json.RawMessage) (any, error) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, errorf(codeInvalidParams, "invalid params: %v", err)
+	}
+	handler, ok := toolHandlers[p.Name]
+	if !ok {
+		return nil, errorf(codeInvalidParams, "unknown tool: %s", p.Name)
+	}
+
+	result, err := handler(s, p.Arguments)
+	if err != nil {
+		return toolResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+	out := toolResult{Content: []content{{Type: "text", Text: string(b)}}, StructuredContent: result}
+	if p.Name == "done" {
+		out.Content = append(out.Content, content{Type: "text", Text: reflectPrompt})
+	}
+	return out, nil
+}
+
+// reflectPrompt follows done, as 'prog done' does on the command line.
+const reflectPrompt = "Reflect: what would help the next agent? Record it with the learn tool."
+
+// decodeArgs strictly decodes tool arguments into v.
+func decodeArgs(args json.RawMessage, v any) error {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidArgs, err)
+	}
+	return nil
+}
+
+type idArgs struct {
+	ID string `json:"id"`
+}
+
+func (a idArgs) validate() error {
+	if a.ID == "" {
+		return fmt.Errorf("%w: id is required", errInvalidArgs)
+	}
+	return nil
+}
+
+func (s *Server) project(p string) (string, error) {
+	if p != "" {
+		return p, nil
+	}
+	if s.cfg.Project != "" {
+		return s.cfg.Project, nil
+	}
+	return "", fmt.Errorf("%w: project is required", errInvalidArgs)
+}
+
+func (s *Server) toolReady(args json.RawMessage) (any, error) {
+	var a struct {
+		Project string   `json:"project"`
+		Labels  []string `json:"labels"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	project := a.Project
+	if project == "" {
+		project = s.cfg.Project
+	}
+	items, err := s.db.ReadyItemsFiltered(project, a.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.PopulateItemLabels(items); err != nil {
+		return nil, err
+	}
+	return map[string]any{"tasks": server.NewItemsJSON(items)}, nil
+}
+
+func (s *Server) toolShow(args json.RawMessage) (any, error) {
+	var a idArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	return server.LoadItemDetail(s.db, a.ID)
+}
+
+func (s *Server) toolStart(args json.RawMessage) (any, error) {
+	var a idArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	// Claim rather than set the status, so two agents can't both start it
+	if _, err := s.db.ClaimTask(a.ID, s.db.Actor(), db.DefaultLeaseTTL); errors.Is(err, db.ErrNotClaimable) {
+		return nil, fmt.Errorf("%w\nPick another task with the ready tool", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return server.LoadItemDetail(s.db, a.ID)
+}
+
+func (s *Server) toolCheck(args json.RawMessage) (any, error) {
+	var a struct {
+		ID        string `json:"id"`
+		Criterion int    `json:"criterion"`
+		Note      string `json:"note"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if a.ID == "" || a.Criterion < 1 || a.Note == "" {
+		return nil, fmt.Errorf("%w: id, criterion and note are required", errInvalidArgs)
+	}
+	if err := s.db.CheckCriterion(a.ID, a.Criterion, a.Note); err != nil {
+		return nil, err
+	}
+	return server.LoadItemDetail(s.db, a.ID)
+}
+
+func (s *Server) toolDone(args json.RawMessage) (any, error) {
+	var a idArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.db.CompleteItem(a.ID, false); errors.Is(err, db.ErrDoDIncomplete) {
+		return nil, fmt.Errorf("%w\nVerify each one and check it off with the check tool", err)
+	} else if err != nil {
+		return nil, err
+	}
+	item, err := server.LoadItemDetail(s.db, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.db.BackupQuiet()
+	return item, nil
+}
+
+func (s *Server) toolLog(args json.RawMessage) (any, error) {
+	var a struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if a.ID == "" || a.Message == "" {
+		return nil, fmt.Errorf("%w: id and message are required", errInvalidArgs)
+	}
+	// AddLog doesn't check the item exists
+	if _, err := s.db.GetItem(a.ID); err != nil {
+		return nil, err
+	}
+	if err := s.db.AddLog(a.ID, a.Message); err != nil {
+		return nil, err
+	}
+	// Progress keeps a claim from start alive; without one there is nothing to renew
+	_, _ = s.db.RenewLease(a.ID, s.db.Actor(), db.DefaultLeaseTTL)
+	return map[string]any{"id": a.ID, "logged": a.Message}, nil
+}
+
+func (s *Server) toolLearn(args json.RawMessage) (any, error) {
+	var a struct {
+		Project  string   `json:"project"`
+		Summary  string   `json:"summary"`
+		Detail   string   `json:"detail"`
+		Concepts []string `json:"concepts"`
+		Files    []string `json:"files"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	project, err := s.project(a.Project)
+	if err != nil {
+		return nil, err
+	}
+	if a.Summary == "" || len(a.Concepts) == 0 {
+		return nil, fmt.Errorf("%w: summary and at least one concept are required", errInvalidArgs)
+	}
+
+	// Link to the task in progress, as 'prog learn' does
+	taskID, _ := s.db.GetCurrentTaskID(project)
+	now := time.Now()
+	learning := &model.Learning{
+		ID:        model.GenerateLearningID(),
+		Project:   project,
+		CreatedAt: now,
+		UpdatedAt: now,
+		TaskID:    taskID,
+		Summary:   a.Summary,
+		Detail:    a.Detail,
+		Status:    model.LearningStatusActive,
+		Concepts:  a.Concepts,
+		Files:     a.Files,
+	}
+	if err := s.db.CreateLearning(learning); err != nil {
+		return nil, err
+	}
+	s.db.BackupQuiet()
+	return server.NewLearningJSON(*learning), nil
+}
+
+func (s *Server) toolContext(args json.RawMessage) (any, error) {
+	var a struct {
+		Project      string   `json:"project"`
+		Concepts     []string `json:"concepts"`
+		Files        []string `json:"files"`
+		Query        string   `json:"query"`
+		IncludeStale bool     `json:"include_stale"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	project, err := s.project(a.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	var learnings []model.Learning
+	switch {
+	case len(a.Concepts) > 0:
+		learnings, err = s.db.GetLearningsByConcepts(project, a.Concepts, a.IncludeStale)
+	case len(a.Files) > 0:
+		learnings, err = s.db.GetLearningsByFiles(project, a.Files, a.IncludeStale)
+	case a.Query != "":
+		learnings, err = s.db.SearchLearnings(project, a.Query, a.IncludeStale)
+	default:
+		learnings, err = s.db.GetAllLearnings(project, a.IncludeStale)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]server.LearningJSON, 0, len(learnings))
+	for _, l := range learnings {
+		out = append(out, server.NewLearningJSON(l))
+	}
+	return map[string]any{"learnings": out}, nil
+}
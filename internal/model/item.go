@@ -3,7 +3,9 @@ package model
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"time"
 )
 
@@ -51,20 +53,88 @@ func (s Status) IsValid() bool {
 	return s == StatusDraft || s == StatusOpen || s == StatusInProgress || s == StatusBlocked || s == StatusReviewing || s == StatusDone || s == StatusCanceled
 }
 
-// Item represents a task or epic in the system.
+// Item represents a task or epic in the system. The JSON field names match
+// the HTTP API's item representation; webhook payloads carry items as-is.
 type Item struct {
-	ID               string   // Unique identifier (ts-XXXXXX or ep-XXXXXX)
-	Project          string   // Project scope (e.g., "gaia", "myapp")
-	Type             ItemType // "task" or "epic"
-	Title            string   // Short description
-	Description      string   // Full context, notes, handoff info
-	DefinitionOfDone *string  // Completion criteria for agents (natural language)
-	Status           Status   // Current state
-	Priority         int      // 1=high, 2=medium, 3=low
-	ParentID         *string  // Optional parent epic ID
-	Labels           []string // Attached label names (populated separately)
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
+	ID               string    `json:"id"`                 // Unique identifier (ts-XXXXXX or ep-XXXXXX)
+	Project          string    `json:"project"`            // Project scope (e.g., "gaia", "myapp")
+	Type             ItemType  `json:"type"`               // "task" or "epic"
+	Title            string    `json:"title"`              // Short description
+	Description      string    `json:"description"`        // Full context, notes, handoff info
+	DefinitionOfDone *string   `json:"definition_of_done"` // Completion criteria as text, "; "-separated (checkable criteria are populated separately)
+	Status           Status    `json:"status"`             // Current state
+	Priority         int       `json:"priority"`           // 1=high, 2=medium, 3=low
+	ParentID         *string   `json:"parent"`             // Optional parent epic ID
+	CreatedBy        string    `json:"created_by"`         // Actor who created the item
+	Assignee         string    `json:"assignee"`           // Actor working on it; set when started or claimed, cleared when reopened
+	Labels           []string  `json:"labels"`             // Attached label names (populated separately)
+	Areas            []string  `json:"areas,omitempty"`    // Touched code areas (populated separately)
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Criterion is one checkable entry in a task's definition of done.
+type Criterion struct {
+	Position  int        `json:"position"`          // 1-based, as numbered by prog dod
+	Text      string     `json:"text"`              // What must be true
+	Command   string     `json:"command,omitempty"` // Shell command that verifies it, if any
+	Checked   bool       `json:"checked"`
+	Note      string     `json:"note,omitempty"` // Evidence given when it was checked off
+	CheckedBy string     `json:"checked_by,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+
+	// Verification is the latest run of Command by prog verify, if any.
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// Verification records one run of a criterion's command by prog verify.
+type Verification struct {
+	ID         int64     `json:"id"`
+	ItemID     string    `json:"item_id"`
+	Criterion  string    `json:"criterion"` // Text of the criterion verified
+	Command    string    `json:"command"`
+	Dir        string    `json:"dir,omitempty"` // Where the command ran
+	ExitCode   int       `json:"exit_code"`     // -1 if it couldn't run or timed out
+	DurationMS int64     `json:"duration_ms"`
+	Output     string    `json:"output"` // Combined stdout and stderr, truncated to the end
+	RanBy      string    `json:"ran_by"`
+	RanAt      time.Time `json:"ran_at"`
+}
+
+// Duration is how long the command ran.
+func (v *Verification) Duration() time.Duration {
+	return time.Duration(v.DurationMS) * time.Millisecond
+}
+
+// Passed reports whether the command exited successfully.
+func (v *Verification) Passed() bool {
+	return v.ExitCode == 0
+}
+
+// Note is the note a passing run checks its criterion off with.
+func (v *Verification) Note() string {
+	return fmt.Sprintf("verified: `%s` passed in %s", v.Command, v.Duration())
+}
+
+// Review verdicts. A review is pending from when a reviewer is assigned until
+// they give their verdict.
+const (
+	VerdictPending          = "pending"
+	VerdictApproved         = "approved"
+	VerdictChangesRequested = "changes_requested"
+)
+
+// Review is one reviewer's review of a task in one round of review. A task
+// sent back for changes and resubmitted gets a new round.
+type Review struct {
+	ID          int64      `json:"id"`
+	ItemID      string     `json:"item_id"`
+	Reviewer    string     `json:"reviewer"`
+	Verdict     string     `json:"verdict"`
+	Note        string     `json:"note,omitempty"` // What the reviewer found or wants changed
+	RequestedBy string     `json:"requested_by,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
 }
 
 // Log is a timestamped audit trail entry for an item.
@@ -72,7 +142,117 @@ type Log struct {
 	ID        int64
 	ItemID    string
 	Message   string
+	Actor     string // Who wrote the entry
+	CreatedAt time.Time
+}
+
+// Event is one recorded change to an item. Events are append-only and outlive
+// the item, so they serve as its history and audit trail.
+type Event struct {
+	ID        int64
+	ItemID    string
+	Field     string // What changed: status, title, dependency, label, ...
+	OldValue  string // Empty when the field was unset or a value was added
+	NewValue  string // Empty when the field was cleared or a value was removed
+	Actor     string // Who made the change
+	Reverts   int64  // ID of the event this one undoes, or 0
+	CreatedAt time.Time
+}
+
+// Change is one entry in the change feed: an item, log, dependency, label or
+// learning change, numbered in the order it was made. Seq is the cursor a
+// reader resumes from.
+type Change struct {
+	Seq       int64
+	Kind      string // item, log, dep, label or learning
+	Action    string // What happened, e.g. created, status, added, removed
+	Target    string // Item or learning ID
+	Project   string
+	Actor     string
+	OldValue  string
+	NewValue  string
+	CreatedAt time.Time
+}
+
+// Webhook is a project's subscription to task status transitions. Each
+// transition into one of Events is POSTed to URL, signed with Secret.
+type Webhook struct {
+	ID        string // wh-XXXXXX
+	Project   string
+	URL       string
+	Secret    string   // HMAC-SHA256 key for the X-Prog-Signature header
+	Events    []string // Statuses that trigger a delivery, e.g. reviewing, done, blocked
+	CreatedBy string
+	CreatedAt time.Time
+	Pending   int // Deliveries waiting to be sent or retried (populated by listing)
+	Failed    int // Deliveries that ran out of attempts (populated by listing)
+}
+
+// Delivery states in the webhook outbox.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // Gave up after the maximum number of attempts
+)
+
+// Delivery is one queued webhook notification. Deliveries are written in the
+// same transaction as the change that triggers them, so none are lost if the
+// sender is down, and retried until they succeed or run out of attempts.
+type Delivery struct {
+	ID          int64
+	WebhookID   string
+	URL         string // From the webhook, at the time of sending
+	Secret      string
+	Event       string
+	ItemID      string
+	Payload     []byte // JSON body, fixed when the delivery is queued
+	State       string
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// GenerateWebhookID returns a new webhook ID with wh- prefix and 6 hex chars.
+func GenerateWebhookID() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return "wh-" + hex.EncodeToString(b)
+}
+
+// Lease records which actor has claimed an in-progress task and until when.
+// A lease must be renewed before ExpiresAt or the task returns to open.
+type Lease struct {
+	ItemID    string
+	Actor     string
+	ClaimedAt time.Time
+	ExpiresAt time.Time
+}
+
+// AssignmentState tracks a task handed to an agent by the orchestrator daemon.
+type AssignmentState string
+
+const (
+	AssignmentQueued   AssignmentState = "queued"   // In the agent's inbox, not yet picked up
+	AssignmentActive   AssignmentState = "active"   // Agent is working on it
+	AssignmentDone     AssignmentState = "done"     // Agent reported a result
+	AssignmentRequeued AssignmentState = "requeued" // Agent went away before making progress; task reopened
+	AssignmentBlocked  AssignmentState = "blocked"  // Agent went away mid-task; needs a human to reassign
+	AssignmentReleased AssignmentState = "released" // Removed from the inbox without being worked on
+)
+
+// Assignment records that the orchestrator daemon gave a task to an agent.
+type Assignment struct {
+	ID        int64
+	ItemID    string
+	AgentID   string
+	Role      string // implementer, reviewer, planner
+	State     AssignmentState
+	Progress  bool // Agent reported progress (STATUS) while holding the task
 	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // Dep represents a dependency relationship where ItemID depends on DependsOn.
@@ -97,10 +277,15 @@ const (
 	LearningStatusActive   LearningStatus = "active"
 	LearningStatusStale    LearningStatus = "stale"
 	LearningStatusArchived LearningStatus = "archived"
+
+	// LearningStatusNeedsReview marks a learning whose files changed heavily
+	// or were deleted since it was recorded. It is still retrieved, flagged,
+	// until someone confirms, edits or retires it.
+	LearningStatusNeedsReview LearningStatus = "needs-review"
 )
 
 func (s LearningStatus) IsValid() bool {
-	return s == LearningStatusActive || s == LearningStatusStale || s == LearningStatusArchived
+	return s == LearningStatusActive || s == LearningStatusStale || s == LearningStatusArchived || s == LearningStatusNeedsReview
 }
 
 // Concept represents a knowledge category within a project.
@@ -115,16 +300,51 @@ type Concept struct {
 
 // Learning represents a piece of knowledge discovered during work.
 type Learning struct {
-	ID        string // lrn-XXXXXX
-	Project   string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	TaskID    *string // Optional link to the task that discovered this
-	Summary   string  // One-liner
-	Detail    string  // Full context
-	Files     []string
-	Status    LearningStatus
-	Concepts  []string // Associated concept names
+	ID        string         `json:"id"` // lrn-XXXXXX
+	Project   string         `json:"project"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	TaskID    *string        `json:"task_id"` // Optional link to the task that discovered this
+	Summary   string         `json:"summary"` // One-liner
+	Detail    string         `json:"detail"`  // Full context
+	Files     []string       `json:"files"`
+	Status    LearningStatus `json:"status"`
+	Concepts  []string       `json:"concepts"` // Associated concept names
+	Actor     string         `json:"actor"`    // Who recorded it
+
+	ReviewReason string `json:"review_reason,omitempty"` // Why it needs review, e.g. "auth/token.go was deleted"
+
+	// Set for stubs indexed from a learning page, where Summary is the
+	// page's one-liner and Detail its short summary
+	Path       string   `json:"path,omitempty"`       // Repo-relative path of the page
+	Title      string   `json:"title,omitempty"`      // Page title
+	Provenance []string `json:"provenance,omitempty"` // Tasks, issues or commits the learning came from
+}
+
+// IsPage reports whether the learning is a stub for a learning page.
+func (l *Learning) IsPage() bool {
+	return l.Path != ""
+}
+
+// Feedback is an agent's evaluation of a learning it retrieved: whether it
+// looked relevant from its summary or stub, and whether it turned out to
+// apply to the task. Learnings that look relevant but aren't are misleading,
+// and rank lower.
+type Feedback struct {
+	ID               int64     `json:"id"`
+	LearningID       string    `json:"learning_id"`
+	TaskID           *string   `json:"task_id"`                   // Task the learning was retrieved for
+	ExpectedRelevant bool      `json:"expected_relevant"`         // Looked relevant before it was read
+	ActuallyRelevant bool      `json:"actually_relevant"`         // Applied to the task once read
+	MismatchReason   string    `json:"mismatch_reason,omitempty"` // Why not, e.g. "stale info", "wrong subsystem"
+	TaskContext      string    `json:"task_context,omitempty"`    // Task type or scope, e.g. "bugfix, db"
+	Actor            string    `json:"actor"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Misleading reports whether the learning looked relevant but wasn't.
+func (f *Feedback) Misleading() bool {
+	return f.ExpectedRelevant && !f.ActuallyRelevant
 }
 
 // GenerateLearningID returns a new learning ID with lrn- prefix and 6 hex chars.
@@ -136,6 +356,14 @@ func GenerateLearningID() string {
 	return "lrn-" + hex.EncodeToString(b)
 }
 
+// PageLearningID returns the ID of the stub for the learning page at path in
+// project. It is derived from the path, so reindexing a page, or indexing it
+// from another clone, keeps the ID that tasks and notes refer to.
+func PageLearningID(project, path string) string {
+	sum := sha256.Sum256([]byte(project + "\x00" + path))
+	return "lrn-" + hex.EncodeToString(sum[:3])
+}
+
 // GenerateConceptID returns a new concept ID with con- prefix and 6 hex chars.
 func GenerateConceptID() string {
 	b := make([]byte, 3)
@@ -0,0 +1,525 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+// DefaultHeartbeatTTL is how long an agent may go without a heartbeat before
+// the daemon treats it as gone (design doc: heartbeat every 30s, TTL 90s).
+const DefaultHeartbeatTTL = 90 * time.Second
+
+// Config controls daemon behavior.
+type Config struct {
+	HeartbeatTTL   time.Duration // Missed-heartbeat cutoff (default DefaultHeartbeatTTL)
+	LeaseTTL       time.Duration // Lease on assigned tasks, renewed by heartbeats (default 2x HeartbeatTTL)
+	AutoRequeue    bool          // Requeue tasks with progress instead of blocking them when an agent is lost
+	StealThreshold int           // Minimum load an agent must carry before idle agents steal from it (default DefaultStealThreshold)
+	Project        string        // Scope for filling empty inboxes from ready work ("" = all projects)
+	Labels         []string      // Label filter for filling empty inboxes
+
+	Now  func() time.Time                 // Clock, for tests (default time.Now)
+	Logf func(format string, args ...any) // Event log (default discards)
+}
+
+// Daemon holds the agent pool and inboxes in memory and persists assignments
+// to the prog database. All message handling is serialized.
+type Daemon struct {
+	db  *db.DB
+	cfg Config
+
+	mu     sync.Mutex
+	agents map[string]*agent
+}
+
+type agent struct {
+	id       string
+	status   string
+	lastSeen time.Time
+	current  *model.Assignment   // Task the agent is working on
+	inbox    []*model.Assignment // Queued tasks, already claimed for the agent; front is next
+	restored bool                // Rebuilt from the DB after a restart; not yet re-registered
+}
+
+// AgentInfo is a snapshot of one agent for status displays and tests.
+type AgentInfo struct {
+	ID       string
+	Status   string
+	TaskID   string   // Current task, if any
+	Inbox    []string // Queued task IDs, next first
+	LastSeen time.Time
+}
+
+// New creates a daemon backed by database.
+func New(database *db.DB, cfg Config) *Daemon {
+	if cfg.HeartbeatTTL <= 0 {
+		cfg.HeartbeatTTL = DefaultHeartbeatTTL
+	}
+	if cfg.LeaseTTL <= 0 {
+		// Longer than the heartbeat TTL so the daemon's loss policy runs before
+		// the lease lapses and some other prog command reopens the task
+		cfg.LeaseTTL = 2 * cfg.HeartbeatTTL
+	}
+	if cfg.StealThreshold <= 0 {
+		cfg.StealThreshold = DefaultStealThreshold
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = func(string, ...any) {}
+	}
+	return &Daemon{db: database, cfg: cfg, agents: make(map[string]*agent)}
+}
+
+// Restore rebuilds inboxes from assignments persisted by a previous run.
+// Restored agents must re-register (or heartbeat) within the heartbeat TTL,
+// otherwise their tasks go through the usual loss policy.
+func (d *Daemon) Restore() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	open, err := d.db.OpenAssignments()
+	if err != nil {
+		return err
+	}
+	now := d.cfg.Now()
+	for i := range open {
+		a := &open[i]
+		// The lease may have lapsed while the daemon was down
+		if !d.holdsLease(a) {
+			if err := d.db.SetAssignmentState(a.ID, model.AssignmentReleased); err != nil {
+				return err
+			}
+			continue
+		}
+		ag := d.agents[a.AgentID]
+		if ag == nil {
+			ag = &agent{id: a.AgentID, status: StatusIdle, lastSeen: now, restored: true}
+			d.agents[a.AgentID] = ag
+		}
+		if a.State == model.AssignmentActive && ag.current == nil {
+			ag.current = a
+			ag.status = StatusWorking
+		} else {
+			ag.inbox = append(ag.inbox, a)
+		}
+	}
+	if len(d.agents) > 0 {
+		d.cfg.Logf("restored %d agent(s) from previous run", len(d.agents))
+	}
+	return nil
+}
+
+// Handle processes one request and returns the reply.
+func (d *Daemon) Handle(msg Message) Message {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch msg.Type {
+	case MsgRegister:
+		return d.register(msg)
+	case MsgHeartbeat:
+		return d.heartbeat(msg)
+	case MsgAssign:
+		return d.assign(msg)
+	case MsgPoll:
+		return d.poll(msg)
+	case MsgStatus:
+		return d.status(msg)
+	case MsgResult:
+		return d.result(msg)
+	case MsgDeregister:
+		return d.deregister(msg)
+	default:
+		return errorf("unknown message type %q", msg.Type)
+	}
+}
+
+func (d *Daemon) register(msg Message) Message {
+	if !agentIDPattern.MatchString(msg.AgentID) {
+		return errorf("invalid agent_id %q: must be 6 lowercase base36 characters", msg.AgentID)
+	}
+	if ag, ok := d.agents[msg.AgentID]; ok {
+		if !ag.restored {
+			return Message{Type: MsgIDInUse, AgentID: msg.AgentID}
+		}
+		// Agent reconnecting after a daemon restart picks its inbox back up
+		ag.restored = false
+		ag.lastSeen = d.cfg.Now()
+		d.cfg.Logf("agent %s re-registered", msg.AgentID)
+		return Message{Type: MsgOK, AgentID: msg.AgentID}
+	}
+	d.agents[msg.AgentID] = &agent{id: msg.AgentID, status: StatusIdle, lastSeen: d.cfg.Now()}
+	d.cfg.Logf("agent %s registered", msg.AgentID)
+	return Message{Type: MsgOK, AgentID: msg.AgentID}
+}
+
+func (d *Daemon) heartbeat(msg Message) Message {
+	ag, errMsg := d.lookup(msg.AgentID)
+	if ag == nil {
+		return errMsg
+	}
+	if msg.Status != "" {
+		if !validStatus(msg.Status) {
+			return errorf("invalid status %q", msg.Status)
+		}
+		ag.status = msg.Status
+	}
+	ag.lastSeen = d.cfg.Now()
+	ag.restored = false
+
+	// Keep every task the agent holds leased to it
+	for _, a := range ag.tasks() {
+		if _, err := d.db.RenewLease(a.ItemID, ag.id, d.cfg.LeaseTTL); err != nil {
+			if a == ag.current {
+				return errorf("lost task %s: %v", a.ItemID, err)
+			}
+			d.cfg.Logf("agent %s: dropping queued task %s: %v", ag.id, a.ItemID, err)
+			d.dropFromInbox(ag, a, model.AssignmentReleased)
+		}
+	}
+	return Message{Type: MsgOK, AgentID: ag.id, TaskID: ag.currentTaskID()}
+}
+
+func (d *Daemon) assign(msg Message) Message {
+	if msg.TaskID == "" {
+		return errorf("task_id is required")
+	}
+	role := msg.Role
+	if role == "" {
+		role = RoleImplementer
+	}
+	if !validRole(role) {
+		return errorf("invalid role %q (valid: implementer, reviewer, planner)", role)
+	}
+
+	var ag *agent
+	if msg.AgentID == "" {
+		ag = d.leastLoaded()
+		if ag == nil {
+			return errorf("no agents registered")
+		}
+	} else {
+		var errMsg Message
+		if ag, errMsg = d.lookup(msg.AgentID); ag == nil {
+			return errMsg
+		}
+	}
+
+	a, err := d.enqueue(ag, msg.TaskID, role)
+	if err != nil {
+		return errorf("%v", err)
+	}
+	return Message{Type: MsgOK, AgentID: ag.id, TaskID: a.ItemID, Role: a.Role}
+}
+
+// enqueue claims a task for an agent and pushes it onto the back of its inbox.
+// The task is in_progress and leased to the agent from here on, not from when
+// the agent polls it, so nobody else can start it while it waits.
+func (d *Daemon) enqueue(ag *agent, taskID, role string) (*model.Assignment, error) {
+	if _, err := d.db.ClaimTask(taskID, ag.id, d.cfg.LeaseTTL); err != nil {
+		return nil, err
+	}
+	a := &model.Assignment{ItemID: taskID, AgentID: ag.id, Role: role, State: model.AssignmentQueued}
+	if err := d.db.CreateAssignment(a); err != nil {
+		_ = d.db.ReleaseLease(taskID, ag.id)
+		return nil, err
+	}
+	ag.inbox = append(ag.inbox, a)
+	_ = d.db.AddLog(taskID, fmt.Sprintf("Assigned to agent %s (%s)", ag.id, role))
+	d.cfg.Logf("assigned %s to agent %s (%s)", taskID, ag.id, role)
+	return a, nil
+}
+
+func (d *Daemon) poll(msg Message) Message {
+	ag, errMsg := d.lookup(msg.AgentID)
+	if ag == nil {
+		return errMsg
+	}
+	ag.lastSeen = d.cfg.Now()
+	ag.restored = false
+
+	// Re-deliver the current task until the agent reports a result
+	if ag.current != nil {
+		return assignMsg(ag.current)
+	}
+
+	// A queued task someone blocked or closed by hand has lost its lease
+	for len(ag.inbox) > 0 && !d.holdsLease(ag.inbox[0]) {
+		a := ag.inbox[0]
+		d.cfg.Logf("agent %s: dropping queued task %s: no longer claimed", ag.id, a.ItemID)
+		d.dropFromInbox(ag, a, model.AssignmentReleased)
+	}
+
+	// Like a work-stealing scheduler: own inbox first, then steal from other
+	// agents' inboxes, and only then take new work from the ready pool
+	if len(ag.inbox) == 0 {
+		d.rebalance()
+	}
+	if len(ag.inbox) == 0 {
+		if err := d.fillInbox(ag); err != nil {
+			return errorf("%v", err)
+		}
+	}
+	if len(ag.inbox) == 0 {
+		return Message{Type: MsgEmpty, AgentID: ag.id}
+	}
+
+	a := ag.inbox[0]
+	ag.inbox = ag.inbox[1:]
+	if err := d.db.SetAssignmentState(a.ID, model.AssignmentActive); err != nil {
+		ag.inbox = append([]*model.Assignment{a}, ag.inbox...)
+		return errorf("%v", err)
+	}
+	a.State = model.AssignmentActive
+	ag.current = a
+	ag.status = StatusWorking
+	return assignMsg(a)
+}
+
+// fillInbox claims the best ready task in the daemon's scope for an idle agent.
+// Candidates another actor claims first, and tasks whose areas overlap work
+// already in progress, are skipped.
+func (d *Daemon) fillInbox(ag *agent) error {
+	ranked, err := d.db.RankedReadyItems(db.ReadyFilter{Project: d.cfg.Project, Labels: d.cfg.Labels, NoConflicts: true})
+	if err != nil {
+		return err
+	}
+	for _, r := range ranked {
+		_, err := d.enqueue(ag, r.ID, RoleImplementer)
+		if errors.Is(err, db.ErrNotClaimable) {
+			continue
+		}
+		return err
+	}
+	return nil
+}
+
+func (d *Daemon) status(msg Message) Message {
+	ag, errMsg := d.lookup(msg.AgentID)
+	if ag == nil {
+		return errMsg
+	}
+	if !validStatus(msg.Status) {
+		return errorf("invalid status %q", msg.Status)
+	}
+	ag.status = msg.Status
+	ag.lastSeen = d.cfg.Now()
+	ag.restored = false
+
+	if msg.TaskID == "" {
+		return Message{Type: MsgOK, AgentID: ag.id}
+	}
+	if ag.current == nil || ag.current.ItemID != msg.TaskID {
+		return errorf("task %s is not assigned to agent %s", msg.TaskID, ag.id)
+	}
+	if !ag.current.Progress {
+		if err := d.db.MarkAssignmentProgress(ag.current.ID); err != nil {
+			return errorf("%v", err)
+		}
+		ag.current.Progress = true
+	}
+	entry := fmt.Sprintf("Agent %s: %s", ag.id, msg.Status)
+	if msg.Note != "" {
+		entry += ": " + msg.Note
+	}
+	if err := d.db.WithActor(ag.id).AddLog(msg.TaskID, entry); err != nil {
+		return errorf("%v", err)
+	}
+	return Message{Type: MsgOK, AgentID: ag.id, TaskID: msg.TaskID}
+}
+
+func (d *Daemon) result(msg Message) Message {
+	ag, errMsg := d.lookup(msg.AgentID)
+	if ag == nil {
+		return errMsg
+	}
+	ag.lastSeen = d.cfg.Now()
+	if ag.current == nil || ag.current.ItemID != msg.TaskID {
+		return errorf("task %s is not assigned to agent %s", msg.TaskID, ag.id)
+	}
+
+	// Agents never mark done; the task waits for review
+	if err := d.db.WithActor(ag.id).UpdateStatus(msg.TaskID, model.StatusReviewing); err != nil {
+		return errorf("%v", err)
+	}
+	entry := fmt.Sprintf("Result from agent %s", ag.id)
+	if msg.SummaryRef != "" {
+		entry += ": " + msg.SummaryRef
+	}
+	_ = d.db.WithActor(ag.id).AddLog(msg.TaskID, entry)
+	if err := d.db.SetAssignmentState(ag.current.ID, model.AssignmentDone); err != nil {
+		return errorf("%v", err)
+	}
+	d.cfg.Logf("agent %s finished %s", ag.id, msg.TaskID)
+	ag.current = nil
+	ag.status = StatusIdle
+	return Message{Type: MsgOK, AgentID: ag.id, TaskID: msg.TaskID}
+}
+
+func (d *Daemon) deregister(msg Message) Message {
+	ag, errMsg := d.lookup(msg.AgentID)
+	if ag == nil {
+		return errMsg
+	}
+	reason := msg.Reason
+	if reason == "" {
+		reason = "deregistered"
+	}
+	d.removeAgent(ag, reason)
+	return Message{Type: MsgOK, AgentID: ag.id}
+}
+
+// Sweep removes agents that missed their heartbeat TTL and applies the loss
+// policy to their tasks. Returns the IDs of the removed agents.
+func (d *Daemon) Sweep() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.cfg.Now()
+	var lost []string
+	for _, ag := range d.sortedAgents() {
+		if now.Sub(ag.lastSeen) > d.cfg.HeartbeatTTL {
+			d.removeAgent(ag, "missed heartbeats")
+			lost = append(lost, ag.id)
+		}
+	}
+	return lost
+}
+
+// removeAgent drops an agent from the pool. Queued tasks go back to open.
+// The current task follows the loss policy: requeue if the agent reported no
+// progress (or AutoRequeue is set), otherwise mark it blocked for a human.
+func (d *Daemon) removeAgent(ag *agent, reason string) {
+	for len(ag.inbox) > 0 {
+		a := ag.inbox[0]
+		d.releaseTask(a)
+		d.dropFromInbox(ag, a, model.AssignmentReleased)
+	}
+
+	if a := ag.current; a != nil && d.holdsLease(a) {
+		if !a.Progress || d.cfg.AutoRequeue {
+			d.releaseTask(a)
+			_ = d.db.SetAssignmentState(a.ID, model.AssignmentRequeued)
+			_ = d.db.AddLog(a.ItemID, fmt.Sprintf("Requeued: agent %s %s", ag.id, reason))
+			d.cfg.Logf("requeued %s: agent %s %s", a.ItemID, ag.id, reason)
+		} else {
+			if err := d.db.UpdateStatus(a.ItemID, model.StatusBlocked); err != nil {
+				d.cfg.Logf("failed to block %s: %v", a.ItemID, err)
+			}
+			_ = d.db.SetAssignmentState(a.ID, model.AssignmentBlocked)
+			_ = d.db.AddLog(a.ItemID, fmt.Sprintf(
+				"Blocked: agent %s %s after reporting progress; review its work, then 'prog open %s' to reassign",
+				ag.id, reason, a.ItemID))
+			d.cfg.Logf("blocked %s: agent %s %s mid-task", a.ItemID, ag.id, reason)
+		}
+	} else if a != nil {
+		_ = d.db.SetAssignmentState(a.ID, model.AssignmentReleased)
+	}
+
+	delete(d.agents, ag.id)
+	d.cfg.Logf("agent %s removed: %s", ag.id, reason)
+}
+
+// releaseTask gives a task back to open if the agent still holds its lease.
+func (d *Daemon) releaseTask(a *model.Assignment) {
+	if !d.holdsLease(a) {
+		return
+	}
+	if err := d.db.ReleaseLease(a.ItemID, a.AgentID); err != nil {
+		d.cfg.Logf("failed to release %s: %v", a.ItemID, err)
+	}
+}
+
+func (d *Daemon) holdsLease(a *model.Assignment) bool {
+	lease, err := d.db.GetLease(a.ItemID)
+	return err == nil && lease != nil && lease.Actor == a.AgentID
+}
+
+func (d *Daemon) dropFromInbox(ag *agent, a *model.Assignment, state model.AssignmentState) {
+	for i, q := range ag.inbox {
+		if q == a {
+			ag.inbox = append(ag.inbox[:i], ag.inbox[i+1:]...)
+			break
+		}
+	}
+	_ = d.db.SetAssignmentState(a.ID, state)
+}
+
+// Agents returns a snapshot of the pool, sorted by agent ID.
+func (d *Daemon) Agents() []AgentInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var infos []AgentInfo
+	for _, ag := range d.sortedAgents() {
+		info := AgentInfo{ID: ag.id, Status: ag.status, TaskID: ag.currentTaskID(), LastSeen: ag.lastSeen}
+		for _, a := range ag.inbox {
+			info.Inbox = append(info.Inbox, a.ItemID)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func (d *Daemon) lookup(id string) (*agent, Message) {
+	if id == "" {
+		return nil, errorf("agent_id is required")
+	}
+	ag, ok := d.agents[id]
+	if !ok {
+		return nil, errorf("unknown agent %s (send REGISTER first)", id)
+	}
+	return ag, Message{}
+}
+
+// leastLoaded returns the agent with the fewest held tasks, ties broken by ID.
+func (d *Daemon) leastLoaded() *agent {
+	var best *agent
+	for _, ag := range d.sortedAgents() {
+		if best == nil || ag.load() < best.load() {
+			best = ag
+		}
+	}
+	return best
+}
+
+func (d *Daemon) sortedAgents() []*agent {
+	agents := make([]*agent, 0, len(d.agents))
+	for _, ag := range d.agents {
+		agents = append(agents, ag)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].id < agents[j].id })
+	return agents
+}
+
+// tasks returns every assignment the agent holds, current first.
+func (ag *agent) tasks() []*model.Assignment {
+	var tasks []*model.Assignment
+	if ag.current != nil {
+		tasks = append(tasks, ag.current)
+	}
+	return append(tasks, ag.inbox...)
+}
+
+func (ag *agent) load() int {
+	return len(ag.tasks())
+}
+
+func (ag *agent) currentTaskID() string {
+	if ag.current == nil {
+		return ""
+	}
+	return ag.current.ItemID
+}
+
+func assignMsg(a *model.Assignment) Message {
+	return Message{Type: MsgAssign, AgentID: a.AgentID, TaskID: a.ItemID, Role: a.Role}
+}
@@ -0,0 +1,350 @@
+package orchestrator
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+// fakeClock is a manually advanced clock for heartbeat tests.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if err := database.Init(); err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	return database
+}
+
+func setupDaemon(t *testing.T, cfg Config) (*Daemon, *db.DB, *fakeClock) {
+	t.Helper()
+	database := setupTestDB(t)
+	clock := &fakeClock{now: time.Now()}
+	cfg.Now = clock.Now
+	if cfg.HeartbeatTTL == 0 {
+		cfg.HeartbeatTTL = 90 * time.Second
+	}
+	return New(database, cfg), database, clock
+}
+
+func createTask(t *testing.T, database *db.DB, id string, priority int) {
+	t.Helper()
+	item := &model.Item{
+		ID:        id,
+		Project:   "test",
+		Type:      model.ItemTypeTask,
+		Title:     "Task " + id,
+		Status:    model.StatusOpen,
+		Priority:  priority,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := database.CreateItem(item); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+}
+
+func mustHandle(t *testing.T, d *Daemon, msg Message, want MessageType) Message {
+	t.Helper()
+	reply := d.Handle(msg)
+	if reply.Type != want {
+		t.Fatalf("%s reply = %s (%s), want %s", msg.Type, reply.Type, reply.Error, want)
+	}
+	return reply
+}
+
+func taskStatus(t *testing.T, database *db.DB, id string) model.Status {
+	t.Helper()
+	item, err := database.GetItem(id)
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	return item.Status
+}
+
+func TestRegister(t *testing.T) {
+	d, _, _ := setupDaemon(t, Config{})
+
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "abc123"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "abc123"}, MsgIDInUse)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "BAD"}, MsgError)
+
+	agents := d.Agents()
+	if len(agents) != 1 || agents[0].ID != "abc123" || agents[0].Status != StatusIdle {
+		t.Errorf("agents = %+v, want one idle abc123", agents)
+	}
+}
+
+func TestUnknownAgentAndMessage(t *testing.T) {
+	d, _, _ := setupDaemon(t, Config{})
+
+	mustHandle(t, d, Message{Type: MsgHeartbeat, AgentID: "nobody"}, MsgError)
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "nobody"}, MsgError)
+	mustHandle(t, d, Message{Type: "BOGUS"}, MsgError)
+}
+
+func TestAssignPollResult(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+	if got := taskStatus(t, database, "ts-aaa001"); got != model.StatusInProgress {
+		t.Errorf("status after assign = %s, want in_progress", got)
+	}
+	if agents := d.Agents(); len(agents[0].Inbox) != 1 {
+		t.Errorf("inbox = %v, want 1 task", agents[0].Inbox)
+	}
+
+	reply := mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	if reply.TaskID != "ts-aaa001" || reply.Role != RoleImplementer {
+		t.Errorf("poll reply = %+v", reply)
+	}
+	// Polling again re-delivers the current task
+	reply = mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	if reply.TaskID != "ts-aaa001" {
+		t.Errorf("re-poll task = %s, want ts-aaa001", reply.TaskID)
+	}
+
+	mustHandle(t, d, Message{Type: MsgResult, AgentID: "agent1", TaskID: "ts-aaa001", SummaryRef: "commit abc"}, MsgOK)
+	if got := taskStatus(t, database, "ts-aaa001"); got != model.StatusReviewing {
+		t.Errorf("status after result = %s, want reviewing", got)
+	}
+
+	assignments, err := database.GetAssignments("ts-aaa001")
+	if err != nil {
+		t.Fatalf("failed to get assignments: %v", err)
+	}
+	if len(assignments) != 1 || assignments[0].State != model.AssignmentDone {
+		t.Errorf("assignments = %+v, want one done", assignments)
+	}
+
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgEmpty)
+}
+
+func TestAssign_AlreadyClaimed(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent2"}, MsgOK)
+
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent2", TaskID: "ts-aaa001"}, MsgError)
+}
+
+func TestAssign_LeastLoadedAgent(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	createTask(t, database, "ts-aaa002", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent2"}, MsgOK)
+
+	first := mustHandle(t, d, Message{Type: MsgAssign, TaskID: "ts-aaa001"}, MsgOK)
+	second := mustHandle(t, d, Message{Type: MsgAssign, TaskID: "ts-aaa002"}, MsgOK)
+	if first.AgentID != "agent1" || second.AgentID != "agent2" {
+		t.Errorf("assigned to %s, %s; want agent1, agent2", first.AgentID, second.AgentID)
+	}
+}
+
+func TestPoll_FillsFromReadyWork(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{Project: "test"})
+	createTask(t, database, "ts-low001", 3)
+	createTask(t, database, "ts-hig001", 1)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+
+	reply := mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	if reply.TaskID != "ts-hig001" {
+		t.Errorf("polled %s, want highest priority ts-hig001", reply.TaskID)
+	}
+	lease, _ := database.GetLease("ts-hig001")
+	if lease == nil || lease.Actor != "agent1" {
+		t.Errorf("lease = %+v, want held by agent1", lease)
+	}
+}
+
+func TestStatus_LogsNoteAndRequiresAssignment(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+
+	mustHandle(t, d, Message{Type: MsgStatus, AgentID: "agent1", Status: StatusWorking, TaskID: "ts-aaa001"}, MsgError)
+	mustHandle(t, d, Message{Type: MsgStatus, AgentID: "agent1", Status: "napping"}, MsgError)
+
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	mustHandle(t, d, Message{Type: MsgStatus, AgentID: "agent1", Status: StatusBlocked, TaskID: "ts-aaa001", Note: "need creds"}, MsgOK)
+
+	logs, err := database.GetLogs("ts-aaa001")
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	last := logs[len(logs)-1].Message
+	if last != "Agent agent1: blocked: need creds" {
+		t.Errorf("last log = %q", last)
+	}
+	if agents := d.Agents(); agents[0].Status != StatusBlocked {
+		t.Errorf("agent status = %s, want blocked", agents[0].Status)
+	}
+}
+
+func TestSweep_RequeuesWithoutProgress(t *testing.T) {
+	d, database, clock := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	createTask(t, database, "ts-aaa002", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa002"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+
+	clock.Advance(60 * time.Second)
+	if lost := d.Sweep(); len(lost) != 0 {
+		t.Fatalf("swept %v before TTL", lost)
+	}
+
+	clock.Advance(60 * time.Second)
+	lost := d.Sweep()
+	if len(lost) != 1 || lost[0] != "agent1" {
+		t.Fatalf("lost = %v, want [agent1]", lost)
+	}
+	for _, id := range []string{"ts-aaa001", "ts-aaa002"} {
+		if got := taskStatus(t, database, id); got != model.StatusOpen {
+			t.Errorf("%s status = %s, want open", id, got)
+		}
+	}
+	if len(d.Agents()) != 0 {
+		t.Error("expected agent to be removed")
+	}
+}
+
+func TestSweep_BlocksAfterProgress(t *testing.T) {
+	d, database, clock := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	mustHandle(t, d, Message{Type: MsgStatus, AgentID: "agent1", Status: StatusWorking, TaskID: "ts-aaa001"}, MsgOK)
+
+	clock.Advance(2 * time.Minute)
+	d.Sweep()
+
+	if got := taskStatus(t, database, "ts-aaa001"); got != model.StatusBlocked {
+		t.Errorf("status = %s, want blocked", got)
+	}
+	assignments, _ := database.GetAssignments("ts-aaa001")
+	if len(assignments) != 1 || assignments[0].State != model.AssignmentBlocked {
+		t.Errorf("assignments = %+v, want one blocked", assignments)
+	}
+}
+
+func TestSweep_AutoRequeueAfterProgress(t *testing.T) {
+	d, database, clock := setupDaemon(t, Config{AutoRequeue: true})
+	createTask(t, database, "ts-aaa001", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	mustHandle(t, d, Message{Type: MsgStatus, AgentID: "agent1", Status: StatusWorking, TaskID: "ts-aaa001"}, MsgOK)
+
+	clock.Advance(2 * time.Minute)
+	d.Sweep()
+
+	if got := taskStatus(t, database, "ts-aaa001"); got != model.StatusOpen {
+		t.Errorf("status = %s, want open", got)
+	}
+}
+
+func TestHeartbeat_KeepsAgentAlive(t *testing.T) {
+	d, database, clock := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+
+	for i := 0; i < 5; i++ {
+		clock.Advance(30 * time.Second)
+		mustHandle(t, d, Message{Type: MsgHeartbeat, AgentID: "agent1", Status: StatusIdle}, MsgOK)
+		if lost := d.Sweep(); len(lost) != 0 {
+			t.Fatalf("agent swept despite heartbeats: %v", lost)
+		}
+	}
+	if got := taskStatus(t, database, "ts-aaa001"); got != model.StatusInProgress {
+		t.Errorf("status = %s, want in_progress", got)
+	}
+}
+
+func TestDeregister_ReleasesInbox(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+
+	mustHandle(t, d, Message{Type: MsgDeregister, AgentID: "agent1", Reason: "shutting down"}, MsgOK)
+
+	if got := taskStatus(t, database, "ts-aaa001"); got != model.StatusOpen {
+		t.Errorf("status = %s, want open", got)
+	}
+	assignments, _ := database.GetAssignments("ts-aaa001")
+	if len(assignments) != 1 || assignments[0].State != model.AssignmentReleased {
+		t.Errorf("assignments = %+v, want one released", assignments)
+	}
+	// The ID is free again
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+}
+
+func TestPoll_DropsTaskNoLongerClaimed(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{Project: "none"})
+	createTask(t, database, "ts-aaa001", 2)
+	createTask(t, database, "ts-aaa002", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa002"}, MsgOK)
+	if err := database.UpdateStatus("ts-aaa001", model.StatusCanceled); err != nil {
+		t.Fatalf("failed to cancel task: %v", err)
+	}
+
+	reply := mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	if reply.TaskID != "ts-aaa002" {
+		t.Errorf("polled %s, want ts-aaa002", reply.TaskID)
+	}
+	assignments, _ := database.GetAssignments("ts-aaa001")
+	if len(assignments) != 1 || assignments[0].State != model.AssignmentReleased {
+		t.Errorf("assignments = %+v, want one released", assignments)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	d, database, clock := setupDaemon(t, Config{})
+	createTask(t, database, "ts-aaa001", 2)
+	createTask(t, database, "ts-aaa002", 2)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa001"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: "ts-aaa002"}, MsgOK)
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+
+	// Simulate a daemon restart
+	restarted := New(database, Config{Now: clock.Now})
+	if err := restarted.Restore(); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	agents := restarted.Agents()
+	if len(agents) != 1 || agents[0].TaskID != "ts-aaa001" || len(agents[0].Inbox) != 1 {
+		t.Fatalf("restored agents = %+v", agents)
+	}
+
+	// The agent can re-register with its old ID and continue
+	mustHandle(t, restarted, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	reply := mustHandle(t, restarted, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	if reply.TaskID != "ts-aaa001" {
+		t.Errorf("polled %s, want current task ts-aaa001", reply.TaskID)
+	}
+}
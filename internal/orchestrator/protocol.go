@@ -0,0 +1,82 @@
+// Package orchestrator implements the prog daemon: a registry of volunteer
+// agents with per-agent inboxes, heartbeats, and the message protocol from
+// docs/agent-orchestrator-design.md.
+//
+// Messages are newline-delimited JSON objects exchanged over a Unix socket.
+// Each request gets exactly one response on the same connection.
+package orchestrator
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// MessageType identifies a protocol message.
+type MessageType string
+
+// Agent -> daemon requests, as described in the design doc.
+const (
+	MsgRegister   MessageType = "REGISTER"   // {agent_id}: join the pool
+	MsgHeartbeat  MessageType = "HEARTBEAT"  // {agent_id, status, task_id?}: liveness + current state
+	MsgAssign     MessageType = "ASSIGN"     // {agent_id?, task_id, role}: queue a task (also the POLL reply)
+	MsgStatus     MessageType = "STATUS"     // {agent_id, status, task_id, note?}: progress or blocked state
+	MsgResult     MessageType = "RESULT"     // {agent_id, task_id, summary_ref?}: completion signal
+	MsgDeregister MessageType = "DEREGISTER" // {agent_id, reason}: leave the pool
+	MsgPoll       MessageType = "POLL"       // {agent_id}: take the next task from the inbox
+)
+
+// Daemon -> agent replies.
+const (
+	MsgOK      MessageType = "OK"
+	MsgError   MessageType = "ERROR"
+	MsgIDInUse MessageType = "ID_IN_USE" // REGISTER with an ID another live agent holds; pick a new one
+	MsgEmpty   MessageType = "EMPTY"     // POLL found nothing to do
+)
+
+// Agent statuses reported in HEARTBEAT and STATUS messages.
+const (
+	StatusIdle        = "idle"
+	StatusWorking     = "working"
+	StatusVerifying   = "verifying"
+	StatusBlocked     = "blocked"
+	StatusReviewReady = "review_ready"
+)
+
+// Roles an agent can be assigned a task in.
+const (
+	RoleImplementer = "implementer"
+	RoleReviewer    = "reviewer"
+	RolePlanner     = "planner"
+)
+
+// Message is a single protocol message. Fields not used by a message type are omitted.
+type Message struct {
+	Type       MessageType `json:"type"`
+	AgentID    string      `json:"agent_id,omitempty"`
+	TaskID     string      `json:"task_id,omitempty"`
+	Role       string      `json:"role,omitempty"`
+	Status     string      `json:"status,omitempty"`
+	Note       string      `json:"note,omitempty"`
+	SummaryRef string      `json:"summary_ref,omitempty"`
+	Reason     string      `json:"reason,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// agentIDPattern matches the self-generated 6-char base36 agent IDs.
+var agentIDPattern = regexp.MustCompile(`^[0-9a-z]{6}$`)
+
+func validStatus(s string) bool {
+	switch s {
+	case StatusIdle, StatusWorking, StatusVerifying, StatusBlocked, StatusReviewReady:
+		return true
+	}
+	return false
+}
+
+func validRole(r string) bool {
+	return r == RoleImplementer || r == RoleReviewer || r == RolePlanner
+}
+
+func errorf(format string, args ...any) Message {
+	return Message{Type: MsgError, Error: fmt.Sprintf(format, args...)}
+}
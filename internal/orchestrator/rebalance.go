@@ -0,0 +1,183 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// DefaultStealThreshold is the smallest load (current task + queued tasks) an
+// agent must carry before idle agents steal from it. At 1 there would be
+// nothing to gain: the victim is about to pick the task up itself.
+const DefaultStealThreshold = 2
+
+// Inbox is the rebalancer's view of one agent.
+type Inbox struct {
+	AgentID string
+	Busy    bool     // Agent is working on a task
+	Queue   []string // Queued task IDs, front is next
+}
+
+func (ib Inbox) load() int {
+	n := len(ib.Queue)
+	if ib.Busy {
+		n++
+	}
+	return n
+}
+
+// Move is one task stolen from an agent's inbox by another.
+type Move struct {
+	TaskID string
+	From   string
+	To     string
+}
+
+func (m Move) String() string {
+	return fmt.Sprintf("%s: %s -> %s", m.TaskID, m.From, m.To)
+}
+
+// PlanRebalance decides which queued tasks idle agents should steal.
+//
+// Stealing follows the work-stealing deque convention: an idle agent (not busy,
+// empty queue) takes from the back of the most loaded agent's queue, leaving
+// the victim's next tasks in place. Only tasks movable returns true for are
+// taken; the daemon uses it to leave a task that picked up a blocker since it
+// was queued behind that blocker. Victims must carry at least threshold tasks.
+//
+// The plan is deterministic: agents are visited in ID order and ties go to
+// the lowest agent ID. inboxes is not modified.
+func PlanRebalance(inboxes []Inbox, movable func(taskID string) bool, threshold int) []Move {
+	if threshold < DefaultStealThreshold {
+		threshold = DefaultStealThreshold
+	}
+
+	work := make([]Inbox, len(inboxes))
+	for i, ib := range inboxes {
+		work[i] = Inbox{AgentID: ib.AgentID, Busy: ib.Busy, Queue: append([]string(nil), ib.Queue...)}
+	}
+	sort.Slice(work, func(i, j int) bool { return work[i].AgentID < work[j].AgentID })
+
+	var moves []Move
+	for t := range work {
+		thief := &work[t]
+		if thief.load() > 0 {
+			continue
+		}
+
+		// Most loaded victim that has something movable to give
+		var victim *Inbox
+		victimIdx := -1
+		for v := range work {
+			cand := &work[v]
+			if v == t || cand.load() < threshold {
+				continue
+			}
+			idx := lastMovable(cand, movable)
+			if idx < 0 {
+				continue
+			}
+			if victim == nil || cand.load() > victim.load() {
+				victim, victimIdx = cand, idx
+			}
+		}
+		if victim == nil {
+			continue
+		}
+
+		taskID := victim.Queue[victimIdx]
+		victim.Queue = append(victim.Queue[:victimIdx], victim.Queue[victimIdx+1:]...)
+		thief.Queue = append(thief.Queue, taskID)
+		moves = append(moves, Move{TaskID: taskID, From: victim.AgentID, To: thief.AgentID})
+	}
+	return moves
+}
+
+// lastMovable returns the index of the movable task nearest the back of the
+// queue, or -1. An agent that isn't busy keeps its front task: it is about to
+// pick it up.
+func lastMovable(ib *Inbox, movable func(string) bool) int {
+	first := 1
+	if ib.Busy {
+		first = 0
+	}
+	for i := len(ib.Queue) - 1; i >= first; i-- {
+		if movable(ib.Queue[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rebalance lets idle agents steal queued work from overloaded ones and
+// returns the moves made. Each move transfers the task's lease and is
+// recorded in its log.
+func (d *Daemon) Rebalance() []Move {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rebalance()
+}
+
+func (d *Daemon) rebalance() []Move {
+	agents := d.sortedAgents()
+	inboxes := make([]Inbox, 0, len(agents))
+	queued := make(map[string]*model.Assignment)
+	for _, ag := range agents {
+		if ag.restored {
+			// Don't hand work to, or take it from, an agent that hasn't come back yet
+			continue
+		}
+		ib := Inbox{AgentID: ag.id, Busy: ag.current != nil}
+		for _, a := range ag.inbox {
+			ib.Queue = append(ib.Queue, a.ItemID)
+			queued[a.ItemID] = a
+		}
+		inboxes = append(inboxes, ib)
+	}
+
+	// Queued tasks were claimed when they were enqueued, so they are already
+	// in_progress and can't become unclaimable. What can still change is a
+	// blocker added since, or the lease going because the task was blocked or
+	// closed by hand.
+	movable := func(taskID string) bool {
+		if !d.holdsLease(queued[taskID]) {
+			return false
+		}
+		unmet, err := d.db.HasUnmetDeps(taskID)
+		return err == nil && !unmet
+	}
+
+	var applied []Move
+	for _, m := range PlanRebalance(inboxes, movable, d.cfg.StealThreshold) {
+		from, to := d.agents[m.From], d.agents[m.To]
+		a := from.queued(m.TaskID)
+		if a == nil {
+			continue
+		}
+		if err := d.db.MoveAssignment(a.ID, a.ItemID, from.id, to.id); err != nil {
+			d.cfg.Logf("failed to move %s: %v", m, err)
+			continue
+		}
+		for i, q := range from.inbox {
+			if q == a {
+				from.inbox = append(from.inbox[:i], from.inbox[i+1:]...)
+				break
+			}
+		}
+		a.AgentID = to.id
+		to.inbox = append(to.inbox, a)
+		d.cfg.Logf("stole %s", m)
+		applied = append(applied, m)
+	}
+	return applied
+}
+
+func (ag *agent) queued(taskID string) *model.Assignment {
+	for _, a := range ag.inbox {
+		if a.ItemID == taskID {
+			return a
+		}
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package orchestrator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+func allMovable(string) bool { return true }
+
+func TestPlanRebalance_IdleStealsFromBack(t *testing.T) {
+	inboxes := []Inbox{
+		{AgentID: "aaaaaa", Busy: true, Queue: []string{"t1", "t2", "t3"}},
+		{AgentID: "bbbbbb"},
+	}
+
+	moves := PlanRebalance(inboxes, allMovable, DefaultStealThreshold)
+	want := []Move{{TaskID: "t3", From: "aaaaaa", To: "bbbbbb"}}
+	if !reflect.DeepEqual(moves, want) {
+		t.Errorf("moves = %v, want %v", moves, want)
+	}
+	// Input is left alone
+	if len(inboxes[0].Queue) != 3 {
+		t.Errorf("input queue modified: %v", inboxes[0].Queue)
+	}
+}
+
+func TestPlanRebalance_MostLoadedVictim(t *testing.T) {
+	inboxes := []Inbox{
+		{AgentID: "aaaaaa", Busy: true, Queue: []string{"a1"}},
+		{AgentID: "bbbbbb", Busy: true, Queue: []string{"b1", "b2", "b3"}},
+		{AgentID: "cccccc"},
+		{AgentID: "dddddd"},
+	}
+
+	moves := PlanRebalance(inboxes, allMovable, DefaultStealThreshold)
+	want := []Move{
+		{TaskID: "b3", From: "bbbbbb", To: "cccccc"},
+		// bbbbbb still carries the most (busy + 2 queued vs busy + 1)
+		{TaskID: "b2", From: "bbbbbb", To: "dddddd"},
+	}
+	if !reflect.DeepEqual(moves, want) {
+		t.Errorf("moves = %v, want %v", moves, want)
+	}
+}
+
+func TestPlanRebalance_RespectsDeps(t *testing.T) {
+	inboxes := []Inbox{
+		{AgentID: "aaaaaa", Busy: true, Queue: []string{"ready", "blocked"}},
+		{AgentID: "bbbbbb"},
+	}
+	movable := func(id string) bool { return id != "blocked" }
+
+	moves := PlanRebalance(inboxes, movable, DefaultStealThreshold)
+	want := []Move{{TaskID: "ready", From: "aaaaaa", To: "bbbbbb"}}
+	if !reflect.DeepEqual(moves, want) {
+		t.Errorf("moves = %v, want %v", moves, want)
+	}
+
+	// Nothing movable: nothing moves
+	moves = PlanRebalance(inboxes, func(string) bool { return false }, DefaultStealThreshold)
+	if len(moves) != 0 {
+		t.Errorf("moves = %v, want none", moves)
+	}
+}
+
+func TestPlanRebalance_KeepsIdleVictimsNextTask(t *testing.T) {
+	// Not busy: "next" is about to be picked up, only "later" can go
+	inboxes := []Inbox{
+		{AgentID: "aaaaaa", Queue: []string{"next", "later"}},
+		{AgentID: "bbbbbb"},
+		{AgentID: "cccccc"},
+	}
+
+	moves := PlanRebalance(inboxes, allMovable, DefaultStealThreshold)
+	want := []Move{{TaskID: "later", From: "aaaaaa", To: "bbbbbb"}}
+	if !reflect.DeepEqual(moves, want) {
+		t.Errorf("moves = %v, want %v", moves, want)
+	}
+}
+
+func TestPlanRebalance_Threshold(t *testing.T) {
+	inboxes := []Inbox{
+		{AgentID: "aaaaaa", Busy: true, Queue: []string{"t1", "t2"}},
+		{AgentID: "bbbbbb"},
+	}
+
+	if moves := PlanRebalance(inboxes, allMovable, 4); len(moves) != 0 {
+		t.Errorf("moves = %v, want none below threshold", moves)
+	}
+	if moves := PlanRebalance(inboxes, allMovable, 3); len(moves) != 1 {
+		t.Errorf("moves = %v, want one at threshold", moves)
+	}
+}
+
+func TestPlanRebalance_Deterministic(t *testing.T) {
+	inboxes := []Inbox{
+		{AgentID: "dddddd"},
+		{AgentID: "bbbbbb", Busy: true, Queue: []string{"b1", "b2"}},
+		{AgentID: "aaaaaa", Busy: true, Queue: []string{"a1", "a2"}},
+		{AgentID: "cccccc"},
+	}
+
+	first := PlanRebalance(inboxes, allMovable, DefaultStealThreshold)
+	for i := 0; i < 10; i++ {
+		if again := PlanRebalance(inboxes, allMovable, DefaultStealThreshold); !reflect.DeepEqual(first, again) {
+			t.Fatalf("plan changed between runs: %v vs %v", first, again)
+		}
+	}
+	// Ties go to the lowest agent ID, on both sides
+	want := []Move{
+		{TaskID: "a2", From: "aaaaaa", To: "cccccc"},
+		{TaskID: "b2", From: "bbbbbb", To: "dddddd"},
+	}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("moves = %v, want %v", first, want)
+	}
+}
+
+func TestRebalance_MovesLeaseAndLogs(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{})
+	for _, id := range []string{"ts-aaa001", "ts-aaa002", "ts-aaa003"} {
+		createTask(t, database, id, 2)
+	}
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	for _, id := range []string{"ts-aaa001", "ts-aaa002", "ts-aaa003"} {
+		mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: id}, MsgOK)
+	}
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent2"}, MsgOK)
+
+	moves := d.Rebalance()
+	want := []Move{{TaskID: "ts-aaa003", From: "agent1", To: "agent2"}}
+	if !reflect.DeepEqual(moves, want) {
+		t.Fatalf("moves = %v, want %v", moves, want)
+	}
+
+	lease, _ := database.GetLease("ts-aaa003")
+	if lease == nil || lease.Actor != "agent2" {
+		t.Errorf("lease = %+v, want held by agent2", lease)
+	}
+	assignments, _ := database.GetAssignments("ts-aaa003")
+	if len(assignments) != 1 || assignments[0].AgentID != "agent2" || assignments[0].State != model.AssignmentQueued {
+		t.Errorf("assignments = %+v, want one queued for agent2", assignments)
+	}
+	logs, _ := database.GetLogs("ts-aaa003")
+	if !strings.Contains(logs[len(logs)-1].Message, "Moved from agent agent1 to agent agent2") {
+		t.Errorf("last log = %q", logs[len(logs)-1].Message)
+	}
+
+	reply := mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent2"}, MsgAssign)
+	if reply.TaskID != "ts-aaa003" {
+		t.Errorf("agent2 polled %s, want ts-aaa003", reply.TaskID)
+	}
+}
+
+func TestRebalance_SkipsTaskWithUnmetDeps(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{})
+	for _, id := range []string{"ts-aaa001", "ts-aaa002", "ts-aaa003", "ts-blk001"} {
+		createTask(t, database, id, 2)
+	}
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	for _, id := range []string{"ts-aaa001", "ts-aaa002", "ts-aaa003"} {
+		mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: id}, MsgOK)
+	}
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	// A blocker discovered after assignment pins ts-aaa003 in place
+	if err := database.AddDep("ts-aaa003", "ts-blk001"); err != nil {
+		t.Fatalf("failed to add dep: %v", err)
+	}
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent2"}, MsgOK)
+
+	moves := d.Rebalance()
+	want := []Move{{TaskID: "ts-aaa002", From: "agent1", To: "agent2"}}
+	if !reflect.DeepEqual(moves, want) {
+		t.Errorf("moves = %v, want %v", moves, want)
+	}
+}
+
+func TestRebalance_SkipsTaskNoLongerClaimed(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{})
+	for _, id := range []string{"ts-aaa001", "ts-aaa002", "ts-aaa003"} {
+		createTask(t, database, id, 2)
+	}
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	for _, id := range []string{"ts-aaa001", "ts-aaa002", "ts-aaa003"} {
+		mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: id}, MsgOK)
+	}
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	// Queued tasks are in progress already; blocking one by hand drops its lease
+	if got := taskStatus(t, database, "ts-aaa003"); got != model.StatusInProgress {
+		t.Fatalf("queued status = %s, want in_progress", got)
+	}
+	if err := database.UpdateStatus("ts-aaa003", model.StatusBlocked); err != nil {
+		t.Fatalf("failed to block task: %v", err)
+	}
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent2"}, MsgOK)
+
+	moves := d.Rebalance()
+	want := []Move{{TaskID: "ts-aaa002", From: "agent1", To: "agent2"}}
+	if !reflect.DeepEqual(moves, want) {
+		t.Errorf("moves = %v, want %v", moves, want)
+	}
+}
+
+func TestPoll_StealsBeforeReadyPool(t *testing.T) {
+	d, database, _ := setupDaemon(t, Config{Project: "test"})
+	for _, id := range []string{"ts-aaa001", "ts-aaa002", "ts-aaa003", "ts-pool01"} {
+		createTask(t, database, id, 2)
+	}
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent1"}, MsgOK)
+	for _, id := range []string{"ts-aaa001", "ts-aaa002", "ts-aaa003"} {
+		mustHandle(t, d, Message{Type: MsgAssign, AgentID: "agent1", TaskID: id}, MsgOK)
+	}
+	mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent1"}, MsgAssign)
+	mustHandle(t, d, Message{Type: MsgRegister, AgentID: "agent2"}, MsgOK)
+
+	reply := mustHandle(t, d, Message{Type: MsgPoll, AgentID: "agent2"}, MsgAssign)
+	if reply.TaskID != "ts-aaa003" {
+		t.Errorf("agent2 polled %s, want stolen ts-aaa003", reply.TaskID)
+	}
+}
+
+// simAgent is a simulated agent that needs a fixed number of ticks per task.
+type simAgent struct {
+	id        string
+	task      string
+	remaining int
+}
+
+// simulate runs agents against the daemon until every task is in review,
+// rebalancing at the start of each tick. Returns the ticks taken and the moves
+// made by those rebalances. Task i takes durations[i] ticks.
+func simulate(t *testing.T, numAgents int, durations []int, threshold int) (int, []Move) {
+	t.Helper()
+	// Project "none" keeps idle agents from pulling work from the ready pool
+	d, database, _ := setupDaemon(t, Config{Project: "none", StealThreshold: threshold})
+
+	agents := make([]*simAgent, numAgents)
+	for i := range agents {
+		agents[i] = &simAgent{id: fmt.Sprintf("sim%03d", i)}
+		mustHandle(t, d, Message{Type: MsgRegister, AgentID: agents[i].id}, MsgOK)
+	}
+
+	// Everything lands in the first agent's inbox, the worst case
+	ticksFor := make(map[string]int)
+	for i, dur := range durations {
+		id := fmt.Sprintf("ts-sim%03d", i)
+		createTask(t, database, id, 2)
+		ticksFor[id] = dur
+		mustHandle(t, d, Message{Type: MsgAssign, AgentID: agents[0].id, TaskID: id}, MsgOK)
+	}
+
+	var moves []Move
+	finished := 0
+	for tick := 1; tick < 10000; tick++ {
+		moves = append(moves, d.Rebalance()...)
+		for _, ag := range agents {
+			if ag.task == "" {
+				reply := d.Handle(Message{Type: MsgPoll, AgentID: ag.id})
+				if reply.Type != MsgAssign {
+					continue
+				}
+				ag.task, ag.remaining = reply.TaskID, ticksFor[reply.TaskID]
+			}
+			ag.remaining--
+			if ag.remaining == 0 {
+				mustHandle(t, d, Message{Type: MsgResult, AgentID: ag.id, TaskID: ag.task}, MsgOK)
+				ag.task = ""
+				finished++
+			}
+		}
+		if finished == len(durations) {
+			return tick, moves
+		}
+	}
+	t.Fatal("simulation did not finish")
+	return 0, nil
+}
+
+func TestSimulation_StealingSpreadsWork(t *testing.T) {
+	durations := []int{3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5, 8}
+
+	// A threshold nobody reaches turns stealing off
+	serial, noMoves := simulate(t, 4, durations, len(durations)+1)
+	if len(noMoves) != 0 {
+		t.Fatalf("moves without stealing: %v", noMoves)
+	}
+	total := 0
+	for _, dur := range durations {
+		total += dur
+	}
+	if serial != total {
+		t.Errorf("without stealing took %d ticks, want %d (one agent does everything)", serial, total)
+	}
+
+	parallel, moves := simulate(t, 4, durations, DefaultStealThreshold)
+	if len(moves) == 0 {
+		t.Fatal("expected some tasks to be stolen")
+	}
+	if parallel >= serial {
+		t.Errorf("with stealing took %d ticks, without %d; expected a speedup", parallel, serial)
+	}
+
+	// Same inputs, same schedule
+	again, movesAgain := simulate(t, 4, durations, DefaultStealThreshold)
+	if again != parallel || !reflect.DeepEqual(moves, movesAgain) {
+		t.Errorf("simulation is not deterministic: %d ticks %v vs %d ticks %v", parallel, moves, again, movesAgain)
+	}
+}
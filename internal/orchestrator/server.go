@@ -0,0 +1,113 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxMessageSize bounds a single JSON line; messages carry IDs and short notes only.
+const maxMessageSize = 64 * 1024
+
+// Serve accepts connections on ln and handles messages until ctx is canceled.
+// It also sweeps for agents that missed heartbeats. ln is closed on return.
+func (d *Daemon) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.sweepLoop(ctx)
+	}()
+
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	var conns sync.WaitGroup
+	defer func() {
+		cancel()
+		conns.Wait()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			d.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// serveConn reads newline-delimited requests and writes one reply per request.
+func (d *Daemon) serveConn(ctx context.Context, conn net.Conn) {
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		_ = conn.Close()
+	}()
+	// Unblock the read when the daemon shuts down
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxMessageSize)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg Message
+		reply := errorf("invalid message: expected a JSON object")
+		if err := json.Unmarshal(line, &msg); err == nil {
+			reply = d.Handle(msg)
+		}
+		if err := enc.Encode(reply); err != nil {
+			return
+		}
+	}
+}
+
+func (d *Daemon) sweepLoop(ctx context.Context) {
+	// Sweep several times per TTL so a lost agent is noticed promptly and its
+	// peers' backlogs are spread to agents that went idle
+	interval := d.cfg.HeartbeatTTL / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Sweep()
+			d.Rebalance()
+		}
+	}
+}
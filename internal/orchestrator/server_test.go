@@ -0,0 +1,62 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestServe_UnixSocket(t *testing.T) {
+	d, _, _ := setupDaemon(t, Config{})
+
+	sock := filepath.Join(t.TempDir(), "d.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Serve(ctx, ln) }()
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+
+	send := func(raw string) Message {
+		t.Helper()
+		if _, err := conn.Write([]byte(raw + "\n")); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("failed to read reply: %v", err)
+		}
+		var reply Message
+		if err := json.Unmarshal(line, &reply); err != nil {
+			t.Fatalf("bad reply %q: %v", line, err)
+		}
+		return reply
+	}
+
+	if reply := send(`{"type":"REGISTER","agent_id":"abc123"}`); reply.Type != MsgOK {
+		t.Errorf("register reply = %+v", reply)
+	}
+	if reply := send(`{"type":"POLL","agent_id":"abc123"}`); reply.Type != MsgEmpty {
+		t.Errorf("poll reply = %+v", reply)
+	}
+	if reply := send(`not json`); reply.Type != MsgError {
+		t.Errorf("garbage reply = %+v", reply)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
@@ -0,0 +1,391 @@
+// Package pages parses learning pages: Markdown files in a repository that
+// hold the canonical text of learnings. prog indexes each page as a stub (a
+// title, one-liner and short summary with the page's path), so agents see
+// stubs first and open the full page only when they need it. See
+// docs/context-engine-spec.md.
+//
+// A page follows a template: a "# Title", then "## Problem", "## Pattern /
+// Rule", "## Example", "## Caveats / When to ignore" and "## References"
+// sections. Optional YAML-style frontmatter sets tags, the updated date and
+// provenance, and can override the stub's one-liner and summary:
+//
+//	---
+//	tags: [db, sqlite, migrations]
+//	updated: 2026-01-21
+//	provenance: [ts-a1b2c3, "#142"]
+//	files: [internal/db/db.go]
+//	---
+package pages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultDir is where learning pages live, relative to the repository root.
+const DefaultDir = "docs/learnings"
+
+// MaxOneLiner is the longest a stub's one-liner may be.
+const MaxOneLiner = 120
+
+// Sections of the page template, by the key Page.Sections uses.
+const (
+	SectionProblem    = "problem"
+	SectionPattern    = "pattern"
+	SectionExample    = "example"
+	SectionCaveats    = "caveats"
+	SectionReferences = "references"
+)
+
+// sectionNames are the template sections in order, with the heading that
+// names each in error messages.
+var sectionNames = []struct{ key, heading string }{
+	{SectionProblem, "Problem"},
+	{SectionPattern, "Pattern / Rule"},
+	{SectionExample, "Example"},
+	{SectionCaveats, "Caveats / When to ignore"},
+	{SectionReferences, "References"},
+}
+
+// sectionKeys maps the first word of a "## " heading to its section, so
+// "Pattern", "Rule" and "Pattern / Rule" are all the pattern section.
+var sectionKeys = map[string]string{
+	"problem": SectionProblem, "problems": SectionProblem,
+	"pattern": SectionPattern, "patterns": SectionPattern, "rule": SectionPattern, "rules": SectionPattern,
+	"example": SectionExample, "examples": SectionExample,
+	"caveat": SectionCaveats, "caveats": SectionCaveats, "when": SectionCaveats,
+	"reference": SectionReferences, "references": SectionReferences, "refs": SectionReferences,
+}
+
+// Page is a parsed learning page and the stub derived from it.
+type Page struct {
+	Path       string            // Repo-relative, slash-separated
+	Hash       string            // SHA-256 of the content, to skip unchanged pages when reindexing
+	Title      string            // From frontmatter, or the "# " heading
+	OneLiner   string            // From frontmatter, or the first sentence of the pattern
+	Summary    string            // From frontmatter, or the first sentences of the problem
+	Tags       []string          // Indexed as concepts
+	Files      []string          // Code the page is about
+	Provenance []string          // Tasks, issues, PRs or commits the learning came from
+	Updated    time.Time         // From frontmatter; zero if not given
+	Sections   map[string]string // Body of each template section found, by section key
+}
+
+// InvalidError reports a page that fails the template's quality gates.
+type InvalidError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("%s was not indexed:\n  - %s", e.Path, strings.Join(e.Problems, "\n  - "))
+}
+
+// Parse parses a learning page's content. path is recorded as given.
+func Parse(path string, content []byte) (*Page, error) {
+	sum := sha256.Sum256(content)
+	p := &Page{
+		Path:     path,
+		Hash:     hex.EncodeToString(sum[:]),
+		Sections: make(map[string]string),
+	}
+
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	front, body, err := splitFrontmatter(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for key, values := range front {
+		switch key {
+		case "title":
+			p.Title = strings.Join(values, ", ")
+		case "one_liner", "one-liner", "oneliner":
+			p.OneLiner = strings.Join(values, ", ")
+		case "summary", "description":
+			p.Summary = strings.Join(values, ", ")
+		case "tags", "concepts":
+			p.Tags = values
+		case "files":
+			p.Files = values
+		case "provenance", "task", "tasks", "source", "sources":
+			p.Provenance = append(p.Provenance, values...)
+		case "updated", "updated_at":
+			if len(values) == 1 {
+				if p.Updated, err = parseDate(values[0]); err != nil {
+					return nil, fmt.Errorf("%s: invalid updated date %q (use YYYY-MM-DD)", path, values[0])
+				}
+			}
+		}
+	}
+
+	parseSections(p, body)
+
+	if p.OneLiner == "" {
+		p.OneLiner = truncate(firstSentences(p.Sections[SectionPattern], 1), MaxOneLiner)
+	}
+	if p.Summary == "" {
+		p.Summary = firstSentences(p.Sections[SectionProblem], 3)
+	}
+	if len(p.Provenance) == 0 {
+		p.Provenance = listItems(p.Sections[SectionReferences], 5)
+	}
+	return p, nil
+}
+
+// Validate checks the page against the template: a title, every section,
+// and a problem, pattern, example and caveat that aren't empty.
+func (p *Page) Validate() error {
+	var problems []string
+	if p.Title == "" {
+		problems = append(problems, "missing title (a '# Title' heading, or title in the frontmatter)")
+	}
+	for _, s := range sectionNames {
+		body, ok := p.Sections[s.key]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("missing section: ## %s", s.heading))
+		case body == "" && s.key != SectionReferences:
+			problems = append(problems, fmt.Sprintf("section ## %s is empty", s.heading))
+		}
+	}
+	if n := len([]rune(p.OneLiner)); n > MaxOneLiner {
+		problems = append(problems, fmt.Sprintf("one_liner is %d characters; keep it to %d", n, MaxOneLiner))
+	}
+	if len(problems) > 0 {
+		return &InvalidError{Path: p.Path, Problems: problems}
+	}
+	return nil
+}
+
+// splitFrontmatter separates "---"-delimited frontmatter from the body,
+// parsing it as "key: value", "key: [a, b]" or a "key:" followed by "- item"
+// lines. Keys are lowercased.
+func splitFrontmatter(text string) (map[string][]string, string, error) {
+	front := make(map[string][]string)
+	if !strings.HasPrefix(text, "---\n") {
+		return front, text, nil
+	}
+	// Prepend the newline the opening line ended with, so empty frontmatter
+	// closes like any other
+	rest := text[len("---"):]
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return nil, "", errors.New("frontmatter is not closed with ---")
+	}
+	block, body := rest[:end], rest[end+len("\n---"):]
+	body = strings.TrimPrefix(body, "\n")
+
+	var key string
+	for _, line := range strings.Split(block, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && key != "" {
+			front[key] = append(front[key], unquote(item))
+			continue
+		}
+		k, v, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, "", fmt.Errorf("invalid frontmatter line %q", trimmed)
+		}
+		key = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		switch {
+		case v == "":
+			front[key] = nil
+		case strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]"):
+			var values []string
+			for _, item := range strings.Split(v[1:len(v)-1], ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					values = append(values, item)
+				}
+			}
+			front[key] = values
+		default:
+			front[key] = []string{unquote(v)}
+		}
+	}
+	return front, body, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseSections finds the title and template sections. Headings inside code
+// blocks don't count, and deeper headings belong to their section.
+func parseSections(p *Page, body string) {
+	var current string
+	var lines []string
+	flush := func() {
+		if current != "" {
+			p.Sections[current] = strings.TrimSpace(strings.Join(lines, "\n"))
+		}
+		lines = nil
+	}
+
+	inCode := false
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCode = !inCode
+		}
+		if !inCode {
+			if title, ok := strings.CutPrefix(line, "# "); ok {
+				flush()
+				current = ""
+				if p.Title == "" {
+					p.Title = strings.TrimSpace(title)
+				}
+				continue
+			}
+			if heading, ok := strings.CutPrefix(line, "## "); ok {
+				flush()
+				current = ""
+				if words := strings.FieldsFunc(strings.ToLower(heading), isSeparator); len(words) > 0 {
+					current = sectionKeys[words[0]]
+				}
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	flush()
+}
+
+func isSeparator(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+}
+
+// firstSentences returns up to n sentences from the first paragraph of a
+// section, as plain text on one line.
+func firstSentences(section string, n int) string {
+	para, _, _ := strings.Cut(section, "\n\n")
+	var words []string
+	for _, line := range strings.Split(para, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimLeft(line, "-*> ")
+		words = append(words, strings.Fields(line)...)
+	}
+	text := strings.Join(words, " ")
+
+	end := 0
+	for i := 0; i < n; i++ {
+		next := sentenceEnd(text[end:])
+		if next < 0 {
+			return text
+		}
+		end += next
+	}
+	return strings.TrimSpace(text[:end])
+}
+
+// sentenceEnd returns the index just past the first sentence in s, or -1 if
+// s is a single sentence.
+func sentenceEnd(s string) int {
+	for i := 0; i < len(s)-1; i++ {
+		if (s[i] == '.' || s[i] == '!' || s[i] == '?') && s[i+1] == ' ' {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// listItems returns up to n items of a Markdown list, or its lines.
+func listItems(section string, n int) []string {
+	var items []string
+	for _, line := range strings.Split(section, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*+"))
+		if line != "" && len(items) < n {
+			items = append(items, line)
+		}
+	}
+	return items
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(r[:n-3])) + "..."
+}
+
+// FindRoot returns the repository root for dir: the nearest directory, from
+// dir up, containing .git. Pages are indexed by their path from the root.
+func FindRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("%s is not in a git repository", dir)
+		}
+	}
+}
+
+// RelPath returns the repo-relative, slash-separated path of file, which is
+// relative to the current directory or absolute.
+func RelPath(root, file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the repository at %s", file, root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Discover returns the repo-relative paths of the Markdown pages under dir
+// in root, skipping README.md and index.md, which describe the directory.
+func Discover(root, dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(filepath.Join(root, dir), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), ".") && path != filepath.Join(root, dir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := strings.ToLower(d.Name())
+		if filepath.Ext(name) != ".md" || name == "readme.md" || name == "index.md" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return paths, err
+}
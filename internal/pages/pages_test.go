@@ -0,0 +1,147 @@
+package pages
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const goodPage = `---
+tags: [db, migrations]
+updated: 2026-01-21
+files:
+  - internal/db/db.go
+---
+# Migrations must be re-runnable
+
+## Problem
+A migration that fails halfway leaves the schema at the old version. The next
+run applies it again. Statements that aren't idempotent then fail forever.
+
+## Pattern / Rule
+Use IF NOT EXISTS on every CREATE. Split ALTERs into their own migration.
+
+## Example
+` + "```sql" + `
+## Not a heading
+CREATE TABLE IF NOT EXISTS reviews (id INTEGER PRIMARY KEY);
+` + "```" + `
+
+## Caveats / When to ignore
+ALTER TABLE ADD COLUMN has no IF NOT EXISTS form.
+
+## References
+- ts-a1b2c3
+- #142
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse("docs/learnings/migrations.md", []byte(goodPage))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("valid page rejected: %v", err)
+	}
+
+	if p.Title != "Migrations must be re-runnable" {
+		t.Errorf("title = %q", p.Title)
+	}
+	if p.OneLiner != "Use IF NOT EXISTS on every CREATE." {
+		t.Errorf("one-liner = %q", p.OneLiner)
+	}
+	wantSummary := "A migration that fails halfway leaves the schema at the old version. The next run applies it again. Statements that aren't idempotent then fail forever."
+	if p.Summary != wantSummary {
+		t.Errorf("summary = %q, want %q", p.Summary, wantSummary)
+	}
+	if !reflect.DeepEqual(p.Tags, []string{"db", "migrations"}) {
+		t.Errorf("tags = %q", p.Tags)
+	}
+	if !reflect.DeepEqual(p.Files, []string{"internal/db/db.go"}) {
+		t.Errorf("files = %q", p.Files)
+	}
+	if !reflect.DeepEqual(p.Provenance, []string{"ts-a1b2c3", "#142"}) {
+		t.Errorf("provenance = %q", p.Provenance)
+	}
+	if !p.Updated.Equal(time.Date(2026, 1, 21, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("updated = %v", p.Updated)
+	}
+	if !strings.Contains(p.Sections[SectionExample], "## Not a heading") {
+		t.Errorf("heading in a code block split the example: %q", p.Sections[SectionExample])
+	}
+	if p.Hash == "" {
+		t.Error("hash not set")
+	}
+}
+
+func TestParse_FrontmatterOverrides(t *testing.T) {
+	content := "---\ntitle: \"Custom\"\none_liner: Short\nsummary: Longer summary.\n---\n" +
+		strings.SplitN(goodPage, "---\n", 3)[2]
+	p, err := Parse("a.md", []byte(content))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if p.Title != "Custom" || p.OneLiner != "Short" || p.Summary != "Longer summary." {
+		t.Errorf("frontmatter ignored: title %q, one-liner %q, summary %q", p.Title, p.OneLiner, p.Summary)
+	}
+
+	if _, err := Parse("b.md", []byte("---\ntags: [a]\n# Title\n")); err == nil {
+		t.Error("unclosed frontmatter accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	content := strings.Replace(goodPage, "## Caveats / When to ignore\nALTER TABLE ADD COLUMN has no IF NOT EXISTS form.\n", "", 1)
+	content = strings.Replace(content, "## Example\n", "## Examples\n\n", 1)
+	content = strings.Replace(content, "Use IF NOT EXISTS on every CREATE.", strings.Repeat("x", 130)+".", 1)
+	content = strings.Replace(content, "## Problem\n", "## Problem\n\n## Ignored\n", 1)
+
+	p, err := Parse("docs/learnings/bad.md", []byte(content))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	err = p.Validate()
+	var invalid *InvalidError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("invalid page accepted: %v", err)
+	}
+	want := []string{
+		"section ## Problem is empty",
+		"missing section: ## Caveats / When to ignore",
+	}
+	if !reflect.DeepEqual(invalid.Problems, want) {
+		t.Errorf("problems = %q, want %q", invalid.Problems, want)
+	}
+	if p.OneLiner != strings.Repeat("x", 117)+"..." {
+		t.Errorf("long one-liner not truncated: %q", p.OneLiner)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"docs/learnings/a.md", "docs/learnings/db/b.md", "docs/learnings/README.md", "docs/learnings/notes.txt", "docs/other.md"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := Discover(root, DefaultDir)
+	if err != nil {
+		t.Fatalf("failed to discover: %v", err)
+	}
+	if want := []string{"docs/learnings/a.md", "docs/learnings/db/b.md"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+
+	if paths, err := Discover(root, "missing"); err != nil || paths != nil {
+		t.Errorf("missing dir = %q, %v", paths, err)
+	}
+}
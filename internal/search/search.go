@@ -0,0 +1,274 @@
+// Package search ranks learnings for free-text queries offline, with no
+// model or network: alongside SQLite's BM25 full-text ranking, each learning
+// is indexed as a TF-IDF vector of its words and their character trigrams,
+// so "expiring tokens" finds "Token expiry" and a typo still lands near the
+// word it meant. The two rankings are fused by reciprocal rank.
+//
+// Words are lowercased, stop words dropped and suffixes lightly stemmed.
+// Trigrams are of the unstemmed word, padded at both ends, and are kept
+// apart from words by a "#" prefix.
+package search
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	// GramWeight is how much trigram similarity counts against word
+	// similarity when scoring a document.
+	GramWeight = 0.5
+
+	// ExpansionWeight is how much a synonym added to a query counts against
+	// the query's own words.
+	ExpansionWeight = 0.5
+
+	// FusionK damps the reciprocal rank fusion of rankings: a document's
+	// fused score is the sum of 1/(FusionK+rank) over the rankings it is in.
+	FusionK = 60
+)
+
+// stopWords are too common to say anything about a learning.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "do": true, "does": true, "for": true,
+	"from": true, "has": true, "have": true, "how": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "its": true, "not": true, "of": true,
+	"on": true, "or": true, "so": true, "that": true, "the": true, "then": true,
+	"there": true, "this": true, "to": true, "was": true, "were": true,
+	"what": true, "when": true, "where": true, "which": true, "while": true,
+	"why": true, "will": true, "with": true,
+}
+
+// tokens splits text into lowercase runs of letters and digits.
+func tokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Words returns the stemmed words of text, without stop words.
+func Words(text string) []string {
+	var words []string
+	for _, t := range tokens(text) {
+		if stopWords[t] {
+			continue
+		}
+		words = append(words, Stem(t))
+	}
+	return words
+}
+
+// Stem strips common English suffixes so forms of a word index alike:
+// "expiry", "expires", "expired" and "expiring" all stem to "expir". It is
+// crude, but only has to agree with itself.
+func Stem(word string) string {
+	if len([]rune(word)) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+	case strings.HasSuffix(word, "s"):
+		word = strings.TrimSuffix(word, "s")
+	}
+	switch {
+	case strings.HasSuffix(word, "ing") && len(word) > 5:
+		word = strings.TrimSuffix(word, "ing")
+	case strings.HasSuffix(word, "ed") && len(word) > 4:
+		word = strings.TrimSuffix(word, "ed")
+	}
+	if (strings.HasSuffix(word, "e") || strings.HasSuffix(word, "y")) && len(word) > 3 {
+		word = word[:len(word)-1]
+	}
+	return word
+}
+
+// grams returns the trigrams of a word padded with ^ and $, as terms.
+func grams(word string) []string {
+	r := []rune("^" + word + "$")
+	var out []string
+	for i := 0; i+3 <= len(r); i++ {
+		out = append(out, "#"+string(r[i:i+3]))
+	}
+	return out
+}
+
+// IsGram reports whether term is a trigram rather than a word.
+func IsGram(term string) bool {
+	return strings.HasPrefix(term, "#")
+}
+
+// Terms counts the terms text is indexed by: its stemmed words and the
+// trigrams of each word.
+func Terms(text string) map[string]float64 {
+	counts := make(map[string]float64)
+	for _, t := range tokens(text) {
+		if stopWords[t] {
+			continue
+		}
+		counts[Stem(t)]++
+		for _, g := range grams(t) {
+			counts[g]++
+		}
+	}
+	return counts
+}
+
+// Vector is a weighted set of terms.
+type Vector map[string]float64
+
+// DocumentVector returns the vector a document is stored as: each term
+// weighted by the log of its count, with words and trigrams each scaled to
+// unit length so that long words don't drown out the words themselves.
+// Inverse document frequency is left to the query, as it changes with
+// every learning added.
+func DocumentVector(text string) Vector {
+	return weigh(Terms(text), nil)
+}
+
+// QueryVector returns the vector a query is scored with: like a document's,
+// but with each term also weighted by idf, and trigrams by GramWeight. A
+// document's score is the dot product of the two, so 1 + GramWeight for a
+// document identical to the query.
+func QueryVector(counts map[string]float64, idf func(term string) float64) Vector {
+	v := weigh(counts, idf)
+	for t := range v {
+		if IsGram(t) {
+			v[t] *= GramWeight
+		}
+	}
+	return v
+}
+
+func weigh(counts map[string]float64, idf func(string) float64) Vector {
+	v := make(Vector, len(counts))
+	var words, grams float64
+	for t, n := range counts {
+		if n <= 0 {
+			continue
+		}
+		w := 1 + math.Log(max(n, 1))
+		if n < 1 {
+			w = n // A term that was only added at a fraction of a count
+		}
+		if idf != nil {
+			w *= idf(t)
+		}
+		v[t] = w
+		if IsGram(t) {
+			grams += w * w
+		} else {
+			words += w * w
+		}
+	}
+	words, grams = math.Sqrt(words), math.Sqrt(grams)
+	for t, w := range v {
+		norm := words
+		if IsGram(t) {
+			norm = grams
+		}
+		if norm == 0 {
+			delete(v, t)
+			continue
+		}
+		v[t] = w / norm
+	}
+	return v
+}
+
+// IDF is the inverse document frequency of a term found in df of n
+// documents, smoothed so that a term in every document still counts a
+// little and one in none doesn't divide by zero.
+func IDF(n, df int) float64 {
+	return math.Log(float64(n+1)/float64(df+1)) + 1
+}
+
+// Mentions reports whether text contains phrase: its words, in order and
+// adjacent, compared as stemmed.
+func Mentions(text, phrase string) bool {
+	p := Words(phrase)
+	return len(p) > 0 && containsRun(Words(text), p)
+}
+
+// Expand returns the synonyms a query brings in. Each group is a set of
+// phrases that mean the same thing, such as a concept's name and its
+// synonyms; if the query mentions one of a group's phrases, the group's
+// other phrases are returned.
+func Expand(query string, groups [][]string) []string {
+	var out []string
+	for _, group := range groups {
+		matched := -1
+		for i, phrase := range group {
+			if Mentions(query, phrase) {
+				matched = i
+				break
+			}
+		}
+		if matched < 0 {
+			continue
+		}
+		for i, phrase := range group {
+			if i != matched && !slices.Contains(out, phrase) {
+				out = append(out, phrase)
+			}
+		}
+	}
+	return out
+}
+
+// containsRun reports whether run appears in words, in order and adjacent.
+func containsRun(words, run []string) bool {
+	for i := 0; i+len(run) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(run)], run) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchQuery turns free text into an FTS5 MATCH expression that can't fail
+// to parse: each word is quoted, so operators, column filters and stray
+// punctuation are taken as plain text, and the words are ORed together for
+// BM25 to rank. A word ending in * stays a prefix search. Stop words are
+// dropped unless there is nothing else. Returns "" if text has no words.
+func MatchQuery(text string) string {
+	var all, kept []string
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		prefix := strings.HasSuffix(field, "*")
+		for _, t := range tokens(field) {
+			term := `"` + t + `"`
+			if prefix && strings.HasSuffix(strings.TrimRight(field, "*"), t) {
+				term += "*"
+			}
+			if slices.Contains(all, term) {
+				continue
+			}
+			all = append(all, term)
+			if !stopWords[t] {
+				kept = append(kept, term)
+			}
+		}
+	}
+	if len(kept) == 0 {
+		kept = all
+	}
+	return strings.Join(kept, " OR ")
+}
+
+// Fuse combines rankings, each a list of IDs best first, by reciprocal rank
+// fusion: an ID's score is the sum of 1/(FusionK+rank) over the rankings
+// that include it, so one ranked well by several beats one ranked first by
+// one.
+func Fuse(rankings ...[]string) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, ranking := range rankings {
+		for i, id := range ranking {
+			scores[id] += 1 / float64(FusionK+i+1)
+		}
+	}
+	return scores
+}
@@ -0,0 +1,146 @@
+package search
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"expires":    "expir",
+		"expired":    "expir",
+		"expiring":   "expir",
+		"expire":     "expir",
+		"tokens":     "token",
+		"expiry":     "expir",
+		"queries":    "quer",
+		"query":      "quer",
+		"process":    "process",
+		"status":     "status",
+		"analysis":   "analysis",
+		"caching":    "cach",
+		"cache":      "cach",
+		"refreshing": "refresh",
+		"go":         "go",
+		"ids":        "ids",
+	}
+	for word, want := range tests {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	got := Words("How do the Tokens expire? See auth/token.go")
+	want := []string{"token", "expir", "see", "auth", "token", "go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Words = %q, want %q", got, want)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	terms := Terms("Token tokens")
+	if terms["token"] != 2 {
+		t.Errorf("token counted %v times, want 2", terms["token"])
+	}
+	for _, g := range []string{"#^to", "#tok", "#oke", "#ken", "#en$", "#ns$"} {
+		if terms[g] == 0 {
+			t.Errorf("missing trigram %s in %v", g, terms)
+		}
+	}
+}
+
+func dot(a, b Vector) float64 {
+	var sum float64
+	for t, w := range a {
+		sum += w * b[t]
+	}
+	return sum
+}
+
+func TestVectors(t *testing.T) {
+	doc := DocumentVector("Session timeout is an hour")
+	var words, grams float64
+	for term, w := range doc {
+		if IsGram(term) {
+			grams += w * w
+		} else {
+			words += w * w
+		}
+	}
+	if math.Abs(words-1) > 1e-9 || math.Abs(grams-1) > 1e-9 {
+		t.Errorf("document words and trigrams should each have unit length, got %v and %v", words, grams)
+	}
+
+	flat := func(string) float64 { return 1 }
+	same := QueryVector(Terms("Session timeout is an hour"), flat)
+	if got := dot(same, doc); math.Abs(got-(1+GramWeight)) > 1e-9 {
+		t.Errorf("identical query scores %v, want %v", got, 1+GramWeight)
+	}
+
+	// Trigrams score a near miss above an unrelated document
+	typo := QueryVector(Terms("sesion timout"), flat)
+	unrelated := DocumentVector("Connection pool size affects throughput")
+	if near, far := dot(typo, doc), dot(typo, unrelated); near <= far || near == 0 {
+		t.Errorf("misspelt query scores %v against the document, %v against an unrelated one", near, far)
+	}
+
+	// A rare term counts for more than a common one
+	idf := func(term string) float64 {
+		if term == "hour" {
+			return IDF(10, 9)
+		}
+		return IDF(10, 1)
+	}
+	q := QueryVector(Terms("session hour"), idf)
+	if q["session"] <= q["hour"] {
+		t.Errorf("rare term weight %v should exceed common term weight %v", q["session"], q["hour"])
+	}
+}
+
+func TestExpand(t *testing.T) {
+	groups := [][]string{
+		{"sessions", "session timeout", "token expiry", "ttl"},
+		{"database", "sqlite"},
+	}
+	got := Expand("why do tokens expire? token expiry is odd", groups)
+	want := []string{"sessions", "session timeout", "ttl"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expand = %q, want %q", got, want)
+	}
+	if got := Expand("expiry of tokens", groups); len(got) != 0 {
+		t.Errorf("phrase words out of order expanded to %q", got)
+	}
+	if got := Expand("SQLite locking", groups); !slices.Equal(got, []string{"database"}) {
+		t.Errorf("Expand = %q, want [database]", got)
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	tests := map[string]string{
+		"token expiry":                `"token" OR "expiry"`,
+		`auth AND (token OR "refresh`: `"auth" OR "token" OR "refresh"`,
+		"title:foo -bar NEAR(":        `"title" OR "foo" OR "bar" OR "near"`,
+		"Tok* refresh":                `"tok"* OR "refresh"`,
+		"the token of the user token": `"token" OR "user"`,
+		"the of":                      `"the" OR "of"`,
+		"*** ()":                      "",
+	}
+	for text, want := range tests {
+		if got := MatchQuery(text); got != want {
+			t.Errorf("MatchQuery(%q) = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestFuse(t *testing.T) {
+	scores := Fuse([]string{"a", "b", "c"}, []string{"b", "c"})
+	if !(scores["b"] > scores["c"] && scores["c"] > scores["a"]) {
+		t.Errorf("fused scores = %v, want b > c > a", scores)
+	}
+	if _, ok := scores["d"]; ok {
+		t.Errorf("unranked ID scored")
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+// defaultChangeLimit bounds GET /v1/changes when no limit is given.
+const defaultChangeLimit = 100
+
+// changePollInterval is how often change streams check for new changes.
+var changePollInterval = 500 * time.Millisecond
+
+// listChanges returns a page of the change feed after the since cursor.
+func (s *Server) listChanges(database *db.DB, r *http.Request) (any, error) {
+	q := r.URL.Query()
+	since, err := intParam(q.Get("since"), 0)
+	if err != nil {
+		return nil, badRequestf("invalid since: %v", err)
+	}
+	limit, err := intParam(q.Get("limit"), defaultChangeLimit)
+	if err != nil || limit <= 0 {
+		return nil, badRequestf("invalid limit: %s", q.Get("limit"))
+	}
+	changes, err := database.Changes(db.ChangeFilter{After: since, Project: q.Get("project"), Limit: int(limit)})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ChangeJSON, 0, len(changes))
+	for _, c := range changes {
+		out = append(out, NewChangeJSON(c))
+	}
+	return out, nil
+}
+
+// streamChanges sends changes as server-sent events until the client goes
+// away. A reconnecting client's Last-Event-ID resumes where it left off;
+// otherwise the since parameter does, and without either only changes made
+// from now on are sent.
+func (s *Server) streamChanges(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("since")
+	}
+	since, err := intParam(cursor, -1)
+	if err != nil {
+		writeError(w, badRequestf("invalid since: %v", err))
+		return
+	}
+	if since < 0 {
+		if since, err = s.db.LatestChange(); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	filter := db.ChangeFilter{After: since, Project: r.URL.Query().Get("project"), Limit: defaultChangeLimit}
+	_ = s.db.FollowChanges(r.Context(), filter, changePollInterval, func(changes []model.Change) error {
+		for _, c := range changes {
+			data, err := json.Marshal(NewChangeJSON(c))
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", c.Seq, c.Kind, data); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+// intParam parses an integer query value, returning def when it is empty.
+func intParam(v string, def int64) (int64, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
@@ -0,0 +1,391 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+// CreateItemRequest is the body of POST /v1/items.
+type CreateItemRequest struct {
+	Title            string   `json:"title"`
+	Project          string   `json:"project"`
+	Type             string   `json:"type"`     // task (default) or epic
+	Status           string   `json:"status"`   // open (default) or draft
+	Priority         int      `json:"priority"` // 1-3, default 2
+	Description      string   `json:"description"`
+	DefinitionOfDone *string  `json:"definition_of_done"`
+	Parent           string   `json:"parent"`
+	Labels           []string `json:"labels"`
+	Areas            []string `json:"areas"`
+}
+
+// UpdateItemRequest is the body of PATCH /v1/items/{id}. Only the fields
+// present are changed; an empty definition_of_done clears it.
+type UpdateItemRequest struct {
+	Title            *string `json:"title"`
+	Description      *string `json:"description"`
+	DefinitionOfDone *string `json:"definition_of_done"`
+	Status           *string `json:"status"`
+	Parent           *string `json:"parent"` // Epic ID
+	Project          *string `json:"project"`
+}
+
+// LogRequest is the body of POST /v1/items/{id}/logs.
+type LogRequest struct {
+	Message string `json:"message"`
+}
+
+// DepRequest is the body of POST /v1/items/{id}/deps.
+type DepRequest struct {
+	DependsOn string `json:"depends_on"`
+}
+
+// LabelRequest is the body of POST /v1/items/{id}/labels.
+type LabelRequest struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) listItems(database *db.DB, r *http.Request) (any, error) {
+	q := r.URL.Query()
+	filter := db.ListFilter{
+		Project:   q.Get("project"),
+		Parent:    q.Get("parent"),
+		Type:      q.Get("type"),
+		Labels:    q["label"],
+		Assignee:  q.Get("assignee"),
+		CreatedBy: q.Get("created_by"),
+	}
+	if v := q.Get("status"); v != "" {
+		status := model.Status(v)
+		if !status.IsValid() {
+			return nil, badRequestf("invalid status: %s", v)
+		}
+		filter.Status = &status
+	}
+	items, err := database.ListItemsFiltered(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.PopulateItemLabels(items); err != nil {
+		return nil, err
+	}
+	return NewItemsJSON(items), nil
+}
+
+func (s *Server) createItem(database *db.DB, r *http.Request) (any, error) {
+	var req CreateItemRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Title == "" {
+		return nil, badRequestf("title is required")
+	}
+	if req.Project == "" {
+		return nil, badRequestf("project is required")
+	}
+
+	itemType := model.ItemTypeTask
+	if req.Type != "" {
+		itemType = model.ItemType(req.Type)
+	}
+	status := model.StatusOpen
+	switch req.Status {
+	case "", string(model.StatusOpen):
+	case string(model.StatusDraft):
+		status = model.StatusDraft
+	default:
+		return nil, badRequestf("new items must be open or draft, not %s", req.Status)
+	}
+	priority := req.Priority
+	if priority == 0 {
+		priority = 2
+	}
+
+	now := time.Now()
+	item := &model.Item{
+		ID:               model.GenerateID(itemType),
+		Project:          req.Project,
+		Type:             itemType,
+		Title:            req.Title,
+		Description:      req.Description,
+		DefinitionOfDone: req.DefinitionOfDone,
+		Status:           status,
+		Priority:         priority,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Labels:           req.Labels,
+		Areas:            req.Areas,
+	}
+	if item.DefinitionOfDone != nil && *item.DefinitionOfDone == "" {
+		item.DefinitionOfDone = nil
+	}
+	if req.Parent != "" {
+		item.ParentID = &req.Parent
+	}
+	if err := database.CreateItem(item); err != nil {
+		return nil, err
+	}
+	detail, err := LoadItemDetail(database, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	return created{detail}, nil
+}
+
+func (s *Server) getItem(database *db.DB, r *http.Request) (any, error) {
+	return LoadItemDetail(database, r.PathValue("id"))
+}
+
+func (s *Server) updateItem(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	var req UpdateItemRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	// One transaction, so a rejected field leaves the others unchanged too
+	edit := db.ItemEdit{
+		Title:            req.Title,
+		Description:      req.Description,
+		DefinitionOfDone: req.DefinitionOfDone,
+		Project:          req.Project,
+		Parent:           req.Parent,
+	}
+	if req.Status != nil {
+		status := model.Status(*req.Status)
+		edit.Status = &status
+	}
+	if err := database.EditItem(id, edit); err != nil {
+		return nil, err
+	}
+	return LoadItemDetail(database, id)
+}
+
+func (s *Server) deleteItem(database *db.DB, r *http.Request) (any, error) {
+	return nil, database.DeleteItem(r.PathValue("id"))
+}
+
+func (s *Server) restoreItem(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	if err := database.RestoreItem(id); err != nil {
+		return nil, err
+	}
+	return LoadItemDetail(database, id)
+}
+
+func (s *Server) getLogs(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	if _, err := database.GetItem(id); err != nil {
+		return nil, err
+	}
+	logs, err := database.GetLogs(id)
+	if err != nil {
+		return nil, err
+	}
+	return logsJSON(logs), nil
+}
+
+func (s *Server) addLog(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	var req LogRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Message == "" {
+		return nil, badRequestf("message is required")
+	}
+	if _, err := database.GetItem(id); err != nil {
+		return nil, err
+	}
+	if err := database.AddLog(id, req.Message); err != nil {
+		return nil, err
+	}
+	logs, err := database.GetLogs(id)
+	if err != nil {
+		return nil, err
+	}
+	return created{logsJSON(logs)}, nil
+}
+
+func (s *Server) getDeps(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	if _, err := database.GetItem(id); err != nil {
+		return nil, err
+	}
+	deps, err := database.GetDeps(id)
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(deps), nil
+}
+
+func (s *Server) addDep(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	var req DepRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.DependsOn == "" {
+		return nil, badRequestf("depends_on is required")
+	}
+	if err := database.AddDep(id, req.DependsOn); err != nil {
+		return nil, err
+	}
+	deps, err := database.GetDeps(id)
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(deps), nil
+}
+
+func (s *Server) getHistory(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	events, err := database.GetEvents(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		// Distinguish a quiet item from a mistyped ID
+		if _, err := database.GetItem(id); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]EventJSON, 0, len(events))
+	for _, e := range events {
+		out = append(out, EventJSON{
+			Field:     e.Field,
+			OldValue:  e.OldValue,
+			NewValue:  e.NewValue,
+			Actor:     e.Actor,
+			Reverts:   e.Reverts,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+func (s *Server) addLabel(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	var req LabelRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Name == "" {
+		return nil, badRequestf("name is required")
+	}
+	item, err := database.GetItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.AddLabelToItem(id, item.Project, req.Name); err != nil {
+		return nil, err
+	}
+	return LoadItemDetail(database, id)
+}
+
+func (s *Server) removeLabel(database *db.DB, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	item, err := database.GetItem(id)
+	if err != nil {
+		return nil, err
+	}
+	return nil, database.RemoveLabelFromItem(id, item.Project, r.PathValue("name"))
+}
+
+func (s *Server) readyItems(database *db.DB, r *http.Request) (any, error) {
+	q := r.URL.Query()
+	items, err := database.ReadyItemsMatching(db.ReadyFilter{
+		Project:     q.Get("project"),
+		Labels:      q["label"],
+		NoConflicts: q.Get("no_conflicts") == "true",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := database.PopulateItemLabels(items); err != nil {
+		return nil, err
+	}
+	return NewItemsJSON(items), nil
+}
+
+func (s *Server) projectStatus(database *db.DB, r *http.Request) (any, error) {
+	q := r.URL.Query()
+	report, err := database.ProjectStatusFiltered(q.Get("project"), q["label"])
+	if err != nil {
+		return nil, err
+	}
+	return NewStatusJSON(report), nil
+}
+
+func (s *Server) listDeps(database *db.DB, r *http.Request) (any, error) {
+	edges, err := database.GetAllDeps(r.URL.Query().Get("project"))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DepJSON, 0, len(edges))
+	for _, e := range edges {
+		out = append(out, DepJSON{
+			ItemID:          e.ItemID,
+			ItemTitle:       e.ItemTitle,
+			ItemStatus:      e.ItemStatus,
+			DependsOn:       e.DependsOnID,
+			DependsOnTitle:  e.DependsOnTitle,
+			DependsOnStatus: e.DependsOnStatus,
+		})
+	}
+	return out, nil
+}
+
+// LoadItemDetail loads an item with everything attached to it.
+func LoadItemDetail(database *db.DB, id string) (*ItemDetailJSON, error) {
+	item, err := database.GetItem(id)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := database.GetItemLabels(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		item.Labels = append(item.Labels, l.Name)
+	}
+	areas, err := database.GetItemAreas(id)
+	if err != nil {
+		return nil, err
+	}
+	criteria, err := database.GetCriteria(id)
+	if err != nil {
+		return nil, err
+	}
+	reviews, err := database.LatestReviews(id)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := database.GetDeps(id)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := database.GetLogs(id)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := database.GetLease(id)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &ItemDetailJSON{
+		ItemJSON:     NewItemJSON(*item),
+		Areas:        nonNil(areas),
+		Criteria:     criteriaJSON(criteria),
+		Reviews:      reviewsJSON(reviews),
+		Dependencies: nonNil(deps),
+		Logs:         logsJSON(logs),
+	}
+	if lease != nil {
+		detail.Lease = &LeaseJSON{Actor: lease.Actor, ClaimedAt: lease.ClaimedAt, ExpiresAt: lease.ExpiresAt}
+	}
+	return detail, nil
+}
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+// ItemJSON is the API representation of a task or epic. Epic status is
+// derived from the epic's children.
+type ItemJSON struct {
+	ID               string    `json:"id"`
+	Title            string    `json:"title"`
+	Type             string    `json:"type"`
+	Status           string    `json:"status"`
+	Priority         int       `json:"priority"`
+	Project          string    `json:"project"`
+	Parent           *string   `json:"parent"`
+	Description      string    `json:"description"`
+	DefinitionOfDone *string   `json:"definition_of_done"`
+	Labels           []string  `json:"labels"`
+	CreatedBy        string    `json:"created_by"`
+	Assignee         string    `json:"assignee"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// ItemDetailJSON is an item with its areas, definition of done criteria,
+// dependencies, logs and lease.
+type ItemDetailJSON struct {
+	ItemJSON
+	Areas        []string        `json:"areas"`
+	Criteria     []CriterionJSON `json:"criteria"`
+	Reviews      []ReviewJSON    `json:"reviews"`
+	Dependencies []string        `json:"dependencies"`
+	Logs         []LogJSON       `json:"logs"`
+	Lease        *LeaseJSON      `json:"lease,omitempty"`
+}
+
+// CriterionJSON is one criterion in an item's definition of done.
+type CriterionJSON struct {
+	Position  int        `json:"position"`
+	Text      string     `json:"text"`
+	Command   string     `json:"command,omitempty"`
+	Checked   bool       `json:"checked"`
+	Note      string     `json:"note,omitempty"`
+	CheckedBy string     `json:"checked_by,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+
+	Verification *VerificationJSON `json:"verification,omitempty"`
+}
+
+// VerificationJSON is the latest run of a criterion's command by prog verify.
+type VerificationJSON struct {
+	Command    string    `json:"command"`
+	Dir        string    `json:"dir,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	Passed     bool      `json:"passed"`
+	DurationMS int64     `json:"duration_ms"`
+	Output     string    `json:"output"`
+	RanBy      string    `json:"ran_by"`
+	RanAt      time.Time `json:"ran_at"`
+}
+
+// ReviewJSON is a reviewer's latest review of an item.
+type ReviewJSON struct {
+	Reviewer    string     `json:"reviewer"`
+	Verdict     string     `json:"verdict"`
+	Note        string     `json:"note,omitempty"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+}
+
+// LogJSON is a log entry on an item.
+type LogJSON struct {
+	Message   string    `json:"message"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LeaseJSON is a claim on an in-progress task.
+type LeaseJSON struct {
+	Actor     string    `json:"actor"`
+	ClaimedAt time.Time `json:"claimed_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EventJSON is one entry in an item's history.
+type EventJSON struct {
+	Field     string    `json:"field"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	Actor     string    `json:"actor"`
+	Reverts   int64     `json:"reverts,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChangeJSON is one entry in the change feed.
+type ChangeJSON struct {
+	Seq       int64     `json:"seq"`
+	Kind      string    `json:"kind"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Project   string    `json:"project"`
+	Actor     string    `json:"actor"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DepJSON is a dependency: item_id waits on depends_on.
+type DepJSON struct {
+	ItemID          string `json:"item_id"`
+	ItemTitle       string `json:"item_title"`
+	ItemStatus      string `json:"item_status"`
+	DependsOn       string `json:"depends_on"`
+	DependsOnTitle  string `json:"depends_on_title"`
+	DependsOnStatus string `json:"depends_on_status"`
+}
+
+// StatusJSON is a project overview, as shown by 'prog status'.
+type StatusJSON struct {
+	Project    string         `json:"project"`
+	Counts     map[string]int `json:"counts"`
+	Ready      []ItemJSON     `json:"ready"`
+	InProgress []ItemJSON     `json:"in_progress"`
+	Reviewing  []ItemJSON     `json:"reviewing"`
+	Blocked    []ItemJSON     `json:"blocked"`
+	Draft      []ItemJSON     `json:"draft"`
+	RecentDone []ItemJSON     `json:"recent_done"`
+}
+
+// LabelJSON is a project label.
+type LabelJSON struct {
+	Name    string `json:"name"`
+	Project string `json:"project"`
+	Color   string `json:"color"`
+}
+
+// ConceptJSON is a knowledge category with its learning count.
+type ConceptJSON struct {
+	Name          string    `json:"name"`
+	Project       string    `json:"project"`
+	Summary       string    `json:"summary"`
+	LearningCount int       `json:"learning_count"`
+	LastUpdated   time.Time `json:"last_updated"`
+}
+
+// LearningJSON is a recorded learning.
+type LearningJSON struct {
+	ID        string    `json:"id"`
+	Project   string    `json:"project"`
+	TaskID    *string   `json:"task_id"`
+	Summary   string    `json:"summary"`
+	Detail    string    `json:"detail"`
+	Files     []string  `json:"files"`
+	Concepts  []string  `json:"concepts"`
+	Status    string    `json:"status"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ReviewReason string `json:"review_reason,omitempty"` // Why it needs review
+
+	// Set for stubs of learning pages
+	Path       string   `json:"path,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Provenance []string `json:"provenance,omitempty"`
+}
+
+// NewItemJSON converts an item to its API representation.
+func NewItemJSON(item model.Item) ItemJSON {
+	return ItemJSON{
+		ID:               item.ID,
+		Title:            item.Title,
+		Type:             string(item.Type),
+		Status:           string(item.Status),
+		Priority:         item.Priority,
+		Project:          item.Project,
+		Parent:           item.ParentID,
+		Description:      item.Description,
+		DefinitionOfDone: item.DefinitionOfDone,
+		Labels:           nonNil(item.Labels),
+		CreatedBy:        item.CreatedBy,
+		Assignee:         item.Assignee,
+		CreatedAt:        item.CreatedAt,
+		UpdatedAt:        item.UpdatedAt,
+	}
+}
+
+// NewItemsJSON converts items to their API representation.
+func NewItemsJSON(items []model.Item) []ItemJSON {
+	out := make([]ItemJSON, 0, len(items))
+	for _, item := range items {
+		out = append(out, NewItemJSON(item))
+	}
+	return out
+}
+
+func logsJSON(logs []model.Log) []LogJSON {
+	out := make([]LogJSON, 0, len(logs))
+	for _, l := range logs {
+		out = append(out, LogJSON{Message: l.Message, Actor: l.Actor, CreatedAt: l.CreatedAt})
+	}
+	return out
+}
+
+// NewStatusJSON converts a status report to its API representation.
+func NewStatusJSON(report *db.StatusReport) StatusJSON {
+	return StatusJSON{
+		Project: report.Project,
+		Counts: map[string]int{
+			string(model.StatusDraft):      report.Draft,
+			string(model.StatusOpen):       report.Open,
+			string(model.StatusInProgress): report.InProgress,
+			string(model.StatusBlocked):    report.Blocked,
+			string(model.StatusReviewing):  report.Reviewing,
+			string(model.StatusDone):       report.Done,
+			string(model.StatusCanceled):   report.Canceled,
+			"ready":                        report.Ready,
+		},
+		Ready:      NewItemsJSON(report.ReadyItems),
+		InProgress: NewItemsJSON(report.InProgItems),
+		Reviewing:  NewItemsJSON(report.ReviewingItems),
+		Blocked:    NewItemsJSON(report.BlockedItems),
+		Draft:      NewItemsJSON(report.DraftItems),
+		RecentDone: NewItemsJSON(report.RecentDone),
+	}
+}
+
+// NewChangeJSON converts a change feed entry to its API representation.
+func NewChangeJSON(c model.Change) ChangeJSON {
+	return ChangeJSON{
+		Seq:       c.Seq,
+		Kind:      c.Kind,
+		Action:    c.Action,
+		Target:    c.Target,
+		Project:   c.Project,
+		Actor:     c.Actor,
+		OldValue:  c.OldValue,
+		NewValue:  c.NewValue,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+func criteriaJSON(criteria []model.Criterion) []CriterionJSON {
+	out := make([]CriterionJSON, 0, len(criteria))
+	for _, c := range criteria {
+		cj := CriterionJSON{
+			Position:  c.Position,
+			Text:      c.Text,
+			Command:   c.Command,
+			Checked:   c.Checked,
+			Note:      c.Note,
+			CheckedBy: c.CheckedBy,
+			CheckedAt: c.CheckedAt,
+		}
+		if v := c.Verification; v != nil {
+			cj.Verification = &VerificationJSON{
+				Command:    v.Command,
+				Dir:        v.Dir,
+				ExitCode:   v.ExitCode,
+				Passed:     v.Passed(),
+				DurationMS: v.DurationMS,
+				Output:     v.Output,
+				RanBy:      v.RanBy,
+				RanAt:      v.RanAt,
+			}
+		}
+		out = append(out, cj)
+	}
+	return out
+}
+
+func reviewsJSON(reviews []model.Review) []ReviewJSON {
+	out := make([]ReviewJSON, 0, len(reviews))
+	for _, r := range reviews {
+		out = append(out, ReviewJSON{
+			Reviewer:    r.Reviewer,
+			Verdict:     r.Verdict,
+			Note:        r.Note,
+			RequestedBy: r.RequestedBy,
+			RequestedAt: r.RequestedAt,
+			DecidedAt:   r.DecidedAt,
+		})
+	}
+	return out
+}
+
+// NewLearningJSON converts a learning to its API representation.
+func NewLearningJSON(l model.Learning) LearningJSON {
+	return LearningJSON{
+		ID:        l.ID,
+		Project:   l.Project,
+		TaskID:    l.TaskID,
+		Summary:   l.Summary,
+		Detail:    l.Detail,
+		Files:     nonNil(l.Files),
+		Concepts:  nonNil(l.Concepts),
+		Status:    string(l.Status),
+		Actor:     l.Actor,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+
+		ReviewReason: l.ReviewReason,
+
+		Path:       l.Path,
+		Title:      l.Title,
+		Provenance: l.Provenance,
+	}
+}
+
+// nonNil returns s, or an empty slice so it encodes as [] rather than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
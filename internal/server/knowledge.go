@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+func (s *Server) listProjects(database *db.DB, r *http.Request) (any, error) {
+	projects, err := database.ListProjects()
+	if err != nil {
+		return nil, err
+	}
+	return nonNil(projects), nil
+}
+
+func (s *Server) listLabels(database *db.DB, r *http.Request) (any, error) {
+	project, err := requireProject(r)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := database.ListLabels(project)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]LabelJSON, 0, len(labels))
+	for _, l := range labels {
+		out = append(out, LabelJSON{Name: l.Name, Project: l.Project, Color: l.Color})
+	}
+	return out, nil
+}
+
+func (s *Server) listConcepts(database *db.DB, r *http.Request) (any, error) {
+	project, err := requireProject(r)
+	if err != nil {
+		return nil, err
+	}
+	concepts, err := database.ListConcepts(project, r.URL.Query().Get("sort") == "recent")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ConceptJSON, 0, len(concepts))
+	for _, c := range concepts {
+		out = append(out, ConceptJSON{
+			Name:          c.Name,
+			Project:       c.Project,
+			Summary:       c.Summary,
+			LearningCount: c.LearningCount,
+			LastUpdated:   c.LastUpdated,
+		})
+	}
+	return out, nil
+}
+
+// listLearnings returns a project's learnings, narrowed to those tagged with
+// any of the concept parameters, about any of the file parameters, or
+// matching the q search, like 'prog context'.
+func (s *Server) listLearnings(database *db.DB, r *http.Request) (any, error) {
+	project, err := requireProject(r)
+	if err != nil {
+		return nil, err
+	}
+	q := r.URL.Query()
+	includeStale := q.Get("include_stale") == "true"
+
+	var learnings []model.Learning
+	switch {
+	case q.Get("q") != "":
+		learnings, err = database.SearchLearnings(project, q.Get("q"), includeStale)
+	case len(q["concept"]) > 0:
+		learnings, err = database.GetLearningsByConcepts(project, q["concept"], includeStale)
+	case len(q["file"]) > 0:
+		learnings, err = database.GetLearningsByFiles(project, q["file"], includeStale)
+	default:
+		learnings, err = database.GetAllLearnings(project, includeStale)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]LearningJSON, 0, len(learnings))
+	for _, l := range learnings {
+		out = append(out, NewLearningJSON(l))
+	}
+	return out, nil
+}
+
+func (s *Server) getLearning(database *db.DB, r *http.Request) (any, error) {
+	l, err := database.GetLearning(r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	return NewLearningJSON(*l), nil
+}
+
+func requireProject(r *http.Request) (string, error) {
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		return "", badRequestf("project is required")
+	}
+	return project, nil
+}
@@ -0,0 +1,244 @@
+// Package server exposes the prog database as a versioned HTTP/JSON API.
+//
+// Every route lives under /v1 and is a thin layer over the internal/db
+// methods the CLI uses, so derived state such as epic status and blocking is
+// computed in one place. The API is described by the OpenAPI document served
+// at /v1/openapi.json.
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+)
+
+// ActorHeader names the request header that attributes a change to an actor,
+// like the CLI's --as flag. Without it changes are recorded as the server's
+// actor.
+const ActorHeader = "X-Prog-Actor"
+
+// maxBodySize bounds request bodies; they carry titles, descriptions and log
+// messages only.
+const maxBodySize = 1 << 20
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Server handles API requests against a prog database.
+type Server struct {
+	db  *db.DB
+	mux *http.ServeMux
+}
+
+// New creates a server backed by database.
+func New(database *db.DB) *Server {
+	s := &Server{db: database, mux: http.NewServeMux()}
+	s.routes()
+	return s
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPI)
+	})
+
+	s.handle("GET /v1/projects", s.listProjects)
+	s.handle("GET /v1/status", s.projectStatus)
+	s.handle("GET /v1/ready", s.readyItems)
+	s.handle("GET /v1/deps", s.listDeps)
+
+	s.handle("GET /v1/items", s.listItems)
+	s.handle("POST /v1/items", s.createItem)
+	s.handle("GET /v1/items/{id}", s.getItem)
+	s.handle("PATCH /v1/items/{id}", s.updateItem)
+	s.handle("DELETE /v1/items/{id}", s.deleteItem)
+	s.handle("POST /v1/items/{id}/restore", s.restoreItem)
+	s.handle("GET /v1/items/{id}/logs", s.getLogs)
+	s.handle("POST /v1/items/{id}/logs", s.addLog)
+	s.handle("GET /v1/items/{id}/deps", s.getDeps)
+	s.handle("POST /v1/items/{id}/deps", s.addDep)
+	s.handle("GET /v1/items/{id}/history", s.getHistory)
+	s.handle("POST /v1/items/{id}/labels", s.addLabel)
+	s.handle("DELETE /v1/items/{id}/labels/{name}", s.removeLabel)
+
+	s.handle("GET /v1/changes", s.listChanges)
+	s.mux.HandleFunc("GET /v1/changes/stream", s.streamChanges)
+
+	s.handle("GET /v1/labels", s.listLabels)
+	s.handle("GET /v1/concepts", s.listConcepts)
+	s.handle("GET /v1/learnings", s.listLearnings)
+	s.handle("GET /v1/learnings/{id}", s.getLearning)
+}
+
+// handlerFunc handles one request with the database attributed to the
+// request's actor. It returns the response body, or an error.
+type handlerFunc func(database *db.DB, r *http.Request) (any, error)
+
+// handle registers h for pattern. Lapsed leases are expired before every
+// request so tasks whose claim ran out read as ready, as they do in the CLI.
+//
+// Requests that change anything must be sent as JSON, even without a body:
+// a web page can post a form or plain text to localhost without the
+// browser asking first, but not JSON.
+func (s *Server) handle(pattern string, h handlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && !isJSON(r) {
+			writeJSON(w, http.StatusUnsupportedMediaType, ErrorJSON{Error: "Content-Type must be application/json"})
+			return
+		}
+		database := s.db
+		if actor := r.Header.Get(ActorHeader); actor != "" {
+			database = database.WithActor(actor)
+		}
+		if _, err := database.ExpireLeases(time.Now()); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		body, err := h(database, r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		switch body := body.(type) {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case created:
+			writeJSON(w, http.StatusCreated, body.body)
+		default:
+			writeJSON(w, http.StatusOK, body)
+		}
+	})
+}
+
+// created wraps the body of a response that created something.
+type created struct{ body any }
+
+// ServeHTTP implements http.Handler. Requests not addressed to localhost are
+// refused; see allowedHost.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowedHost(r) {
+		writeJSON(w, http.StatusForbidden, ErrorJSON{Error: fmt.Sprintf("host %q is not allowed; use localhost", r.Host)})
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// allowedHost reports whether r is addressed to localhost, 127.0.0.1 or
+// [::1] on the port it arrived on. This stops DNS rebinding: a web page whose
+// domain has been pointed at 127.0.0.1 can reach the server, but its requests
+// still carry its own domain as Host. Requests over a Unix socket can't come
+// from a browser, so their Host isn't checked.
+func allowedHost(r *http.Request) bool {
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = strings.Trim(r.Host, "[]"), "80"
+	}
+	switch strings.ToLower(host) {
+	case "localhost", "127.0.0.1", "::1":
+		return port == strconv.Itoa(local.Port)
+	}
+	return false
+}
+
+// isJSON reports whether r's Content-Type is application/json.
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// Serve handles requests on ln until ctx is canceled, then shuts down
+// gracefully. ln is closed on return. Requests inherit ctx, so open change
+// streams end when it is canceled rather than holding up shutdown.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdownCtx)
+		case <-done:
+		}
+	}()
+	defer close(done)
+
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// badRequest marks an error caused by the request itself rather than the
+// state of the database.
+type badRequest struct{ msg string }
+
+func (e badRequest) Error() string { return e.msg }
+
+func badRequestf(format string, args ...any) error {
+	return badRequest{msg: fmt.Sprintf(format, args...)}
+}
+
+// ErrorJSON is the body of every error response.
+type ErrorJSON struct {
+	Error string `json:"error"`
+}
+
+// writeError maps err to a status code. Errors from the database that aren't
+// a missing record or a conflict are rejected changes, such as an invalid
+// status or a parent that isn't an epic, so they are reported as 422.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusUnprocessableEntity
+	var bad badRequest
+	switch {
+	case errors.As(err, &bad):
+		status = http.StatusBadRequest
+	case errors.Is(err, db.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, db.ErrInTrash):
+		status = http.StatusGone
+	case errors.Is(err, db.ErrDepCycle), errors.Is(err, db.ErrNotClaimable), errors.Is(err, db.ErrUndoConflict):
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, ErrorJSON{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(body)
+}
+
+// decode reads a JSON request body into v, rejecting unknown fields so typos
+// aren't silently ignored.
+func decode(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequestf("invalid request body: %v", err)
+	}
+	return nil
+}
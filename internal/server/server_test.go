@@ -0,0 +1,422 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+)
+
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if err := database.Init(); err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	return database
+}
+
+func setupServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(New(setupTestDB(t).WithActor("server")))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// call sends a request and decodes the JSON reply into out, returning the
+// status code.
+func call(t *testing.T, ts *httptest.Server, method, path, actor string, body, out any) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to marshal body: %v", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	if actor != "" {
+		req.Header.Set(ActorHeader, actor)
+	}
+	if method != "GET" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: failed to decode reply: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestItemsAPI(t *testing.T) {
+	ts := setupServer(t)
+
+	var epic, task ItemDetailJSON
+	if code := call(t, ts, "POST", "/v1/items", "", CreateItemRequest{Title: "Epic", Project: "demo", Type: "epic"}, &epic); code != http.StatusCreated {
+		t.Fatalf("create epic = %d", code)
+	}
+	req := CreateItemRequest{Title: "Task", Project: "demo", Parent: epic.ID, Labels: []string{"bug"}, Areas: []string{"internal/db"}}
+	if code := call(t, ts, "POST", "/v1/items", "alice", req, &task); code != http.StatusCreated {
+		t.Fatalf("create task = %d", code)
+	}
+	if task.Parent == nil || *task.Parent != epic.ID || len(task.Labels) != 1 || len(task.Areas) != 1 {
+		t.Errorf("task = %+v, want parent, label and area set", task)
+	}
+	if task.CreatedBy != "alice" || epic.CreatedBy != "server" {
+		t.Errorf("created by %q and %q, want alice and server", task.CreatedBy, epic.CreatedBy)
+	}
+
+	// The epic's status is derived from its child
+	status := "in_progress"
+	if code := call(t, ts, "PATCH", "/v1/items/"+task.ID, "alice", UpdateItemRequest{Status: &status}, &task); code != http.StatusOK {
+		t.Fatalf("patch = %d", code)
+	}
+	if task.Status != "in_progress" || task.Assignee != "alice" {
+		t.Errorf("task = %s/%s, want in_progress by alice", task.Status, task.Assignee)
+	}
+	var items []ItemJSON
+	call(t, ts, "GET", "/v1/items?project=demo&type=epic", "", nil, &items)
+	if len(items) != 1 || items[0].Status != "in_progress" {
+		t.Errorf("epics = %+v, want one in progress", items)
+	}
+
+	var logs []LogJSON
+	if code := call(t, ts, "POST", "/v1/items/"+task.ID+"/logs", "alice", LogRequest{Message: "Started"}, &logs); code != http.StatusCreated {
+		t.Fatalf("log = %d", code)
+	}
+	if len(logs) != 1 || logs[0].Actor != "alice" {
+		t.Errorf("logs = %+v, want alice's entry", logs)
+	}
+
+	var history []EventJSON
+	call(t, ts, "GET", "/v1/items/"+task.ID+"/history", "", nil, &history)
+	if len(history) == 0 || history[0].Field != db.EventCreated {
+		t.Errorf("history = %+v, want it to start with creation", history)
+	}
+
+	if code := call(t, ts, "DELETE", "/v1/items/"+task.ID, "", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("delete = %d", code)
+	}
+	var errBody ErrorJSON
+	if code := call(t, ts, "GET", "/v1/items/"+task.ID, "", nil, &errBody); code != http.StatusGone || errBody.Error == "" {
+		t.Errorf("get trashed = %d %q, want 410 with a message", code, errBody.Error)
+	}
+	if code := call(t, ts, "POST", "/v1/items/"+task.ID+"/restore", "", nil, &task); code != http.StatusOK {
+		t.Errorf("restore = %d", code)
+	}
+}
+
+func TestItemsAPI_Errors(t *testing.T) {
+	ts := setupServer(t)
+
+	var a, b ItemDetailJSON
+	call(t, ts, "POST", "/v1/items", "", CreateItemRequest{Title: "A", Project: "demo"}, &a)
+	call(t, ts, "POST", "/v1/items", "", CreateItemRequest{Title: "B", Project: "demo"}, &b)
+	call(t, ts, "POST", "/v1/items/"+a.ID+"/deps", "", DepRequest{DependsOn: b.ID}, nil)
+
+	bogus := "bogus"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{"missing item", "GET", "/v1/items/ts-000000", nil, http.StatusNotFound},
+		{"missing title", "POST", "/v1/items", CreateItemRequest{Project: "demo"}, http.StatusBadRequest},
+		{"unknown field", "POST", "/v1/items", map[string]string{"title": "x", "project": "demo", "priorty": "1"}, http.StatusBadRequest},
+		{"cycle", "POST", "/v1/items/" + b.ID + "/deps", DepRequest{DependsOn: a.ID}, http.StatusConflict},
+		{"invalid status", "PATCH", "/v1/items/" + a.ID, UpdateItemRequest{Status: &bogus}, http.StatusUnprocessableEntity},
+		{"labels need a project", "GET", "/v1/labels", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errBody ErrorJSON
+			if code := call(t, ts, tt.method, tt.path, "", tt.body, &errBody); code != tt.want {
+				t.Errorf("status = %d (%s), want %d", code, errBody.Error, tt.want)
+			}
+		})
+	}
+}
+
+// A request that fails partway through leaves everything as it was.
+func TestItemsAPI_RejectedRequestChangesNothing(t *testing.T) {
+	database := setupTestDB(t)
+	ts := httptest.NewServer(New(database))
+	t.Cleanup(ts.Close)
+
+	var task ItemDetailJSON
+	call(t, ts, "POST", "/v1/items", "", CreateItemRequest{Title: "Task", Project: "demo"}, &task)
+
+	title, parent := "Renamed", task.ID
+	if code := call(t, ts, "PATCH", "/v1/items/"+task.ID, "", UpdateItemRequest{Title: &title, Parent: &parent}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("patch with a task as parent = %d, want 422", code)
+	}
+	done := "done"
+	dod := "Tests pass"
+	if code := call(t, ts, "PATCH", "/v1/items/"+task.ID, "", UpdateItemRequest{Title: &title, DefinitionOfDone: &dod, Status: &done}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("patch to done with a new unchecked criterion = %d, want 422", code)
+	}
+	item, err := database.GetItem(task.ID)
+	if err != nil {
+		t.Fatalf("failed to get task: %v", err)
+	}
+	if item.Title != "Task" || item.DefinitionOfDone != nil || item.Status != "open" {
+		t.Errorf("task = %q/%v/%s, want it unchanged", item.Title, item.DefinitionOfDone, item.Status)
+	}
+
+	req := CreateItemRequest{Title: "Other", Project: "demo", Labels: []string{"bug"}, Areas: []string{"internal/["}}
+	if code := call(t, ts, "POST", "/v1/items", "", req, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("create with a bad area = %d, want 422", code)
+	}
+	req = CreateItemRequest{Title: "Other", Project: "demo", Parent: "ep-000000"}
+	if code := call(t, ts, "POST", "/v1/items", "", req, nil); code != http.StatusNotFound {
+		t.Errorf("create with a missing parent = %d, want 404", code)
+	}
+	var items []ItemJSON
+	call(t, ts, "GET", "/v1/items?project=demo", "", nil, &items)
+	if len(items) != 1 {
+		t.Errorf("items = %+v, want only the first task", items)
+	}
+	if labels, _ := database.ListLabels("demo"); len(labels) != 0 {
+		t.Errorf("labels = %+v, want none created", labels)
+	}
+}
+
+// Marking a task done over the API passes the same gates as 'prog done'.
+func TestItemsAPI_DoneGates(t *testing.T) {
+	database := setupTestDB(t)
+	ts := httptest.NewServer(New(database))
+	t.Cleanup(ts.Close)
+	done := "done"
+
+	var task ItemDetailJSON
+	call(t, ts, "POST", "/v1/items", "", CreateItemRequest{Title: "Task", Project: "demo"}, &task)
+	if err := database.AddCriterion(task.ID, "Tests pass", ""); err != nil {
+		t.Fatalf("failed to add criterion: %v", err)
+	}
+	var errBody ErrorJSON
+	if code := call(t, ts, "PATCH", "/v1/items/"+task.ID, "", UpdateItemRequest{Status: &done}, &errBody); code != http.StatusUnprocessableEntity {
+		t.Errorf("done with unchecked criteria = %d, want 422", code)
+	}
+	if !strings.Contains(errBody.Error, "Tests pass") {
+		t.Errorf("error = %q, want it to name the criterion", errBody.Error)
+	}
+	if item, _ := database.GetItem(task.ID); item.Status == "done" {
+		t.Errorf("task was marked done")
+	}
+	if err := database.CheckCriterion(task.ID, 1, "ran them"); err != nil {
+		t.Fatalf("failed to check criterion: %v", err)
+	}
+
+	// In review, it waits on every reviewer approving
+	inReview := "reviewing"
+	call(t, ts, "PATCH", "/v1/items/"+task.ID, "alice", UpdateItemRequest{Status: &inReview}, nil)
+	if err := database.AssignReviewer(task.ID, "bob"); err != nil {
+		t.Fatalf("failed to assign reviewer: %v", err)
+	}
+	if code := call(t, ts, "PATCH", "/v1/items/"+task.ID, "alice", UpdateItemRequest{Status: &done}, &errBody); code != http.StatusUnprocessableEntity {
+		t.Errorf("done with a pending review = %d, want 422", code)
+	}
+	if err := database.WithActor("bob").RequestChanges(task.ID, "needs a test"); err != nil {
+		t.Fatalf("failed to request changes: %v", err)
+	}
+	if code := call(t, ts, "PATCH", "/v1/items/"+task.ID, "alice", UpdateItemRequest{Status: &done}, &errBody); code != http.StatusUnprocessableEntity {
+		t.Errorf("done with changes requested = %d, want 422", code)
+	}
+	if !strings.Contains(errBody.Error, "bob (changes requested)") {
+		t.Errorf("error = %q, want it to name the reviewer", errBody.Error)
+	}
+	if item, _ := database.GetItem(task.ID); item.Status == "done" {
+		t.Errorf("task was marked done")
+	}
+
+	call(t, ts, "PATCH", "/v1/items/"+task.ID, "alice", UpdateItemRequest{Status: &inReview}, nil)
+	if err := database.WithActor("bob").Approve(task.ID, ""); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	if code := call(t, ts, "PATCH", "/v1/items/"+task.ID, "alice", UpdateItemRequest{Status: &done}, &task); code != http.StatusOK || task.Status != "done" {
+		t.Errorf("done once approved = %d %s, want 200 done", code, task.Status)
+	}
+}
+
+// Browsers can reach a localhost server from any web page, so requests that
+// don't look like they came from a local client are refused.
+func TestServer_RejectsForeignRequests(t *testing.T) {
+	ts := setupServer(t)
+	port := strconv.Itoa(ts.Listener.Addr().(*net.TCPAddr).Port)
+
+	tests := []struct {
+		name        string
+		method      string
+		host        string // PORT is replaced with the server's
+		contentType string
+		want        int
+	}{
+		{"json", "POST", "127.0.0.1:PORT", "application/json; charset=utf-8", http.StatusCreated},
+		{"localhost", "GET", "localhost:PORT", "", http.StatusOK},
+		{"ipv6 loopback", "GET", "[::1]:PORT", "", http.StatusOK},
+		{"form", "POST", "127.0.0.1:PORT", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"plain text", "POST", "127.0.0.1:PORT", "text/plain", http.StatusUnsupportedMediaType},
+		{"no content type", "POST", "127.0.0.1:PORT", "", http.StatusUnsupportedMediaType},
+		{"rebound domain", "GET", "attacker.example:PORT", "", http.StatusForbidden},
+		{"other port", "GET", "localhost:1", "", http.StatusForbidden},
+		{"default port", "GET", "localhost", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.NewReader(`{"title": "Task", "project": "demo"}`)
+			req, err := http.NewRequest(tt.method, ts.URL+"/v1/items?project=demo", body)
+			if err != nil {
+				t.Fatalf("failed to build request: %v", err)
+			}
+			req.Host = strings.ReplaceAll(tt.host, "PORT", port)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadyAndStatusAPI(t *testing.T) {
+	ts := setupServer(t)
+
+	var blocker, blocked ItemDetailJSON
+	call(t, ts, "POST", "/v1/items", "", CreateItemRequest{Title: "Blocker", Project: "demo"}, &blocker)
+	call(t, ts, "POST", "/v1/items", "", CreateItemRequest{Title: "Blocked", Project: "demo"}, &blocked)
+	call(t, ts, "POST", "/v1/items/"+blocked.ID+"/deps", "", DepRequest{DependsOn: blocker.ID}, nil)
+
+	var ready []ItemJSON
+	call(t, ts, "GET", "/v1/ready?project=demo", "", nil, &ready)
+	if len(ready) != 1 || ready[0].ID != blocker.ID {
+		t.Errorf("ready = %+v, want only the blocker", ready)
+	}
+
+	var status StatusJSON
+	call(t, ts, "GET", "/v1/status?project=demo", "", nil, &status)
+	if status.Counts["open"] != 2 || status.Counts["ready"] != 1 {
+		t.Errorf("counts = %v, want 2 open and 1 ready", status.Counts)
+	}
+
+	var projects []string
+	call(t, ts, "GET", "/v1/projects", "", nil, &projects)
+	if len(projects) != 1 || projects[0] != "demo" {
+		t.Errorf("projects = %v, want [demo]", projects)
+	}
+
+	var spec map[string]any
+	if code := call(t, ts, "GET", "/v1/openapi.json", "", nil, &spec); code != http.StatusOK || spec["openapi"] == nil {
+		t.Errorf("openapi = %d %v", code, spec["openapi"])
+	}
+}
+
+func TestChangesAPI(t *testing.T) {
+	changePollInterval = 10 * time.Millisecond
+	ts := setupServer(t)
+
+	var task ItemDetailJSON
+	call(t, ts, "POST", "/v1/items", "", CreateItemRequest{Title: "Task", Project: "demo"}, &task)
+	call(t, ts, "POST", "/v1/items/"+task.ID+"/logs", "alice", LogRequest{Message: "Started"}, nil)
+
+	var changes []ChangeJSON
+	if code := call(t, ts, "GET", "/v1/changes?project=demo", "", nil, &changes); code != http.StatusOK {
+		t.Fatalf("changes = %d", code)
+	}
+	if len(changes) != 2 || changes[0].Action != db.EventCreated || changes[1].Kind != db.ChangeLog || changes[1].Actor != "alice" {
+		t.Fatalf("changes = %+v, want the creation then alice's log", changes)
+	}
+
+	// Resuming after the creation replays the log, then streams new changes
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/v1/changes/stream", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(changes[0].Seq, 10))
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+	call(t, ts, "POST", "/v1/items/"+task.ID+"/logs", "bob", LogRequest{Message: "Still going"}, nil)
+
+	var got []ChangeJSON
+	scanner := bufio.NewScanner(resp.Body)
+	for len(got) < 2 && scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			var c ChangeJSON
+			if err := json.Unmarshal([]byte(data), &c); err != nil {
+				t.Fatalf("bad event data %q: %v", data, err)
+			}
+			got = append(got, c)
+		}
+	}
+	if len(got) != 2 || got[0].NewValue != "Started" || got[1].NewValue != "Still going" {
+		t.Errorf("streamed = %+v, want both logs in order", got)
+	}
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	database := setupTestDB(t)
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(database).Serve(ctx, ln) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://prog/v1/projects")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
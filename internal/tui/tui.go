@@ -2,6 +2,7 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -84,12 +85,16 @@ type Model struct {
 	message string // temporary status message
 
 	// Detail view state
-	detailLogs []model.Log
-	detailDeps []string
+	detailLogs     []model.Log
+	detailDeps     []string
+	detailCriteria []model.Criterion
 
 	// Split view state
 	focusPane    FocusPane // Which pane is focused (list or detail)
 	detailScroll int       // Scroll offset in detail pane
+
+	// Live updates
+	changeSeq int64 // Newest change feed entry reflected in items
 }
 
 // Styles
@@ -176,10 +181,13 @@ func New(database *db.DB) Model {
 		model.StatusDone:       false,
 		model.StatusCanceled:   false,
 	}
+	// Only changes made after the first load need to trigger a reload
+	changeSeq, _ := database.LatestChange()
 	return Model{
 		db:             database,
 		viewMode:       ViewList,
 		filterStatuses: statuses,
+		changeSeq:      changeSeq,
 	}
 }
 
@@ -190,10 +198,11 @@ type itemsMsg struct {
 }
 
 type detailMsg struct {
-	logs []model.Log
-	deps []string
-	id   string // Track which task this load was for (to ignore stale results)
-	err  error
+	logs     []model.Log
+	deps     []string
+	criteria []model.Criterion
+	id       string // Track which task this load was for (to ignore stale results)
+	err      error
 }
 
 type actionMsg struct {
@@ -201,6 +210,33 @@ type actionMsg struct {
 	err     error
 }
 
+// changesMsg reports the newest change once the feed has moved on.
+type changesMsg struct {
+	seq int64
+	err error
+}
+
+// changePollInterval is how often the TUI checks the change feed.
+const changePollInterval = time.Second
+
+// watchChanges waits until something, from this TUI or any other process,
+// changes the database.
+func (m Model) watchChanges() tea.Cmd {
+	after := m.changeSeq
+	return func() tea.Msg {
+		for {
+			time.Sleep(changePollInterval)
+			latest, err := m.db.LatestChange()
+			if err != nil {
+				return changesMsg{seq: after, err: err}
+			}
+			if latest > after {
+				return changesMsg{seq: latest}
+			}
+		}
+	}
+}
+
 // loadItems loads items from the database.
 func (m Model) loadItems() tea.Cmd {
 	return func() tea.Msg {
@@ -216,7 +252,7 @@ func (m Model) loadItems() tea.Cmd {
 	}
 }
 
-// loadDetail loads logs and deps for current item.
+// loadDetail loads logs, deps and definition of done for current item.
 func (m Model) loadDetail() tea.Cmd {
 	if len(m.filtered) == 0 || m.cursor >= len(m.filtered) {
 		return nil
@@ -231,7 +267,11 @@ func (m Model) loadDetail() tea.Cmd {
 		if err != nil {
 			return detailMsg{id: id, err: err}
 		}
-		return detailMsg{logs: logs, deps: deps, id: id}
+		criteria, err := m.db.GetCriteria(id)
+		if err != nil {
+			return detailMsg{id: id, err: err}
+		}
+		return detailMsg{logs: logs, deps: deps, criteria: criteria, id: id}
 	}
 }
 
@@ -280,7 +320,7 @@ func (m *Model) applyFilters() {
 
 // Init implements tea.Model.
 func (m Model) Init() tea.Cmd {
-	return m.loadItems()
+	return tea.Batch(m.loadItems(), m.watchChanges())
 }
 
 // Update implements tea.Model.
@@ -331,6 +371,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.filtered[m.cursor].ID == msg.id {
 			m.detailLogs = msg.logs
 			m.detailDeps = msg.deps
+			m.detailCriteria = msg.criteria
 		}
 		return m, nil
 
@@ -341,6 +382,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.message = msg.message
 		}
 		return m, m.loadItems()
+
+	case changesMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, m.watchChanges()
+		}
+		// Other agents' work shows up without pressing r
+		m.changeSeq = msg.seq
+		return m, tea.Batch(m.loadItems(), m.watchChanges())
 	}
 
 	return m, nil
@@ -769,7 +819,10 @@ func (m Model) doDone() (Model, tea.Cmd) {
 		return m, nil
 	}
 	return m, func() tea.Msg {
-		if err := m.db.UpdateStatus(item.ID, model.StatusDone); err != nil {
+		if err := m.db.CompleteItem(item.ID, false); err != nil {
+			if errors.Is(err, db.ErrDoDIncomplete) {
+				return actionMsg{err: fmt.Errorf("%w (check them off with 'prog dod check')", err)}
+			}
 			return actionMsg{err: err}
 		}
 		return actionMsg{message: fmt.Sprintf("Completed %s", item.ID)}
@@ -802,7 +855,7 @@ func (m Model) doDelete() (Model, tea.Cmd) {
 		if err := m.db.DeleteItem(item.ID); err != nil {
 			return actionMsg{err: err}
 		}
-		return actionMsg{message: fmt.Sprintf("Deleted %s", item.ID)}
+		return actionMsg{message: fmt.Sprintf("Moved %s to the trash", item.ID)}
 	}
 }
 
@@ -1221,6 +1274,43 @@ func (m Model) detailViewWithHeight(width, height int) string {
 		}
 	}
 
+	// Definition of done
+	if len(m.detailCriteria) > 0 {
+		checked := 0
+		for _, c := range m.detailCriteria {
+			if c.Checked {
+				checked++
+			}
+		}
+		lines = append(lines, "")
+		lines = append(lines, detailLabelStyle.Render(fmt.Sprintf("Definition of Done (%d/%d):", checked, len(m.detailCriteria))))
+		for _, c := range m.detailCriteria {
+			box := dimStyle.Render("[ ]")
+			if c.Checked {
+				box = lipgloss.NewStyle().Foreground(statusColors[model.StatusDone]).Render("[x]")
+			}
+			text := fmt.Sprintf("%d. %s", c.Position, c.Text)
+			if width > 0 {
+				text = truncate(text, effectiveWidth-6)
+			}
+			lines = append(lines, "  "+box+" "+text)
+			if v := c.Verification; v != nil && !v.Passed() {
+				failed := fmt.Sprintf("verify failed: `%s` exited %d", v.Command, v.ExitCode)
+				if width > 0 {
+					failed = truncate(failed, effectiveWidth-6)
+				}
+				lines = append(lines, "      "+lipgloss.NewStyle().Foreground(statusColors[model.StatusBlocked]).Render(failed))
+			}
+			if c.Checked && c.Note != "" {
+				note := c.Note
+				if width > 0 {
+					note = truncate(note, effectiveWidth-6)
+				}
+				lines = append(lines, "      "+dimStyle.Render(note))
+			}
+		}
+	}
+
 	// Description
 	if item.Description != "" {
 		lines = append(lines, "")
@@ -0,0 +1,122 @@
+// Package verify runs the shell commands that verify definition of done
+// criteria, capturing the exit code, duration and output so that a reviewer
+// sees the evidence rather than a claim that "tests pass".
+//
+// Commands run with sh -c in the task's working directory. Output is kept
+// from the end, where test runners and compilers report what failed.
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/baiirun/prog/internal/model"
+)
+
+// DefaultTimeout is how long a command may run before it is killed.
+const DefaultTimeout = 10 * time.Minute
+
+// MaxOutput is how much of a command's output is kept, from the end.
+const MaxOutput = 8 << 10
+
+// Config controls how verification commands run.
+type Config struct {
+	Dir     string            // Working directory (default: current directory)
+	Timeout time.Duration     // Per command (default DefaultTimeout)
+	Output  io.Writer         // Receives output as it is produced, if set
+	Env     map[string]string // Added to the environment, e.g. PROG_ITEM
+}
+
+// Run runs command and returns the record of the run. ItemID and Criterion
+// are left for the caller to fill in. A command that can't be started or
+// runs past the timeout is recorded with exit code -1.
+func Run(ctx context.Context, cfg Config, command string) *model.Verification {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	var tail tailWriter
+	var out io.Writer = &tail
+	if cfg.Output != nil {
+		out = io.MultiWriter(cfg.Output, &tail)
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = cfg.Dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// Run in its own process group so a timeout kills what the shell started,
+	// e.g. the test binaries under go test, not just the shell
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Don't wait forever on children that escaped the group and hold the output open
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	v := &model.Verification{
+		Command:    command,
+		Dir:        cfg.Dir,
+		DurationMS: time.Since(start).Milliseconds(),
+		RanAt:      start,
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		v.ExitCode = -1
+		fmt.Fprintf(&tail, "\n[timed out after %s]\n", cfg.Timeout)
+	case ctx.Err() == context.Canceled:
+		v.ExitCode = -1
+		fmt.Fprintf(&tail, "\n[interrupted]\n")
+	case errors.As(err, &exitErr):
+		v.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		v.ExitCode = -1
+		fmt.Fprintf(&tail, "\n[%v]\n", err)
+	}
+	v.Output = tail.String()
+	return v
+}
+
+// tailWriter keeps the last MaxOutput bytes written to it.
+type tailWriter struct {
+	buf     []byte
+	dropped int
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if over := len(w.buf) - MaxOutput; over > 0 {
+		w.buf = w.buf[over:]
+		w.dropped += over
+	}
+	return len(p), nil
+}
+
+// String returns the kept output, noting how much was cut from the start.
+func (w *tailWriter) String() string {
+	buf := w.buf
+	if w.dropped == 0 {
+		return string(buf)
+	}
+	// Don't start partway through a character
+	for len(buf) > 0 && !utf8.RuneStart(buf[0]) {
+		buf = buf[1:]
+	}
+	return fmt.Sprintf("[%d bytes truncated]\n%s", w.dropped+len(w.buf)-len(buf), buf)
+}
@@ -0,0 +1,57 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "marker"), []byte("here\n"), 0644); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+	var live bytes.Buffer
+	cfg := Config{Dir: dir, Output: &live, Env: map[string]string{"PROG_ITEM": "ts-a1b2c3"}}
+
+	v := Run(context.Background(), cfg, `cat marker; echo "$PROG_ITEM"`)
+	if !v.Passed() || v.Output != "here\nts-a1b2c3\n" {
+		t.Errorf("passing run = exit %d, output %q", v.ExitCode, v.Output)
+	}
+	if live.String() != v.Output {
+		t.Errorf("live output = %q, want %q", live.String(), v.Output)
+	}
+	if v.Dir != dir || v.RanAt.IsZero() {
+		t.Errorf("run not recorded: %+v", v)
+	}
+
+	v = Run(context.Background(), cfg, "echo 'FAIL: TestLogin' >&2; exit 3")
+	if v.Passed() || v.ExitCode != 3 || !strings.Contains(v.Output, "FAIL: TestLogin") {
+		t.Errorf("failing run = exit %d, output %q", v.ExitCode, v.Output)
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	start := time.Now()
+	v := Run(context.Background(), Config{Timeout: 100 * time.Millisecond}, "sleep 5")
+	if v.ExitCode != -1 || !strings.Contains(v.Output, "timed out after 100ms") {
+		t.Errorf("timed out run = exit %d, output %q", v.ExitCode, v.Output)
+	}
+	if time.Since(start) > 4*time.Second {
+		t.Errorf("command was not killed at the timeout")
+	}
+}
+
+func TestRun_TruncatesOutput(t *testing.T) {
+	v := Run(context.Background(), Config{}, "yes line | head -c 20000; echo; echo last")
+	if len(v.Output) > MaxOutput+64 {
+		t.Errorf("output is %d bytes, want about %d", len(v.Output), MaxOutput)
+	}
+	if !strings.HasPrefix(v.Output, "[") || !strings.HasSuffix(v.Output, "\nlast\n") {
+		t.Errorf("output should note the truncation and keep the end: %q...%q", v.Output[:40], v.Output[len(v.Output)-20:])
+	}
+}
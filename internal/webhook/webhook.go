@@ -0,0 +1,202 @@
+// Package webhook sends the deliveries queued in the prog database's webhook
+// outbox.
+//
+// Deliveries are queued by internal/db in the same transaction as the status
+// change that triggers them. A Dispatcher POSTs each one to its webhook's URL
+// with an HMAC-SHA256 signature of the body, and retries failures with
+// exponential backoff until they succeed or run out of attempts. Because the
+// outbox is persistent, deliveries survive restarts and receiver outages.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+// Request headers sent with every delivery.
+const (
+	SignatureHeader = "X-Prog-Signature" // "sha256=" + hex HMAC of the body
+	EventHeader     = "X-Prog-Event"     // The status the item moved to
+	DeliveryHeader  = "X-Prog-Delivery"  // Delivery ID, stable across retries
+)
+
+// Defaults for Config.
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultTimeout     = 10 * time.Second
+	DefaultLease       = 10 * time.Minute // Covers a full batch timing out
+)
+
+// batchSize bounds how many due deliveries are sent per pass.
+const batchSize = 50
+
+// Config controls dispatcher behavior.
+type Config struct {
+	Client      *http.Client  // HTTP client (default: DefaultTimeout per request)
+	MaxAttempts int           // Attempts before a delivery is marked failed (default DefaultMaxAttempts)
+	Backoff     time.Duration // Delay before the first retry, doubled for each one after (default DefaultBackoff)
+	MaxBackoff  time.Duration // Upper bound on the retry delay (default DefaultMaxBackoff)
+	Lease       time.Duration // How long a claimed batch is kept from other dispatchers (default DefaultLease)
+
+	Now  func() time.Time                 // Clock, for tests (default time.Now)
+	Logf func(format string, args ...any) // Delivery log (default discards)
+}
+
+// Dispatcher drains the webhook outbox.
+type Dispatcher struct {
+	db  *db.DB
+	cfg Config
+}
+
+// New creates a dispatcher for database's outbox.
+func New(database *db.DB, cfg Config) *Dispatcher {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = DefaultLease
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = func(string, ...any) {}
+	}
+	return &Dispatcher{db: database, cfg: cfg}
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret. Receivers should compute
+// the same and compare with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Result counts the outcome of one pass over the outbox.
+type Result struct {
+	Delivered int // Accepted with a 2xx response
+	Retrying  int // Failed and scheduled for another attempt
+	Failed    int // Failed for the last time
+}
+
+// DeliverDue sends every delivery that is due, one at a time in the order
+// they were queued. Deliveries are claimed a batch at a time, so dispatchers
+// in several processes — prog serve, the daemon and 'prog webhooks deliver'
+// — can drain the same outbox without sending anything twice.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (Result, error) {
+	var res Result
+	for {
+		now := d.cfg.Now()
+		due, err := d.db.ClaimDeliveries(now, now.Add(d.cfg.Lease), batchSize)
+		if err != nil {
+			return res, err
+		}
+		for _, delivery := range due {
+			if ctx.Err() != nil {
+				return res, nil
+			}
+			if err := d.deliver(ctx, delivery, &res); err != nil {
+				return res, err
+			}
+		}
+		if len(due) < batchSize {
+			return res, nil
+		}
+	}
+}
+
+// Run delivers due webhooks every interval until ctx is done. Database
+// errors are logged rather than returned so a long-running server keeps
+// going.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil {
+			d.cfg.Logf("webhook delivery failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery model.Delivery, res *Result) error {
+	sendErr := d.send(ctx, delivery)
+	if sendErr == nil {
+		res.Delivered++
+		d.cfg.Logf("webhook %s: delivered %s for %s", delivery.WebhookID, delivery.Event, delivery.ItemID)
+		return d.db.MarkDelivered(delivery.ID)
+	}
+
+	attempt := delivery.Attempts + 1
+	var next time.Time
+	if attempt < d.cfg.MaxAttempts {
+		next = d.cfg.Now().Add(d.backoff(attempt))
+		res.Retrying++
+		d.cfg.Logf("webhook %s: attempt %d failed, retrying at %s: %v", delivery.WebhookID, attempt, next.Format(time.TimeOnly), sendErr)
+	} else {
+		res.Failed++
+		d.cfg.Logf("webhook %s: giving up after %d attempts: %v", delivery.WebhookID, attempt, sendErr)
+	}
+	return d.db.MarkDeliveryFailed(delivery.ID, sendErr.Error(), next)
+}
+
+// backoff is the delay before retrying after the given attempt: Backoff,
+// then doubling, capped at MaxBackoff.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.Backoff
+	for i := 1; i < attempt && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.MaxBackoff)
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery model.Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "prog-webhook")
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, delivery.Payload))
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", delivery.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/baiirun/prog/internal/db"
+	"github.com/baiirun/prog/internal/model"
+)
+
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if err := database.Init(); err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	return database
+}
+
+// finishTask creates a task in project demo and marks it done, queueing a
+// delivery for every webhook subscribed to done.
+func finishTask(t *testing.T, database *db.DB) *model.Item {
+	t.Helper()
+	now := time.Now()
+	item := &model.Item{
+		ID:        model.GenerateID(model.ItemTypeTask),
+		Project:   "demo",
+		Type:      model.ItemTypeTask,
+		Title:     "Ship it",
+		Status:    model.StatusOpen,
+		Priority:  2,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := database.CreateItem(item); err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	if err := database.UpdateStatus(item.ID, model.StatusDone); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	return item
+}
+
+func TestDeliverDue_SignsAndSends(t *testing.T) {
+	database := setupTestDB(t)
+
+	type received struct {
+		event, signature string
+		body             []byte
+	}
+	got := make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Get(EventHeader), r.Header.Get(SignatureHeader), body}
+	}))
+	defer receiver.Close()
+
+	hook := &model.Webhook{Project: "demo", URL: receiver.URL, Events: []string{"done"}}
+	if err := database.CreateWebhook(hook); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	task := finishTask(t, database)
+
+	res, err := New(database, Config{}).DeliverDue(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverDue failed: %v", err)
+	}
+	if res.Delivered != 1 {
+		t.Fatalf("result = %+v, want 1 delivered", res)
+	}
+
+	r := <-got
+	if !hmac.Equal([]byte(r.signature), []byte(Sign(hook.Secret, r.body))) {
+		t.Errorf("signature %q doesn't match the body", r.signature)
+	}
+	var payload db.WebhookPayload
+	if err := json.Unmarshal(r.body, &payload); err != nil {
+		t.Fatalf("bad payload: %v", err)
+	}
+	if r.event != "done" || payload.Item.ID != task.ID || payload.Transition.To != "done" {
+		t.Errorf("received %s %+v, want done for %s", r.event, payload, task.ID)
+	}
+
+	// Delivered webhooks aren't sent again
+	if res, _ := New(database, Config{}).DeliverDue(context.Background()); res != (Result{}) {
+		t.Errorf("second pass = %+v, want nothing to do", res)
+	}
+}
+
+func TestDeliverDue_RetriesWithBackoff(t *testing.T) {
+	database := setupTestDB(t)
+
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Down for the first two attempts
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	if err := database.CreateWebhook(&model.Webhook{Project: "demo", URL: receiver.URL}); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	finishTask(t, database)
+
+	now := time.Now()
+	d := New(database, Config{Backoff: time.Minute, Now: func() time.Time { return now }})
+	pass := func() Result {
+		t.Helper()
+		res, err := d.DeliverDue(context.Background())
+		if err != nil {
+			t.Fatalf("DeliverDue failed: %v", err)
+		}
+		return res
+	}
+
+	if res := pass(); res.Retrying != 1 {
+		t.Fatalf("first pass = %+v, want a retry", res)
+	}
+	// Not due again until the backoff has passed: 1m, then 2m
+	now = now.Add(59 * time.Second)
+	if res := pass(); res != (Result{}) {
+		t.Errorf("pass before backoff = %+v, want nothing", res)
+	}
+	now = now.Add(time.Second)
+	if res := pass(); res.Retrying != 1 {
+		t.Fatalf("second attempt = %+v, want another retry", res)
+	}
+	now = now.Add(2 * time.Minute)
+	if res := pass(); res.Delivered != 1 {
+		t.Errorf("third attempt = %+v, want delivered", res)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("receiver called %d times, want 3", calls.Load())
+	}
+}
+
+func TestDeliverDue_GivesUp(t *testing.T) {
+	database := setupTestDB(t)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	if err := database.CreateWebhook(&model.Webhook{Project: "demo", URL: receiver.URL}); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	finishTask(t, database)
+
+	now := time.Now()
+	d := New(database, Config{MaxAttempts: 2, Now: func() time.Time { return now }})
+	first, _ := d.DeliverDue(context.Background())
+	now = now.Add(time.Hour)
+	second, _ := d.DeliverDue(context.Background())
+	if first.Retrying != 1 || second.Failed != 1 {
+		t.Fatalf("passes = %+v, %+v, want a retry then giving up", first, second)
+	}
+
+	webhooks, err := database.ListWebhooks("demo")
+	if err != nil {
+		t.Fatalf("failed to list webhooks: %v", err)
+	}
+	if webhooks[0].Failed != 1 || webhooks[0].Pending != 0 {
+		t.Errorf("webhook = %+v, want one failed delivery", webhooks[0])
+	}
+}
+
+// prog serve, the daemon and 'prog webhooks deliver --follow' may all be
+// draining the outbox at once.
+func TestDeliverDue_ConcurrentDispatchers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	open := func() *db.DB {
+		database, err := db.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open db: %v", err)
+		}
+		if err := database.Init(); err != nil {
+			t.Fatalf("failed to init db: %v", err)
+		}
+		t.Cleanup(func() { _ = database.Close() })
+		return database
+	}
+	first, second := open(), open()
+
+	var mu sync.Mutex
+	sent := make(map[string]int)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent[r.Header.Get(DeliveryHeader)]++
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	if err := first.CreateWebhook(&model.Webhook{Project: "demo", URL: receiver.URL, Events: []string{"done"}}); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	const tasks = 2*batchSize + 10
+	for range tasks {
+		finishTask(t, first)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]Result, 2)
+	for i, database := range []*db.DB{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := New(database, Config{}).DeliverDue(context.Background())
+			if err != nil {
+				t.Errorf("DeliverDue failed: %v", err)
+			}
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+
+	if len(sent) != tasks {
+		t.Errorf("received %d distinct deliveries, want %d", len(sent), tasks)
+	}
+	for id, n := range sent {
+		if n != 1 {
+			t.Errorf("delivery %s sent %d times", id, n)
+		}
+	}
+	if got := results[0].Delivered + results[1].Delivered; got != tasks {
+		t.Errorf("dispatchers delivered %d, want %d", got, tasks)
+	}
+}